@@ -0,0 +1,521 @@
+// Package config loads the settings of the shortener, layering defaults, a YAML file, the
+// environment and command line flags, each overriding the ones before.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"l24.dev/shortener"
+
+	"github.com/hashicorp/go-multierror"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the environment variable pointing at a config file, when --config is not given
+const FileEnv = "CONFIG_FILE"
+
+const redacted = "REDACTED"
+
+// Config is every setting of the shortener. Each setting can be set in the config file under its
+// yaml key, through the environment variable in its env tag, or with a flag named after its
+// yaml path, e.g. --database-host. Settings tagged secret are redacted when printed.
+type Config struct {
+	Database   Database   `yaml:"database"`
+	Server     Server     `yaml:"server"`
+	TLS        TLS        `yaml:"tls"`
+	Auth       Auth       `yaml:"auth"`
+	OIDC       OIDC       `yaml:"oidc"`
+	RateLimits RateLimits `yaml:"rate_limits"`
+	URLPolicy  URLPolicy  `yaml:"url_policy"`
+	Blocklist  Blocklist  `yaml:"blocklist"`
+	Metrics    Metrics    `yaml:"metrics"`
+	Tracing    Tracing    `yaml:"tracing"`
+	Logging    Logging    `yaml:"logging"`
+}
+
+type Database struct {
+	Driver         string        `yaml:"driver" env:"DB_DRIVER" usage:"database/sql driver"`
+	Host           string        `yaml:"host" env:"DB_HOST" usage:"database host"`
+	Port           int           `yaml:"port" env:"DB_PORT" usage:"database port"`
+	User           string        `yaml:"user" env:"DB_USER" usage:"database user"`
+	Password       string        `yaml:"password" env:"DB_PASS" secret:"true" usage:"database password"`
+	Name           string        `yaml:"name" env:"DB_NAME" usage:"database name"`
+	SSLMode        string        `yaml:"sslmode" env:"DB_SSLMODE" usage:"one of disable, allow, prefer, require, verify-ca or verify-full"`
+	Migrations     string        `yaml:"migrations" env:"MIGRATIONS_DIR" usage:"directory to read goose migrations from instead of the ones built in"`
+	AutoMigrate    bool          `yaml:"auto_migrate" env:"AUTO_MIGRATE" usage:"apply pending migrations when the server starts"`
+	ConnectMaxWait time.Duration `yaml:"connect_max_wait" env:"DB_CONNECT_MAX_WAIT" usage:"time to keep retrying the database at startup, 0 to try once"`
+}
+
+type Server struct {
+	ListenAddress  string        `yaml:"listen_address" env:"LISTEN_ADDRESS" usage:"address the server listens on"`
+	BaseURL        string        `yaml:"base_url" env:"BASE_URL" usage:"URL of shorts on hosts not registered as domains, e.g. https://l24.dev, instead of the one of each request"`
+	ReadTimeout    time.Duration `yaml:"read_timeout" env:"READ_TIMEOUT" usage:"time allowed to read a request"`
+	WriteTimeout   time.Duration `yaml:"write_timeout" env:"WRITE_TIMEOUT" usage:"time allowed to write a response"`
+	DrainDelay     time.Duration `yaml:"drain_delay" env:"DRAIN_DELAY" usage:"time spent reporting unready on shutdown before no longer accepting connections"`
+	DrainTimeout   time.Duration `yaml:"drain_timeout" env:"DRAIN_TIMEOUT" usage:"time requests in flight get to finish on shutdown"`
+	CORSOrigins    []string      `yaml:"cors_origins" env:"CORS_ORIGINS" usage:"origins allowed to call the API from a browser"`
+	TrustedProxies []string      `yaml:"trusted_proxies" env:"TRUSTED_PROXIES" usage:"networks of proxies whose X-Forwarded-For is believed"`
+	H2C            bool          `yaml:"h2c" env:"H2C" usage:"serve HTTP/2 without TLS, for proxies speaking HTTP/2 to the server"`
+}
+
+type TLS struct {
+	CertFile              string        `yaml:"cert_file" env:"TLS_CERT_FILE" usage:"PEM certificate to serve HTTPS with, enabling TLS"`
+	KeyFile               string        `yaml:"key_file" env:"TLS_KEY_FILE" usage:"PEM private key of the certificate"`
+	ReloadInterval        time.Duration `yaml:"reload_interval" env:"TLS_RELOAD_INTERVAL" usage:"how often the certificate files are checked for changes"`
+	RedirectAddress       string        `yaml:"redirect_address" env:"TLS_REDIRECT_ADDRESS" usage:"address of a plain HTTP listener redirecting to HTTPS, e.g. :80"`
+	HSTSMaxAge            time.Duration `yaml:"hsts_max_age" env:"HSTS_MAX_AGE" usage:"max age of the Strict-Transport-Security header, 0 to not send it"`
+	HSTSIncludeSubdomains bool          `yaml:"hsts_include_subdomains" env:"HSTS_INCLUDE_SUBDOMAINS" usage:"extend HSTS to subdomains"`
+	HSTSPreload           bool          `yaml:"hsts_preload" env:"HSTS_PRELOAD" usage:"ask for HSTS preloading"`
+}
+
+type Auth struct {
+	AdminAPIKey          string `yaml:"admin_api_key" env:"ADMIN_API_KEY" secret:"true" usage:"bootstrap key with the admin scope"`
+	AllowAnonymousCreate bool   `yaml:"allow_anonymous_create" env:"ALLOW_ANONYMOUS_CREATE" usage:"let unauthenticated clients create shorts"`
+	UnlockSecret         string `yaml:"unlock_secret" env:"UNLOCK_SECRET" secret:"true" usage:"key signing the cookies of password protected shorts"`
+}
+
+type OIDC struct {
+	IssuerURL    string `yaml:"issuer_url" env:"OIDC_ISSUER_URL" usage:"OpenID Connect issuer, enabling single sign-on"`
+	ClientID     string `yaml:"client_id" env:"OIDC_CLIENT_ID" usage:"OpenID Connect client ID"`
+	ClientSecret string `yaml:"client_secret" env:"OIDC_CLIENT_SECRET" secret:"true" usage:"OpenID Connect client secret"`
+	RedirectURL  string `yaml:"redirect_url" env:"OIDC_REDIRECT_URL" usage:"URL of /auth/oidc/callback"`
+	GroupsClaim  string `yaml:"groups_claim" env:"OIDC_GROUPS_CLAIM" usage:"ID token claim listing groups"`
+	GroupRoles   string `yaml:"group_roles" env:"OIDC_GROUP_ROLES" usage:"roles granted to groups, e.g. sre=admin"`
+}
+
+type RateLimits struct {
+	RedisURL string `yaml:"redis_url" env:"REDIS_URL" secret:"true" usage:"Redis sharing rate limits between replicas"`
+	Create   string `yaml:"create" env:"CREATE_RATE_LIMIT" usage:"limit on creating shorts, e.g. 30/m"`
+	Redirect string `yaml:"redirect" env:"REDIRECT_RATE_LIMIT" usage:"limit on redirects per IP address"`
+	Report   string `yaml:"report" env:"REPORT_RATE_LIMIT" usage:"limit on abuse reports"`
+	Unlock   string `yaml:"unlock" env:"UNLOCK_RATE_LIMIT" usage:"limit on password attempts"`
+}
+
+type URLPolicy struct {
+	AllowedSchemes []string `yaml:"allowed_schemes" env:"URL_ALLOWED_SCHEMES" usage:"schemes destinations may use"`
+	MaxLength      int      `yaml:"max_length" env:"URL_MAX_LENGTH" usage:"longest destination allowed, in bytes"`
+	AllowPrivate   bool     `yaml:"allow_private" env:"URL_ALLOW_PRIVATE" usage:"allow private and internal destinations"`
+	AllowedHosts   []string `yaml:"allowed_hosts" env:"URL_ALLOWED_HOSTS" usage:"only allow these hosts and their subdomains"`
+	DeniedHosts    []string `yaml:"denied_hosts" env:"URL_DENIED_HOSTS" usage:"never allow these hosts and their subdomains"`
+	ResolveHosts   bool     `yaml:"resolve_hosts" env:"URL_RESOLVE_HOSTS" usage:"reject hosts resolving to private addresses"`
+}
+
+type Blocklist struct {
+	Files          string        `yaml:"files" env:"BLOCKLIST_FILES" usage:"format:path pairs of blocklists"`
+	ReloadInterval time.Duration `yaml:"reload_interval" env:"BLOCKLIST_RELOAD_INTERVAL" usage:"how often blocklists are reloaded"`
+}
+
+type Metrics struct {
+	Enabled       bool   `yaml:"enabled" env:"METRICS_ENABLED" usage:"expose Prometheus metrics on /metrics"`
+	ListenAddress string `yaml:"listen_address" env:"METRICS_LISTEN_ADDRESS" usage:"separate address to serve /metrics on without authentication, instead of the main one where it needs an admin key"`
+}
+
+type Tracing struct {
+	Exporter     string `yaml:"exporter" env:"TRACING_EXPORTER" usage:"where spans go: otlp, stdout or none"`
+	OTLPEndpoint string `yaml:"otlp_endpoint" env:"TRACING_OTLP_ENDPOINT" usage:"URL of the OTLP/HTTP collector, instead of OTEL_EXPORTER_OTLP_ENDPOINT"`
+	ServiceName  string `yaml:"service_name" env:"TRACING_SERVICE_NAME" usage:"service name spans are reported under"`
+}
+
+type Logging struct {
+	Level             string `yaml:"level" env:"LOG_LEVEL" usage:"lowest level logged: debug, info, warn or error"`
+	AccessLogSampling int    `yaml:"access_log_sampling" env:"ACCESS_LOG_SAMPLING" usage:"log one request in this many, 0 for none; server errors are always logged"`
+}
+
+// Default is the configuration before anything overrides it
+func Default() Config {
+	policy := shortener.DefaultURLPolicy()
+
+	return Config{
+		Database: Database{
+			Driver:         "postgres",
+			Host:           "localhost",
+			Port:           5432,
+			SSLMode:        "disable",
+			AutoMigrate:    true,
+			ConnectMaxWait: time.Minute,
+		},
+		Server: Server{
+			ListenAddress: "0.0.0.0:8080",
+			ReadTimeout:   15 * time.Second,
+			WriteTimeout:  15 * time.Second,
+			DrainTimeout:  shortener.DefaultDrainTimeout,
+			CORSOrigins:   []string{"https://shortener.dev"},
+		},
+		TLS: TLS{
+			ReloadInterval: time.Minute,
+		},
+		RateLimits: RateLimits{
+			Create: "30/m",
+			Report: "10/h",
+			Unlock: "10/h",
+		},
+		URLPolicy: URLPolicy{
+			AllowedSchemes: policy.AllowedSchemes,
+			MaxLength:      policy.MaxLength,
+		},
+		Blocklist: Blocklist{
+			ReloadInterval: 15 * time.Minute,
+		},
+		Metrics: Metrics{
+			Enabled: true,
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			ServiceName: "l24",
+		},
+		Logging: Logging{
+			Level:             "info",
+			AccessLogSampling: 1,
+		},
+	}
+}
+
+// Load builds the configuration from its defaults, then the file named by --config or CONFIG_FILE,
+// then the environment, then the flags in args. It registers a flag for every setting on flags, which
+// the caller may have added flags of its own to, and returns an error if the result is not valid.
+func Load(flags *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	config := Default()
+	settings := collectSettings(reflect.ValueOf(&config).Elem(), "")
+
+	file := flags.String("config", "", fmt.Sprintf("YAML config file (env %s)", FileEnv))
+	values := make(map[string]*string, len(settings))
+	for _, setting := range settings {
+		values[setting.flag] = flags.String(setting.flag, "", fmt.Sprintf("%s (env %s)", setting.usage, setting.env))
+	}
+
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if *file == "" {
+		*file, _ = lookupEnv(FileEnv)
+	}
+	if *file != "" {
+		err = loadFile(&config, *file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var result *multierror.Error
+	for _, setting := range settings {
+		if value, ok := lookupEnv(setting.env); ok {
+			result = multierror.Append(result, setting.set(value, setting.env))
+		}
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		for _, setting := range settings {
+			if setting.flag == f.Name {
+				result = multierror.Append(result, setting.set(*values[f.Name], "--"+f.Name))
+			}
+		}
+	})
+
+	if err := result.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+func loadFile(config *Config, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+
+	err = decoder.Decode(config)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+var sslModes = map[string]bool{"disable": true, "allow": true, "prefer": true, "require": true, "verify-ca": true, "verify-full": true}
+
+var traceExporters = map[string]bool{"otlp": true, "stdout": true, "none": true}
+
+// Validate reports every setting that is missing or malformed
+func (c *Config) Validate() error {
+	var result *multierror.Error
+	invalid := func(format string, args ...interface{}) {
+		result = multierror.Append(result, fmt.Errorf(format, args...))
+	}
+
+	if c.Database.Driver == "" {
+		invalid("database.driver must be set")
+	}
+	if c.Database.Host == "" {
+		invalid("database.host must be set")
+	}
+	if c.Database.Port < 1 || c.Database.Port > 65535 {
+		invalid("database.port %d must be between 1 and 65535", c.Database.Port)
+	}
+	if c.Database.ConnectMaxWait < 0 {
+		invalid("database.connect_max_wait must not be negative")
+	}
+	if !sslModes[c.Database.SSLMode] {
+		invalid("database.sslmode %q must be one of disable, allow, prefer, require, verify-ca or verify-full", c.Database.SSLMode)
+	}
+
+	if _, _, err := net.SplitHostPort(c.Server.ListenAddress); err != nil {
+		invalid("server.listen_address %q must be host:port", c.Server.ListenAddress)
+	}
+	if c.Server.BaseURL != "" {
+		if URL, err := url.Parse(c.Server.BaseURL); err != nil || (URL.Scheme != "http" && URL.Scheme != "https") || URL.Host == "" || strings.Trim(URL.Path, "/") != "" || URL.RawQuery != "" || URL.Fragment != "" {
+			invalid("server.base_url %q must be an http or https URL without a path", c.Server.BaseURL)
+		}
+	}
+	if c.Server.ReadTimeout <= 0 {
+		invalid("server.read_timeout must be positive")
+	}
+	if c.Server.WriteTimeout <= 0 {
+		invalid("server.write_timeout must be positive")
+	}
+	if c.Server.DrainDelay < 0 {
+		invalid("server.drain_delay must not be negative")
+	}
+	if c.Server.DrainTimeout <= 0 {
+		invalid("server.drain_timeout must be positive")
+	}
+	for _, origin := range c.Server.CORSOrigins {
+		if URL, err := url.Parse(origin); origin != "*" && (err != nil || URL.Scheme == "" || URL.Host == "") {
+			invalid("server.cors_origins entry %q must be an origin like https://example.com", origin)
+		}
+	}
+	if _, err := shortener.ParseTrustedProxies(strings.Join(c.Server.TrustedProxies, ",")); err != nil {
+		invalid("server.trusted_proxies: %v", err)
+	}
+
+	tlsEnabled := c.TLS.Enabled()
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		invalid("tls.cert_file and tls.key_file must be set together")
+	}
+	if c.TLS.ReloadInterval <= 0 {
+		invalid("tls.reload_interval must be positive")
+	}
+	if c.TLS.RedirectAddress != "" {
+		if !tlsEnabled {
+			invalid("tls.redirect_address needs tls.cert_file and tls.key_file")
+		}
+		if _, _, err := net.SplitHostPort(c.TLS.RedirectAddress); err != nil {
+			invalid("tls.redirect_address %q must be host:port", c.TLS.RedirectAddress)
+		}
+		if c.TLS.RedirectAddress == c.Server.ListenAddress {
+			invalid("tls.redirect_address must differ from server.listen_address")
+		}
+	}
+	if c.TLS.HSTSMaxAge < 0 {
+		invalid("tls.hsts_max_age must not be negative")
+	}
+	if c.TLS.HSTSPreload && (!c.TLS.HSTSIncludeSubdomains || c.TLS.HSTSMaxAge < 365*24*time.Hour) {
+		invalid("tls.hsts_preload needs tls.hsts_include_subdomains and a tls.hsts_max_age of at least a year")
+	}
+	if c.Server.H2C && tlsEnabled {
+		invalid("server.h2c only applies without tls, which negotiates HTTP/2 by itself")
+	}
+
+	if c.OIDC.IssuerURL != "" && (c.OIDC.ClientID == "" || c.OIDC.RedirectURL == "") {
+		invalid("oidc.client_id and oidc.redirect_url must be set along with oidc.issuer_url")
+	}
+	if _, err := shortener.ParseGroupRoles(c.OIDC.GroupRoles); err != nil {
+		invalid("oidc.group_roles: %v", err)
+	}
+
+	if c.RateLimits.RedisURL != "" {
+		if _, err := url.Parse(c.RateLimits.RedisURL); err != nil {
+			invalid("rate_limits.redis_url is not a URL")
+		}
+	}
+	limits := map[string]string{
+		"create":   c.RateLimits.Create,
+		"redirect": c.RateLimits.Redirect,
+		"report":   c.RateLimits.Report,
+		"unlock":   c.RateLimits.Unlock,
+	}
+	for name, limit := range limits {
+		if _, err := shortener.ParseRateLimit(limit); err != nil {
+			invalid("rate_limits.%s: %v", name, err)
+		}
+	}
+
+	if len(c.URLPolicy.AllowedSchemes) == 0 {
+		invalid("url_policy.allowed_schemes must not be empty")
+	}
+	if c.URLPolicy.MaxLength < 1 {
+		invalid("url_policy.max_length %d must be positive", c.URLPolicy.MaxLength)
+	}
+
+	if _, err := shortener.ParseBlocklistSources(c.Blocklist.Files); err != nil {
+		invalid("blocklist.files: %v", err)
+	}
+	if c.Blocklist.ReloadInterval <= 0 {
+		invalid("blocklist.reload_interval must be positive")
+	}
+
+	if c.Metrics.ListenAddress != "" {
+		if _, _, err := net.SplitHostPort(c.Metrics.ListenAddress); err != nil {
+			invalid("metrics.listen_address %q must be host:port", c.Metrics.ListenAddress)
+		}
+		if c.Metrics.ListenAddress == c.Server.ListenAddress {
+			invalid("metrics.listen_address must differ from server.listen_address")
+		}
+	}
+
+	if !traceExporters[c.Tracing.Exporter] {
+		invalid("tracing.exporter %q must be one of otlp, stdout or none", c.Tracing.Exporter)
+	}
+	if c.Tracing.OTLPEndpoint != "" {
+		if URL, err := url.Parse(c.Tracing.OTLPEndpoint); err != nil || (URL.Scheme != "http" && URL.Scheme != "https") || URL.Host == "" {
+			invalid("tracing.otlp_endpoint %q must be an http or https URL", c.Tracing.OTLPEndpoint)
+		}
+	}
+	if c.Tracing.ServiceName == "" {
+		invalid("tracing.service_name must be set")
+	}
+
+	if _, err := shortener.ParseLogLevel(c.Logging.Level); err != nil {
+		invalid("logging.level %q must be one of debug, info, warn or error", c.Logging.Level)
+	}
+	if c.Logging.AccessLogSampling < 0 {
+		invalid("logging.access_log_sampling must not be negative")
+	}
+
+	return result.ErrorOrNil()
+}
+
+// Enabled reports whether the server serves HTTPS
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+// DSN is the connection string of the database, in the key=value form lib/pq reads
+func (d Database) DSN() string {
+	pairs := []string{
+		"host=" + quoteDSN(d.Host),
+		"port=" + strconv.Itoa(d.Port),
+		"user=" + quoteDSN(d.User),
+		"password=" + quoteDSN(d.Password),
+		"dbname=" + quoteDSN(d.Name),
+		"sslmode=" + quoteDSN(d.SSLMode),
+	}
+	return strings.Join(pairs, " ")
+}
+
+func quoteDSN(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// Redacted is a copy of the configuration safe to print, with every secret that is set replaced
+func (c Config) Redacted() Config {
+	for _, setting := range collectSettings(reflect.ValueOf(&c).Elem(), "") {
+		if setting.secret && setting.value.String() != "" {
+			setting.value.SetString(redacted)
+		}
+	}
+	return c
+}
+
+// YAML renders the configuration in the format of the config file
+func (c Config) YAML() (string, error) {
+	content, err := yaml.Marshal(c)
+	return string(content), err
+}
+
+// setting is a single configurable field of Config
+type setting struct {
+	flag   string
+	env    string
+	usage  string
+	secret bool
+	value  reflect.Value
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// collectSettings lists the settings of a struct, naming their flags after their yaml path
+func collectSettings(value reflect.Value, prefix string) []setting {
+	var settings []setting
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name := prefix + strings.ReplaceAll(field.Tag.Get("yaml"), "_", "-")
+
+		if field.Type.Kind() == reflect.Struct {
+			settings = append(settings, collectSettings(value.Field(i), name+"-")...)
+			continue
+		}
+
+		settings = append(settings, setting{
+			flag:   name,
+			env:    field.Tag.Get("env"),
+			usage:  field.Tag.Get("usage"),
+			secret: field.Tag.Get("secret") == "true",
+			value:  value.Field(i),
+		})
+	}
+
+	return settings
+}
+
+// set parses a value from the environment or a flag, named by source
+func (s setting) set(raw string, source string) error {
+	switch {
+	case s.value.Type() == durationType:
+		duration, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%s %q must be a duration like 15s", source, raw)
+		}
+		s.value.SetInt(int64(duration))
+	case s.value.Kind() == reflect.Int:
+		number, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%s %q must be a number", source, raw)
+		}
+		s.value.SetInt(int64(number))
+	case s.value.Kind() == reflect.Bool:
+		enabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%s %q must be true or false", source, raw)
+		}
+		s.value.SetBool(enabled)
+	case s.value.Kind() == reflect.Slice:
+		s.value.Set(reflect.ValueOf(splitList(raw)))
+	default:
+		s.value.SetString(raw)
+	}
+
+	return nil
+}
+
+// splitList splits a comma separated value, dropping empty entries
+func splitList(value string) []string {
+	entries := []string{}
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,177 @@
+//go:build unit || all
+
+package config_test
+
+import (
+	"flag"
+	"io"
+	"l24.dev/config"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func env(values map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := values[name]
+		return value, ok
+	}
+}
+
+func newFlags() *flag.FlagSet {
+	flags := flag.NewFlagSet("l24", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	return flags
+}
+
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := config.Load(newFlags(), nil, env(nil))
+
+	assert.Nil(t, err)
+	assert.Equal(t, config.Default(), *cfg)
+	assert.Equal(t, "0.0.0.0:8080", cfg.Server.ListenAddress)
+	assert.Equal(t, "", cfg.Database.Migrations, "the built in migrations should be used")
+	assert.True(t, cfg.Database.AutoMigrate)
+}
+
+func TestLoadLayers(t *testing.T) {
+	path := writeFile(t, `
+database:
+  host: db.internal
+  name: shortener
+  sslmode: require
+server:
+  listen_address: 127.0.0.1:9000
+  read_timeout: 5s
+  cors_origins: [https://l24.dev, https://admin.l24.dev]
+rate_limits:
+  create: 100/m
+`)
+
+	cfg, err := config.Load(newFlags(), []string{"--config", path, "--server-listen-address", ":7000", "--url-policy-allow-private=true"}, env(map[string]string{
+		"DB_HOST":           "db.staging",
+		"DB_PASS":           "hunter2",
+		"CREATE_RATE_LIMIT": "",
+	}))
+
+	if assert.Nil(t, err) {
+		assert.Equal(t, "db.staging", cfg.Database.Host, "the environment should override the file")
+		assert.Equal(t, "shortener", cfg.Database.Name, "the file should override the defaults")
+		assert.Equal(t, "require", cfg.Database.SSLMode)
+		assert.Equal(t, "hunter2", cfg.Database.Password)
+		assert.Equal(t, ":7000", cfg.Server.ListenAddress, "flags should override everything")
+		assert.Equal(t, 5*time.Second, cfg.Server.ReadTimeout)
+		assert.Equal(t, 15*time.Second, cfg.Server.WriteTimeout)
+		assert.Equal(t, []string{"https://l24.dev", "https://admin.l24.dev"}, cfg.Server.CORSOrigins)
+		assert.Equal(t, "", cfg.RateLimits.Create, "an empty variable should turn a limit off")
+		assert.True(t, cfg.URLPolicy.AllowPrivate)
+	}
+}
+
+func TestLoadFileFromEnvironment(t *testing.T) {
+	path := writeFile(t, "database:\n  name: from-file\n")
+
+	cfg, err := config.Load(newFlags(), nil, env(map[string]string{config.FileEnv: path}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "from-file", cfg.Database.Name)
+}
+
+func TestLoadErrors(t *testing.T) {
+	type testCase struct {
+		Name string
+		File string
+		Args []string
+		Env  map[string]string
+	}
+
+	testCases := []testCase{
+		{Name: "Unknown File Key", File: "database:\n  hots: db.internal\n"},
+		{Name: "Malformed Duration", Env: map[string]string{"READ_TIMEOUT": "soon"}},
+		{Name: "Malformed Number", Args: []string{"--database-port", "postgres"}},
+		{Name: "Malformed Boolean", Env: map[string]string{"ALLOW_ANONYMOUS_CREATE": "sure"}},
+		{Name: "Unknown Flag", Args: []string{"--listen", ":80"}},
+		{Name: "Unknown SSL Mode", Env: map[string]string{"DB_SSLMODE": "off"}},
+		{Name: "Listen Address Without Port", Args: []string{"--server-listen-address", "localhost"}},
+		{Name: "Base URL With Path", Env: map[string]string{"BASE_URL": "https://l24.dev/links"}},
+		{Name: "Negative Timeout", Env: map[string]string{"WRITE_TIMEOUT": "-1s"}},
+		{Name: "Negative Connect Max Wait", Env: map[string]string{"DB_CONNECT_MAX_WAIT": "-1m"}},
+		{Name: "Certificate Without Key", Env: map[string]string{"TLS_CERT_FILE": "/etc/l24/tls.crt"}},
+		{Name: "Redirect Without TLS", Env: map[string]string{"TLS_REDIRECT_ADDRESS": ":80"}},
+		{Name: "HSTS Preload Too Short", Env: map[string]string{"HSTS_MAX_AGE": "24h", "HSTS_INCLUDE_SUBDOMAINS": "true", "HSTS_PRELOAD": "true"}},
+		{Name: "H2C With TLS", Env: map[string]string{"TLS_CERT_FILE": "/etc/l24/tls.crt", "TLS_KEY_FILE": "/etc/l24/tls.key", "H2C": "true"}},
+		{Name: "CORS Origin Without Scheme", Env: map[string]string{"CORS_ORIGINS": "l24.dev"}},
+		{Name: "Malformed Rate Limit", Env: map[string]string{"REPORT_RATE_LIMIT": "lots"}},
+		{Name: "Malformed Trusted Proxy", Env: map[string]string{"TRUSTED_PROXIES": "10.0.0.0/33"}},
+		{Name: "Incomplete OIDC", Env: map[string]string{"OIDC_ISSUER_URL": "https://accounts.example.com"}},
+		{Name: "Unknown Blocklist Format", Env: map[string]string{"BLOCKLIST_FILES": "adblock:/etc/l24/list.txt"}},
+		{Name: "Empty Schemes", Env: map[string]string{"URL_ALLOWED_SCHEMES": ""}},
+		{Name: "Unknown Trace Exporter", Env: map[string]string{"TRACING_EXPORTER": "jaeger"}},
+		{Name: "OTLP Endpoint Without Scheme", Env: map[string]string{"TRACING_OTLP_ENDPOINT": "collector:4318"}},
+		{Name: "Unknown Log Level", Env: map[string]string{"LOG_LEVEL": "verbose"}},
+		{Name: "Negative Access Log Sampling", Env: map[string]string{"ACCESS_LOG_SAMPLING": "-1"}},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			args := test.Args
+			if test.File != "" {
+				args = append([]string{"--config", writeFile(t, test.File)}, args...)
+			}
+
+			cfg, err := config.Load(newFlags(), args, env(test.Env))
+
+			assert.NotNil(t, err)
+			assert.Nil(t, cfg)
+		})
+	}
+}
+
+func TestValidateReportsEveryError(t *testing.T) {
+	cfg := config.Default()
+	cfg.Database.Driver = ""
+	cfg.Server.ReadTimeout = 0
+	cfg.URLPolicy.MaxLength = 0
+
+	err := cfg.Validate()
+
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "database.driver")
+		assert.Contains(t, err.Error(), "server.read_timeout")
+		assert.Contains(t, err.Error(), "url_policy.max_length")
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := config.Default()
+	cfg.Database.Password = "hunter2"
+	cfg.OIDC.ClientSecret = "s3cret"
+	cfg.OIDC.ClientID = "l24"
+
+	out, err := cfg.Redacted().YAML()
+
+	assert.Nil(t, err)
+	assert.NotContains(t, out, "hunter2")
+	assert.NotContains(t, out, "s3cret")
+	assert.Contains(t, out, "password: REDACTED")
+	assert.Contains(t, out, "client_id: l24")
+	assert.Contains(t, out, "admin_api_key: \"\"", "unset secrets should show they are unset")
+	assert.Equal(t, "hunter2", cfg.Database.Password, "the original should be left alone")
+}
+
+func TestDSN(t *testing.T) {
+	database := config.Database{Host: "localhost", Port: 5432, User: "user", Password: `it's a \ pass`, Name: "public", SSLMode: "verify-full"}
+
+	assert.Equal(t, `host='localhost' port=5432 user='user' password='it\'s a \\ pass' dbname='public' sslmode='verify-full'`, database.DSN())
+}
@@ -1,62 +1,553 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	"l24.dev/config"
 	"l24.dev/shortener"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/mux"
 	"github.com/pressly/goose/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/cors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
 )
 
 func main() {
-	host := os.Getenv("DB_HOST")
-	user := os.Getenv("DB_USER")
-	pass := os.Getenv("DB_PASS")
-	name := os.Getenv("DB_NAME")
-	dbstring := fmt.Sprintf("host=%s user=%s password=%s dbname=%s sslmode=disable", host, user, pass, name)
-	driver := "postgres"
+	args := os.Args[1:]
+	migrate := len(args) > 0 && args[0] == "migrate"
+	if migrate {
+		args = args[1:]
+	}
+
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	printConfig := flags.Bool("print-config", false, "print the effective configuration, with secrets redacted, and exit")
 
-	db, err := sql.Open(driver, dbstring)
+	cfg, err := config.Load(flags, args, os.LookupEnv)
 	if err != nil {
-		log.Fatalf("failed to open to database: %v", err)
+		fatal("invalid configuration", err)
+	}
+
+	level, _ := shortener.ParseLogLevel(cfg.Logging.Level)
+	slog.SetDefault(shortener.NewLogger(os.Stderr, level))
+
+	if *printConfig {
+		out, err := cfg.Redacted().YAML()
+		if err != nil {
+			fatal("failed to print configuration", err)
+		}
+		fmt.Print(out)
+		return
 	}
 
-	err = goose.Up(db, "migrations")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	driver := cfg.Database.Driver
+	db, err := connectDatabase(ctx, cfg.Database)
 	if err != nil {
-		log.Fatalf("failed to run migrations: %v", err)
+		fatal("failed to connect to database", err)
+	}
+
+	if migrate {
+		err = runMigrate(db, cfg.Database, flags.Args())
+		db.Close()
+		if err != nil {
+			fatal("failed to migrate", err)
+		}
+		return
+	}
+
+	migrationsDir := useMigrations(cfg.Database)
+	if cfg.Database.AutoMigrate {
+		err = goose.Up(db, migrationsDir)
+		if err != nil {
+			fatal("failed to run migrations", err)
+		}
+	} else {
+		slog.Info("database.auto_migrate is off, leaving migrations to main migrate")
 	}
 
 	router := mux.NewRouter()
 
+	serverOptions := []shortener.ServerOption{shortener.WithDrainTimeout(cfg.Server.DrainTimeout)}
+
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if provider := tracerProvider(cfg.Tracing); provider != nil {
+		otel.SetTracerProvider(provider)
+		serverOptions = append(serverOptions, shortener.WithCloser(tracerShutdown{provider}))
+	}
+
+	blocklist, sweeper := loadBlocklist(cfg.Blocklist, db, driver)
+	if sweeper != nil {
+		serverOptions = append(serverOptions, shortener.WithWorker(sweeper))
+	}
+	policy := urlPolicy(cfg.URLPolicy)
+	policy.Blocklist = blocklist
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db, cfg.Database.Name),
+	)
+	metrics := shortener.NewMetrics(registry)
+	withMetrics := shortener.WithMetrics(metrics)
+
 	dao := shortener.NewShortPostgresDao(db, driver)
-	getShortHandler := shortener.NewGetShortHandler(dao)
-	createShortHandler := shortener.NewCreateShortHandler(dao)
+	withPolicy := shortener.WithURLPolicy(policy)
+	withUnlockSecret := shortener.WithUnlockSecret(unlockSecret(cfg.Auth))
+	withBaseURL := shortener.WithBaseURL(baseURL(cfg.Server))
+	getShortHandler := shortener.NewGetShortHandler(dao, shortener.WithBlocklist(blocklist), withUnlockSecret, withMetrics)
+	unlockShortHandler := shortener.NewUnlockShortHandler(dao, withUnlockSecret)
+	createShortHandler := shortener.NewCreateShortHandler(dao, withPolicy, withMetrics, withBaseURL)
+	getShortStatsHandler := shortener.NewGetShortStatsHandler(dao)
+	updateShortHandler := shortener.NewUpdateShortHandler(dao, withPolicy)
+	deleteShortHandler := shortener.NewDeleteShortHandler(dao)
+
+	keyDAO := shortener.NewAPIKeyPostgresDao(db, driver)
+	createAPIKeyHandler := shortener.NewCreateAPIKeyHandler(keyDAO)
+	listAPIKeysHandler := shortener.NewListAPIKeysHandler(keyDAO)
+	revokeAPIKeyHandler := shortener.NewRevokeAPIKeyHandler(keyDAO)
+
+	userDAO := shortener.NewUserPostgresDao(db, driver)
+	registerHandler := shortener.NewRegisterHandler(userDAO)
+	loginHandler := shortener.NewLoginHandler(userDAO)
+	logoutHandler := shortener.NewLogoutHandler(userDAO)
+
+	reportDAO := shortener.NewReportPostgresDao(db, driver)
+	reportShortHandler := shortener.NewReportShortHandler(reportDAO)
+	listReportsHandler := shortener.NewListReportsHandler(reportDAO)
+	moderateHandler := shortener.NewModerateHandler(reportDAO)
+
+	auditDAO := shortener.NewAuditPostgresDao(db, driver)
+	listAuditEventsHandler := shortener.NewListAuditEventsHandler(auditDAO)
+
+	workspaceDAO := shortener.NewWorkspacePostgresDao(db, driver)
+	createWorkspaceHandler := shortener.NewCreateWorkspaceHandler(workspaceDAO)
+	listWorkspacesHandler := shortener.NewListWorkspacesHandler(workspaceDAO)
+	listMembersHandler := shortener.NewListMembersHandler(workspaceDAO)
+	updateMemberHandler := shortener.NewUpdateMemberHandler(workspaceDAO)
+	removeMemberHandler := shortener.NewRemoveMemberHandler(workspaceDAO)
+	createInvitationHandler := shortener.NewCreateInvitationHandler(workspaceDAO)
+	acceptInvitationHandler := shortener.NewAcceptInvitationHandler(workspaceDAO)
+	inWorkspace := shortener.NewWorkspaceResolver(workspaceDAO)
+
+	domains := shortener.NewDomainCache(shortener.NewDomainPostgresDao(db, driver), shortener.WithDomainCacheMetrics(metrics))
+	err = domains.Load(ctx)
+	if err != nil {
+		fatal("failed to load domains", err)
+	}
+	serverOptions = append(serverOptions, shortener.WithWorker(func(ctx context.Context) {
+		domains.Run(ctx, shortener.DefaultDomainReloadInterval)
+	}))
+	createDomainHandler := shortener.NewCreateDomainHandler(domains)
+	listDomainsHandler := shortener.NewListDomainsHandler(domains)
+	deleteDomainHandler := shortener.NewDeleteDomainHandler(domains)
+	onDomain := shortener.NewDomainResolver(domains)
+
+	var oidcProvider *shortener.OIDCProvider
+	if cfg.OIDC.IssuerURL != "" {
+		groupRoles, err := shortener.ParseGroupRoles(cfg.OIDC.GroupRoles)
+		if err != nil {
+			fatal("invalid oidc.group_roles", err)
+		}
+
+		oidcProvider, err = shortener.NewOIDCProvider(context.Background(), shortener.OIDCConfig{
+			IssuerURL:    cfg.OIDC.IssuerURL,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+			GroupsClaim:  cfg.OIDC.GroupsClaim,
+			GroupRoles:   groupRoles,
+		})
+		if err != nil {
+			fatal("failed to set up oidc", err)
+		}
+	}
+
+	auth := shortener.NewAuthenticator(keyDAO,
+		shortener.WithBootstrapKey(cfg.Auth.AdminAPIKey),
+		shortener.WithSessions(userDAO),
+	)
+	trustedProxies, err := shortener.ParseTrustedProxies(strings.Join(cfg.Server.TrustedProxies, ","))
+	if err != nil {
+		fatal("invalid server.trusted_proxies", err)
+	}
+	router.Use(shortener.NewTracingMiddleware())
+	if cfg.Metrics.Enabled {
+		router.Use(metrics.Middleware())
+	}
+	router.Use(shortener.NewRequestIDMiddleware())
+	router.Use(shortener.NewClientIPMiddleware(trustedProxies))
+	router.Use(shortener.NewLoggingMiddleware(cfg.Logging.AccessLogSampling))
+	limit := rateLimiters(cfg.RateLimits, trustedProxies)
+
+	checks := []shortener.HealthCheck{
+		shortener.DatabaseCheck(db),
+		shortener.MigrationsCheck(db, driver, latestMigration(migrationsDir)),
+		shortener.DomainCacheCheck(domains),
+	}
+	if sweeper != nil {
+		checks = append(checks, shortener.BlocklistCheck(blocklist))
+	}
+	if limit.redis != nil {
+		checks = append(checks, shortener.HealthCheck{
+			Name:     "redis",
+			Optional: true,
+			Check: func(ctx context.Context) (interface{}, error) {
+				return nil, limit.redis.Ping(ctx).Err()
+			},
+		})
+		serverOptions = append(serverOptions, shortener.WithCloser(limit.redis))
+	}
+
+	metricsHandler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	if cfg.Metrics.Enabled && cfg.Metrics.ListenAddress != "" {
+		admin := http.NewServeMux()
+		admin.Handle("/metrics", metricsHandler)
+		serverOptions = append(serverOptions, shortener.WithWorker(shortener.HTTPWorker(&http.Server{
+			Handler:      admin,
+			Addr:         cfg.Metrics.ListenAddress,
+			WriteTimeout: cfg.Server.WriteTimeout,
+			ReadTimeout:  cfg.Server.ReadTimeout,
+		})))
+	}
+
+	srv := &http.Server{
+		Addr:         cfg.Server.ListenAddress,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+	}
+	if cfg.TLS.Enabled() {
+		serverOptions = append(serverOptions, serveTLS(cfg, srv)...)
+	}
+	if cfg.Server.H2C {
+		serverOptions = append(serverOptions, shortener.WithH2C())
+	}
+
+	// the database goes last, once nothing can use it anymore
+	serverOptions = append(serverOptions, shortener.WithDrainDelay(cfg.Server.DrainDelay), shortener.WithCloser(db))
+	server := shortener.NewServer(srv, serverOptions...)
+
+	requireCreate := auth.Require(shortener.ScopeCreate)
+	if cfg.Auth.AllowAnonymousCreate {
+		requireCreate = auth.Optional(shortener.ScopeCreate)
+	}
+	requireRead := auth.Require(shortener.ScopeRead)
+	requireManage := auth.Require(shortener.ScopeManage)
+	requireAdmin := auth.Require(shortener.ScopeAdmin)
 
-	router.HandleFunc("/{short}", getShortHandler).Methods(http.MethodGet)
-	router.HandleFunc("/short", createShortHandler).Methods(http.MethodPost)
+	router.HandleFunc("/healthz", shortener.NewHealthzHandler()).Methods(http.MethodGet)
+	router.HandleFunc("/readyz", shortener.NewReadyzHandler(server.Draining, checks...)).Methods(http.MethodGet)
+	if cfg.Metrics.Enabled && cfg.Metrics.ListenAddress == "" {
+		// the public listener is open to anyone, and metrics give away pool stats and error counts
+		router.Handle("/metrics", requireAdmin(metricsHandler)).Methods(http.MethodGet)
+	}
+	router.HandleFunc(shortener.BlockedPagePath, shortener.NewBlockedPageHandler()).Methods(http.MethodGet)
+	router.HandleFunc("/auth/register", registerHandler).Methods(http.MethodPost)
+	router.HandleFunc("/auth/login", loginHandler).Methods(http.MethodPost)
+	router.HandleFunc("/auth/logout", logoutHandler).Methods(http.MethodPost)
+	if oidcProvider != nil {
+		router.HandleFunc("/auth/oidc/login", shortener.NewOIDCLoginHandler(oidcProvider)).Methods(http.MethodGet)
+		router.HandleFunc("/auth/oidc/callback", shortener.NewOIDCCallbackHandler(oidcProvider, userDAO, workspaceDAO)).Methods(http.MethodGet)
+		router.HandleFunc("/auth/oidc/link", shortener.NewOIDCLinkHandler(userDAO)).Methods(http.MethodPost)
+	}
+	router.Handle("/admin/keys", requireAdmin(http.HandlerFunc(createAPIKeyHandler))).Methods(http.MethodPost)
+	router.Handle("/admin/keys", requireAdmin(http.HandlerFunc(listAPIKeysHandler))).Methods(http.MethodGet)
+	router.Handle("/admin/keys/{id}", requireAdmin(http.HandlerFunc(revokeAPIKeyHandler))).Methods(http.MethodDelete)
+	router.Handle("/admin/reports", requireAdmin(http.HandlerFunc(listReportsHandler))).Methods(http.MethodGet)
+	router.Handle("/admin/reports/{id}", requireAdmin(http.HandlerFunc(moderateHandler))).Methods(http.MethodPost)
+	router.Handle("/admin/audit", requireAdmin(http.HandlerFunc(listAuditEventsHandler))).Methods(http.MethodGet)
+	router.Handle("/admin/domains", requireAdmin(http.HandlerFunc(createDomainHandler))).Methods(http.MethodPost)
+	router.Handle("/admin/domains", requireAdmin(http.HandlerFunc(listDomainsHandler))).Methods(http.MethodGet)
+	router.Handle("/admin/domains/{id}", requireAdmin(http.HandlerFunc(deleteDomainHandler))).Methods(http.MethodDelete)
+	router.Handle("/workspaces", requireCreate(http.HandlerFunc(createWorkspaceHandler))).Methods(http.MethodPost)
+	router.Handle("/workspaces", requireRead(http.HandlerFunc(listWorkspacesHandler))).Methods(http.MethodGet)
+	router.Handle("/invitations/accept", requireRead(http.HandlerFunc(acceptInvitationHandler))).Methods(http.MethodPost)
+	router.Handle("/w/{workspace}/members", requireRead(inWorkspace(http.HandlerFunc(listMembersHandler)))).Methods(http.MethodGet)
+	router.Handle("/w/{workspace}/members/{user}", requireManage(inWorkspace(http.HandlerFunc(updateMemberHandler)))).Methods(http.MethodPut)
+	router.Handle("/w/{workspace}/members/{user}", requireManage(inWorkspace(http.HandlerFunc(removeMemberHandler)))).Methods(http.MethodDelete)
+	router.Handle("/w/{workspace}/invitations", requireManage(inWorkspace(http.HandlerFunc(createInvitationHandler)))).Methods(http.MethodPost)
+	router.Handle("/w/{workspace}/short/{short}/report", limit.reports(inWorkspace(onDomain(http.HandlerFunc(reportShortHandler))))).Methods(http.MethodPost)
+	router.Handle("/w/{workspace}/short/{short}/stats", requireRead(inWorkspace(onDomain(http.HandlerFunc(getShortStatsHandler))))).Methods(http.MethodGet)
+	router.Handle("/w/{workspace}/short/{short}", requireManage(inWorkspace(onDomain(http.HandlerFunc(updateShortHandler))))).Methods(http.MethodPut)
+	router.Handle("/w/{workspace}/short/{short}", requireManage(inWorkspace(onDomain(http.HandlerFunc(deleteShortHandler))))).Methods(http.MethodDelete)
+	router.Handle("/w/{workspace}/short", requireCreate(limit.create(inWorkspace(onDomain(http.HandlerFunc(createShortHandler)))))).Methods(http.MethodPost)
+	router.Handle("/w/{workspace}/{short}", limit.redirects(inWorkspace(onDomain(http.HandlerFunc(getShortHandler))))).Methods(http.MethodGet)
+	router.Handle("/w/{workspace}/{short}/{rest:.+}", limit.redirects(inWorkspace(onDomain(http.HandlerFunc(getShortHandler))))).Methods(http.MethodGet)
+	router.Handle("/w/{workspace}/{short}", limit.unlock(inWorkspace(onDomain(http.HandlerFunc(unlockShortHandler))))).Methods(http.MethodPost)
+	router.Handle("/w/{workspace}/{short}/{rest:.+}", limit.unlock(inWorkspace(onDomain(http.HandlerFunc(unlockShortHandler))))).Methods(http.MethodPost)
+	router.Handle("/short/{short}/report", limit.reports(onDomain(http.HandlerFunc(reportShortHandler)))).Methods(http.MethodPost)
+	router.Handle("/short/{short}/stats", requireRead(onDomain(http.HandlerFunc(getShortStatsHandler)))).Methods(http.MethodGet)
+	router.Handle("/short/{short}", requireManage(onDomain(http.HandlerFunc(updateShortHandler)))).Methods(http.MethodPut)
+	router.Handle("/short/{short}", requireManage(onDomain(http.HandlerFunc(deleteShortHandler)))).Methods(http.MethodDelete)
+	router.Handle("/{short}", limit.redirects(onDomain(http.HandlerFunc(getShortHandler)))).Methods(http.MethodGet)
+	router.Handle("/{short}/{rest:.+}", limit.redirects(onDomain(http.HandlerFunc(getShortHandler)))).Methods(http.MethodGet)
+	router.Handle("/short", requireCreate(limit.create(onDomain(http.HandlerFunc(createShortHandler))))).Methods(http.MethodPost)
+	router.Handle("/{short}", limit.unlock(onDomain(http.HandlerFunc(unlockShortHandler)))).Methods(http.MethodPost)
+	router.Handle("/{short}/{rest:.+}", limit.unlock(onDomain(http.HandlerFunc(unlockShortHandler)))).Methods(http.MethodPost)
 	router.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) { rw.WriteHeader(200) })
 
 	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"https://shortener.dev"},
+		AllowedOrigins:   cfg.Server.CORSOrigins,
 		AllowCredentials: true,
 		AllowedHeaders:   []string{"*"},
-		AllowedMethods:   []string{"GET", "HEAD", "POST"},
+		AllowedMethods:   []string{"GET", "HEAD", "POST", "PUT", "DELETE"},
 	})
 
-	srv := &http.Server{
-		Handler:      c.Handler(router),
-		Addr:         "0.0.0.0:8080",
-		WriteTimeout: 15 * time.Second,
-		ReadTimeout:  15 * time.Second,
+	handler := c.Handler(router)
+	if cfg.TLS.HSTSMaxAge > 0 {
+		handler = shortener.NewHSTSMiddleware(shortener.HSTS{
+			MaxAge:            cfg.TLS.HSTSMaxAge,
+			IncludeSubdomains: cfg.TLS.HSTSIncludeSubdomains,
+			Preload:           cfg.TLS.HSTSPreload,
+		})(handler)
+	}
+	srv.Handler = handler
+
+	slog.Info("starting server", "address", cfg.Server.ListenAddress, "tls", cfg.TLS.Enabled())
+	if err := server.ListenAndServe(ctx); err != nil {
+		fatal("server failed", err)
+	}
+}
+
+// fatal logs why the server cannot run and exits
+func fatal(msg string, err error, args ...any) {
+	slog.Error(msg, append([]any{"error", err}, args...)...)
+	os.Exit(1)
+}
+
+// serveTLS makes srv serve HTTPS with the configured certificate, returning the workers reloading it
+// on SIGHUP or when its files change and, when configured, redirecting plain HTTP to HTTPS
+func serveTLS(cfg *config.Config, srv *http.Server) []shortener.ServerOption {
+	reloader, err := shortener.NewCertReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+	if err != nil {
+		fatal("failed to load tls certificate", err)
+	}
+	srv.TLSConfig = reloader.TLSConfig()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	options := []shortener.ServerOption{shortener.WithWorker(func(ctx context.Context) {
+		reloader.Run(ctx, cfg.TLS.ReloadInterval, hup)
+	})}
+
+	if cfg.TLS.RedirectAddress != "" {
+		_, port, _ := net.SplitHostPort(cfg.Server.ListenAddress)
+		options = append(options, shortener.WithWorker(shortener.HTTPWorker(&http.Server{
+			Handler:      shortener.NewHTTPSRedirectHandler(port),
+			Addr:         cfg.TLS.RedirectAddress,
+			WriteTimeout: cfg.Server.WriteTimeout,
+			ReadTimeout:  cfg.Server.ReadTimeout,
+		})))
+	}
+
+	return options
+}
+
+// connectDatabase opens the database and waits for it to answer, as it may still be starting along
+// with the server, e.g. under docker-compose
+func connectDatabase(ctx context.Context, cfg config.Database) (*sql.DB, error) {
+	db, err := sql.Open(cfg.Driver, cfg.DSN())
+	if err != nil {
+		return nil, err
+	}
+
+	retrier := shortener.NewRetrier("database", shortener.DefaultRetryPolicy(cfg.ConnectMaxWait))
+	err = retrier.Do(ctx, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		return db.PingContext(ctx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// latestMigration is the version of the newest migration in dir, which the database must be at to serve
+func latestMigration(dir string) int64 {
+	migrations, err := goose.CollectMigrations(dir, 0, goose.MaxVersion)
+	if err != nil {
+		fatal("failed to read migrations", err)
+	}
+
+	last, err := migrations.Last()
+	if err != nil {
+		fatal("failed to read migrations", err)
+	}
+
+	return last.Version
+}
+
+// tracerProvider sends spans to the configured exporter. There is no provider when tracing is off,
+// leaving the global one recording nothing.
+func tracerProvider(cfg config.Tracing) *sdktrace.TracerProvider {
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch cfg.Exporter {
+	case "none":
+		return nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case "otlp":
+		var options []otlptracehttp.Option
+		if cfg.OTLPEndpoint != "" {
+			endpoint, _ := url.Parse(cfg.OTLPEndpoint)
+			options = append(options, otlptracehttp.WithEndpoint(endpoint.Host))
+			if endpoint.Path != "" && endpoint.Path != "/" {
+				options = append(options, otlptracehttp.WithURLPath(endpoint.Path))
+			}
+			if endpoint.Scheme == "http" {
+				options = append(options, otlptracehttp.WithInsecure())
+			}
+		}
+		exporter, err = otlptracehttp.New(context.Background(), options...)
+	}
+	if err != nil {
+		fatal("failed to set up the trace exporter", err, "exporter", cfg.Exporter)
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(cfg.ServiceName))),
+	)
+}
+
+// tracerShutdown flushes the spans still buffered when the server closes
+type tracerShutdown struct {
+	provider *sdktrace.TracerProvider
+}
+
+func (t tracerShutdown) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return t.provider.Shutdown(ctx)
+}
+
+// limiters are the rate limiting middleware wrapping the routes open to abuse
+type limiters struct {
+	create    mux.MiddlewareFunc
+	redirects mux.MiddlewareFunc
+	reports   mux.MiddlewareFunc
+	unlock    mux.MiddlewareFunc
+
+	// redis is the client sharing budgets between replicas, if any
+	redis *redis.Client
+}
+
+// rateLimiters builds the middleware limiting short creation, redirects, abuse reports and password
+// attempts, sharing budgets between replicas through Redis when a Redis URL is configured
+func rateLimiters(cfg config.RateLimits, trustedProxies []*net.IPNet) limiters {
+	var result limiters
+
+	var store shortener.RateLimitStore = shortener.NewMemoryRateLimitStore()
+	if cfg.RedisURL != "" {
+		options, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			fatal("invalid rate_limits.redis_url", err)
+		}
+		client := redis.NewClient(options)
+		store = shortener.NewRedisRateLimitStore(client, "l24:ratelimit:")
+		result.redis = client
+	}
+
+	limiter := func(name, value string) mux.MiddlewareFunc {
+		limit, err := shortener.ParseRateLimit(value)
+		if err != nil {
+			fatal("invalid rate_limits."+name, err)
+		}
+		return shortener.NewRateLimiter(name, store, limit, shortener.WithTrustedProxies(trustedProxies)).Middleware()
+	}
+
+	result.create = limiter("create", cfg.Create)
+	result.redirects = limiter("redirect", cfg.Redirect)
+	result.reports = limiter("report", cfg.Report)
+	result.unlock = limiter("unlock", cfg.Unlock)
+
+	return result
+}
+
+// loadBlocklist loads the configured blocklists, along with the worker reloading them in the background
+// and blocking stored shorts that start matching. There is no worker when no blocklists are configured.
+func loadBlocklist(cfg config.Blocklist, db *sql.DB, driver string) (*shortener.Blocklist, shortener.Worker) {
+	sources, err := shortener.ParseBlocklistSources(cfg.Files)
+	if err != nil {
+		fatal("invalid blocklist.files", err)
+	}
+
+	blocklist := shortener.NewBlocklist(sources)
+	if len(sources) == 0 {
+		return blocklist, nil
+	}
+
+	err = blocklist.Reload()
+	if err != nil {
+		fatal("failed to load blocklist", err)
+	}
+	slog.Info("loaded blocklist", "entries", blocklist.Size())
+
+	dao := shortener.NewBlocklistPostgresDao(db, driver)
+	return blocklist, func(ctx context.Context) {
+		blocklist.Run(ctx, cfg.ReloadInterval, dao)
+	}
+}
+
+// unlockSecret is the key signing the cookies of password protected shorts, which must be shared
+// by all replicas for visitors to stay unlocked whichever one they reach
+func unlockSecret(cfg config.Auth) []byte {
+	if cfg.UnlockSecret == "" {
+		slog.Warn("auth.unlock_secret is not set, visitors of password protected shorts will be asked again after a restart")
+	}
+	return []byte(cfg.UnlockSecret)
+}
+
+// baseURL is the URL shorts on the default domain are served from, or nil to take it from each request
+func baseURL(cfg config.Server) *url.URL {
+	if cfg.BaseURL == "" {
+		return nil
+	}
+	URL, _ := url.Parse(cfg.BaseURL)
+	return URL
+}
+
+// urlPolicy builds the policy deciding which destinations shorts may point at
+func urlPolicy(cfg config.URLPolicy) shortener.URLPolicy {
+	policy := shortener.DefaultURLPolicy()
+	policy.AllowedSchemes = cfg.AllowedSchemes
+	policy.MaxLength = cfg.MaxLength
+	policy.AllowPrivate = cfg.AllowPrivate
+	policy.AllowedHosts = cfg.AllowedHosts
+	policy.DeniedHosts = cfg.DeniedHosts
+
+	if cfg.ResolveHosts {
+		policy.Resolver = net.DefaultResolver
 	}
 
-	log.Print("starting server on port 8080")
-	log.Fatal(srv.ListenAndServe())
+	return policy
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"l24.dev/config"
+	"l24.dev/migrations"
+
+	"github.com/pressly/goose/v3"
+)
+
+const migrateUsage = "usage: main migrate [flags] up | down | status | to-version VERSION"
+
+var errMigrateUsage = errors.New(migrateUsage)
+
+// useMigrations points goose at the migrations built into the binary, or at the directory configured
+// instead, and returns the directory to pass it
+func useMigrations(cfg config.Database) string {
+	if cfg.Migrations != "" {
+		goose.SetBaseFS(nil)
+		return cfg.Migrations
+	}
+
+	goose.SetBaseFS(migrations.FS)
+	return migrations.Dir
+}
+
+// runMigrate runs the migrate subcommand: up applies every pending migration, down rolls back the
+// newest one, status lists them all and to-version migrates up or down to the given version
+func runMigrate(db *sql.DB, cfg config.Database, args []string) error {
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+
+	// goose prints what it does, which is the output of the command rather than a log
+	goose.SetLogger(log.New(os.Stdout, "", 0))
+	dir := useMigrations(cfg)
+
+	command, args := args[0], args[1:]
+	switch {
+	case command == "up" && len(args) == 0:
+		return goose.Up(db, dir)
+	case command == "down" && len(args) == 0:
+		return goose.Down(db, dir)
+	case command == "status" && len(args) == 0:
+		return goose.Status(db, dir)
+	case command == "to-version" && len(args) == 1:
+		version, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid version %q: %w", args[0], errMigrateUsage)
+		}
+		return migrateTo(db, dir, version)
+	default:
+		return errMigrateUsage
+	}
+}
+
+// migrateTo applies or rolls back migrations until the database is at version
+func migrateTo(db *sql.DB, dir string, version int64) error {
+	current, err := goose.GetDBVersion(db)
+	if err != nil {
+		return err
+	}
+
+	if version >= current {
+		return goose.UpTo(db, dir, version)
+	}
+	return goose.DownTo(db, dir, version)
+}
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE destinations (
+    id SERIAL NOT NULL PRIMARY KEY,
+    url_id INTEGER NOT NULL REFERENCES urls (id) ON DELETE CASCADE,
+    url VARCHAR NOT NULL,
+    weight INTEGER NOT NULL CHECK (weight > 0),
+    clicks BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX destinations_url_id_idx ON destinations (url_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE destinations;
+-- +goose StatementEnd
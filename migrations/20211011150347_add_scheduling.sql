@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE urls ADD COLUMN activate_at TIMESTAMPTZ;
+ALTER TABLE urls ADD COLUMN timezone VARCHAR;
+
+CREATE TABLE schedules (
+    id SERIAL NOT NULL PRIMARY KEY,
+    url_id INTEGER NOT NULL REFERENCES urls (id) ON DELETE CASCADE,
+    url VARCHAR NOT NULL,
+    starts_at TIMESTAMPTZ,
+    ends_at TIMESTAMPTZ,
+    CHECK (starts_at IS NOT NULL OR ends_at IS NOT NULL),
+    CHECK (starts_at IS NULL OR ends_at IS NULL OR starts_at < ends_at)
+);
+
+CREATE INDEX schedules_url_id_idx ON schedules (url_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE schedules;
+ALTER TABLE urls DROP COLUMN timezone;
+ALTER TABLE urls DROP COLUMN activate_at;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE urls ADD COLUMN forward_query BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE urls ADD COLUMN utm_source VARCHAR;
+ALTER TABLE urls ADD COLUMN utm_medium VARCHAR;
+ALTER TABLE urls ADD COLUMN utm_campaign VARCHAR;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE urls DROP COLUMN utm_campaign;
+ALTER TABLE urls DROP COLUMN utm_medium;
+ALTER TABLE urls DROP COLUMN utm_source;
+ALTER TABLE urls DROP COLUMN forward_query;
+-- +goose StatementEnd
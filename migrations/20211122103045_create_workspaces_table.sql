@@ -0,0 +1,49 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE workspaces (
+    id SERIAL NOT NULL PRIMARY KEY,
+    slug VARCHAR NOT NULL UNIQUE,
+    name VARCHAR NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- every link created before workspaces existed lives in the default workspace
+INSERT INTO workspaces (id, slug, name) VALUES (1, 'default', 'Default');
+SELECT setval('workspaces_id_seq', 1);
+
+CREATE TABLE workspace_members (
+    workspace_id INTEGER NOT NULL REFERENCES workspaces (id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role VARCHAR NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (workspace_id, user_id)
+);
+
+CREATE INDEX workspace_members_user_id_idx ON workspace_members (user_id);
+
+CREATE TABLE workspace_invitations (
+    id SERIAL NOT NULL PRIMARY KEY,
+    workspace_id INTEGER NOT NULL REFERENCES workspaces (id) ON DELETE CASCADE,
+    email VARCHAR NOT NULL,
+    role VARCHAR NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    token_hash VARCHAR NOT NULL UNIQUE,
+    invited_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    accepted_at TIMESTAMPTZ
+);
+
+ALTER TABLE urls ADD COLUMN workspace_id INTEGER NOT NULL DEFAULT 1 REFERENCES workspaces (id) ON DELETE CASCADE;
+ALTER TABLE urls DROP CONSTRAINT urls_redirect_path_key;
+ALTER TABLE urls ADD CONSTRAINT urls_workspace_id_redirect_path_key UNIQUE (workspace_id, redirect_path);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE urls DROP CONSTRAINT urls_workspace_id_redirect_path_key;
+ALTER TABLE urls DROP COLUMN workspace_id;
+ALTER TABLE urls ADD CONSTRAINT urls_redirect_path_key UNIQUE (redirect_path);
+DROP TABLE workspace_invitations;
+DROP TABLE workspace_members;
+DROP TABLE workspaces;
+-- +goose StatementEnd
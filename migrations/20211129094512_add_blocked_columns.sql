@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE urls ADD COLUMN blocked_reason VARCHAR;
+ALTER TABLE urls ADD COLUMN blocked_at TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE urls DROP COLUMN blocked_at;
+ALTER TABLE urls DROP COLUMN blocked_reason;
+-- +goose StatementEnd
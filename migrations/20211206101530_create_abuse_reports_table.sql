@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE urls ADD COLUMN disabled_at TIMESTAMPTZ;
+
+CREATE TABLE abuse_reports (
+    id SERIAL NOT NULL PRIMARY KEY,
+    url_id INTEGER NOT NULL REFERENCES urls (id) ON DELETE CASCADE,
+    reason VARCHAR NOT NULL CHECK (reason IN ('phishing', 'malware', 'spam', 'illegal', 'other')),
+    details VARCHAR NOT NULL DEFAULT '',
+    reporter_ip VARCHAR NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ,
+    resolved_by VARCHAR,
+    resolution VARCHAR CHECK (resolution IN ('disabled', 'dismissed'))
+);
+
+CREATE INDEX abuse_reports_open_idx ON abuse_reports (url_id) WHERE resolved_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE abuse_reports;
+ALTER TABLE urls DROP COLUMN disabled_at;
+-- +goose StatementEnd
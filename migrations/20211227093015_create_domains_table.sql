@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE domains (
+    id SERIAL NOT NULL PRIMARY KEY,
+    host VARCHAR NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- every link created before domains existed lives on the default domain, which serves any host not registered
+INSERT INTO domains (id, host) VALUES (1, 'default');
+SELECT setval('domains_id_seq', 1);
+
+ALTER TABLE urls ADD COLUMN domain_id INTEGER NOT NULL DEFAULT 1 REFERENCES domains (id);
+ALTER TABLE urls DROP CONSTRAINT urls_workspace_id_redirect_path_key;
+ALTER TABLE urls ADD CONSTRAINT urls_workspace_id_domain_id_redirect_path_key UNIQUE (workspace_id, domain_id, redirect_path);
+
+ALTER TABLE audit_events ADD COLUMN domain_id INTEGER NOT NULL DEFAULT 1;
+DROP INDEX audit_events_short_idx;
+CREATE INDEX audit_events_short_idx ON audit_events (workspace_id, domain_id, redirect_path, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX audit_events_short_idx;
+CREATE INDEX audit_events_short_idx ON audit_events (workspace_id, redirect_path, id);
+ALTER TABLE audit_events DROP COLUMN domain_id;
+
+ALTER TABLE urls DROP CONSTRAINT urls_workspace_id_domain_id_redirect_path_key;
+ALTER TABLE urls DROP COLUMN domain_id;
+ALTER TABLE urls ADD CONSTRAINT urls_workspace_id_redirect_path_key UNIQUE (workspace_id, redirect_path);
+DROP TABLE domains;
+-- +goose StatementEnd
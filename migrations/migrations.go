@@ -0,0 +1,13 @@
+// Package migrations holds the goose migrations of the database, embedded in the binary so it
+// does not depend on the directory it runs from.
+package migrations
+
+import "embed"
+
+// Dir is the directory of the migrations within FS
+const Dir = "."
+
+// FS holds every migration
+//
+//go:embed *.sql
+var FS embed.FS
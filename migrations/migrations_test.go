@@ -0,0 +1,36 @@
+//go:build unit || all
+
+package migrations_test
+
+import (
+	"l24.dev/migrations"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pressly/goose/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbedsEveryMigration(t *testing.T) {
+	goose.SetBaseFS(migrations.FS)
+	defer goose.SetBaseFS(nil)
+
+	embedded, err := goose.CollectMigrations(migrations.Dir, 0, goose.MaxVersion)
+	if err != nil {
+		t.Fatalf("failed to collect embedded migrations: %v", err)
+	}
+
+	files, err := filepath.Glob("*.sql")
+	if err != nil {
+		t.Fatalf("failed to list migrations: %v", err)
+	}
+
+	assert.Len(t, embedded, len(files), "every migration should be embedded")
+
+	last, err := embedded.Last()
+	if assert.Nil(t, err) {
+		_, err = os.Stat(filepath.Base(last.Source))
+		assert.Nil(t, err, "the newest migration should be one of the files")
+	}
+}
@@ -0,0 +1,36 @@
+package shortener
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,62}$`)
+
+// ReservedAliases cannot be claimed as shorts because they collide with routes served by the API
+var ReservedAliases = map[string]bool{
+	"short":       true,
+	"admin":       true,
+	"auth":        true,
+	"w":           true,
+	"workspaces":  true,
+	"invitations": true,
+	"blocked":     true,
+	"healthz":     true,
+	"metrics":     true,
+	"readyz":      true,
+}
+
+// ValidateAlias checks that a custom alias can be served as a single path segment
+func ValidateAlias(alias string) error {
+	if !aliasPattern.MatchString(alias) {
+		return fmt.Errorf("alias %q must be 1-63 letters, digits, '-' or '_', starting with a letter or digit", alias)
+	}
+
+	if ReservedAliases[strings.ToLower(alias)] {
+		return fmt.Errorf("alias %q is reserved", alias)
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package shortener
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	InsertAPIKeyQuery    = "INSERT INTO api_keys (name, prefix, key_hash, scopes) VALUES ($1, $2, $3, $4) RETURNING id, created_at"
+	GetAPIKeyByHashQuery = "SELECT id, name, prefix, key_hash, scopes, created_at, revoked_at FROM api_keys WHERE key_hash=$1 AND revoked_at IS NULL"
+	ListAPIKeysQuery     = "SELECT id, name, prefix, key_hash, scopes, created_at, revoked_at FROM api_keys ORDER BY id"
+	RevokeAPIKeyQuery    = "UPDATE api_keys SET revoked_at = NOW() WHERE id=$1 AND revoked_at IS NULL"
+)
+
+type APIKeyDAO interface {
+	InsertAPIKey(ctx context.Context, key *APIKey) error
+	GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, id int64) error
+}
+
+func NewAPIKeyPostgresDao(db *sql.DB, driver string) *APIKeyPostgresDAO {
+	return &APIKeyPostgresDAO{db: db, driver: driver}
+}
+
+type APIKeyPostgresDAO struct {
+	db     *sql.DB
+	driver string
+}
+
+// InsertAPIKey stores key, filling in its ID and creation time
+func (s *APIKeyPostgresDAO) InsertAPIKey(ctx context.Context, key *APIKey) error {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	return db.QueryRowxContext(ctx, InsertAPIKeyQuery, key.Name, key.Prefix, key.Hash, key.Scopes).
+		Scan(&key.ID, &key.CreatedAt)
+}
+
+func (s *APIKeyPostgresDAO) GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	var key APIKey
+	err := db.GetContext(ctx, &key, GetAPIKeyByHashQuery, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+func (s *APIKeyPostgresDAO) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	keys := []APIKey{}
+	err := db.SelectContext(ctx, &keys, ListAPIKeysQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey revokes an active key, returning sql.ErrNoRows if there is none with that ID
+func (s *APIKeyPostgresDAO) RevokeAPIKey(ctx context.Context, id int64) error {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	return executeTransaction(ctx, *db, statement{query: RevokeAPIKeyQuery, args: []interface{}{id}, mustAffectRows: true})
+}
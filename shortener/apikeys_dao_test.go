@@ -0,0 +1,98 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"context"
+	"database/sql"
+	"l24.dev/shortener"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInsertAPIKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	createdAt := time.Date(2021, 11, 8, 9, 0, 0, 0, time.UTC)
+	key := &shortener.APIKey{Name: "ci", Prefix: "0123abcd", Hash: "digest", Scopes: pq.StringArray{"create"}}
+
+	mock.ExpectQuery(regexp.QuoteMeta(shortener.InsertAPIKeyQuery)).
+		WithArgs("ci", "0123abcd", "digest", key.Scopes).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(7, createdAt))
+
+	dao := shortener.NewAPIKeyPostgresDao(db, "postgres")
+	err = dao.InsertAPIKey(context.Background(), key)
+
+	assert.Nil(t, err, "insert should succeed")
+	assert.Equal(t, int64(7), key.ID, "id should be filled in")
+	assert.Equal(t, createdAt, key.CreatedAt, "creation time should be filled in")
+	assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+}
+
+func TestGetAPIKeyByHash(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(shortener.GetAPIKeyByHashQuery)).
+		WithArgs("digest").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "prefix", "key_hash", "scopes", "created_at", "revoked_at"}).
+			AddRow(7, "ci", "0123abcd", "digest", "{create,read}", time.Now(), nil))
+
+	dao := shortener.NewAPIKeyPostgresDao(db, "postgres")
+	key, err := dao.GetAPIKeyByHash(context.Background(), "digest")
+
+	assert.Nil(t, err, "get should succeed")
+	assert.Equal(t, pq.StringArray{"create", "read"}, key.Scopes, "scopes should be decoded")
+	assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	type testCase struct {
+		Name         string
+		RowsAffected int64
+		ExpectedErr  error
+	}
+
+	testCases := []testCase{
+		{Name: "Revoked", RowsAffected: 1, ExpectedErr: nil},
+		{Name: "Already Revoked", RowsAffected: 0, ExpectedErr: sql.ErrNoRows},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta(shortener.RevokeAPIKeyQuery)).
+				WithArgs(7).
+				WillReturnResult(sqlmock.NewResult(0, test.RowsAffected))
+			if test.ExpectedErr == nil {
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			dao := shortener.NewAPIKeyPostgresDao(db, "postgres")
+			err = dao.RevokeAPIKey(context.Background(), 7)
+
+			assert.Equal(t, test.ExpectedErr, err, "error should match")
+			assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+		})
+	}
+}
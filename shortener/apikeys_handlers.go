@@ -0,0 +1,108 @@
+package shortener
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// CreateAPIKeyResponse is the only place the plaintext key is ever returned
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+func NewCreateAPIKeyHandler(dao APIKeyDAO) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request CreateAPIKeyRequest
+
+		err := DecodeJSONBody(w, r, &request)
+		if err != nil {
+			slog.InfoContext(r.Context(), "failed to decode json body", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		request.Name = strings.TrimSpace(request.Name)
+		if request.Name == "" {
+			slog.InfoContext(r.Context(), "api key name is required")
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		err = ValidateScopes(request.Scopes)
+		if err != nil {
+			slog.InfoContext(r.Context(), "invalid scopes", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		plaintext, key, err := GenerateAPIKey(request.Name, request.Scopes)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to generate api key", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		err = dao.InsertAPIKey(r.Context(), key)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to insert api key", "prefix", key.Prefix, "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(CreateAPIKeyResponse{APIKey: *key, Key: plaintext})
+	}
+}
+
+func NewListAPIKeysHandler(dao APIKeyDAO) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys, err := dao.ListAPIKeys(r.Context())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to list api keys", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(keys)
+	}
+}
+
+func NewRevokeAPIKeyHandler(dao APIKeyDAO) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		id, err := strconv.ParseInt(vars["id"], 10, 64)
+		if err != nil {
+			slog.InfoContext(r.Context(), "invalid api key id", "id", vars["id"], "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		err = dao.RevokeAPIKey(r.Context(), id)
+		if err == sql.ErrNoRows {
+			slog.InfoContext(r.Context(), "api key not found or already revoked", "id", id)
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to revoke api key", "id", id, "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,150 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"database/sql"
+	"l24.dev/shortener"
+	"l24.dev/test/mocks"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+)
+
+func TestCreateAPIKeyHandler(t *testing.T) {
+	type testCase struct {
+		Name           string
+		Request        shortener.CreateAPIKeyRequest
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{
+			Name:           "Create Key",
+			Request:        shortener.CreateAPIKeyRequest{Name: "ci", Scopes: []string{"create", "read"}},
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "Missing Name",
+			Request:        shortener.CreateAPIKeyRequest{Name: " ", Scopes: []string{"create"}},
+			ExpectedStatus: http.StatusBadRequest,
+		},
+		{
+			Name:           "Unknown Scope",
+			Request:        shortener.CreateAPIKeyRequest{Name: "ci", Scopes: []string{"root"}},
+			ExpectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			dao := mocks.NewMockAPIKeyDAO(mock)
+
+			times := 0
+			if test.ExpectedStatus == http.StatusOK {
+				times = 1
+			}
+			dao.
+				EXPECT().
+				InsertAPIKey(gomock.Any(), gomock.AssignableToTypeOf(&shortener.APIKey{})).
+				DoAndReturn(func(_ interface{}, key *shortener.APIKey) error {
+					key.ID = 3
+					key.CreatedAt = time.Now()
+					return nil
+				}).
+				Times(times)
+
+			server := httptest.NewServer(http.HandlerFunc(shortener.NewCreateAPIKeyHandler(dao)))
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			response := e.POST("/admin/keys").WithJSON(&test.Request).WithHeader("Content-Type", "application/json").
+				Expect().
+				Status(test.ExpectedStatus)
+
+			if test.ExpectedStatus == http.StatusOK {
+				object := response.JSON().Object()
+				object.Keys().ContainsOnly("id", "name", "prefix", "scopes", "created_at", "key")
+				object.Value("id").Number().Equal(3)
+				object.Value("key").String().Match(`^l24_[0-9a-f]{8}_[0-9a-f]{64}$`)
+			}
+		})
+	}
+}
+
+func TestListAPIKeysHandler(t *testing.T) {
+	mock := gomock.NewController(t)
+	dao := mocks.NewMockAPIKeyDAO(mock)
+	dao.
+		EXPECT().
+		ListAPIKeys(gomock.Any()).
+		Return([]shortener.APIKey{{ID: 1, Name: "ci", Prefix: "0123abcd", Hash: "secret-hash", Scopes: []string{"create"}}}, nil).
+		Times(1)
+
+	server := httptest.NewServer(http.HandlerFunc(shortener.NewListAPIKeysHandler(dao)))
+	defer server.Close()
+	e := httpexpect.New(t, server.URL)
+
+	keys := e.GET("/admin/keys").Expect().Status(http.StatusOK).JSON().Array()
+	keys.Length().Equal(1)
+	keys.Element(0).Object().NotContainsKey("key_hash").NotContainsKey("key")
+	keys.Element(0).Object().Value("prefix").String().Equal("0123abcd")
+}
+
+func TestRevokeAPIKeyHandler(t *testing.T) {
+	type testCase struct {
+		Name           string
+		ID             string
+		RevokeError    error
+		ExpectRevoke   bool
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{
+			Name:           "Revoke",
+			ID:             "3",
+			ExpectRevoke:   true,
+			ExpectedStatus: http.StatusNoContent,
+		},
+		{
+			Name:           "Unknown Key",
+			ID:             "4",
+			RevokeError:    sql.ErrNoRows,
+			ExpectRevoke:   true,
+			ExpectedStatus: http.StatusNotFound,
+		},
+		{
+			Name:           "Bad ID",
+			ID:             "three",
+			ExpectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			dao := mocks.NewMockAPIKeyDAO(mock)
+
+			times := 0
+			if test.ExpectRevoke {
+				times = 1
+			}
+			dao.EXPECT().RevokeAPIKey(gomock.Any(), gomock.Any()).Return(test.RevokeError).Times(times)
+
+			router := mux.NewRouter()
+			router.HandleFunc("/admin/keys/{id}", shortener.NewRevokeAPIKeyHandler(dao))
+			server := httptest.NewServer(router)
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			e.DELETE("/admin/keys/{id}", test.ID).Expect().Status(test.ExpectedStatus)
+		})
+	}
+}
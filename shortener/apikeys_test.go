@@ -0,0 +1,47 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"l24.dev/shortener"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	plaintext, key, err := shortener.GenerateAPIKey("ci", []string{"create"})
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	assert.Regexp(t, regexp.MustCompile(`^l24_[0-9a-f]{8}_[0-9a-f]{64}$`), plaintext, "key should be well formed")
+	assert.Equal(t, plaintext[4:12], key.Prefix, "prefix should identify the key")
+	assert.Equal(t, shortener.HashToken(plaintext), key.Hash, "hash should match plaintext")
+	assert.NotContains(t, key.Hash, plaintext[13:], "hash should not contain the secret")
+	assert.True(t, shortener.IsAPIKey(plaintext), "plaintext should look like an api key")
+
+	other, _, err := shortener.GenerateAPIKey("ci", []string{"create"})
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	assert.NotEqual(t, plaintext, other, "keys should be unique")
+}
+
+func TestAPIKeyHasScope(t *testing.T) {
+	creator := shortener.APIKey{Scopes: []string{"create", "read"}}
+	admin := shortener.APIKey{Scopes: []string{"admin"}}
+
+	assert.True(t, creator.HasScope(shortener.ScopeCreate), "creator should create")
+	assert.True(t, creator.HasScope(shortener.ScopeRead), "creator should read")
+	assert.False(t, creator.HasScope(shortener.ScopeManage), "creator should not manage")
+	assert.False(t, creator.HasScope(shortener.ScopeAdmin), "creator should not administer")
+	assert.True(t, admin.HasScope(shortener.ScopeManage), "admin should have every scope")
+}
+
+func TestValidateScopes(t *testing.T) {
+	assert.Nil(t, shortener.ValidateScopes([]string{"create", "read", "manage", "admin"}), "known scopes should be valid")
+	assert.NotNil(t, shortener.ValidateScopes(nil), "no scopes should be invalid")
+	assert.NotNil(t, shortener.ValidateScopes([]string{"create", "delete"}), "unknown scope should be invalid")
+}
@@ -0,0 +1,141 @@
+package shortener
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// AuditAction is the kind of change an audit event records
+type AuditAction string
+
+const (
+	AuditInsert  AuditAction = "insert"
+	AuditUpdate  AuditAction = "update"
+	AuditDelete  AuditAction = "delete"
+	AuditDisable AuditAction = "disable"
+	AuditBlock   AuditAction = "block"
+	AuditUnblock AuditAction = "unblock"
+)
+
+const (
+	DefaultAuditLimit = 100
+	MaxAuditLimit     = 1000
+)
+
+// systemActor is recorded as the actor of changes made outside of a request, like blocklist sweeps
+const systemActor = "system"
+
+// AuditEvent is a change made to a short. Old and new values are the stored row before and after
+// the change, without the password hash; OldValue is null for inserts and NewValue for deletes.
+type AuditEvent struct {
+	ID           int64            `json:"id" db:"id"`
+	OccurredAt   time.Time        `json:"occurred_at" db:"occurred_at"`
+	Action       AuditAction      `json:"action" db:"action"`
+	Actor        string           `json:"actor" db:"actor"`
+	SourceIP     *string          `json:"source_ip" db:"source_ip"`
+	RequestID    *string          `json:"request_id" db:"request_id"`
+	WorkspaceID  int64            `json:"workspace_id" db:"workspace_id"`
+	DomainID     int64            `json:"domain_id" db:"domain_id"`
+	RedirectPath string           `json:"short" db:"redirect_path"`
+	OldValue     *json.RawMessage `json:"old_value" db:"old_value"`
+	NewValue     *json.RawMessage `json:"new_value" db:"new_value"`
+}
+
+// AuditFilter narrows down the audit events listed. Zero fields match everything.
+type AuditFilter struct {
+	WorkspaceID  *int64
+	DomainID     *int64
+	RedirectPath string
+	Actor        string
+	Action       AuditAction
+	RequestID    string
+	Since        *time.Time
+	Until        *time.Time
+
+	// Before pages through events, returning only those with a lower ID
+	Before int64
+	Limit  int
+}
+
+// ParseAuditFilter reads a filter from the query string of the audit API
+func ParseAuditFilter(query url.Values) (AuditFilter, error) {
+	filter := AuditFilter{
+		RedirectPath: query.Get("short"),
+		Actor:        query.Get("actor"),
+		Action:       AuditAction(query.Get("action")),
+		RequestID:    query.Get("request_id"),
+		Limit:        DefaultAuditLimit,
+	}
+
+	if value := query.Get("workspace"); value != "" {
+		workspace, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("workspace %q must be a workspace ID", value)
+		}
+		filter.WorkspaceID = &workspace
+	}
+
+	if value := query.Get("domain"); value != "" {
+		domain, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("domain %q must be a domain ID", value)
+		}
+		filter.DomainID = &domain
+	}
+
+	for name, field := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			at, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("%s %q must be an RFC 3339 time", name, value)
+			}
+			*field = &at
+		}
+	}
+
+	if value := query.Get("before"); value != "" {
+		before, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || before <= 0 {
+			return filter, fmt.Errorf("before %q must be an event ID", value)
+		}
+		filter.Before = before
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > MaxAuditLimit {
+			return filter, fmt.Errorf("limit %q must be between 1 and %d", value, MaxAuditLimit)
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
+
+// auditStatement records an audit event in the transaction making the change. query selects the
+// affected short, and must be run before the change so it reads the old value. Its first four
+// parameters are the action, actor, source IP and request ID, taken from ctx, followed by args.
+func auditStatement(ctx context.Context, query string, action AuditAction, args ...interface{}) statement {
+	actor := systemActor
+	sourceIP := nullString(ClientIPFromContext(ctx))
+	requestID := nullString(RequestIDFromContext(ctx))
+	if principal := PrincipalFromContext(ctx); principal != nil || sourceIP != nil {
+		actor = principal.Name()
+	}
+
+	return statement{
+		query: query,
+		args:  append([]interface{}{action, actor, sourceIP, requestID}, args...),
+	}
+}
+
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,102 @@
+package shortener
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// AuditInsertShortQuery and its siblings record an audit event for the short they select,
+	// in the transaction changing it. See auditStatement for their first parameters.
+	AuditInsertShortQuery     = "INSERT INTO audit_events (action, actor, source_ip, request_id, workspace_id, domain_id, redirect_path, old_value, new_value) SELECT $1, $2, $3, $4, u.workspace_id, u.domain_id, u.redirect_path, NULL, to_jsonb(u) - 'password_hash' FROM urls u WHERE u.redirect_path=$5 AND u.workspace_id=$6 AND u.domain_id=$7"
+	AuditUpdateShortQuery     = "INSERT INTO audit_events (action, actor, source_ip, request_id, workspace_id, domain_id, redirect_path, old_value, new_value) SELECT $1, $2, $3, $4, u.workspace_id, u.domain_id, u.redirect_path, to_jsonb(u) - 'password_hash', (to_jsonb(u) - 'password_hash') || jsonb_build_object('scheme', $8::text, 'host', $9::text, 'path', $10::text, 'query', $11::text, 'fragment', $12::text) FROM urls u WHERE u.redirect_path=$5 AND u.workspace_id=$6 AND u.domain_id=$7 FOR UPDATE"
+	AuditDeleteShortQuery     = "INSERT INTO audit_events (action, actor, source_ip, request_id, workspace_id, domain_id, redirect_path, old_value, new_value) SELECT $1, $2, $3, $4, u.workspace_id, u.domain_id, u.redirect_path, to_jsonb(u) - 'password_hash', NULL FROM urls u WHERE u.redirect_path=$5 AND u.workspace_id=$6 AND u.domain_id=$7 FOR UPDATE"
+	AuditDisableShortQuery    = "INSERT INTO audit_events (action, actor, source_ip, request_id, workspace_id, domain_id, redirect_path, old_value, new_value) SELECT $1, $2, $3, $4, u.workspace_id, u.domain_id, u.redirect_path, to_jsonb(u) - 'password_hash', (to_jsonb(u) - 'password_hash') || jsonb_build_object('disabled_at', NOW()) FROM urls u WHERE u.id=$5 FOR UPDATE"
+	AuditDeleteShortByIDQuery = "INSERT INTO audit_events (action, actor, source_ip, request_id, workspace_id, domain_id, redirect_path, old_value, new_value) SELECT $1, $2, $3, $4, u.workspace_id, u.domain_id, u.redirect_path, to_jsonb(u) - 'password_hash', NULL FROM urls u WHERE u.id=$5 FOR UPDATE"
+	AuditBlockShortQuery      = "INSERT INTO audit_events (action, actor, source_ip, request_id, workspace_id, domain_id, redirect_path, old_value, new_value) SELECT $1, $2, $3, $4, u.workspace_id, u.domain_id, u.redirect_path, to_jsonb(u) - 'password_hash', (to_jsonb(u) - 'password_hash') || jsonb_build_object('blocked_reason', $6::text) FROM urls u WHERE u.id=$5 FOR UPDATE"
+	ListAuditEventsQuery      = "SELECT id, occurred_at, action, actor, source_ip, request_id, workspace_id, domain_id, redirect_path, old_value, new_value FROM audit_events%v ORDER BY id DESC LIMIT %v"
+)
+
+// AuditDAO reads the audit log. Events are written by the other DAOs, in the transactions making the changes.
+type AuditDAO interface {
+	ListAuditEvents(ctx context.Context, filter AuditFilter) ([]AuditEvent, error)
+}
+
+func NewAuditPostgresDao(db *sql.DB, driver string) *AuditPostgresDAO {
+	return &AuditPostgresDAO{db: db, driver: driver}
+}
+
+type AuditPostgresDAO struct {
+	db     *sql.DB
+	driver string
+}
+
+// ListAuditEvents returns the events matching filter, newest first
+func (s *AuditPostgresDAO) ListAuditEvents(ctx context.Context, filter AuditFilter) ([]AuditEvent, error) {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	query, args := buildListAuditEventsQuery(filter)
+
+	events := []AuditEvent{}
+	err := db.SelectContext(ctx, &events, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func buildListAuditEventsQuery(filter AuditFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.WorkspaceID != nil {
+		where("workspace_id=$%d", *filter.WorkspaceID)
+	}
+	if filter.DomainID != nil {
+		where("domain_id=$%d", *filter.DomainID)
+	}
+	if filter.RedirectPath != "" {
+		where("redirect_path=$%d", filter.RedirectPath)
+	}
+	if filter.Actor != "" {
+		where("actor=$%d", filter.Actor)
+	}
+	if filter.Action != "" {
+		where("action=$%d", filter.Action)
+	}
+	if filter.RequestID != "" {
+		where("request_id=$%d", filter.RequestID)
+	}
+	if filter.Since != nil {
+		where("occurred_at >= $%d", *filter.Since)
+	}
+	if filter.Until != nil {
+		where("occurred_at < $%d", *filter.Until)
+	}
+	if filter.Before > 0 {
+		where("id < $%d", filter.Before)
+	}
+
+	clause := ""
+	if len(conditions) > 0 {
+		clause = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > MaxAuditLimit {
+		limit = DefaultAuditLimit
+	}
+	args = append(args, limit)
+
+	return fmt.Sprintf(ListAuditEventsQuery, clause, fmt.Sprintf("$%d", len(args))), args
+}
@@ -0,0 +1,63 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"context"
+	"l24.dev/shortener"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListAuditEvents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	columns := []string{"id", "occurred_at", "action", "actor", "source_ip", "request_id", "workspace_id", "domain_id", "redirect_path", "old_value", "new_value"}
+	occurred := time.Date(2021, 12, 20, 10, 0, 0, 0, time.UTC)
+	since := occurred.Add(-24 * time.Hour)
+	workspace := int64(3)
+	domain := int64(2)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, occurred_at, action, actor, source_ip, request_id, workspace_id, domain_id, redirect_path, old_value, new_value FROM audit_events ORDER BY id DESC LIMIT $1")).
+		WithArgs(shortener.DefaultAuditLimit).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(2, occurred, "update", "api key l24_ab12", "203.0.113.7", "req-1", 1, 1, "c3xd4d", []byte(`{"host": "example.com"}`), []byte(`{"host": "example.org"}`)).
+			AddRow(1, occurred.Add(-time.Hour), "insert", "anonymous", nil, nil, 1, 1, "c3xd4d", nil, []byte(`{"host": "example.com"}`)))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, occurred_at, action, actor, source_ip, request_id, workspace_id, domain_id, redirect_path, old_value, new_value FROM audit_events WHERE workspace_id=$1 AND domain_id=$2 AND actor=$3 AND action=$4 AND occurred_at >= $5 AND id < $6 ORDER BY id DESC LIMIT $7")).
+		WithArgs(workspace, domain, "system", shortener.AuditBlock, since, 40, 10).
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	dao := shortener.NewAuditPostgresDao(db, "postgres")
+
+	events, err := dao.ListAuditEvents(context.Background(), shortener.AuditFilter{})
+	assert.Nil(t, err)
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, shortener.AuditUpdate, events[0].Action)
+		assert.Equal(t, "req-1", *events[0].RequestID)
+		assert.JSONEq(t, `{"host": "example.org"}`, string(*events[0].NewValue))
+		assert.Nil(t, events[1].SourceIP)
+		assert.Nil(t, events[1].OldValue)
+	}
+
+	events, err = dao.ListAuditEvents(context.Background(), shortener.AuditFilter{
+		WorkspaceID: &workspace,
+		DomainID:    &domain,
+		Actor:       "system",
+		Action:      shortener.AuditBlock,
+		Since:       &since,
+		Before:      40,
+		Limit:       10,
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, events)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
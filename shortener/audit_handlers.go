@@ -0,0 +1,43 @@
+package shortener
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// AuditEventsResponse is a page of audit events, newest first. When more events match, NextBefore
+// is the value of the before parameter fetching the next page.
+type AuditEventsResponse struct {
+	Events     []AuditEvent `json:"events"`
+	NextBefore *int64       `json:"next_before,omitempty"`
+}
+
+// NewListAuditEventsHandler searches the audit log, filtered by the workspace, domain, short, actor,
+// action, request_id, since and until query parameters, and paged with before and limit
+func NewListAuditEventsHandler(dao AuditDAO) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := ParseAuditFilter(r.URL.Query())
+		if err != nil {
+			slog.InfoContext(r.Context(), "invalid audit filter", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		events, err := dao.ListAuditEvents(r.Context(), filter)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to list audit events", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		response := AuditEventsResponse{Events: events}
+		if len(events) == filter.Limit {
+			next := events[len(events)-1].ID
+			response.NextBefore = &next
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+	}
+}
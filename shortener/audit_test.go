@@ -0,0 +1,137 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"encoding/json"
+	"l24.dev/shortener"
+	"l24.dev/test/mocks"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAuditFilter(t *testing.T) {
+	type testCase struct {
+		Name     string
+		Query    string
+		Expected shortener.AuditFilter
+		Fails    bool
+	}
+
+	since := time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC)
+	workspace := int64(3)
+	domain := int64(2)
+
+	testCases := []testCase{
+		{Name: "Empty", Query: "", Expected: shortener.AuditFilter{Limit: shortener.DefaultAuditLimit}},
+		{
+			Name:  "Every Filter",
+			Query: "workspace=3&domain=2&short=c3xd4d&actor=user+ada%40example.com&action=update&request_id=req-1&since=2021-12-01T00:00:00Z&before=40&limit=20",
+			Expected: shortener.AuditFilter{
+				WorkspaceID:  &workspace,
+				DomainID:     &domain,
+				RedirectPath: "c3xd4d",
+				Actor:        "user ada@example.com",
+				Action:       shortener.AuditUpdate,
+				RequestID:    "req-1",
+				Since:        &since,
+				Before:       40,
+				Limit:        20,
+			},
+		},
+		{Name: "Workspace Slug", Query: "workspace=marketing", Fails: true},
+		{Name: "Domain Host", Query: "domain=go.acme.example", Fails: true},
+		{Name: "Bad Time", Query: "until=yesterday", Fails: true},
+		{Name: "Bad Cursor", Query: "before=-1", Fails: true},
+		{Name: "Limit Too High", Query: "limit=5000", Fails: true},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			query, err := url.ParseQuery(test.Query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			filter, err := shortener.ParseAuditFilter(query)
+			if test.Fails {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, test.Expected, filter)
+		})
+	}
+}
+
+func TestListAuditEventsHandler(t *testing.T) {
+	mock := gomock.NewController(t)
+	dao := mocks.NewMockAuditDAO(mock)
+
+	ip := "203.0.113.7"
+	value := json.RawMessage(`{"host": "example.com"}`)
+	occurred := time.Date(2021, 12, 20, 10, 0, 0, 0, time.UTC)
+	dao.EXPECT().
+		ListAuditEvents(gomock.Any(), shortener.AuditFilter{RedirectPath: "c3xd4d", Limit: 2}).
+		Return([]shortener.AuditEvent{
+			{ID: 9, OccurredAt: occurred, Action: shortener.AuditDelete, Actor: "user ada@example.com", SourceIP: &ip, RedirectPath: "c3xd4d", WorkspaceID: 1, OldValue: &value},
+			{ID: 7, OccurredAt: occurred.Add(-time.Hour), Action: shortener.AuditInsert, Actor: "anonymous", SourceIP: &ip, RedirectPath: "c3xd4d", WorkspaceID: 1, NewValue: &value},
+		}, nil)
+	dao.EXPECT().
+		ListAuditEvents(gomock.Any(), shortener.AuditFilter{RedirectPath: "c3xd4d", Before: 7, Limit: 2}).
+		Return([]shortener.AuditEvent{}, nil)
+
+	server := httptest.NewServer(http.HandlerFunc(shortener.NewListAuditEventsHandler(dao)))
+	defer server.Close()
+	e := httpexpect.New(t, server.URL)
+
+	page := e.GET("/").WithQuery("short", "c3xd4d").WithQuery("limit", 2).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object()
+	page.Value("next_before").Number().Equal(7)
+	events := page.Value("events").Array()
+	events.Length().Equal(2)
+	events.Element(0).Object().ValueEqual("action", "delete").ValueEqual("source_ip", ip)
+	events.Element(0).Object().Value("old_value").Object().ValueEqual("host", "example.com")
+	events.Element(0).Object().Value("new_value").Null()
+
+	page = e.GET("/").WithQuery("short", "c3xd4d").WithQuery("limit", 2).WithQuery("before", 7).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object()
+	page.NotContainsKey("next_before")
+	page.Value("events").Array().Empty()
+
+	e.GET("/").WithQuery("since", "last week").
+		Expect().
+		Status(http.StatusBadRequest)
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	handler := shortener.NewRequestIDMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = shortener.RequestIDFromContext(r.Context())
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/c3xd4d", nil)
+	request.Header.Set(shortener.RequestIDHeader, "edge-4f2a")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, "edge-4f2a", seen, "a well formed request ID should be kept")
+	assert.Equal(t, "edge-4f2a", recorder.Header().Get(shortener.RequestIDHeader))
+
+	request = httptest.NewRequest(http.MethodGet, "/c3xd4d", nil)
+	request.Header.Set(shortener.RequestIDHeader, "<script>alert(1)</script>")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Len(t, seen, 32, "a malformed request ID should be replaced")
+	assert.Equal(t, seen, recorder.Header().Get(shortener.RequestIDHeader))
+}
@@ -0,0 +1,243 @@
+package shortener
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type contextKey string
+
+const principalContextKey contextKey = "principal"
+
+// userScopes are granted to every logged in user. What they may do to a particular short is
+// further limited by ownership, see Principal.CanManage.
+var userScopes = []Scope{ScopeCreate, ScopeRead, ScopeManage}
+
+// Principal is whoever authenticated a request: an API key or a logged in user
+type Principal struct {
+	APIKey *APIKey
+	User   *User
+}
+
+// HasScope reports whether the principal may perform actions requiring scope
+func (p *Principal) HasScope(scope Scope) bool {
+	if p.APIKey != nil {
+		return p.APIKey.HasScope(scope)
+	}
+
+	if p.User != nil {
+		if p.User.IsAdmin {
+			return true
+		}
+		for _, granted := range userScopes {
+			if granted == scope {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// CanManage reports whether the principal may read stats for, update or delete short.
+// Admins manage every short, users the shorts they own and keys the shorts they created.
+func (p *Principal) CanManage(short *Short) bool {
+	if p == nil {
+		return false
+	}
+
+	if p.HasScope(ScopeAdmin) {
+		return true
+	}
+
+	if p.User != nil {
+		return short.OwnerID != nil && *short.OwnerID == p.User.ID
+	}
+
+	if p.APIKey != nil {
+		return short.CreatedByKeyID != nil && *short.CreatedByKeyID == p.APIKey.ID
+	}
+
+	return false
+}
+
+// Name identifies the principal in logs
+func (p *Principal) Name() string {
+	switch {
+	case p == nil:
+		return "anonymous"
+	case p.User != nil:
+		return "user " + p.User.Email
+	case p.APIKey != nil:
+		return "api key " + p.APIKey.Prefix
+	}
+	return "anonymous"
+}
+
+// ContextWithPrincipal returns a copy of ctx carrying whoever authenticated the request
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey, principal)
+}
+
+// PrincipalFromContext returns whoever authenticated the request, or nil for anonymous requests
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalContextKey).(*Principal)
+	return principal
+}
+
+// ContextWithAPIKey returns a copy of ctx authenticated by key
+func ContextWithAPIKey(ctx context.Context, key *APIKey) context.Context {
+	return ContextWithPrincipal(ctx, &Principal{APIKey: key})
+}
+
+// APIKeyFromContext returns the key that authenticated the request, if any
+func APIKeyFromContext(ctx context.Context) *APIKey {
+	if principal := PrincipalFromContext(ctx); principal != nil {
+		return principal.APIKey
+	}
+	return nil
+}
+
+// ContextWithUser returns a copy of ctx authenticated by a session of user
+func ContextWithUser(ctx context.Context, user *User) context.Context {
+	return ContextWithPrincipal(ctx, &Principal{User: user})
+}
+
+// UserFromContext returns the logged in user making the request, if any
+func UserFromContext(ctx context.Context) *User {
+	if principal := PrincipalFromContext(ctx); principal != nil {
+		return principal.User
+	}
+	return nil
+}
+
+// AuthenticatorOption customises an Authenticator
+type AuthenticatorOption func(*Authenticator)
+
+// WithBootstrapKey accepts a fixed key with admin scope, so the first real keys can be issued.
+// An empty key disables bootstrapping.
+func WithBootstrapKey(key string) AuthenticatorOption {
+	return func(a *Authenticator) {
+		a.bootstrapKey = key
+	}
+}
+
+// WithSessions accepts session tokens issued by the login endpoint
+func WithSessions(users UserDAO) AuthenticatorOption {
+	return func(a *Authenticator) {
+		a.users = users
+	}
+}
+
+// Authenticator checks bearer API keys and session tokens on incoming requests
+type Authenticator struct {
+	keys         APIKeyDAO
+	users        UserDAO
+	bootstrapKey string
+}
+
+func NewAuthenticator(keys APIKeyDAO, opts ...AuthenticatorOption) *Authenticator {
+	authenticator := &Authenticator{keys: keys}
+	for _, opt := range opts {
+		opt(authenticator)
+	}
+	return authenticator
+}
+
+// Require returns middleware rejecting requests without valid credentials granting scope.
+// Missing or unknown credentials get 401 Unauthorized, ones lacking the scope 403 Forbidden.
+func (a *Authenticator) Require(scope Scope) mux.MiddlewareFunc {
+	return a.middleware(scope, false)
+}
+
+// Optional is like Require, but lets requests without any credentials through anonymously.
+// Requests presenting bad credentials are still rejected.
+func (a *Authenticator) Optional(scope Scope) mux.MiddlewareFunc {
+	return a.middleware(scope, true)
+}
+
+func (a *Authenticator) middleware(scope Scope, allowAnonymous bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := BearerToken(r)
+			if token == "" && allowAnonymous {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			principal, err := a.authenticate(r.Context(), token)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "failed to authenticate request", "error", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			if principal == nil {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="l24.dev"`)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			if !principal.HasScope(scope) {
+				slog.WarnContext(r.Context(), "principal lacks scope", "principal", principal.Name(), "scope", scope)
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(ContextWithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// authenticate resolves a bearer token to a principal, returning nil if it is not valid
+func (a *Authenticator) authenticate(ctx context.Context, token string) (*Principal, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	if a.bootstrapKey != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.bootstrapKey)) == 1 {
+		return &Principal{APIKey: &APIKey{Name: "bootstrap", Prefix: "bootstrap", Scopes: []string{string(ScopeAdmin)}}}, nil
+	}
+
+	if IsAPIKey(token) {
+		key, err := a.keys.GetAPIKeyByHash(ctx, HashToken(token))
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &Principal{APIKey: key}, nil
+	}
+
+	if IsSessionToken(token) && a.users != nil {
+		user, err := a.users.GetUserBySession(ctx, HashToken(token))
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &Principal{User: user}, nil
+	}
+
+	return nil, nil
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer <token>" header
+func BearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(parts[1])
+}
@@ -0,0 +1,212 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"database/sql"
+	"errors"
+	"l24.dev/shortener"
+	"l24.dev/test/mocks"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/golang/mock/gomock"
+)
+
+func TestAuthenticatorRequire(t *testing.T) {
+	const validKey = "l24_0123abcd_00000000000000000000000000000000000000000000000000000000"
+
+	type testCase struct {
+		Name           string
+		Authorization  string
+		StoredKey      *shortener.APIKey
+		LookupError    error
+		ExpectLookup   bool
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{
+			Name:           "No Header",
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:           "Not Bearer",
+			Authorization:  "Basic dXNlcjpwYXNz",
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:           "Not An API Key",
+			Authorization:  "Bearer hunter2",
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:           "Unknown Or Revoked Key",
+			Authorization:  "Bearer " + validKey,
+			LookupError:    sql.ErrNoRows,
+			ExpectLookup:   true,
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:           "Missing Scope",
+			Authorization:  "Bearer " + validKey,
+			StoredKey:      &shortener.APIKey{ID: 1, Prefix: "0123abcd", Scopes: []string{"read"}},
+			ExpectLookup:   true,
+			ExpectedStatus: http.StatusForbidden,
+		},
+		{
+			Name:           "Granted",
+			Authorization:  "bearer " + validKey,
+			StoredKey:      &shortener.APIKey{ID: 1, Prefix: "0123abcd", Scopes: []string{"create"}},
+			ExpectLookup:   true,
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "Admin Implies Scope",
+			Authorization:  "Bearer " + validKey,
+			StoredKey:      &shortener.APIKey{ID: 1, Prefix: "0123abcd", Scopes: []string{"admin"}},
+			ExpectLookup:   true,
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "Bootstrap Key",
+			Authorization:  "Bearer bootstrap-secret",
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "Lookup Failure",
+			Authorization:  "Bearer " + validKey,
+			LookupError:    errors.New("connection refused"),
+			ExpectLookup:   true,
+			ExpectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			dao := mocks.NewMockAPIKeyDAO(mock)
+
+			times := 0
+			if test.ExpectLookup {
+				times = 1
+			}
+			dao.
+				EXPECT().
+				GetAPIKeyByHash(gomock.Any(), shortener.HashToken(validKey)).
+				Return(test.StoredKey, test.LookupError).
+				Times(times)
+
+			var authenticated *shortener.APIKey
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				authenticated = shortener.APIKeyFromContext(r.Context())
+			})
+
+			auth := shortener.NewAuthenticator(dao, shortener.WithBootstrapKey("bootstrap-secret"))
+			server := httptest.NewServer(auth.Require(shortener.ScopeCreate)(next))
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			request := e.POST("/short")
+			if test.Authorization != "" {
+				request = request.WithHeader("Authorization", test.Authorization)
+			}
+			response := request.Expect().Status(test.ExpectedStatus)
+
+			if test.ExpectedStatus == http.StatusUnauthorized {
+				response.Header("WWW-Authenticate").Contains("Bearer")
+			}
+
+			if test.ExpectedStatus == http.StatusOK && authenticated == nil {
+				t.Errorf("authenticated key should be in the request context")
+			}
+		})
+	}
+}
+
+func TestAuthenticatorSessions(t *testing.T) {
+	const token = "l24s_0000000000000000000000000000000000000000000000000000000000000000"
+
+	type testCase struct {
+		Name           string
+		StoredUser     *shortener.User
+		LookupError    error
+		Scope          shortener.Scope
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{
+			Name:           "User Creates",
+			StoredUser:     &shortener.User{ID: 5},
+			Scope:          shortener.ScopeCreate,
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "User Cannot Administer",
+			StoredUser:     &shortener.User{ID: 5},
+			Scope:          shortener.ScopeAdmin,
+			ExpectedStatus: http.StatusForbidden,
+		},
+		{
+			Name:           "Admin User",
+			StoredUser:     &shortener.User{ID: 1, IsAdmin: true},
+			Scope:          shortener.ScopeAdmin,
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "Expired Session",
+			LookupError:    sql.ErrNoRows,
+			Scope:          shortener.ScopeCreate,
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			keys := mocks.NewMockAPIKeyDAO(mock)
+			users := mocks.NewMockUserDAO(mock)
+			users.
+				EXPECT().
+				GetUserBySession(gomock.Any(), shortener.HashToken(token)).
+				Return(test.StoredUser, test.LookupError).
+				Times(1)
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if shortener.UserFromContext(r.Context()) == nil {
+					t.Errorf("user should be in the request context")
+				}
+			})
+
+			auth := shortener.NewAuthenticator(keys, shortener.WithSessions(users))
+			server := httptest.NewServer(auth.Require(test.Scope)(next))
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			e.POST("/short").WithHeader("Authorization", "Bearer "+token).Expect().Status(test.ExpectedStatus)
+		})
+	}
+}
+
+func TestAuthenticatorOptional(t *testing.T) {
+	mock := gomock.NewController(t)
+	keys := mocks.NewMockAPIKeyDAO(mock)
+	keys.EXPECT().GetAPIKeyByHash(gomock.Any(), gomock.Any()).Return(nil, sql.ErrNoRows).Times(1)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if shortener.PrincipalFromContext(r.Context()) != nil {
+			t.Errorf("anonymous request should have no principal")
+		}
+	})
+
+	auth := shortener.NewAuthenticator(keys)
+	server := httptest.NewServer(auth.Optional(shortener.ScopeCreate)(next))
+	defer server.Close()
+	e := httpexpect.New(t, server.URL)
+
+	e.POST("/short").Expect().Status(http.StatusOK)
+	e.POST("/short").WithHeader("Authorization", "Bearer l24_bad_key").Expect().Status(http.StatusUnauthorized)
+}
@@ -0,0 +1,359 @@
+package shortener
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BlockedPagePath is where visitors of blocked shorts are sent instead of the destination
+const BlockedPagePath = "/blocked"
+
+// BlocklistFormat is the layout of a blocklist file
+type BlocklistFormat string
+
+const (
+	// BlocklistDomains lists one domain per line. Subdomains of a listed domain are blocked too.
+	BlocklistDomains BlocklistFormat = "domains"
+	// BlocklistHosts is a hosts file, blocking every host mapped to an address, e.g. "0.0.0.0 evil.example"
+	BlocklistHosts BlocklistFormat = "hosts"
+	// BlocklistPrefixes lists one URL per line, blocking every URL starting with it
+	BlocklistPrefixes BlocklistFormat = "prefixes"
+	// BlocklistURLhaus is a CSV export in the layout published by URLhaus, with URLs in the third column
+	BlocklistURLhaus BlocklistFormat = "urlhaus"
+	// BlocklistHashes lists the hex SHA-256 of URLs, as canonicalised by HashURL, one per line
+	BlocklistHashes BlocklistFormat = "sha256"
+)
+
+// BlocklistSource is a file to load blocklist entries from
+type BlocklistSource struct {
+	Format BlocklistFormat
+	Path   string
+}
+
+// ParseBlocklistSources parses a comma separated list of format:path pairs,
+// e.g. "domains:/etc/l24/phishing.txt,urlhaus:/var/lib/l24/urlhaus.csv"
+func ParseBlocklistSources(value string) ([]BlocklistSource, error) {
+	var sources []BlocklistSource
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("blocklist %q must look like format:path", entry)
+		}
+
+		source := BlocklistSource{Format: BlocklistFormat(parts[0]), Path: parts[1]}
+		switch source.Format {
+		case BlocklistDomains, BlocklistHosts, BlocklistPrefixes, BlocklistURLhaus, BlocklistHashes:
+		default:
+			return nil, fmt.Errorf("blocklist %q has unknown format %q", entry, source.Format)
+		}
+
+		sources = append(sources, source)
+	}
+
+	return sources, nil
+}
+
+// blocklistEntries is one generation of loaded lists, replaced wholesale on reload
+type blocklistEntries struct {
+	domains  map[string]bool
+	prefixes []string
+	hashes   map[string]bool
+}
+
+func (e *blocklistEntries) size() int {
+	return len(e.domains) + len(e.prefixes) + len(e.hashes)
+}
+
+// Blocklist matches URLs against lists of malicious domains, URL prefixes and URL hashes
+type Blocklist struct {
+	sources []BlocklistSource
+
+	mu       sync.RWMutex
+	entries  *blocklistEntries
+	loadedAt time.Time
+	loadErr  error
+}
+
+// BlocklistStatus describes the lists currently loaded and how the last reload went
+type BlocklistStatus struct {
+	Entries  int       `json:"entries"`
+	LoadedAt time.Time `json:"loaded_at"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// NewBlocklist creates an empty blocklist reading from sources. Call Reload to load them.
+func NewBlocklist(sources []BlocklistSource) *Blocklist {
+	return &Blocklist{
+		sources: sources,
+		entries: &blocklistEntries{domains: map[string]bool{}, hashes: map[string]bool{}},
+	}
+}
+
+// Reload reads every source again. If any of them cannot be read, the lists loaded before are kept.
+func (b *Blocklist) Reload() error {
+	entries := &blocklistEntries{domains: map[string]bool{}, hashes: map[string]bool{}}
+
+	for _, source := range b.sources {
+		if err := loadBlocklistSource(entries, source); err != nil {
+			err = fmt.Errorf("failed to load %s blocklist %s: %w", source.Format, source.Path, err)
+
+			b.mu.Lock()
+			b.loadErr = err
+			b.mu.Unlock()
+
+			return err
+		}
+	}
+
+	b.mu.Lock()
+	b.entries = entries
+	b.loadedAt = time.Now()
+	b.loadErr = nil
+	b.mu.Unlock()
+
+	return nil
+}
+
+// Status reports the lists currently loaded, and the error of the last reload if it failed
+func (b *Blocklist) Status() BlocklistStatus {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	status := BlocklistStatus{Entries: b.entries.size(), LoadedAt: b.loadedAt}
+	if b.loadErr != nil {
+		status.Error = b.loadErr.Error()
+	}
+	return status
+}
+
+// Size is the number of entries currently loaded
+func (b *Blocklist) Size() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.entries.size()
+}
+
+// Match reports whether raw is blocked, describing the entry it matched
+func (b *Blocklist) Match(raw string) (string, bool) {
+	URL, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+
+	canonical := canonicalBlocklistURL(URL)
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	host := canonicalHost(URL)
+	for domain := host; domain != ""; domain = parentDomain(domain) {
+		if b.entries.domains[domain] {
+			return "domain " + domain, true
+		}
+	}
+
+	for _, prefix := range b.entries.prefixes {
+		if strings.HasPrefix(canonical, prefix) {
+			return "url " + prefix, true
+		}
+	}
+
+	if b.entries.hashes[hashCanonicalURL(canonical)] {
+		return "url hash", true
+	}
+
+	return "", false
+}
+
+// Run reloads the blocklist every interval until ctx is done. After every reload, and once when
+// it starts, it blocks the stored shorts that started matching and unblocks those that stopped.
+func (b *Blocklist) Run(ctx context.Context, interval time.Duration, dao BlocklistDAO) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := b.Sweep(ctx, dao); err != nil {
+			slog.ErrorContext(ctx, "failed to apply blocklist to existing shorts", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := b.Reload(); err != nil {
+			slog.ErrorContext(ctx, "keeping previous blocklist", "error", err)
+		}
+	}
+}
+
+// Sweep brings the blocked state of every stored short in line with the blocklist
+func (b *Blocklist) Sweep(ctx context.Context, dao BlocklistDAO) error {
+	shorts, err := dao.ListShortTargets(ctx)
+	if err != nil {
+		return err
+	}
+
+	var changes []BlockedShort
+	for _, short := range shorts {
+		reason := ""
+		for _, raw := range short.URLs {
+			if match, ok := b.Match(raw); ok {
+				reason = "blocklist: " + match
+				break
+			}
+		}
+
+		if reason == short.BlockedReason {
+			continue
+		}
+		changes = append(changes, BlockedShort{ID: short.ID, Reason: reason})
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	slog.InfoContext(ctx, "blocklist changed the blocked state of shorts", "shorts", len(changes))
+	return dao.SetBlocked(ctx, changes)
+}
+
+func loadBlocklistSource(entries *blocklistEntries, source BlocklistSource) error {
+	file, err := os.Open(source.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if source.Format == BlocklistURLhaus {
+		return loadURLhaus(entries, file)
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+
+		switch source.Format {
+		case BlocklistDomains:
+			addBlockedDomain(entries, line)
+		case BlocklistHosts:
+			fields := strings.Fields(strings.SplitN(line, "#", 2)[0])
+			for _, host := range fields[1:] {
+				addBlockedDomain(entries, host)
+			}
+		case BlocklistPrefixes:
+			addBlockedPrefix(entries, line)
+		case BlocklistHashes:
+			entries.hashes[strings.ToLower(line)] = true
+		}
+	}
+
+	return scanner.Err()
+}
+
+func loadURLhaus(entries *blocklistEntries, file io.Reader) error {
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(record) > 2 {
+			addBlockedPrefix(entries, record[2])
+		}
+	}
+}
+
+// localHosts appear in every hosts file, and must not block anything
+var localHosts = map[string]bool{"localhost": true, "localhost.localdomain": true, "local": true, "broadcasthost": true, "ip6-localhost": true, "ip6-loopback": true, "0.0.0.0": true}
+
+func addBlockedDomain(entries *blocklistEntries, domain string) {
+	domain = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(domain), "*"), "."), ".")
+	if domain == "" || localHosts[domain] {
+		return
+	}
+	entries.domains[domain] = true
+}
+
+func addBlockedPrefix(entries *blocklistEntries, raw string) {
+	URL, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || URL.Host == "" {
+		return
+	}
+	entries.prefixes = append(entries.prefixes, canonicalBlocklistURL(URL))
+}
+
+func parentDomain(domain string) string {
+	parts := strings.SplitN(domain, ".", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// canonicalBlocklistURL is URL without its fragment, with its scheme and host lowercased
+func canonicalBlocklistURL(URL *url.URL) string {
+	canonical := *URL
+	canonical.Scheme = strings.ToLower(URL.Scheme)
+	canonical.Host = strings.ToLower(URL.Host)
+	canonical.Fragment = ""
+	canonical.RawFragment = ""
+	return canonical.String()
+}
+
+func hashCanonicalURL(canonical string) string {
+	digest := sha256.Sum256([]byte(canonical))
+	return hex.EncodeToString(digest[:])
+}
+
+// HashURL is the hash under which a URL appears in a sha256 blocklist
+func HashURL(raw string) (string, error) {
+	URL, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	return hashCanonicalURL(canonicalBlocklistURL(URL)), nil
+}
+
+var blockedPage = newPage("blocked", `{{define "title"}}Link blocked{{end}}
+{{define "body"}}<h1>This link has been blocked</h1>
+<p>The page it leads to has been reported as phishing or malware, so we stopped redirecting to it.</p>{{end}}`)
+
+// NewBlockedPageHandler serves the warning shown instead of a blocked destination
+func NewBlockedPageHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		renderPage(w, http.StatusOK, blockedPage, nil)
+	}
+}
@@ -0,0 +1,106 @@
+package shortener
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	ListShortTargetsQuery    = "SELECT id, scheme, host, path, query, fragment, blocked_reason FROM urls ORDER BY id"
+	ListShortTargetURLsQuery = "SELECT url_id, url FROM destinations UNION ALL SELECT url_id, url FROM schedules"
+	BlockShortQuery          = "UPDATE urls SET blocked_reason=$2, blocked_at=NOW() WHERE id=$1"
+	UnblockShortQuery        = "UPDATE urls SET blocked_reason=NULL, blocked_at=NULL WHERE id=$1"
+)
+
+// ShortTarget is every URL a stored short can redirect to, across all workspaces
+type ShortTarget struct {
+	ID            int64
+	BlockedReason string
+	URLs          []string
+}
+
+// BlockedShort is a change to the blocked state of a short. An empty Reason unblocks it.
+type BlockedShort struct {
+	ID     int64
+	Reason string
+}
+
+// BlocklistDAO lets the blocklist find and block stored shorts. Unlike ShortDAO it works across
+// workspaces, as malicious links are blocked wherever they are.
+type BlocklistDAO interface {
+	ListShortTargets(ctx context.Context) ([]ShortTarget, error)
+	SetBlocked(ctx context.Context, changes []BlockedShort) error
+}
+
+func NewBlocklistPostgresDao(db *sql.DB, driver string) *BlocklistPostgresDAO {
+	return &BlocklistPostgresDAO{db: db, driver: driver}
+}
+
+type BlocklistPostgresDAO struct {
+	db     *sql.DB
+	driver string
+}
+
+func (s *BlocklistPostgresDAO) ListShortTargets(ctx context.Context) ([]ShortTarget, error) {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	var rows []struct {
+		ID int64 `db:"id"`
+		Short
+	}
+	err := db.SelectContext(ctx, &rows, ListShortTargetsQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	var urls []struct {
+		ShortID int64  `db:"url_id"`
+		URL     string `db:"url"`
+	}
+	err = db.SelectContext(ctx, &urls, ListShortTargetURLsQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]ShortTarget, len(rows))
+	index := make(map[int64]int, len(rows))
+	for i, row := range rows {
+		targets[i] = ShortTarget{ID: row.ID, URLs: []string{row.Short.RawURL()}}
+		if row.BlockedReason != nil {
+			targets[i].BlockedReason = *row.BlockedReason
+		}
+		index[row.ID] = i
+	}
+
+	for _, url := range urls {
+		if i, ok := index[url.ShortID]; ok {
+			targets[i].URLs = append(targets[i].URLs, url.URL)
+		}
+	}
+
+	return targets, nil
+}
+
+// SetBlocked applies changes to the blocked state of shorts in a single transaction, auditing each of them
+func (s *BlocklistPostgresDAO) SetBlocked(ctx context.Context, changes []BlockedShort) error {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	statements := make([]statement, 0, 2*len(changes))
+	for _, change := range changes {
+		if change.Reason == "" {
+			statements = append(statements,
+				auditStatement(ctx, AuditBlockShortQuery, AuditUnblock, change.ID, nil),
+				statement{query: UnblockShortQuery, args: []interface{}{change.ID}},
+			)
+		} else {
+			statements = append(statements,
+				auditStatement(ctx, AuditBlockShortQuery, AuditBlock, change.ID, change.Reason),
+				statement{query: BlockShortQuery, args: []interface{}{change.ID, change.Reason}},
+			)
+		}
+	}
+
+	return executeTransaction(ctx, *db, statements...)
+}
@@ -0,0 +1,73 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"context"
+	"l24.dev/shortener"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListShortTargets(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(shortener.ListShortTargetsQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "scheme", "host", "path", "query", "fragment", "blocked_reason"}).
+			AddRow(1, "https", "lucastephens.com", "/resume.pdf", "", "", nil).
+			AddRow(2, "http", "login-paypal.example", "", "", "", "blocklist: domain login-paypal.example"))
+	mock.ExpectQuery(regexp.QuoteMeta(shortener.ListShortTargetURLsQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"url_id", "url"}).
+			AddRow(1, "https://lucastephens.com/a").
+			AddRow(1, "https://lucastephens.com/b").
+			AddRow(3, "https://deleted.example"))
+
+	dao := shortener.NewBlocklistPostgresDao(db, "postgres")
+	targets, err := dao.ListShortTargets(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, []shortener.ShortTarget{
+		{ID: 1, URLs: []string{"https://lucastephens.com/resume.pdf", "https://lucastephens.com/a", "https://lucastephens.com/b"}},
+		{ID: 2, URLs: []string{"http://login-paypal.example"}, BlockedReason: "blocklist: domain login-paypal.example"},
+	}, targets)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSetBlocked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(shortener.AuditBlockShortQuery)).
+		WithArgs(shortener.AuditBlock, "system", nil, nil, 2, "blocklist: domain login-paypal.example").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(shortener.BlockShortQuery)).
+		WithArgs(2, "blocklist: domain login-paypal.example").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(shortener.AuditBlockShortQuery)).
+		WithArgs(shortener.AuditUnblock, "system", nil, nil, 4, nil).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec(regexp.QuoteMeta(shortener.UnblockShortQuery)).
+		WithArgs(4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	dao := shortener.NewBlocklistPostgresDao(db, "postgres")
+	err = dao.SetBlocked(context.Background(), []shortener.BlockedShort{
+		{ID: 2, Reason: "blocklist: domain login-paypal.example"},
+		{ID: 4},
+	})
+
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
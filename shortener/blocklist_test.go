@@ -0,0 +1,211 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"context"
+	"l24.dev/shortener"
+	"l24.dev/test/mocks"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeBlocklist(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write blocklist: %v", err)
+	}
+	return path
+}
+
+func newTestBlocklist(t *testing.T) (*shortener.Blocklist, string) {
+	dir := t.TempDir()
+
+	hash, err := shortener.HashURL("https://drive.example.net/file/d/1234")
+	if err != nil {
+		t.Fatalf("failed to hash url: %v", err)
+	}
+
+	blocklist := shortener.NewBlocklist([]shortener.BlocklistSource{
+		{Format: shortener.BlocklistDomains, Path: writeBlocklist(t, dir, "domains.txt", "# phishing\nlogin-paypal.example\n*.evil.example\n")},
+		{Format: shortener.BlocklistHosts, Path: writeBlocklist(t, dir, "hosts", "127.0.0.1 localhost\n0.0.0.0 malware.example tracker.example # ads\n")},
+		{Format: shortener.BlocklistPrefixes, Path: writeBlocklist(t, dir, "prefixes.txt", "https://sites.example.com/phish\n")},
+		{Format: shortener.BlocklistURLhaus, Path: writeBlocklist(t, dir, "urlhaus.csv", "################\n# id,dateadded,url,url_status,last_online,threat,tags,urlhaus_link,reporter\n\"2150081\",\"2021-11-28 20:21:06\",\"http://203.0.113.9/bins/x86\",\"online\",\"2021-11-28 20:21:06\",\"malware_download\",\"elf\",\"https://urlhaus.abuse.ch/url/2150081/\",\"geenensp\"\n")},
+		{Format: shortener.BlocklistHashes, Path: writeBlocklist(t, dir, "hashes.txt", hash+"\n")},
+	})
+
+	if err := blocklist.Reload(); err != nil {
+		t.Fatalf("failed to load blocklist: %v", err)
+	}
+
+	return blocklist, dir
+}
+
+func TestParseBlocklistSources(t *testing.T) {
+	sources, err := shortener.ParseBlocklistSources("domains:/etc/l24/phishing.txt, urlhaus:/var/lib/l24/urlhaus.csv")
+	assert.Nil(t, err)
+	assert.Equal(t, []shortener.BlocklistSource{
+		{Format: shortener.BlocklistDomains, Path: "/etc/l24/phishing.txt"},
+		{Format: shortener.BlocklistURLhaus, Path: "/var/lib/l24/urlhaus.csv"},
+	}, sources)
+
+	_, err = shortener.ParseBlocklistSources("/etc/l24/phishing.txt")
+	assert.NotNil(t, err, "sources without a format should be rejected")
+
+	_, err = shortener.ParseBlocklistSources("adblock:/etc/l24/easylist.txt")
+	assert.NotNil(t, err, "unknown formats should be rejected")
+}
+
+func TestBlocklistMatch(t *testing.T) {
+	blocklist, _ := newTestBlocklist(t)
+
+	type testCase struct {
+		URL      string
+		Expected bool
+	}
+
+	testCases := []testCase{
+		{URL: "https://login-paypal.example/signin", Expected: true},
+		{URL: "https://secure.login-paypal.example", Expected: true},
+		{URL: "https://EVIL.example:8443/", Expected: true},
+		{URL: "http://tracker.example/pixel.gif", Expected: true},
+		{URL: "https://sites.example.com/phishing/kit", Expected: true},
+		{URL: "https://sites.example.com/team", Expected: false},
+		{URL: "http://203.0.113.9/bins/x86", Expected: true},
+		{URL: "http://203.0.113.9/", Expected: false},
+		{URL: "https://drive.example.net/file/d/1234#view", Expected: true},
+		{URL: "https://drive.example.net/file/d/5678", Expected: false},
+		{URL: "http://localhost:3000", Expected: false},
+		{URL: "https://paypal.example", Expected: false},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.URL, func(t *testing.T) {
+			_, matched := blocklist.Match(test.URL)
+			assert.Equal(t, test.Expected, matched)
+		})
+	}
+}
+
+func TestBlocklistReload(t *testing.T) {
+	blocklist, dir := newTestBlocklist(t)
+	size := blocklist.Size()
+
+	writeBlocklist(t, dir, "domains.txt", "login-paypal.example\nnew-campaign.example\n")
+	assert.Nil(t, blocklist.Reload())
+	assert.Equal(t, size, blocklist.Size(), "one domain should be swapped for another")
+
+	_, matched := blocklist.Match("https://new-campaign.example")
+	assert.True(t, matched, "new entries should be picked up")
+	_, matched = blocklist.Match("https://evil.example")
+	assert.False(t, matched, "removed entries should be dropped")
+
+	assert.Nil(t, os.Remove(filepath.Join(dir, "domains.txt")))
+	assert.NotNil(t, blocklist.Reload(), "a missing file should fail the reload")
+	_, matched = blocklist.Match("https://new-campaign.example")
+	assert.True(t, matched, "a failed reload should keep the previous entries")
+}
+
+func TestBlocklistSweep(t *testing.T) {
+	blocklist, _ := newTestBlocklist(t)
+
+	mock := gomock.NewController(t)
+	dao := mocks.NewMockBlocklistDAO(mock)
+	dao.EXPECT().ListShortTargets(gomock.Any()).Return([]shortener.ShortTarget{
+		{ID: 1, URLs: []string{"https://lucastephens.com"}},
+		{ID: 2, URLs: []string{"https://lucastephens.com", "https://login-paypal.example/signin"}},
+		{ID: 3, URLs: []string{"https://malware.example"}, BlockedReason: "blocklist: domain malware.example"},
+		{ID: 4, URLs: []string{"https://lucastephens.com"}, BlockedReason: "blocklist: domain lucastephens.com"},
+	}, nil)
+	dao.EXPECT().SetBlocked(gomock.Any(), []shortener.BlockedShort{
+		{ID: 2, Reason: "blocklist: domain login-paypal.example"},
+		{ID: 4, Reason: ""},
+	}).Return(nil)
+
+	assert.Nil(t, blocklist.Sweep(context.Background(), dao))
+}
+
+func TestGetBlockedShort(t *testing.T) {
+	blocklist, _ := newTestBlocklist(t)
+
+	type testCase struct {
+		Name             string
+		Short            *shortener.Short
+		ExpectedLocation string
+	}
+
+	testCases := []testCase{
+		{
+			Name:             "Marked Blocked",
+			Short:            &shortener.Short{RedirectPath: "c3xd4d", Scheme: "https", Host: "lucastephens.com", BlockedReason: pointerString("blocklist: domain lucastephens.com")},
+			ExpectedLocation: shortener.BlockedPagePath,
+		},
+		{
+			Name:             "Matched Since Last Sweep",
+			Short:            &shortener.Short{RedirectPath: "c3xd4d", Scheme: "https", Host: "login-paypal.example"},
+			ExpectedLocation: shortener.BlockedPagePath,
+		},
+		{
+			Name:             "Not Blocked",
+			Short:            &shortener.Short{RedirectPath: "c3xd4d", Scheme: "https", Host: "lucastephens.com"},
+			ExpectedLocation: "https://lucastephens.com",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			dao := mocks.NewMockShortDAO(mock)
+			dao.EXPECT().GetShort(gomock.Any(), gomock.Any(), gomock.Any(), "c3xd4d").Return(test.Short, nil)
+
+			router := mux.NewRouter()
+			router.HandleFunc("/{short}", shortener.NewGetShortHandler(dao, shortener.WithBlocklist(blocklist)))
+
+			server := httptest.NewServer(router)
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			e.GET("/c3xd4d").
+				WithRedirectPolicy(httpexpect.DontFollowRedirects).
+				Expect().
+				Header("Location").Equal(test.ExpectedLocation)
+		})
+	}
+}
+
+func TestCreateBlocklistedShort(t *testing.T) {
+	blocklist, _ := newTestBlocklist(t)
+	policy := shortener.DefaultURLPolicy()
+	policy.Blocklist = blocklist
+
+	mock := gomock.NewController(t)
+	dao := mocks.NewMockShortDAO(mock)
+	dao.EXPECT().InsertShort(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	server := httptest.NewServer(http.HandlerFunc(shortener.NewCreateShortHandler(dao, shortener.WithURLPolicy(policy))))
+	defer server.Close()
+	e := httpexpect.New(t, server.URL)
+
+	e.POST("/short").WithJSON(shortener.CreateShortRequest{URL: "login-paypal.example/signin"}).WithHeader("Content-Type", "application/json").
+		Expect().
+		Status(http.StatusBadRequest).
+		JSON().Object().Value("reason").String().Equal(shortener.ReasonBlocklisted)
+}
+
+func TestBlockedPage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(shortener.NewBlockedPageHandler()))
+	defer server.Close()
+	e := httpexpect.New(t, server.URL)
+
+	response := e.GET(shortener.BlockedPagePath).Expect().Status(http.StatusOK)
+	response.ContentType("text/html")
+	response.Body().Contains("This link has been blocked")
+}
@@ -0,0 +1,42 @@
+package shortener
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type clientIPContextKey struct{}
+
+// NewClientIPMiddleware works out the address of the client making each request once, trusting
+// X-Forwarded-For as far as it was written by trustedProxies, and stores it in the request context
+func NewClientIPMiddleware(trustedProxies []*net.IPNet) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := ContextWithClientIP(r.Context(), ClientIP(r, trustedProxies))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequestIP returns the client address stored by NewClientIPMiddleware, falling back to the
+// address of the peer when the middleware did not run
+func RequestIP(r *http.Request) string {
+	if ip := ClientIPFromContext(r.Context()); ip != "" {
+		return ip
+	}
+	return ClientIP(r, nil)
+}
+
+func ContextWithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPContextKey{}, ip)
+}
+
+// ClientIPFromContext returns the client address stored by NewClientIPMiddleware, or an empty
+// string when it did not run
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPContextKey{}).(string)
+	return ip
+}
@@ -3,22 +3,44 @@ package shortener
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq" // Postgres Driver
+	"github.com/lib/pq" // Postgres Driver
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
 )
 
 const (
-	InsertShortQuery = "INSERT INTO urls (%v) VALUES (%v)"
-	GetShortQuery    = "SELECT redirect_path, scheme, host, path, query, fragment FROM urls WHERE redirect_path=$1"
+	InsertShortQuery       = "INSERT INTO urls (%v) VALUES (%v)"
+	GetShortQuery          = "SELECT redirect_path, scheme, host, path, query, fragment, passthrough, template, forward_query, utm_source, utm_medium, utm_campaign, activate_at, timezone, created_by_key_id, owner_id, blocked_reason, disabled_at, password_hash FROM urls WHERE redirect_path=$1 AND workspace_id=$2 AND domain_id=$3"
+	InsertDestinationQuery = "INSERT INTO destinations (url_id, url, weight) VALUES ((SELECT id FROM urls WHERE redirect_path=$1 AND workspace_id=$2 AND domain_id=$3), $4, $5)"
+	GetDestinationsQuery   = "SELECT d.id, d.url, d.weight, d.clicks FROM destinations d JOIN urls u ON u.id = d.url_id WHERE u.redirect_path=$1 AND u.workspace_id=$2 AND u.domain_id=$3 ORDER BY d.id"
+	IncrementClicksQuery   = "UPDATE destinations SET clicks = clicks + 1 WHERE id=$1 AND url_id IN (SELECT id FROM urls WHERE workspace_id=$2)"
+	UpdateShortQuery       = "UPDATE urls SET scheme=$4, host=$5, path=$6, query=$7, fragment=$8 WHERE redirect_path=$1 AND workspace_id=$2 AND domain_id=$3"
+	DeleteShortQuery       = "DELETE FROM urls WHERE redirect_path=$1 AND workspace_id=$2 AND domain_id=$3"
+	InsertScheduleQuery    = "INSERT INTO schedules (url_id, url, starts_at, ends_at) VALUES ((SELECT id FROM urls WHERE redirect_path=$1 AND workspace_id=$2 AND domain_id=$3), $4, $5, $6)"
+	GetScheduleQuery       = "SELECT s.id, s.url, s.starts_at, s.ends_at FROM schedules s JOIN urls u ON u.id = s.url_id WHERE u.redirect_path=$1 AND u.workspace_id=$2 AND u.domain_id=$3 ORDER BY s.starts_at NULLS FIRST"
 )
 
+// ErrShortExists is returned when inserting a short whose redirect path is already taken on its domain
+var ErrShortExists = errors.New("short already exists")
+
+// uniqueViolation is the Postgres error code for a unique constraint violation
+const uniqueViolation = "23505"
+
+// ShortDAO stores shorts. Every method is scoped to a workspace, so one workspace can never
+// read or change the shorts of another, whatever the handlers do. Within a workspace, shorts are
+// keyed on their domain and redirect path, so the same path can lead elsewhere on another domain.
 type ShortDAO interface {
-	InsertShort(ctx context.Context, short Short) error
-	GetShort(ctx context.Context, redirect_path string) (*Short, error)
+	InsertShort(ctx context.Context, workspace int64, domain int64, short Short) error
+	GetShort(ctx context.Context, workspace int64, domain int64, redirect_path string) (*Short, error)
+	IncrementDestinationClicks(ctx context.Context, workspace int64, id int64) error
+	UpdateShort(ctx context.Context, workspace int64, domain int64, short Short) error
+	DeleteShort(ctx context.Context, workspace int64, domain int64, redirect_path string) error
 }
 
 func NewShortPostgresDao(db *sql.DB, driver string) *ShortPostgresDAO {
@@ -30,18 +52,55 @@ type ShortPostgresDAO struct {
 	driver string
 }
 
-func (s *ShortPostgresDAO) InsertShort(ctx context.Context, short Short) error {
+func (s *ShortPostgresDAO) InsertShort(ctx context.Context, workspace int64, domain int64, short Short) (err error) {
+	ctx, span := startSpan(ctx, "ShortDAO.InsertShort", shortAttributes(workspace, domain, short.RedirectPath)...)
+	defer func() { endSpan(span, err) }()
+
 	db := sqlx.NewDb(s.db, s.driver)
 
-	query := s.buildInsertQuery(short)
-	return executeTransaction(ctx, *db, query)
+	statements := []statement{s.buildInsertStatement(workspace, domain, short)}
+	for _, destination := range short.Destinations {
+		statements = append(statements, statement{
+			query: InsertDestinationQuery,
+			args:  []interface{}{short.RedirectPath, workspace, domain, destination.URL, destination.Weight},
+		})
+	}
+
+	for _, rule := range short.Schedule {
+		statements = append(statements, statement{
+			query: InsertScheduleQuery,
+			args:  []interface{}{short.RedirectPath, workspace, domain, rule.URL, rule.StartsAt, rule.EndsAt},
+		})
+	}
+
+	statements = append(statements, auditStatement(ctx, AuditInsertShortQuery, AuditInsert, short.RedirectPath, workspace, domain))
+
+	err = executeTransaction(ctx, *db, statements...)
+	if isUniqueViolation(err) {
+		return ErrShortExists
+	}
+
+	return err
 }
 
-func (s *ShortPostgresDAO) GetShort(ctx context.Context, redirect_path string) (*Short, error) {
+func (s *ShortPostgresDAO) GetShort(ctx context.Context, workspace int64, domain int64, redirect_path string) (_ *Short, err error) {
+	ctx, span := startSpan(ctx, "ShortDAO.GetShort", shortAttributes(workspace, domain, redirect_path)...)
+	defer func() { endSpan(span, err) }()
+
 	db := sqlx.NewDb(s.db, s.driver)
 
 	var short Short
-	err := db.GetContext(ctx, &short, GetShortQuery, redirect_path)
+	err = db.GetContext(ctx, &short, GetShortQuery, redirect_path, workspace, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.SelectContext(ctx, &short.Destinations, GetDestinationsQuery, redirect_path, workspace, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.SelectContext(ctx, &short.Schedule, GetScheduleQuery, redirect_path, workspace, domain)
 	if err != nil {
 		return nil, err
 	}
@@ -49,34 +108,127 @@ func (s *ShortPostgresDAO) GetShort(ctx context.Context, redirect_path string) (
 	return &short, nil
 }
 
-func (s *ShortPostgresDAO) buildInsertQuery(short Short) string {
-	columns := []string{"redirect_path", "scheme", "host"}
+func (s *ShortPostgresDAO) IncrementDestinationClicks(ctx context.Context, workspace int64, id int64) (err error) {
+	ctx, span := startSpan(ctx, "ShortDAO.IncrementDestinationClicks", WorkspaceAttribute.Int64(workspace), DestinationAttribute.Int64(id))
+	defer func() { endSpan(span, err) }()
 
-	values := []string{
-		addSingleQuotes(short.RedirectPath),
-		addSingleQuotes(short.Scheme),
-		addSingleQuotes(short.Host),
-	}
+	db := sqlx.NewDb(s.db, s.driver)
+
+	return executeTransaction(ctx, *db, statement{query: IncrementClicksQuery, args: []interface{}{id, workspace}})
+}
+
+// UpdateShort points an existing short at a new URL, returning sql.ErrNoRows if it does not exist
+func (s *ShortPostgresDAO) UpdateShort(ctx context.Context, workspace int64, domain int64, short Short) (err error) {
+	ctx, span := startSpan(ctx, "ShortDAO.UpdateShort", shortAttributes(workspace, domain, short.RedirectPath)...)
+	defer func() { endSpan(span, err) }()
+
+	db := sqlx.NewDb(s.db, s.driver)
+
+	args := []interface{}{short.RedirectPath, workspace, domain, short.Scheme, short.Host, short.Path, short.Query, short.Fragment}
+
+	return executeTransaction(ctx, *db,
+		auditStatement(ctx, AuditUpdateShortQuery, AuditUpdate, args...),
+		statement{query: UpdateShortQuery, args: args, mustAffectRows: true},
+	)
+}
+
+// DeleteShort removes a short along with its destinations and schedule, returning sql.ErrNoRows if it does not exist
+func (s *ShortPostgresDAO) DeleteShort(ctx context.Context, workspace int64, domain int64, redirect_path string) (err error) {
+	ctx, span := startSpan(ctx, "ShortDAO.DeleteShort", shortAttributes(workspace, domain, redirect_path)...)
+	defer func() { endSpan(span, err) }()
+
+	db := sqlx.NewDb(s.db, s.driver)
+
+	return executeTransaction(ctx, *db,
+		auditStatement(ctx, AuditDeleteShortQuery, AuditDelete, redirect_path, workspace, domain),
+		statement{query: DeleteShortQuery, args: []interface{}{redirect_path, workspace, domain}, mustAffectRows: true},
+	)
+}
+
+// buildInsertStatement inserts short with only the columns it sets, leaving the rest to their defaults
+func (s *ShortPostgresDAO) buildInsertStatement(workspace int64, domain int64, short Short) statement {
+	columns := []string{"workspace_id", "domain_id", "redirect_path", "scheme", "host"}
+	args := []interface{}{workspace, domain, short.RedirectPath, short.Scheme, short.Host}
 
 	if !isNilOrEmptyString(short.Path) {
 		columns = append(columns, "path")
-		values = append(values, addSingleQuotes(*short.Path))
+		args = append(args, *short.Path)
 	}
 
 	if !isNilOrEmptyString(short.Query) {
 		columns = append(columns, "query")
-		values = append(values, addSingleQuotes(*short.Query))
+		args = append(args, *short.Query)
 	}
 
 	if !isNilOrEmptyString(short.Fragment) {
 		columns = append(columns, "fragment")
-		values = append(values, addSingleQuotes(*short.Fragment))
+		args = append(args, *short.Fragment)
 	}
 
-	columnsString := strings.Join(columns, ", ")
-	valuesString := strings.Join(values, ", ")
+	if short.Passthrough {
+		columns = append(columns, "passthrough")
+		args = append(args, true)
+	}
+
+	if short.Template {
+		columns = append(columns, "template")
+		args = append(args, true)
+	}
+
+	if short.ForwardQuery {
+		columns = append(columns, "forward_query")
+		args = append(args, true)
+	}
+
+	if !isNilOrEmptyString(short.UTMSource) {
+		columns = append(columns, "utm_source")
+		args = append(args, *short.UTMSource)
+	}
+
+	if !isNilOrEmptyString(short.UTMMedium) {
+		columns = append(columns, "utm_medium")
+		args = append(args, *short.UTMMedium)
+	}
+
+	if !isNilOrEmptyString(short.UTMCampaign) {
+		columns = append(columns, "utm_campaign")
+		args = append(args, *short.UTMCampaign)
+	}
+
+	if short.ActivateAt != nil {
+		columns = append(columns, "activate_at")
+		args = append(args, short.ActivateAt.UTC())
+	}
+
+	if !isNilOrEmptyString(short.Timezone) {
+		columns = append(columns, "timezone")
+		args = append(args, *short.Timezone)
+	}
+
+	if short.CreatedByKeyID != nil {
+		columns = append(columns, "created_by_key_id")
+		args = append(args, *short.CreatedByKeyID)
+	}
+
+	if short.OwnerID != nil {
+		columns = append(columns, "owner_id")
+		args = append(args, *short.OwnerID)
+	}
+
+	if short.PasswordHash != nil {
+		columns = append(columns, "password_hash")
+		args = append(args, *short.PasswordHash)
+	}
+
+	placeholders := make([]string, len(args))
+	for i := range args {
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+	}
 
-	return fmt.Sprintf(InsertShortQuery, columnsString, valuesString)
+	return statement{
+		query: fmt.Sprintf(InsertShortQuery, strings.Join(columns, ", "), strings.Join(placeholders, ", ")),
+		args:  args,
+	}
 }
 
 func isNilOrEmptyString(text *string) bool {
@@ -91,28 +243,53 @@ func isNilOrEmptyString(text *string) bool {
 	return false
 }
 
-func addSingleQuotes(s string) string {
-	return "'" + s + "'"
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == uniqueViolation
+	}
+	return false
+}
+
+// statement is a single query and its arguments, executed as part of a transaction.
+// When mustAffectRows is set, the transaction is rolled back with sql.ErrNoRows if the statement changed nothing.
+type statement struct {
+	query          string
+	args           []interface{}
+	mustAffectRows bool
 }
 
-func executeTransaction(ctx context.Context, db sqlx.DB, query string, args ...interface{}) error {
-	var err error
+func executeTransaction(ctx context.Context, db sqlx.DB, statements ...statement) (err error) {
+	ctx, span := startSpan(ctx, "executeTransaction", semconv.DBSystemPostgreSQL, StatementsAttribute.Int(len(statements)))
+	defer func() { endSpan(span, err) }()
+
 	tx, err := db.Beginx()
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.ExecContext(
-		ctx,
-		query,
-		args...,
-	)
+	for _, stmt := range statements {
+		var result sql.Result
+		result, err = tx.ExecContext(
+			ctx,
+			stmt.query,
+			stmt.args...,
+		)
 
-	if err != nil {
-		if rollbackErr := tx.Rollback(); rollbackErr != nil {
-			err = multierror.Append(err, rollbackErr)
+		if err == nil && stmt.mustAffectRows {
+			var affected int64
+			affected, err = result.RowsAffected()
+			if err == nil && affected == 0 {
+				err = sql.ErrNoRows
+			}
+		}
+
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				err = multierror.Append(err, rollbackErr)
+			}
+			return err
 		}
-		return err
 	}
 
 	err = tx.Commit()
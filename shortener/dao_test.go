@@ -4,11 +4,16 @@ package shortener_test
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"l24.dev/shortener"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -16,18 +21,21 @@ func TestInsertShort(t *testing.T) {
 	type testCase struct {
 		Name          string
 		ExpectedQuery string
+		ExpectedArgs  []driver.Value
 		Scheme        string
 		Host          string
 		Path          string
 		Query         string
 		Fragment      string
+		Passthrough   bool
 		ShouldFail    bool
 	}
 
 	testCases := []testCase{
 		{
 			Name:          "Short with Path Only",
-			ExpectedQuery: "INSERT INTO urls (redirect_path, scheme, host, path) VALUES ('test', 'http', 'github.com', '/DATA-DOG/go-sqlmock')",
+			ExpectedQuery: "INSERT INTO urls (workspace_id, domain_id, redirect_path, scheme, host, path) VALUES ($1, $2, $3, $4, $5, $6)",
+			ExpectedArgs:  []driver.Value{1, 1, "test", "http", "github.com", "/DATA-DOG/go-sqlmock"},
 			Scheme:        "http",
 			Host:          "github.com",
 			Path:          "/DATA-DOG/go-sqlmock",
@@ -37,7 +45,8 @@ func TestInsertShort(t *testing.T) {
 		},
 		{
 			Name:          "Short with Query Only",
-			ExpectedQuery: "INSERT INTO urls (redirect_path, scheme, host, query) VALUES ('test', 'http', 'github.com', 'test=value')",
+			ExpectedQuery: "INSERT INTO urls (workspace_id, domain_id, redirect_path, scheme, host, query) VALUES ($1, $2, $3, $4, $5, $6)",
+			ExpectedArgs:  []driver.Value{1, 1, "test", "http", "github.com", "test=value"},
 			Scheme:        "http",
 			Host:          "github.com",
 			Path:          "",
@@ -47,7 +56,8 @@ func TestInsertShort(t *testing.T) {
 		},
 		{
 			Name:          "Short with Fragment Only",
-			ExpectedQuery: "INSERT INTO urls (redirect_path, scheme, host, fragment) VALUES ('test', 'http', 'github.com', 'info')",
+			ExpectedQuery: "INSERT INTO urls (workspace_id, domain_id, redirect_path, scheme, host, fragment) VALUES ($1, $2, $3, $4, $5, $6)",
+			ExpectedArgs:  []driver.Value{1, 1, "test", "http", "github.com", "info"},
 			Scheme:        "http",
 			Host:          "github.com",
 			Path:          "",
@@ -57,7 +67,8 @@ func TestInsertShort(t *testing.T) {
 		},
 		{
 			Name:          "Short with Path & Fragment",
-			ExpectedQuery: "INSERT INTO urls (redirect_path, scheme, host, path, fragment) VALUES ('test', 'http', 'github.com', '/soggycactus', 'info')",
+			ExpectedQuery: "INSERT INTO urls (workspace_id, domain_id, redirect_path, scheme, host, path, fragment) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+			ExpectedArgs:  []driver.Value{1, 1, "test", "http", "github.com", "/soggycactus", "info"},
 			Scheme:        "http",
 			Host:          "github.com",
 			Path:          "/soggycactus",
@@ -67,7 +78,8 @@ func TestInsertShort(t *testing.T) {
 		},
 		{
 			Name:          "Short with Query & Fragment",
-			ExpectedQuery: "INSERT INTO urls (redirect_path, scheme, host, query, fragment) VALUES ('test', 'http', 'github.com', 'test=value', 'info')",
+			ExpectedQuery: "INSERT INTO urls (workspace_id, domain_id, redirect_path, scheme, host, query, fragment) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+			ExpectedArgs:  []driver.Value{1, 1, "test", "http", "github.com", "test=value", "info"},
 			Scheme:        "http",
 			Host:          "github.com",
 			Path:          "",
@@ -77,7 +89,8 @@ func TestInsertShort(t *testing.T) {
 		},
 		{
 			Name:          "Short with Everything",
-			ExpectedQuery: "INSERT INTO urls (redirect_path, scheme, host, path, query, fragment) VALUES ('test', 'http', 'github.com', '/soggycactus', 'test=value', 'info')",
+			ExpectedQuery: "INSERT INTO urls (workspace_id, domain_id, redirect_path, scheme, host, path, query, fragment) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+			ExpectedArgs:  []driver.Value{1, 1, "test", "http", "github.com", "/soggycactus", "test=value", "info"},
 			Scheme:        "http",
 			Host:          "github.com",
 			Path:          "/soggycactus",
@@ -85,9 +98,29 @@ func TestInsertShort(t *testing.T) {
 			Fragment:      "info",
 			ShouldFail:    false,
 		},
+		{
+			Name:          "Short with Quote in Path",
+			ExpectedQuery: "INSERT INTO urls (workspace_id, domain_id, redirect_path, scheme, host, path) VALUES ($1, $2, $3, $4, $5, $6)",
+			ExpectedArgs:  []driver.Value{1, 1, "test", "http", "github.com", "/o'reilly'); DROP TABLE urls; --"},
+			Scheme:        "http",
+			Host:          "github.com",
+			Path:          "/o'reilly'); DROP TABLE urls; --",
+			ShouldFail:    false,
+		},
+		{
+			Name:          "Short with Passthrough",
+			ExpectedQuery: "INSERT INTO urls (workspace_id, domain_id, redirect_path, scheme, host, path, passthrough) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+			ExpectedArgs:  []driver.Value{1, 1, "test", "http", "github.com", "/soggycactus", true},
+			Scheme:        "http",
+			Host:          "github.com",
+			Path:          "/soggycactus",
+			Passthrough:   true,
+			ShouldFail:    false,
+		},
 		{
 			Name:          "Short with Nothing",
-			ExpectedQuery: "INSERT INTO urls (redirect_path, scheme, host) VALUES ('test', 'http', 'github.com')",
+			ExpectedQuery: "INSERT INTO urls (workspace_id, domain_id, redirect_path, scheme, host) VALUES ($1, $2, $3, $4, $5)",
+			ExpectedArgs:  []driver.Value{1, 1, "test", "http", "github.com"},
 			Scheme:        "http",
 			Host:          "github.com",
 			Path:          "",
@@ -112,15 +145,20 @@ func TestInsertShort(t *testing.T) {
 				Path:         &test.Path,
 				Query:        &test.Query,
 				Fragment:     &test.Fragment,
+				Passthrough:  test.Passthrough,
 			}
 
 			mock.ExpectBegin()
 			mock.ExpectExec(regexp.QuoteMeta(test.ExpectedQuery)).
+				WithArgs(test.ExpectedArgs...).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectExec(regexp.QuoteMeta(shortener.AuditInsertShortQuery)).
+				WithArgs(shortener.AuditInsert, "system", nil, nil, "test", 1, 1).
 				WillReturnResult(sqlmock.NewResult(1, 1))
 			mock.ExpectCommit()
 
 			dao := shortener.NewShortPostgresDao(db, "postgres")
-			err = dao.InsertShort(context.Background(), short)
+			err = dao.InsertShort(context.Background(), shortener.DefaultWorkspaceID, shortener.DefaultDomainID, short)
 			if err != nil {
 				t.Logf("failed to insert: %v", err)
 			}
@@ -130,3 +168,262 @@ func TestInsertShort(t *testing.T) {
 		})
 	}
 }
+
+func TestInsertShortWithDestinations(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	short := shortener.Short{
+		RedirectPath: "test",
+		Scheme:       "http",
+		Host:         "github.com",
+		Destinations: []shortener.Destination{
+			{URL: "http://a.com", Weight: 80},
+			{URL: "http://b.com", Weight: 20},
+		},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO urls (workspace_id, domain_id, redirect_path, scheme, host) VALUES ($1, $2, $3, $4, $5)")).
+		WithArgs(1, 1, "test", "http", "github.com").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(shortener.InsertDestinationQuery)).
+		WithArgs("test", shortener.DefaultWorkspaceID, shortener.DefaultDomainID, "http://a.com", 80).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(shortener.InsertDestinationQuery)).
+		WithArgs("test", shortener.DefaultWorkspaceID, shortener.DefaultDomainID, "http://b.com", 20).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec(regexp.QuoteMeta(shortener.AuditInsertShortQuery)).
+		WithArgs(shortener.AuditInsert, "system", nil, nil, "test", 1, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	dao := shortener.NewShortPostgresDao(db, "postgres")
+	err = dao.InsertShort(context.Background(), shortener.DefaultWorkspaceID, shortener.DefaultDomainID, short)
+
+	assert.Nil(t, err, "insert should succeed")
+	assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+}
+
+func TestInsertShortWithDestinationsRollsBack(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	short := shortener.Short{
+		RedirectPath: "test",
+		Scheme:       "http",
+		Host:         "github.com",
+		Destinations: []shortener.Destination{{URL: "http://a.com", Weight: 0}},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO urls (workspace_id, domain_id, redirect_path, scheme, host) VALUES ($1, $2, $3, $4, $5)")).
+		WithArgs(1, 1, "test", "http", "github.com").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(shortener.InsertDestinationQuery)).
+		WillReturnError(errors.New("check constraint violated"))
+	mock.ExpectRollback()
+
+	dao := shortener.NewShortPostgresDao(db, "postgres")
+	err = dao.InsertShort(context.Background(), shortener.DefaultWorkspaceID, shortener.DefaultDomainID, short)
+
+	assert.NotNil(t, err, "insert should fail")
+	assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+}
+
+func TestGetShortWithDestinations(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(shortener.GetShortQuery)).
+		WithArgs("test", shortener.DefaultWorkspaceID, shortener.DefaultDomainID).
+		WillReturnRows(sqlmock.NewRows([]string{"redirect_path", "scheme", "host", "path", "query", "fragment"}).
+			AddRow("test", "http", "github.com", nil, nil, nil))
+	mock.ExpectQuery(regexp.QuoteMeta(shortener.GetDestinationsQuery)).
+		WithArgs("test", shortener.DefaultWorkspaceID, shortener.DefaultDomainID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "url", "weight", "clicks"}).
+			AddRow(1, "http://a.com", 80, 12).
+			AddRow(2, "http://b.com", 20, 3))
+	mock.ExpectQuery(regexp.QuoteMeta(shortener.GetScheduleQuery)).
+		WithArgs("test", shortener.DefaultWorkspaceID, shortener.DefaultDomainID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "url", "starts_at", "ends_at"}))
+
+	dao := shortener.NewShortPostgresDao(db, "postgres")
+	short, err := dao.GetShort(context.Background(), shortener.DefaultWorkspaceID, shortener.DefaultDomainID, "test")
+
+	assert.Nil(t, err, "get should succeed")
+	assert.Len(t, short.Destinations, 2, "destinations should be loaded")
+	assert.Equal(t, int64(12), short.Destinations[0].Clicks, "clicks should be loaded")
+	assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+}
+
+func TestInsertScheduledShort(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	newYork := "America/New_York"
+	launch := time.Date(2021, 11, 1, 9, 0, 0, 0, time.FixedZone("EDT", -4*60*60))
+	short := shortener.Short{
+		RedirectPath: "test",
+		Scheme:       "http",
+		Host:         "github.com",
+		ActivateAt:   &launch,
+		Timezone:     &newYork,
+		Schedule:     []shortener.ScheduleRule{{URL: "http://soon.com", EndsAt: &launch}},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO urls (workspace_id, domain_id, redirect_path, scheme, host, activate_at, timezone) VALUES ($1, $2, $3, $4, $5, $6, $7)")).
+		WithArgs(1, 1, "test", "http", "github.com", launch.UTC(), "America/New_York").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(shortener.InsertScheduleQuery)).
+		WithArgs("test", shortener.DefaultWorkspaceID, shortener.DefaultDomainID, "http://soon.com", nil, &launch).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(shortener.AuditInsertShortQuery)).
+		WithArgs(shortener.AuditInsert, "system", nil, nil, "test", 1, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	dao := shortener.NewShortPostgresDao(db, "postgres")
+	err = dao.InsertShort(context.Background(), shortener.DefaultWorkspaceID, shortener.DefaultDomainID, short)
+
+	assert.Nil(t, err, "insert should succeed")
+	assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+}
+
+func TestInsertShortWithQueryForwarding(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	source, campaign := "twitter", "spring sale"
+	short := shortener.Short{
+		RedirectPath: "test",
+		Scheme:       "http",
+		Host:         "github.com",
+		ForwardQuery: true,
+		UTMSource:    &source,
+		UTMCampaign:  &campaign,
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO urls (workspace_id, domain_id, redirect_path, scheme, host, forward_query, utm_source, utm_campaign) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)")).
+		WithArgs(1, 1, "test", "http", "github.com", true, "twitter", "spring sale").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(shortener.AuditInsertShortQuery)).
+		WithArgs(shortener.AuditInsert, "system", nil, nil, "test", 1, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	dao := shortener.NewShortPostgresDao(db, "postgres")
+	err = dao.InsertShort(context.Background(), shortener.DefaultWorkspaceID, shortener.DefaultDomainID, short)
+
+	assert.Nil(t, err, "insert should succeed")
+	assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+}
+
+func TestInsertShortAlreadyExists(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO urls (workspace_id, domain_id, redirect_path, scheme, host) VALUES ($1, $2, $3, $4, $5)")).
+		WithArgs(1, 1, "docs", "http", "github.com").
+		WillReturnError(&pq.Error{Code: "23505"})
+	mock.ExpectRollback()
+
+	dao := shortener.NewShortPostgresDao(db, "postgres")
+	err = dao.InsertShort(context.Background(), shortener.DefaultWorkspaceID, shortener.DefaultDomainID, shortener.Short{RedirectPath: "docs", Scheme: "http", Host: "github.com"})
+
+	assert.Equal(t, shortener.ErrShortExists, err, "duplicate redirect path should be reported")
+	assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+}
+
+func TestUpdateShort(t *testing.T) {
+	type testCase struct {
+		Name         string
+		RowsAffected int64
+		ExpectedErr  error
+	}
+
+	testCases := []testCase{
+		{Name: "Updated", RowsAffected: 1, ExpectedErr: nil},
+		{Name: "Not Found", RowsAffected: 0, ExpectedErr: sql.ErrNoRows},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			path := "/soggycactus"
+			short := shortener.Short{RedirectPath: "test", Scheme: "https", Host: "github.com", Path: &path}
+
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta(shortener.AuditUpdateShortQuery)).
+				WithArgs(shortener.AuditUpdate, "system", nil, nil, "test", shortener.DefaultWorkspaceID, shortener.DefaultDomainID, "https", "github.com", &path, nil, nil).
+				WillReturnResult(sqlmock.NewResult(0, test.RowsAffected))
+			mock.ExpectExec(regexp.QuoteMeta(shortener.UpdateShortQuery)).
+				WithArgs("test", shortener.DefaultWorkspaceID, shortener.DefaultDomainID, "https", "github.com", &path, nil, nil).
+				WillReturnResult(sqlmock.NewResult(0, test.RowsAffected))
+			if test.ExpectedErr == nil {
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			dao := shortener.NewShortPostgresDao(db, "postgres")
+			err = dao.UpdateShort(context.Background(), shortener.DefaultWorkspaceID, shortener.DefaultDomainID, short)
+
+			assert.Equal(t, test.ExpectedErr, err, "error should match")
+			assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+		})
+	}
+}
+
+func TestDeleteShort(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(shortener.AuditDeleteShortQuery)).
+		WithArgs(shortener.AuditDelete, "user ada@example.com", "203.0.113.7", "req-1", "test", shortener.DefaultWorkspaceID, shortener.DefaultDomainID).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(shortener.DeleteShortQuery)).
+		WithArgs("test", shortener.DefaultWorkspaceID, shortener.DefaultDomainID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	ctx := shortener.ContextWithPrincipal(context.Background(), &shortener.Principal{User: &shortener.User{Email: "ada@example.com"}})
+	ctx = shortener.ContextWithClientIP(ctx, "203.0.113.7")
+	ctx = shortener.ContextWithRequestID(ctx, "req-1")
+
+	dao := shortener.NewShortPostgresDao(db, "postgres")
+	err = dao.DeleteShort(ctx, shortener.DefaultWorkspaceID, shortener.DefaultDomainID, "test")
+
+	assert.Nil(t, err, "delete should succeed")
+	assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+}
@@ -0,0 +1,142 @@
+package shortener
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	MinDestinations      = 2
+	MaxDestinations      = 10
+	MaxDestinationWeight = 1000
+
+	VariantCookiePrefix = "l24_variant_"
+	VariantCookieMaxAge = 30 * 24 * time.Hour
+)
+
+// Destination is one weighted variant of a split short
+type Destination struct {
+	ID     int64  `json:"id,omitempty" db:"id"`
+	URL    string `json:"url" db:"url"`
+	Weight int    `json:"weight" db:"weight"`
+	Clicks int64  `json:"clicks" db:"clicks"`
+}
+
+// ValidateDestinations checks that a set of variants can be used to split traffic
+func ValidateDestinations(destinations []Destination) error {
+	if len(destinations) < MinDestinations {
+		return fmt.Errorf("a split short needs at least %d destinations, got %d", MinDestinations, len(destinations))
+	}
+
+	if len(destinations) > MaxDestinations {
+		return fmt.Errorf("a split short can have at most %d destinations, got %d", MaxDestinations, len(destinations))
+	}
+
+	for i, destination := range destinations {
+		if destination.Weight < 1 || destination.Weight > MaxDestinationWeight {
+			return fmt.Errorf("destination %d has weight %d, must be between 1 and %d", i, destination.Weight, MaxDestinationWeight)
+		}
+	}
+
+	return nil
+}
+
+func applyDestinationsRequest(short *Short, request CreateShortRequest) error {
+	if len(request.Destinations) == 0 {
+		return nil
+	}
+
+	for _, destination := range request.Destinations {
+		URL, err := ParseDestinationURL(destination.URL)
+		if err != nil {
+			return err
+		}
+		short.Destinations = append(short.Destinations, Destination{URL: URL.String(), Weight: destination.Weight})
+	}
+
+	return ValidateDestinations(short.Destinations)
+}
+
+// TotalWeight sums the weights of all destinations
+func TotalWeight(destinations []Destination) int {
+	total := 0
+	for _, destination := range destinations {
+		total += destination.Weight
+	}
+	return total
+}
+
+// PickDestination maps n, a number in [0, TotalWeight), onto the destination owning that slice of the weight range
+func PickDestination(destinations []Destination, n int) *Destination {
+	for i := range destinations {
+		if n < destinations[i].Weight {
+			return &destinations[i]
+		}
+		n -= destinations[i].Weight
+	}
+	return nil
+}
+
+// ChooseDestination returns the visitor's sticky variant if their cookie still points at one,
+// otherwise it draws a new variant by weight. The boolean reports whether the draw was fresh.
+func ChooseDestination(r *http.Request, short *Short) (*Destination, bool, error) {
+	if cookie, err := r.Cookie(variantCookieName(r, short)); err == nil {
+		if id, err := strconv.ParseInt(cookie.Value, 10, 64); err == nil {
+			for i := range short.Destinations {
+				if short.Destinations[i].ID == id {
+					return &short.Destinations[i], false, nil
+				}
+			}
+		}
+	}
+
+	total := TotalWeight(short.Destinations)
+	if total <= 0 {
+		return nil, false, fmt.Errorf("short %s has no weighted destinations", short.RedirectPath)
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(total)))
+	if err != nil {
+		return nil, false, err
+	}
+
+	return PickDestination(short.Destinations, int(n.Int64())), true, nil
+}
+
+// VariantCookieName names the variant cookie of a short, which is unique across workspaces and domains
+func VariantCookieName(workspace int64, domain int64, redirectPath string) string {
+	return fmt.Sprintf("%s%d_%d_%s", VariantCookiePrefix, workspace, domain, redirectPath)
+}
+
+func variantCookieName(r *http.Request, short *Short) string {
+	return VariantCookieName(workspaceID(r.Context()), domainID(r.Context()), short.RedirectPath)
+}
+
+// NewVariantCookie pins a visitor to a destination of a split short. The cookie is scoped to the path
+// the short was requested on, so it is sent back whether or not the short is in a workspace.
+func NewVariantCookie(r *http.Request, short *Short, destination *Destination) *http.Cookie {
+	return &http.Cookie{
+		Name:     variantCookieName(r, short),
+		Value:    strconv.FormatInt(destination.ID, 10),
+		Path:     shortPath(r),
+		MaxAge:   int(VariantCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// shortPath is the path of the short a request is for, without any suffix passed through
+func shortPath(r *http.Request) string {
+	path := r.URL.Path
+	if rest := mux.Vars(r)["rest"]; rest != "" {
+		path = strings.TrimSuffix(path, "/"+rest)
+	}
+	return path
+}
@@ -0,0 +1,101 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"l24.dev/shortener"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateDestinations(t *testing.T) {
+	type testCase struct {
+		Name         string
+		Destinations []shortener.Destination
+		ShouldFail   bool
+	}
+
+	testCases := []testCase{
+		{
+			Name:         "Two Destinations",
+			Destinations: []shortener.Destination{{URL: "http://a.com", Weight: 50}, {URL: "http://b.com", Weight: 50}},
+			ShouldFail:   false,
+		},
+		{
+			Name:         "Single Destination",
+			Destinations: []shortener.Destination{{URL: "http://a.com", Weight: 50}},
+			ShouldFail:   true,
+		},
+		{
+			Name:         "Zero Weight",
+			Destinations: []shortener.Destination{{URL: "http://a.com", Weight: 0}, {URL: "http://b.com", Weight: 50}},
+			ShouldFail:   true,
+		},
+		{
+			Name:         "Negative Weight",
+			Destinations: []shortener.Destination{{URL: "http://a.com", Weight: -1}, {URL: "http://b.com", Weight: 50}},
+			ShouldFail:   true,
+		},
+		{
+			Name:         "Weight Too Large",
+			Destinations: []shortener.Destination{{URL: "http://a.com", Weight: shortener.MaxDestinationWeight + 1}, {URL: "http://b.com", Weight: 1}},
+			ShouldFail:   true,
+		},
+		{
+			Name:         "Too Many Destinations",
+			Destinations: make([]shortener.Destination, shortener.MaxDestinations+1),
+			ShouldFail:   true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			err := shortener.ValidateDestinations(test.Destinations)
+			assert.Equal(t, test.ShouldFail, err != nil, "ShouldFail is %v, got %v", test.ShouldFail, err)
+		})
+	}
+}
+
+func TestPickDestination(t *testing.T) {
+	destinations := []shortener.Destination{
+		{ID: 1, URL: "http://a.com", Weight: 1},
+		{ID: 2, URL: "http://b.com", Weight: 3},
+	}
+
+	assert.Equal(t, 4, shortener.TotalWeight(destinations), "total weight should match")
+	assert.Equal(t, int64(1), shortener.PickDestination(destinations, 0).ID, "first slice should belong to a")
+	assert.Equal(t, int64(2), shortener.PickDestination(destinations, 1).ID, "second slice should belong to b")
+	assert.Equal(t, int64(2), shortener.PickDestination(destinations, 3).ID, "last slice should belong to b")
+	assert.Nil(t, shortener.PickDestination(destinations, 4), "out of range should pick nothing")
+}
+
+func TestChooseDestinationIsSticky(t *testing.T) {
+	short := &shortener.Short{
+		RedirectPath: "c3xd4d",
+		Destinations: []shortener.Destination{
+			{ID: 1, URL: "http://a.com", Weight: 1},
+			{ID: 2, URL: "http://b.com", Weight: 1},
+		},
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/c3xd4d", nil)
+	request.AddCookie(&http.Cookie{Name: shortener.VariantCookieName(shortener.DefaultWorkspaceID, shortener.DefaultDomainID, "c3xd4d"), Value: "2"})
+
+	for i := 0; i < 20; i++ {
+		destination, fresh, err := shortener.ChooseDestination(request, short)
+		assert.Nil(t, err, "choosing should not fail")
+		assert.False(t, fresh, "cookie should be reused")
+		assert.Equal(t, int64(2), destination.ID, "cookie variant should be chosen")
+	}
+
+	stale := httptest.NewRequest(http.MethodGet, "/c3xd4d", nil)
+	stale.AddCookie(&http.Cookie{Name: shortener.VariantCookieName(shortener.DefaultWorkspaceID, shortener.DefaultDomainID, "c3xd4d"), Value: "99"})
+
+	destination, fresh, err := shortener.ChooseDestination(stale, short)
+	assert.Nil(t, err, "choosing should not fail")
+	assert.True(t, fresh, "stale cookie should cause a new draw")
+	assert.NotNil(t, destination, "a destination should be drawn")
+}
@@ -0,0 +1,139 @@
+package shortener
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// DefaultDomainID is the domain serving every host that was not registered, which is where
+	// shorts live unless they are created on a registered domain
+	DefaultDomainID   int64 = 1
+	DefaultDomainHost       = "default"
+)
+
+const domainContextKey contextKey = "domain"
+
+var (
+	// ErrDomainExists is returned when registering a host that is already registered
+	ErrDomainExists = errors.New("domain already exists")
+	// ErrDomainInUse is returned when removing a domain that still has shorts
+	ErrDomainInUse = errors.New("domain still has shorts")
+)
+
+var domainLabelPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Domain is a host shorts are served from, like a brand's own short domain
+type Domain struct {
+	ID        int64     `json:"id" db:"id"`
+	Host      string    `json:"host" db:"host"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// NormalizeHost turns the Host header of a request into the host of a domain, dropping the port
+// and any trailing dot, and lowercasing it
+func NormalizeHost(host string) string {
+	host = (&url.URL{Host: host}).Hostname()
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// ValidateDomainHost checks that host is a fully qualified domain name, without a scheme or port,
+// that can be registered as a domain
+func ValidateDomainHost(host string) error {
+	if host != NormalizeHost(host) || host == "" {
+		return fmt.Errorf("domain %q must be a lowercase host name without a scheme, port or trailing dot", host)
+	}
+
+	if net.ParseIP(host) != nil {
+		return fmt.Errorf("domain %q must be a host name, not an IP address", host)
+	}
+
+	labels := strings.Split(host, ".")
+	if len(labels) < 2 || len(host) > 253 {
+		return fmt.Errorf("domain %q must be a fully qualified domain name of at most 253 characters", host)
+	}
+
+	for _, label := range labels {
+		if !domainLabelPattern.MatchString(label) {
+			return fmt.Errorf("domain %q has an invalid label %q", host, label)
+		}
+	}
+
+	return nil
+}
+
+// ContextWithDomain returns a copy of ctx addressing domain
+func ContextWithDomain(ctx context.Context, domain *Domain) context.Context {
+	return context.WithValue(ctx, domainContextKey, domain)
+}
+
+// DomainFromContext returns the domain a request addresses, or nil for the default domain
+func DomainFromContext(ctx context.Context) *Domain {
+	domain, _ := ctx.Value(domainContextKey).(*Domain)
+	return domain
+}
+
+// domainID returns the ID of the domain a request addresses
+func domainID(ctx context.Context) int64 {
+	if domain := DomainFromContext(ctx); domain != nil {
+		return domain.ID
+	}
+	return DefaultDomainID
+}
+
+// NewDomainResolver returns middleware loading the registered domain named by the Host header of
+// the request. Requests to any other host address the default domain.
+func NewDomainResolver(dao DomainDAO) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := NormalizeHost(r.Host)
+
+			domain, err := dao.GetDomainByHost(r.Context(), host)
+			if err == sql.ErrNoRows || (err == nil && domain.ID == DefaultDomainID) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err != nil {
+				slog.ErrorContext(r.Context(), "failed to get domain", "host", host, "error", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(ContextWithDomain(r.Context(), domain)))
+		})
+	}
+}
+
+// ShortURL is the full URL short is served at from the domain and workspace the request addresses.
+// Registered domains are served over HTTPS. The default domain is served from baseURL, or from the
+// scheme and host of the request when there is none.
+func ShortURL(r *http.Request, baseURL *url.URL, short *Short) string {
+	var base string
+	switch domain := DomainFromContext(r.Context()); {
+	case domain != nil:
+		base = "https://" + domain.Host
+	case baseURL != nil:
+		base = strings.TrimSuffix(baseURL.String(), "/")
+	case r.TLS != nil:
+		base = "https://" + r.Host
+	default:
+		base = "http://" + r.Host
+	}
+
+	if workspace := WorkspaceFromContext(r.Context()); workspace != nil && workspace.ID != DefaultWorkspaceID {
+		base += "/w/" + workspace.Slug
+	}
+
+	return base + "/" + url.PathEscape(short.RedirectPath)
+}
@@ -0,0 +1,212 @@
+package shortener
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDomainMissTTL is how long a host is remembered as unregistered, and so how long a domain
+	// registered through another replica can take to be served by this one
+	DefaultDomainMissTTL = time.Minute
+	// DefaultDomainReloadInterval is how often the cache catches up with domains removed through other replicas
+	DefaultDomainReloadInterval = 5 * time.Minute
+
+	// maxDomainMisses bounds how many unregistered hosts are remembered, as anyone can make up a Host header
+	maxDomainMisses = 10000
+)
+
+// DomainCacheOption customises a DomainCache
+type DomainCacheOption func(*DomainCache)
+
+// WithDomainCacheClock replaces the wall clock used to expire unregistered hosts
+func WithDomainCacheClock(clock Clock) DomainCacheOption {
+	return func(c *DomainCache) {
+		c.clock = clock
+	}
+}
+
+// WithDomainMissTTL sets how long a host is remembered as unregistered
+func WithDomainMissTTL(ttl time.Duration) DomainCacheOption {
+	return func(c *DomainCache) {
+		c.missTTL = ttl
+	}
+}
+
+// WithDomainCacheMetrics counts the lookups the cache answers and the ones it passes to the database
+func WithDomainCacheMetrics(metrics *Metrics) DomainCacheOption {
+	return func(c *DomainCache) {
+		c.metrics = metrics
+	}
+}
+
+// DomainCache is a DomainDAO keeping the registered domains in memory, so resolving the domain of a
+// request does not cost a database round trip. Domains registered or removed through it are cached
+// straight away. Hosts it does not know are looked up in the database and, when they are not
+// registered, remembered as such for a while.
+type DomainCache struct {
+	dao     DomainDAO
+	clock   Clock
+	missTTL time.Duration
+	metrics *Metrics
+
+	mu       sync.RWMutex
+	domains  map[string]Domain
+	misses   map[string]time.Time
+	loadedAt time.Time
+	loadErr  error
+}
+
+// DomainCacheStatus describes the domains currently cached and how the last load went
+type DomainCacheStatus struct {
+	Domains  int       `json:"domains"`
+	LoadedAt time.Time `json:"loaded_at"`
+	Error    string    `json:"error,omitempty"`
+}
+
+func NewDomainCache(dao DomainDAO, opts ...DomainCacheOption) *DomainCache {
+	cache := &DomainCache{
+		dao:     dao,
+		clock:   SystemClock{},
+		missTTL: DefaultDomainMissTTL,
+		domains: map[string]Domain{},
+		misses:  map[string]time.Time{},
+	}
+	for _, opt := range opts {
+		opt(cache)
+	}
+	return cache
+}
+
+// Load replaces the cached domains with every registered domain
+func (c *DomainCache) Load(ctx context.Context) error {
+	domains, err := c.dao.ListDomains(ctx)
+	if err != nil {
+		c.mu.Lock()
+		c.loadErr = err
+		c.mu.Unlock()
+
+		return err
+	}
+
+	loaded := make(map[string]Domain, len(domains))
+	for _, domain := range domains {
+		loaded[domain.Host] = domain
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.domains = loaded
+	c.misses = map[string]time.Time{}
+	c.loadedAt = c.clock.Now()
+	c.loadErr = nil
+	return nil
+}
+
+// Status reports the domains currently cached, and the error of the last load if it failed
+func (c *DomainCache) Status() DomainCacheStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	status := DomainCacheStatus{Domains: len(c.domains), LoadedAt: c.loadedAt}
+	if c.loadErr != nil {
+		status.Error = c.loadErr.Error()
+	}
+	return status
+}
+
+// Run reloads the cache every interval until ctx is done
+func (c *DomainCache) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := c.Load(ctx); err != nil {
+			slog.ErrorContext(ctx, "keeping previous domains", "error", err)
+		}
+	}
+}
+
+func (c *DomainCache) InsertDomain(ctx context.Context, domain *Domain) error {
+	err := c.dao.InsertDomain(ctx, domain)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.domains[domain.Host] = *domain
+	delete(c.misses, domain.Host)
+	return nil
+}
+
+// GetDomainByHost returns the cached domain for host, only asking the database about hosts it has
+// not seen lately
+func (c *DomainCache) GetDomainByHost(ctx context.Context, host string) (*Domain, error) {
+	now := c.clock.Now()
+
+	c.mu.RLock()
+	domain, found := c.domains[host]
+	missedUntil, missed := c.misses[host]
+	c.mu.RUnlock()
+
+	if found {
+		c.metrics.domainCacheHit()
+		return &domain, nil
+	}
+	if missed && now.Before(missedUntil) {
+		c.metrics.domainCacheHit()
+		return nil, sql.ErrNoRows
+	}
+
+	c.metrics.domainCacheMiss()
+	loaded, err := c.dao.GetDomainByHost(ctx, host)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case err == nil:
+		c.domains[host] = *loaded
+		delete(c.misses, host)
+	case err == sql.ErrNoRows:
+		if len(c.misses) >= maxDomainMisses {
+			c.misses = map[string]time.Time{}
+		}
+		c.misses[host] = now.Add(c.missTTL)
+	}
+
+	return loaded, err
+}
+
+func (c *DomainCache) ListDomains(ctx context.Context) ([]Domain, error) {
+	return c.dao.ListDomains(ctx)
+}
+
+func (c *DomainCache) DeleteDomain(ctx context.Context, id int64) error {
+	err := c.dao.DeleteDomain(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for host, domain := range c.domains {
+		if domain.ID == id {
+			delete(c.domains, host)
+		}
+	}
+	return nil
+}
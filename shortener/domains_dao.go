@@ -0,0 +1,95 @@
+package shortener
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq" // Postgres Driver
+)
+
+const (
+	InsertDomainQuery    = "INSERT INTO domains (host) VALUES ($1) RETURNING id, created_at"
+	GetDomainByHostQuery = "SELECT id, host, created_at FROM domains WHERE host=$1"
+	ListDomainsQuery     = "SELECT id, host, created_at FROM domains WHERE id <> 1 ORDER BY host"
+	DeleteDomainQuery    = "DELETE FROM domains WHERE id=$1 AND id <> 1"
+)
+
+// foreignKeyViolation is the Postgres error code for a row still referenced by another table
+const foreignKeyViolation = "23503"
+
+// DomainDAO stores the registered domains. The default domain is never listed nor removed.
+type DomainDAO interface {
+	InsertDomain(ctx context.Context, domain *Domain) error
+	GetDomainByHost(ctx context.Context, host string) (*Domain, error)
+	ListDomains(ctx context.Context) ([]Domain, error)
+	DeleteDomain(ctx context.Context, id int64) error
+}
+
+func NewDomainPostgresDao(db *sql.DB, driver string) *DomainPostgresDAO {
+	return &DomainPostgresDAO{db: db, driver: driver}
+}
+
+type DomainPostgresDAO struct {
+	db     *sql.DB
+	driver string
+}
+
+// InsertDomain registers domain, filling in its ID and creation time. It returns ErrDomainExists if
+// the host is already registered.
+func (s *DomainPostgresDAO) InsertDomain(ctx context.Context, domain *Domain) error {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	err := db.QueryRowxContext(ctx, InsertDomainQuery, domain.Host).Scan(&domain.ID, &domain.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrDomainExists
+	}
+
+	return err
+}
+
+func (s *DomainPostgresDAO) GetDomainByHost(ctx context.Context, host string) (*Domain, error) {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	var domain Domain
+	err := db.GetContext(ctx, &domain, GetDomainByHostQuery, host)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain, nil
+}
+
+func (s *DomainPostgresDAO) ListDomains(ctx context.Context) ([]Domain, error) {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	domains := []Domain{}
+	err := db.SelectContext(ctx, &domains, ListDomainsQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	return domains, nil
+}
+
+// DeleteDomain removes a registered domain, returning sql.ErrNoRows if there is none with that ID
+// and ErrDomainInUse if shorts still live on it
+func (s *DomainPostgresDAO) DeleteDomain(ctx context.Context, id int64) error {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	err := executeTransaction(ctx, *db, statement{query: DeleteDomainQuery, args: []interface{}{id}, mustAffectRows: true})
+	if isForeignKeyViolation(err) {
+		return ErrDomainInUse
+	}
+
+	return err
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == foreignKeyViolation
+	}
+	return false
+}
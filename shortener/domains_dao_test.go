@@ -0,0 +1,107 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"context"
+	"database/sql"
+	"l24.dev/shortener"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInsertDomain(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	createdAt := time.Date(2021, 12, 27, 9, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta(shortener.InsertDomainQuery)).
+		WithArgs("go.acme.example").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(2, createdAt))
+	mock.ExpectQuery(regexp.QuoteMeta(shortener.InsertDomainQuery)).
+		WithArgs("go.acme.example").
+		WillReturnError(&pq.Error{Code: "23505"})
+
+	dao := shortener.NewDomainPostgresDao(db, "postgres")
+
+	domain := &shortener.Domain{Host: "go.acme.example"}
+	err = dao.InsertDomain(context.Background(), domain)
+	assert.Nil(t, err, "insert should succeed")
+	assert.Equal(t, int64(2), domain.ID, "id should be filled in")
+	assert.Equal(t, createdAt, domain.CreatedAt, "creation time should be filled in")
+
+	err = dao.InsertDomain(context.Background(), &shortener.Domain{Host: "go.acme.example"})
+	assert.Equal(t, shortener.ErrDomainExists, err, "a registered host should be reported")
+
+	assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+}
+
+func TestDeleteDomain(t *testing.T) {
+	type testCase struct {
+		Name        string
+		Result      sql.Result
+		Error       error
+		ExpectedErr error
+	}
+
+	testCases := []testCase{
+		{Name: "Deleted", Result: sqlmock.NewResult(0, 1), ExpectedErr: nil},
+		{Name: "Not Found", Result: sqlmock.NewResult(0, 0), ExpectedErr: sql.ErrNoRows},
+		{Name: "Still Has Shorts", Error: &pq.Error{Code: "23503"}, ExpectedErr: shortener.ErrDomainInUse},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			exec := mock.ExpectExec(regexp.QuoteMeta(shortener.DeleteDomainQuery)).WithArgs(2)
+			if test.Error != nil {
+				exec.WillReturnError(test.Error)
+			} else {
+				exec.WillReturnResult(test.Result)
+			}
+			if test.ExpectedErr == nil {
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			dao := shortener.NewDomainPostgresDao(db, "postgres")
+			err = dao.DeleteDomain(context.Background(), 2)
+
+			assert.Equal(t, test.ExpectedErr, err, "error should match")
+			assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+		})
+	}
+}
+
+func TestShortQueriesAreScopedByDomain(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(shortener.GetShortQuery)).
+		WithArgs("launch", shortener.DefaultWorkspaceID, 2).
+		WillReturnError(sql.ErrNoRows)
+
+	dao := shortener.NewShortPostgresDao(db, "postgres")
+	_, err = dao.GetShort(context.Background(), shortener.DefaultWorkspaceID, 2, "launch")
+
+	assert.Equal(t, sql.ErrNoRows, err, "a short from another domain should not be found")
+	assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+}
@@ -0,0 +1,98 @@
+package shortener
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type CreateDomainRequest struct {
+	Host string `json:"host"`
+}
+
+func NewCreateDomainHandler(dao DomainDAO) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request CreateDomainRequest
+
+		err := DecodeJSONBody(w, r, &request)
+		if err != nil {
+			slog.InfoContext(r.Context(), "failed to decode json body", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		domain := &Domain{Host: strings.TrimSpace(request.Host)}
+		err = ValidateDomainHost(domain.Host)
+		if err != nil {
+			slog.InfoContext(r.Context(), "invalid domain", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		err = dao.InsertDomain(r.Context(), domain)
+		if err == ErrDomainExists {
+			slog.InfoContext(r.Context(), "domain already exists", "host", domain.Host)
+			http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to insert domain", "host", domain.Host, "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(domain)
+	}
+}
+
+func NewListDomainsHandler(dao DomainDAO) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		domains, err := dao.ListDomains(r.Context())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to list domains", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(domains)
+	}
+}
+
+func NewDeleteDomainHandler(dao DomainDAO) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		id, err := strconv.ParseInt(vars["id"], 10, 64)
+		if err != nil {
+			slog.InfoContext(r.Context(), "invalid domain id", "id", vars["id"], "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		err = dao.DeleteDomain(r.Context(), id)
+		if err == sql.ErrNoRows {
+			slog.InfoContext(r.Context(), "domain not found", "id", id)
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		if err == ErrDomainInUse {
+			slog.InfoContext(r.Context(), "domain still has shorts", "id", id)
+			http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to delete domain", "id", id, "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,323 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"context"
+	"database/sql"
+	"l24.dev/shortener"
+	"l24.dev/test/mocks"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+var brand = &shortener.Domain{ID: 2, Host: "go.acme.example"}
+
+// onDomain serves handler with the domain of each request resolved from its Host header
+func onDomain(domains shortener.DomainDAO, pattern string, handler http.HandlerFunc) *httptest.Server {
+	router := mux.NewRouter()
+	router.Handle(pattern, shortener.NewDomainResolver(domains)(handler))
+	return httptest.NewServer(router)
+}
+
+func expectDomains(domains *mocks.MockDomainDAO) {
+	domains.EXPECT().GetDomainByHost(gomock.Any(), brand.Host).Return(brand, nil).AnyTimes()
+	domains.EXPECT().GetDomainByHost(gomock.Any(), gomock.Not(brand.Host)).Return(nil, sql.ErrNoRows).AnyTimes()
+}
+
+func TestValidateDomainHost(t *testing.T) {
+	type testCase struct {
+		Host       string
+		ShouldFail bool
+	}
+
+	testCases := []testCase{
+		{Host: "go.acme.example", ShouldFail: false},
+		{Host: "l24.dev", ShouldFail: false},
+		{Host: "xn--bcher-kva.example", ShouldFail: false},
+		{Host: "", ShouldFail: true},
+		{Host: "localhost", ShouldFail: true},
+		{Host: "default", ShouldFail: true},
+		{Host: "Go.Acme.example", ShouldFail: true},
+		{Host: "go.acme.example:8080", ShouldFail: true},
+		{Host: "https://go.acme.example", ShouldFail: true},
+		{Host: "go.acme.example.", ShouldFail: true},
+		{Host: "-go.acme.example", ShouldFail: true},
+		{Host: "go_links.acme.example", ShouldFail: true},
+		{Host: "203.0.113.7", ShouldFail: true},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Host, func(t *testing.T) {
+			err := shortener.ValidateDomainHost(test.Host)
+			assert.Equal(t, test.ShouldFail, err != nil, "ShouldFail is %v, got %v", test.ShouldFail, err)
+		})
+	}
+}
+
+func TestNormalizeHost(t *testing.T) {
+	assert.Equal(t, "go.acme.example", shortener.NormalizeHost("Go.ACME.example:8080"))
+	assert.Equal(t, "go.acme.example", shortener.NormalizeHost("go.acme.example."))
+	assert.Equal(t, "::1", shortener.NormalizeHost("[::1]:8080"))
+}
+
+func TestGetShortResolvesDomainByHost(t *testing.T) {
+	mock := gomock.NewController(t)
+	domains := mocks.NewMockDomainDAO(mock)
+	expectDomains(domains)
+
+	// the same path leads somewhere else on each domain
+	shorts := mocks.NewMockShortDAO(mock)
+	shorts.
+		EXPECT().
+		GetShort(gomock.Any(), shortener.DefaultWorkspaceID, brand.ID, "launch").
+		Return(&shortener.Short{RedirectPath: "launch", Scheme: "https", Host: "acme.example"}, nil).
+		Times(1)
+	shorts.
+		EXPECT().
+		GetShort(gomock.Any(), shortener.DefaultWorkspaceID, shortener.DefaultDomainID, "launch").
+		Return(&shortener.Short{RedirectPath: "launch", Scheme: "https", Host: "l24.dev"}, nil).
+		Times(1)
+
+	server := onDomain(domains, "/{short}", shortener.NewGetShortHandler(shorts))
+	defer server.Close()
+	e := httpexpect.New(t, server.URL)
+
+	e.GET("/launch").WithHost("GO.acme.example:443").
+		WithRedirectPolicy(httpexpect.DontFollowRedirects).
+		Expect().
+		Status(http.StatusMovedPermanently).
+		Header("Location").Equal("https://acme.example")
+
+	e.GET("/launch").
+		WithRedirectPolicy(httpexpect.DontFollowRedirects).
+		Expect().
+		Status(http.StatusMovedPermanently).
+		Header("Location").Equal("https://l24.dev")
+}
+
+func TestCreateShortReturnsShortURL(t *testing.T) {
+	type testCase struct {
+		Name     string
+		Host     string
+		BaseURL  string
+		Alias    string
+		Expected string
+	}
+
+	testCases := []testCase{
+		{Name: "Registered Domain", Host: brand.Host, Alias: "launch", Expected: "https://go.acme.example/launch"},
+		{Name: "Default Domain", Host: "l24.dev:8080", Alias: "launch", Expected: "http://l24.dev:8080/launch"},
+		{Name: "Default Domain With Base URL", Host: "internal:8080", BaseURL: "https://l24.dev/", Alias: "launch", Expected: "https://l24.dev/launch"},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			domains := mocks.NewMockDomainDAO(mock)
+			expectDomains(domains)
+
+			expectedDomain := shortener.DefaultDomainID
+			if test.Host == brand.Host {
+				expectedDomain = brand.ID
+			}
+			shorts := mocks.NewMockShortDAO(mock)
+			shorts.
+				EXPECT().
+				InsertShort(gomock.Any(), shortener.DefaultWorkspaceID, expectedDomain, gomock.AssignableToTypeOf(shortener.Short{})).
+				Return(nil).
+				Times(1)
+
+			var opts []shortener.HandlerOption
+			if test.BaseURL != "" {
+				baseURL, _ := url.Parse(test.BaseURL)
+				opts = append(opts, shortener.WithBaseURL(baseURL))
+			}
+
+			server := onDomain(domains, "/short", shortener.NewCreateShortHandler(shorts, opts...))
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			e.POST("/short").WithHost(test.Host).
+				WithJSON(&shortener.CreateShortRequest{URL: "https://acme.example/launch", Alias: test.Alias}).WithHeader("Content-Type", "application/json").
+				Expect().
+				Status(http.StatusOK).
+				JSON().Object().Value("short_url").String().Equal(test.Expected)
+		})
+	}
+}
+
+func TestShortURLInWorkspace(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "http://go.acme.example/w/marketing/short", nil)
+	ctx := shortener.ContextWithWorkspace(r.Context(), marketing, shortener.RoleEditor)
+	ctx = shortener.ContextWithDomain(ctx, brand)
+
+	shortURL := shortener.ShortURL(r.WithContext(ctx), nil, &shortener.Short{RedirectPath: "launch"})
+
+	assert.Equal(t, "https://go.acme.example/w/marketing/launch", shortURL)
+}
+
+func TestCreateDomainHandler(t *testing.T) {
+	type testCase struct {
+		Name           string
+		Host           string
+		InsertError    error
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{Name: "Register", Host: "go.acme.example", ExpectedStatus: http.StatusOK},
+		{Name: "Invalid Host", Host: "https://go.acme.example", ExpectedStatus: http.StatusBadRequest},
+		{Name: "Already Registered", Host: "go.acme.example", InsertError: shortener.ErrDomainExists, ExpectedStatus: http.StatusConflict},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			domains := mocks.NewMockDomainDAO(mock)
+
+			times := 1
+			if test.ExpectedStatus == http.StatusBadRequest {
+				times = 0
+			}
+			domains.
+				EXPECT().
+				InsertDomain(gomock.Any(), &shortener.Domain{Host: test.Host}).
+				DoAndReturn(func(_ interface{}, domain *shortener.Domain) error {
+					domain.ID = brand.ID
+					return test.InsertError
+				}).
+				Times(times)
+
+			server := httptest.NewServer(http.HandlerFunc(shortener.NewCreateDomainHandler(domains)))
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			response := e.POST("/admin/domains").WithJSON(&shortener.CreateDomainRequest{Host: test.Host}).WithHeader("Content-Type", "application/json").
+				Expect().
+				Status(test.ExpectedStatus)
+
+			if test.ExpectedStatus == http.StatusOK {
+				response.JSON().Object().ValueEqual("id", brand.ID).ValueEqual("host", test.Host)
+			}
+		})
+	}
+}
+
+func TestDeleteDomainHandler(t *testing.T) {
+	type testCase struct {
+		Name           string
+		DeleteError    error
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{Name: "Deleted", ExpectedStatus: http.StatusNoContent},
+		{Name: "Not Found", DeleteError: sql.ErrNoRows, ExpectedStatus: http.StatusNotFound},
+		{Name: "Still Has Shorts", DeleteError: shortener.ErrDomainInUse, ExpectedStatus: http.StatusConflict},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			domains := mocks.NewMockDomainDAO(mock)
+			domains.EXPECT().DeleteDomain(gomock.Any(), brand.ID).Return(test.DeleteError).Times(1)
+
+			router := mux.NewRouter()
+			router.HandleFunc("/admin/domains/{id}", shortener.NewDeleteDomainHandler(domains))
+			server := httptest.NewServer(router)
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			e.DELETE("/admin/domains/2").Expect().Status(test.ExpectedStatus)
+		})
+	}
+}
+
+func TestDomainCache(t *testing.T) {
+	ctx := context.Background()
+	mock := gomock.NewController(t)
+	domains := mocks.NewMockDomainDAO(mock)
+	clock := &fakeClock{now: time.Date(2021, 12, 20, 9, 0, 0, 0, time.UTC)}
+	registry := prometheus.NewRegistry()
+	cache := shortener.NewDomainCache(domains, shortener.WithDomainCacheClock(clock), shortener.WithDomainCacheMetrics(shortener.NewMetrics(registry)))
+
+	domains.EXPECT().ListDomains(gomock.Any()).Return([]shortener.Domain{*brand}, nil).Times(1)
+	assert.NoError(t, cache.Load(ctx))
+
+	// loaded domains are served without asking the database
+	domain, err := cache.GetDomainByHost(ctx, brand.Host)
+	assert.NoError(t, err)
+	assert.Equal(t, brand, domain)
+
+	// unregistered hosts are looked up once until the miss expires
+	domains.EXPECT().GetDomainByHost(gomock.Any(), "other.example").Return(nil, sql.ErrNoRows).Times(2)
+	for i := 0; i < 3; i++ {
+		_, err = cache.GetDomainByHost(ctx, "other.example")
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	}
+	clock.now = clock.now.Add(shortener.DefaultDomainMissTTL)
+	_, err = cache.GetDomainByHost(ctx, "other.example")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	// registering a host serves it straight away
+	other := &shortener.Domain{ID: 3, Host: "other.example"}
+	domains.EXPECT().InsertDomain(gomock.Any(), other).Return(nil).Times(1)
+	assert.NoError(t, cache.InsertDomain(ctx, other))
+	domain, err = cache.GetDomainByHost(ctx, other.Host)
+	assert.NoError(t, err)
+	assert.Equal(t, other, domain)
+
+	// removing it falls back to the database again
+	domains.EXPECT().DeleteDomain(gomock.Any(), other.ID).Return(nil).Times(1)
+	assert.NoError(t, cache.DeleteDomain(ctx, other.ID))
+	domains.EXPECT().GetDomainByHost(gomock.Any(), other.Host).Return(nil, sql.ErrNoRows).Times(1)
+	_, err = cache.GetDomainByHost(ctx, other.Host)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	expected := `
+# HELP l24_domain_cache_hits_total Domain lookups answered from memory, including hosts remembered as unregistered.
+# TYPE l24_domain_cache_hits_total counter
+l24_domain_cache_hits_total 4
+# HELP l24_domain_cache_misses_total Domain lookups that had to query the database.
+# TYPE l24_domain_cache_misses_total counter
+l24_domain_cache_misses_total 3
+`
+	assert.Nil(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "l24_domain_cache_hits_total", "l24_domain_cache_misses_total"))
+}
+
+func TestDomainCacheCheck(t *testing.T) {
+	ctx := context.Background()
+	mock := gomock.NewController(t)
+	domains := mocks.NewMockDomainDAO(mock)
+	clock := &fakeClock{now: time.Date(2021, 12, 20, 9, 0, 0, 0, time.UTC)}
+	cache := shortener.NewDomainCache(domains, shortener.WithDomainCacheClock(clock))
+	check := shortener.DomainCacheCheck(cache)
+
+	domains.EXPECT().ListDomains(gomock.Any()).Return([]shortener.Domain{*brand}, nil).Times(1)
+	assert.NoError(t, cache.Load(ctx))
+
+	details, err := check.Check(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, shortener.DomainCacheStatus{Domains: 1, LoadedAt: clock.now}, details)
+
+	domains.EXPECT().ListDomains(gomock.Any()).Return(nil, sql.ErrConnDone).Times(1)
+	assert.NotNil(t, cache.Load(ctx))
+
+	details, err = check.Check(ctx)
+	assert.NotNil(t, err, "a failed reload should be reported")
+	assert.Equal(t, 1, details.(shortener.DomainCacheStatus).Domains, "the previous domains should still be counted")
+	assert.Equal(t, sql.ErrConnDone.Error(), details.(shortener.DomainCacheStatus).Error)
+	assert.True(t, check.Optional)
+}
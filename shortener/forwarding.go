@@ -0,0 +1,95 @@
+package shortener
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+)
+
+var utmValuePattern = regexp.MustCompile(`^[A-Za-z0-9 _.~+\-]{1,100}$`)
+
+// UTMParams are the campaign parameters attached to every visit of a short
+type UTMParams struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+}
+
+func applyForwardingRequest(short *Short, request CreateShortRequest) error {
+	short.ForwardQuery = request.ForwardQuery
+
+	if request.UTM == nil {
+		return nil
+	}
+
+	fields := []struct {
+		name  string
+		value string
+		dst   **string
+	}{
+		{"utm_source", request.UTM.Source, &short.UTMSource},
+		{"utm_medium", request.UTM.Medium, &short.UTMMedium},
+		{"utm_campaign", request.UTM.Campaign, &short.UTMCampaign},
+	}
+
+	for _, field := range fields {
+		if field.value == "" {
+			continue
+		}
+
+		if !utmValuePattern.MatchString(field.value) {
+			return fmt.Errorf("%s %q must be 1-100 letters, digits, spaces or one of _.~+-", field.name, field.value)
+		}
+
+		value := field.value
+		*field.dst = &value
+	}
+
+	return nil
+}
+
+// UTMValues returns the UTM parameters configured on the short
+func (s *Short) UTMValues() url.Values {
+	values := url.Values{}
+
+	if !isNilOrEmptyString(s.UTMSource) {
+		values.Set("utm_source", *s.UTMSource)
+	}
+
+	if !isNilOrEmptyString(s.UTMMedium) {
+		values.Set("utm_medium", *s.UTMMedium)
+	}
+
+	if !isNilOrEmptyString(s.UTMCampaign) {
+		values.Set("utm_campaign", *s.UTMCampaign)
+	}
+
+	return values
+}
+
+// RewritesDestination reports whether a visit can change the destination path or query
+func (s *Short) RewritesDestination() bool {
+	return s.Passthrough || s.ForwardQuery || len(s.UTMValues()) > 0
+}
+
+// ApplyQueryForwarding builds the destination query for a visit. The visitor's parameters are only
+// forwarded when the short asks for it, and never override the destination's own parameters;
+// UTM parameters configured on the short override both.
+func ApplyQueryForwarding(destination *url.URL, short *Short, incoming url.Values) {
+	utm := short.UTMValues()
+
+	if (!short.ForwardQuery || len(incoming) == 0) && len(utm) == 0 {
+		return
+	}
+
+	query := destination.Query()
+	if short.ForwardQuery {
+		query = MergeQuery(query, incoming)
+	}
+
+	for key, values := range utm {
+		query[key] = values
+	}
+
+	destination.RawQuery = query.Encode()
+}
@@ -0,0 +1,174 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"l24.dev/shortener"
+	"l24.dev/test/mocks"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyQueryForwarding(t *testing.T) {
+	type testCase struct {
+		Name         string
+		Destination  string
+		ForwardQuery bool
+		UTMSource    *string
+		UTMCampaign  *string
+		Incoming     url.Values
+		Expected     string
+	}
+
+	testCases := []testCase{
+		{
+			Name:         "Forward Onto Bare Destination",
+			Destination:  "https://example.com/landing",
+			ForwardQuery: true,
+			Incoming:     url.Values{"ref": {"newsletter"}},
+			Expected:     "https://example.com/landing?ref=newsletter",
+		},
+		{
+			Name:         "Forward Keeps Stored Values",
+			Destination:  "https://example.com/landing?ref=owner&lang=en",
+			ForwardQuery: true,
+			Incoming:     url.Values{"ref": {"visitor"}, "page": {"2"}},
+			Expected:     "https://example.com/landing?lang=en&page=2&ref=owner",
+		},
+		{
+			Name:         "Incoming Dropped Without Forwarding",
+			Destination:  "https://example.com/landing?lang=en",
+			ForwardQuery: false,
+			Incoming:     url.Values{"ref": {"visitor"}},
+			Expected:     "https://example.com/landing?lang=en",
+		},
+		{
+			Name:        "UTM Overrides Stored",
+			Destination: "https://example.com/landing?utm_source=old#top",
+			UTMSource:   pointerString("twitter"),
+			UTMCampaign: pointerString("spring sale"),
+			Expected:    "https://example.com/landing?utm_campaign=spring+sale&utm_source=twitter#top",
+		},
+		{
+			Name:         "UTM Overrides Visitor",
+			Destination:  "https://example.com",
+			ForwardQuery: true,
+			UTMSource:    pointerString("twitter"),
+			Incoming:     url.Values{"utm_source": {"spoofed"}, "q": {"a&b"}},
+			Expected:     "https://example.com?q=a%26b&utm_source=twitter",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			destination, err := url.Parse(test.Destination)
+			if err != nil {
+				t.Fatalf("failed to parse destination: %v", err)
+			}
+
+			short := &shortener.Short{ForwardQuery: test.ForwardQuery, UTMSource: test.UTMSource, UTMCampaign: test.UTMCampaign}
+			shortener.ApplyQueryForwarding(destination, short, test.Incoming)
+
+			assert.Equal(t, test.Expected, destination.String(), "destination should match")
+		})
+	}
+}
+
+func TestCreateForwardingShortHandler(t *testing.T) {
+	type testCase struct {
+		Name           string
+		Request        shortener.CreateShortRequest
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{
+			Name: "Forwarding With UTM",
+			Request: shortener.CreateShortRequest{
+				URL:          "example.com/landing",
+				ForwardQuery: true,
+				UTM:          &shortener.UTMParams{Source: "twitter", Medium: "social", Campaign: "spring_sale-2021"},
+			},
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name: "UTM With Quote",
+			Request: shortener.CreateShortRequest{
+				URL: "example.com/landing",
+				UTM: &shortener.UTMParams{Source: "it's"},
+			},
+			ExpectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			dao := mocks.NewMockShortDAO(mock)
+
+			times := 0
+			if test.ExpectedStatus == http.StatusOK {
+				times = 1
+			}
+			dao.
+				EXPECT().
+				InsertShort(gomock.Any(), gomock.Any(), gomock.Any(), gomock.AssignableToTypeOf(shortener.Short{})).
+				Return(nil).
+				Times(times)
+
+			server := httptest.NewServer(http.HandlerFunc(shortener.NewCreateShortHandler(dao)))
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			response := e.POST("/short").WithJSON(&test.Request).WithHeader("Content-Type", "application/json").
+				Expect().
+				Status(test.ExpectedStatus)
+
+			if test.ExpectedStatus == http.StatusOK {
+				object := response.JSON().Object()
+				object.Value("forward_query").Boolean().True()
+				object.Value("utm_source").String().Equal("twitter")
+				object.Value("utm_medium").String().Equal("social")
+				object.Value("utm_campaign").String().Equal("spring_sale-2021")
+			}
+		})
+	}
+}
+
+func TestGetForwardingShortHandler(t *testing.T) {
+	mock := gomock.NewController(t)
+	dao := mocks.NewMockShortDAO(mock)
+	dao.
+		EXPECT().
+		GetShort(gomock.Any(), gomock.Any(), gomock.Any(), "promo").
+		Return(&shortener.Short{
+			RedirectPath: "promo",
+			Scheme:       "https",
+			Host:         "example.com",
+			Path:         pointerString("/landing"),
+			Query:        pointerString("lang=en"),
+			ForwardQuery: true,
+			UTMSource:    pointerString("l24"),
+		}, nil).
+		Times(1)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/{short}", shortener.NewGetShortHandler(dao))
+	server := httptest.NewServer(router)
+	defer server.Close()
+	e := httpexpect.New(t, server.URL)
+
+	e.GET("/promo").
+		WithQueryString("lang=de&gclid=abc").
+		WithRedirectPolicy(httpexpect.DontFollowRedirects).
+		Expect().
+		Status(http.StatusMovedPermanently).
+		Header("Location").Equal("https://example.com/landing?gclid=abc&lang=en&utm_source=l24")
+}
@@ -4,7 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strings"
@@ -13,10 +13,45 @@ import (
 )
 
 type CreateShortRequest struct {
+	URL          string                `json:"url"`
+	Alias        string                `json:"alias,omitempty"`
+	Passthrough  bool                  `json:"passthrough,omitempty"`
+	Template     bool                  `json:"template,omitempty"`
+	ForwardQuery bool                  `json:"forward_query,omitempty"`
+	UTM          *UTMParams            `json:"utm,omitempty"`
+	Destinations []DestinationRequest  `json:"destinations,omitempty"`
+	ActivateAt   string                `json:"activate_at,omitempty"`
+	Timezone     string                `json:"timezone,omitempty"`
+	Schedule     []ScheduleRuleRequest `json:"schedule,omitempty"`
+	Password     string                `json:"password,omitempty"`
+}
+
+type UpdateShortRequest struct {
 	URL string `json:"url"`
 }
 
-type CreateShortResponse Short
+type DestinationRequest struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+type ScheduleRuleRequest struct {
+	URL      string `json:"url"`
+	StartsAt string `json:"starts_at,omitempty"`
+	EndsAt   string `json:"ends_at,omitempty"`
+}
+
+// CreateShortResponse is the short created, along with the full URL it is served at
+type CreateShortResponse struct {
+	Short
+	ShortURL string `json:"short_url"`
+}
+
+type ShortStatsResponse struct {
+	RedirectPath string        `json:"redirect_path"`
+	TotalClicks  int64         `json:"total_clicks"`
+	Destinations []Destination `json:"destinations"`
+}
 
 // DecodeJSONBody unmarshalls a JSON response into a struct, while returning any bad request errors
 func DecodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) error {
@@ -34,69 +69,443 @@ func DecodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) err
 	return err
 }
 
-func NewCreateShortHandler(dao ShortDAO) func(w http.ResponseWriter, r *http.Request) {
+// ParseDestinationURL parses a user supplied URL, defaulting to http when no scheme is given.
+// Whether the scheme is acceptable is up to the URLPolicy.
+func ParseDestinationURL(raw string) (*url.URL, error) {
+	if !hasScheme(raw) {
+		raw = "http://" + raw // default to http
+	}
+
+	URL, err := url.Parse(raw)
+	if err != nil {
+		return nil, newURLError(raw, ReasonInvalidURL, "url cannot be parsed")
+	}
+
+	if URL.Host == "" {
+		return nil, newURLError(raw, ReasonInvalidURL, "url has no host")
+	}
+
+	return URL, nil
+}
+
+// hasScheme reports whether raw starts with a scheme and //, unlike a host with a port or a
+// URL that only has another URL in its query
+func hasScheme(raw string) bool {
+	URL, err := url.Parse(raw)
+	return err == nil && URL.Scheme != "" && strings.HasPrefix(strings.ToLower(raw), URL.Scheme+"://")
+}
+
+func NewCreateShortHandler(dao ShortDAO, opts ...HandlerOption) func(w http.ResponseWriter, r *http.Request) {
+	options := newHandlerOptions(opts)
+
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorizeWorkspace(r.Context(), RoleEditor) {
+			slog.WarnContext(r.Context(), "may not create shorts in this workspace", "principal", PrincipalFromContext(r.Context()).Name())
+			options.metrics.creationFailed(ReasonForbidden, nil)
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
 		var request CreateShortRequest
 
 		err := DecodeJSONBody(w, r, &request)
 		if err != nil {
-			log.Printf("failed to decode json body: %v", err)
-			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			slog.InfoContext(r.Context(), "failed to decode json body", "error", err)
+			options.metrics.creationFailed(ReasonInvalidBody, err)
+			writeBadRequest(w, ReasonInvalidBody, err)
+			return
+		}
+
+		URL, err := ParseDestinationURL(request.URL)
+		if err != nil {
+			slog.InfoContext(r.Context(), "invalid url", "error", err)
+			options.metrics.creationFailed(ReasonInvalidURL, err)
+			writeBadRequest(w, ReasonInvalidURL, err)
 			return
 		}
 
-		if !strings.HasPrefix(request.URL, "http://") && !strings.HasPrefix(request.URL, "https://") {
-			request.URL = "http://" + request.URL // default to http
+		short, err := NewShort(URL.Scheme, URL.Host, URL.Path, URL.RawQuery, URL.Fragment)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to create short", "error", err)
+			options.metrics.creationFailed(ReasonInternal, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if request.Alias != "" {
+			err = ValidateAlias(request.Alias)
+			if err != nil {
+				slog.InfoContext(r.Context(), "invalid alias", "error", err)
+				options.metrics.creationFailed(ReasonInvalidAlias, err)
+				writeBadRequest(w, ReasonInvalidAlias, err)
+				return
+			}
+			short.RedirectPath = request.Alias
+		}
+
+		short.Passthrough = request.Passthrough
+
+		if key := APIKeyFromContext(r.Context()); key != nil && key.ID != 0 {
+			short.CreatedByKeyID = &key.ID
 		}
 
-		URL, err := url.Parse(request.URL)
+		if user := UserFromContext(r.Context()); user != nil {
+			short.OwnerID = &user.ID
+		}
+
+		err = applyDestinationsRequest(short, request)
 		if err != nil {
-			log.Printf("cannot parse url: %v", err)
-			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			slog.InfoContext(r.Context(), "invalid destinations", "error", err)
+			options.metrics.creationFailed(ReasonInvalidDestinations, err)
+			writeBadRequest(w, ReasonInvalidDestinations, err)
 			return
 		}
 
-		if URL.Host == "" {
-			log.Printf("invalid url: %s", URL.String())
-			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		err = applyScheduleRequest(short, request)
+		if err != nil {
+			slog.InfoContext(r.Context(), "invalid schedule", "error", err)
+			options.metrics.creationFailed(ReasonInvalidSchedule, err)
+			writeBadRequest(w, ReasonInvalidSchedule, err)
 			return
 		}
 
-		short, err := NewShort(URL.Scheme, URL.Host, URL.Path, URL.RawQuery, URL.Fragment)
+		err = applyTemplateRequest(short, request)
 		if err != nil {
-			log.Printf("failed to create short: %v", err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			slog.InfoContext(r.Context(), "invalid template", "error", err)
+			options.metrics.creationFailed(ReasonInvalidTemplate, err)
+			writeBadRequest(w, ReasonInvalidTemplate, err)
+			return
+		}
+
+		err = applyForwardingRequest(short, request)
+		if err != nil {
+			slog.InfoContext(r.Context(), "invalid query forwarding", "error", err)
+			options.metrics.creationFailed(ReasonInvalidForwarding, err)
+			writeBadRequest(w, ReasonInvalidForwarding, err)
+			return
+		}
+
+		err = applyPasswordRequest(short, request)
+		if err != nil {
+			slog.InfoContext(r.Context(), "invalid password", "error", err)
+			options.metrics.creationFailed(ReasonInvalidPassword, err)
+			writeBadRequest(w, ReasonInvalidPassword, err)
 			return
 		}
 
-		err = dao.InsertShort(r.Context(), *short)
+		err = options.urlPolicy.CheckShort(r.Context(), short)
+		if err != nil {
+			slog.InfoContext(r.Context(), "destination rejected", "error", err)
+			options.metrics.creationFailed(ReasonInvalidURL, err)
+			writeBadRequest(w, ReasonInvalidURL, err)
+			return
+		}
+
+		err = dao.InsertShort(r.Context(), workspaceID(r.Context()), domainID(r.Context()), *short)
+		if err == ErrShortExists {
+			slog.InfoContext(r.Context(), "short already exists", "alias", short.RedirectPath)
+			options.metrics.creationFailed(ReasonExists, err)
+			http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+			return
+		}
 		if err != nil {
-			log.Printf("failed to insert short value %s: %v", short.RedirectPath, err)
+			slog.ErrorContext(r.Context(), "failed to insert short", "alias", short.RedirectPath, "error", err)
+			options.metrics.creationFailed(ReasonInternal, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Add("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(short)
+		_ = json.NewEncoder(w).Encode(CreateShortResponse{Short: *short, ShortURL: ShortURL(r, options.baseURL, short)})
+	}
+}
+
+func NewGetShortHandler(dao ShortDAO, opts ...HandlerOption) func(w http.ResponseWriter, r *http.Request) {
+	options := newHandlerOptions(opts)
+	scheduler := NewScheduler(options.clock)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		short_url := vars["short"]
+
+		short, err := dao.GetShort(r.Context(), workspaceID(r.Context()), domainID(r.Context()), short_url)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				slog.InfoContext(r.Context(), "short not found")
+				options.metrics.shortNotFound()
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			}
+			slog.ErrorContext(r.Context(), "failed to get short", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if short.DisabledAt != nil {
+			slog.InfoContext(r.Context(), "short was disabled by a moderator")
+			renderPage(w, http.StatusGone, disabledPage, nil)
+			return
+		}
+
+		if short.BlockedReason != nil {
+			slog.InfoContext(r.Context(), "short is blocked", "reason", *short.BlockedReason)
+			http.Redirect(w, r, BlockedPagePath, http.StatusFound)
+			return
+		}
+
+		if short.IsProtected() && !isUnlocked(r, options.unlockSecret, workspaceID(r.Context()), short, options.clock.Now()) {
+			renderPage(w, http.StatusUnauthorized, passwordPage, passwordForm{})
+			return
+		}
+
+		rest := vars["rest"]
+		if rest != "" && !short.Passthrough && !short.Template {
+			slog.InfoContext(r.Context(), "short does not accept a path suffix", "rest", rest)
+			options.metrics.shortNotFound()
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		target, status, err := resolveDestination(w, r, dao, scheduler, short)
+		if err == ErrShortNotActive {
+			slog.InfoContext(r.Context(), "short cannot be served", "error", err)
+			options.metrics.shortNotFound()
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to resolve destination", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if short.Template {
+			target, err = RenderTemplate(target, NewTemplateParams(rest, r.URL.Query()))
+			if err != nil {
+				slog.InfoContext(r.Context(), "cannot render template", "error", err)
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if short.RewritesDestination() {
+			destination, err := url.Parse(target)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "cannot parse destination", "error", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			if short.Passthrough {
+				ApplyPassthrough(destination, rest, r.URL.Query())
+			}
+			ApplyQueryForwarding(destination, short, r.URL.Query())
+			target = destination.String()
+		}
+
+		if short.IsProtected() {
+			status = http.StatusFound // a cached redirect would outlive the unlock cookie
+		}
+
+		if options.blocklist != nil {
+			if match, ok := options.blocklist.Match(target); ok {
+				slog.WarnContext(r.Context(), "short leads to a blocked destination", "match", match)
+				http.Redirect(w, r, BlockedPagePath, http.StatusFound)
+				return
+			}
+		}
+
+		options.metrics.redirected(status)
+		http.Redirect(w, r, target, status)
 	}
 }
 
-func NewGetShortHandler(dao ShortDAO) func(w http.ResponseWriter, r *http.Request) {
+// resolveDestination picks the URL a visit to short should be redirected to right now, along with the redirect status
+func resolveDestination(w http.ResponseWriter, r *http.Request, dao ShortDAO, scheduler *Scheduler, short *Short) (string, int, error) {
+	rule, err := scheduler.Resolve(short)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if rule != nil {
+		return rule.URL, http.StatusFound, nil
+	}
+
+	if len(short.Destinations) == 0 {
+		if short.IsScheduled() {
+			return short.RawURL(), http.StatusFound, nil // the destination will change, so it must not be cached
+		}
+		return short.RawURL(), http.StatusMovedPermanently, nil
+	}
+
+	destination, fresh, err := ChooseDestination(r, short)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if fresh {
+		http.SetCookie(w, NewVariantCookie(r, short, destination))
+	}
+
+	err = dao.IncrementDestinationClicks(r.Context(), workspaceID(r.Context()), destination.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to count click", "destination", destination.ID, "error", err)
+	}
+
+	// split shorts must not be cached by the browser, or the visitor would never reach us again
+	return destination.URL, http.StatusFound, nil
+}
+
+func NewGetShortStatsHandler(dao ShortDAO) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		short_url := vars["short"]
 
-		short, err := dao.GetShort(r.Context(), short_url)
+		short, err := dao.GetShort(r.Context(), workspaceID(r.Context()), domainID(r.Context()), short_url)
 		if err != nil {
 			if err == sql.ErrNoRows {
-				log.Printf("%s short not found: %v", short_url, err)
+				slog.InfoContext(r.Context(), "short not found")
 				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 				return
 			}
-			log.Printf("internal error: %v", err)
+			slog.ErrorContext(r.Context(), "failed to get short", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if !authorizeShort(r.Context(), short, RoleViewer) {
+			slog.WarnContext(r.Context(), "may not read stats", "principal", PrincipalFromContext(r.Context()).Name())
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		response := ShortStatsResponse{
+			RedirectPath: short.RedirectPath,
+			Destinations: short.Destinations,
+		}
+		if response.Destinations == nil {
+			response.Destinations = []Destination{}
+		}
+		for _, destination := range response.Destinations {
+			response.TotalClicks += destination.Clicks
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+	}
+}
+
+func NewUpdateShortHandler(dao ShortDAO, opts ...HandlerOption) func(w http.ResponseWriter, r *http.Request) {
+	options := newHandlerOptions(opts)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		short_url := vars["short"]
+
+		existing, ok := authorizeManage(w, r, dao, short_url)
+		if !ok {
+			return
+		}
+
+		// updates only change the URL, so shorts that can redirect elsewhere are rejected rather than left half updated
+		if !existing.RedirectsOnlyToURL() {
+			slog.InfoContext(r.Context(), "short has more than a url to update")
+			http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+			return
+		}
+
+		var request UpdateShortRequest
+
+		err := DecodeJSONBody(w, r, &request)
+		if err != nil {
+			slog.InfoContext(r.Context(), "failed to decode json body", "error", err)
+			writeBadRequest(w, ReasonInvalidBody, err)
+			return
+		}
+
+		URL, err := ParseDestinationURL(request.URL)
+		if err != nil {
+			slog.InfoContext(r.Context(), "invalid url", "error", err)
+			writeBadRequest(w, ReasonInvalidURL, err)
+			return
+		}
+
+		short, err := NewShort(URL.Scheme, URL.Host, URL.Path, URL.RawQuery, URL.Fragment)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to create short", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		short.RedirectPath = short_url
+
+		err = options.urlPolicy.Check(r.Context(), short.RawURL())
+		if err != nil {
+			slog.InfoContext(r.Context(), "destination rejected", "error", err)
+			writeBadRequest(w, ReasonInvalidURL, err)
+			return
+		}
+
+		err = dao.UpdateShort(r.Context(), workspaceID(r.Context()), domainID(r.Context()), *short)
+		if err == sql.ErrNoRows {
+			slog.InfoContext(r.Context(), "short not found")
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to update short", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(short)
+	}
+}
+
+func NewDeleteShortHandler(dao ShortDAO) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		short_url := vars["short"]
+
+		if _, ok := authorizeManage(w, r, dao, short_url); !ok {
+			return
+		}
+
+		err := dao.DeleteShort(r.Context(), workspaceID(r.Context()), domainID(r.Context()), short_url)
+		if err == sql.ErrNoRows {
+			slog.InfoContext(r.Context(), "short not found")
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to delete short", "error", err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
 		}
-		http.Redirect(w, r, short.RawURL(), http.StatusMovedPermanently)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// authorizeManage looks up a short and checks the principal of the request may change it, returning
+// the short, or writing an error response and returning false if not
+func authorizeManage(w http.ResponseWriter, r *http.Request, dao ShortDAO, short_url string) (*Short, bool) {
+	short, err := dao.GetShort(r.Context(), workspaceID(r.Context()), domainID(r.Context()), short_url)
+	if err == sql.ErrNoRows {
+		slog.InfoContext(r.Context(), "short not found")
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get short", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return nil, false
 	}
+
+	if !authorizeShort(r.Context(), short, RoleEditor) {
+		slog.WarnContext(r.Context(), "may not manage short", "principal", PrincipalFromContext(r.Context()).Name())
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return nil, false
+	}
+
+	return short, true
 }
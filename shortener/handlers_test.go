@@ -13,6 +13,7 @@ import (
 
 	"github.com/gavv/httpexpect/v2"
 	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
 )
 
 func TestCreateShortHandler(t *testing.T) {
@@ -89,7 +90,7 @@ func TestCreateShortHandler(t *testing.T) {
 			dao := mocks.NewMockShortDAO(mock)
 			dao.
 				EXPECT().
-				InsertShort(gomock.Any(), gomock.AssignableToTypeOf(shortener.Short{})).
+				InsertShort(gomock.Any(), gomock.Any(), gomock.Any(), gomock.AssignableToTypeOf(shortener.Short{})).
 				Return(nil).
 				Times(1)
 
@@ -104,8 +105,9 @@ func TestCreateShortHandler(t *testing.T) {
 				Expect().
 				Status(http.StatusOK).JSON().Object()
 
-			response.Keys().ContainsOnly("redirect_path", "scheme", "host", "path", "query", "fragment")
-			response.Value("redirect_path").NotNull().String()
+			response.Keys().ContainsOnly("redirect_path", "scheme", "host", "path", "query", "fragment", "short_url")
+			redirectPath := response.Value("redirect_path").NotNull().String().Raw()
+			response.Value("short_url").String().Equal(server.URL + "/" + redirectPath)
 			response.Value("scheme").NotNull().String().Equal(test.ExpectedScheme)
 			response.Value("host").NotNull().String().Equal(test.ExpectedHost)
 			response.Value("path").NotNull().String().Equal(test.ExpectedPath)
@@ -160,7 +162,7 @@ func TestGetShortHandler(t *testing.T) {
 			dao := mocks.NewMockShortDAO(mock)
 			dao.
 				EXPECT().
-				GetShort(gomock.Any(), gomock.Any()).
+				GetShort(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 				Return(test.ExpectedShort, test.ExpectedError).
 				Times(1)
 
@@ -181,6 +183,591 @@ func TestGetShortHandler(t *testing.T) {
 	}
 }
 
+func TestCreateAliasedShortHandler(t *testing.T) {
+	type testCase struct {
+		Name           string
+		Alias          string
+		InsertError    error
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{
+			Name:           "Alias",
+			Alias:          "docs",
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "Alias Taken",
+			Alias:          "docs",
+			InsertError:    shortener.ErrShortExists,
+			ExpectedStatus: http.StatusConflict,
+		},
+		{
+			Name:           "Reserved Alias",
+			Alias:          "short",
+			ExpectedStatus: http.StatusBadRequest,
+		},
+		{
+			Name:           "Alias With Slash",
+			Alias:          "docs/v2",
+			ExpectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			dao := mocks.NewMockShortDAO(mock)
+
+			times := 0
+			if test.ExpectedStatus != http.StatusBadRequest {
+				times = 1
+			}
+			dao.
+				EXPECT().
+				InsertShort(gomock.Any(), gomock.Any(), gomock.Any(), gomock.AssignableToTypeOf(shortener.Short{})).
+				Return(test.InsertError).
+				Times(times)
+
+			server := httptest.NewServer(http.HandlerFunc(shortener.NewCreateShortHandler(dao)))
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			request := shortener.CreateShortRequest{URL: "docs.example.com", Alias: test.Alias, Passthrough: true}
+			response := e.POST("/short").WithJSON(&request).WithHeader("Content-Type", "application/json").
+				Expect().
+				Status(test.ExpectedStatus)
+
+			if test.ExpectedStatus == http.StatusOK {
+				object := response.JSON().Object()
+				object.Value("redirect_path").String().Equal(test.Alias)
+				object.Value("passthrough").Boolean().True()
+			}
+		})
+	}
+}
+
+func TestCreateSplitShortHandler(t *testing.T) {
+	type testCase struct {
+		Name           string
+		Request        shortener.CreateShortRequest
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{
+			Name: "Weighted Destinations",
+			Request: shortener.CreateShortRequest{
+				URL: "lucastephens.com",
+				Destinations: []shortener.DestinationRequest{
+					{URL: "lucastephens.com/a", Weight: 80},
+					{URL: "https://lucastephens.com/b", Weight: 20},
+				},
+			},
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name: "Zero Weight",
+			Request: shortener.CreateShortRequest{
+				URL: "lucastephens.com",
+				Destinations: []shortener.DestinationRequest{
+					{URL: "lucastephens.com/a", Weight: 0},
+					{URL: "lucastephens.com/b", Weight: 20},
+				},
+			},
+			ExpectedStatus: http.StatusBadRequest,
+		},
+		{
+			Name: "Single Destination",
+			Request: shortener.CreateShortRequest{
+				URL:          "lucastephens.com",
+				Destinations: []shortener.DestinationRequest{{URL: "lucastephens.com/a", Weight: 1}},
+			},
+			ExpectedStatus: http.StatusBadRequest,
+		},
+		{
+			Name: "Invalid Destination URL",
+			Request: shortener.CreateShortRequest{
+				URL: "lucastephens.com",
+				Destinations: []shortener.DestinationRequest{
+					{URL: "http://", Weight: 1},
+					{URL: "lucastephens.com/b", Weight: 1},
+				},
+			},
+			ExpectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			dao := mocks.NewMockShortDAO(mock)
+
+			times := 0
+			if test.ExpectedStatus == http.StatusOK {
+				times = 1
+			}
+			dao.
+				EXPECT().
+				InsertShort(gomock.Any(), gomock.Any(), gomock.Any(), gomock.AssignableToTypeOf(shortener.Short{})).
+				Return(nil).
+				Times(times)
+
+			createShort := shortener.NewCreateShortHandler(dao)
+			handler := http.HandlerFunc(createShort)
+
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			response := e.POST("/short").WithJSON(&test.Request).WithHeader("Content-Type", "application/json").
+				Expect().
+				Status(test.ExpectedStatus)
+
+			if test.ExpectedStatus != http.StatusOK {
+				return
+			}
+
+			destinations := response.JSON().Object().Value("destinations").Array()
+			destinations.Length().Equal(2)
+			destinations.Element(0).Object().Value("url").String().Equal("http://lucastephens.com/a")
+			destinations.Element(0).Object().Value("weight").Number().Equal(80)
+			destinations.Element(1).Object().Value("url").String().Equal("https://lucastephens.com/b")
+		})
+	}
+}
+
+func TestGetSplitShortHandler(t *testing.T) {
+	short := &shortener.Short{
+		RedirectPath: "c3xd4d",
+		Scheme:       "http",
+		Host:         "github.com",
+		Destinations: []shortener.Destination{
+			{ID: 7, URL: "http://a.com", Weight: 1},
+			{ID: 8, URL: "http://b.com", Weight: 1},
+		},
+	}
+
+	t.Run("New Visitor", func(t *testing.T) {
+		mock := gomock.NewController(t)
+		dao := mocks.NewMockShortDAO(mock)
+		dao.EXPECT().GetShort(gomock.Any(), gomock.Any(), gomock.Any(), "c3xd4d").Return(short, nil).Times(1)
+		dao.EXPECT().IncrementDestinationClicks(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		router := mux.NewRouter()
+		router.HandleFunc("/{short}", shortener.NewGetShortHandler(dao))
+		server := httptest.NewServer(router)
+		defer server.Close()
+		e := httpexpect.New(t, server.URL)
+
+		response := e.GET("/c3xd4d").
+			WithRedirectPolicy(httpexpect.DontFollowRedirects).
+			Expect().
+			Status(http.StatusFound)
+
+		cookie := response.Cookie(shortener.VariantCookieName(shortener.DefaultWorkspaceID, shortener.DefaultDomainID, "c3xd4d"))
+		cookie.Value().NotEmpty()
+		cookie.Path().Equal("/c3xd4d")
+	})
+
+	t.Run("Returning Visitor", func(t *testing.T) {
+		mock := gomock.NewController(t)
+		dao := mocks.NewMockShortDAO(mock)
+		dao.EXPECT().GetShort(gomock.Any(), gomock.Any(), gomock.Any(), "c3xd4d").Return(short, nil).Times(1)
+		dao.EXPECT().IncrementDestinationClicks(gomock.Any(), gomock.Any(), int64(8)).Return(nil).Times(1)
+
+		router := mux.NewRouter()
+		router.HandleFunc("/{short}", shortener.NewGetShortHandler(dao))
+		server := httptest.NewServer(router)
+		defer server.Close()
+		e := httpexpect.New(t, server.URL)
+
+		e.GET("/c3xd4d").
+			WithCookie(shortener.VariantCookieName(shortener.DefaultWorkspaceID, shortener.DefaultDomainID, "c3xd4d"), "8").
+			WithRedirectPolicy(httpexpect.DontFollowRedirects).
+			Expect().
+			Status(http.StatusFound).
+			Header("Location").Equal("http://b.com")
+	})
+}
+
+func TestCreateScheduledShortHandler(t *testing.T) {
+	type testCase struct {
+		Name           string
+		Request        shortener.CreateShortRequest
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{
+			Name: "Launch With Coming Soon Page",
+			Request: shortener.CreateShortRequest{
+				URL:        "example.com/event",
+				ActivateAt: "2021-11-01T09:00",
+				Timezone:   "Europe/Berlin",
+				Schedule: []shortener.ScheduleRuleRequest{
+					{URL: "example.com/soon", EndsAt: "2021-11-01T09:00"},
+					{URL: "example.com/archive", StartsAt: "2021-11-03T17:00:00Z"},
+				},
+			},
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "Unknown Timezone",
+			Request:        shortener.CreateShortRequest{URL: "example.com", ActivateAt: "2021-11-01T09:00", Timezone: "Mars/Olympus_Mons"},
+			ExpectedStatus: http.StatusBadRequest,
+		},
+		{
+			Name:           "Bad Activation Time",
+			Request:        shortener.CreateShortRequest{URL: "example.com", ActivateAt: "soon"},
+			ExpectedStatus: http.StatusBadRequest,
+		},
+		{
+			Name: "Overlapping Rules",
+			Request: shortener.CreateShortRequest{
+				URL: "example.com",
+				Schedule: []shortener.ScheduleRuleRequest{
+					{URL: "example.com/a", EndsAt: "2021-11-02T00:00"},
+					{URL: "example.com/b", StartsAt: "2021-11-01T00:00"},
+				},
+			},
+			ExpectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			dao := mocks.NewMockShortDAO(mock)
+
+			times := 0
+			if test.ExpectedStatus == http.StatusOK {
+				times = 1
+			}
+			dao.
+				EXPECT().
+				InsertShort(gomock.Any(), gomock.Any(), gomock.Any(), gomock.AssignableToTypeOf(shortener.Short{})).
+				Return(nil).
+				Times(times)
+
+			server := httptest.NewServer(http.HandlerFunc(shortener.NewCreateShortHandler(dao)))
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			response := e.POST("/short").WithJSON(&test.Request).WithHeader("Content-Type", "application/json").
+				Expect().
+				Status(test.ExpectedStatus)
+
+			if test.ExpectedStatus != http.StatusOK {
+				return
+			}
+
+			object := response.JSON().Object()
+			object.Value("activate_at").String().Equal("2021-11-01T09:00:00+01:00")
+			object.Value("timezone").String().Equal("Europe/Berlin")
+			object.Value("schedule").Array().Length().Equal(2)
+		})
+	}
+}
+
+func TestGetShortStatsHandler(t *testing.T) {
+	type testCase struct {
+		Name           string
+		Principal      *shortener.Principal
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{
+			Name:           "Owner",
+			Principal:      &shortener.Principal{User: &shortener.User{ID: 5}},
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "Other User",
+			Principal:      &shortener.Principal{User: &shortener.User{ID: 6}},
+			ExpectedStatus: http.StatusForbidden,
+		},
+		{
+			Name:           "Anonymous",
+			Principal:      nil,
+			ExpectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			dao := mocks.NewMockShortDAO(mock)
+			dao.
+				EXPECT().
+				GetShort(gomock.Any(), gomock.Any(), gomock.Any(), "c3xd4d").
+				Return(&shortener.Short{
+					RedirectPath: "c3xd4d",
+					OwnerID:      pointerInt64(5),
+					Destinations: []shortener.Destination{
+						{ID: 7, URL: "http://a.com", Weight: 1, Clicks: 10},
+						{ID: 8, URL: "http://b.com", Weight: 1, Clicks: 5},
+					},
+				}, nil).
+				Times(1)
+
+			router := mux.NewRouter()
+			router.HandleFunc("/short/{short}/stats", withPrincipal(test.Principal, shortener.NewGetShortStatsHandler(dao)))
+			server := httptest.NewServer(router)
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			response := e.GET("/short/c3xd4d/stats").Expect().Status(test.ExpectedStatus)
+			if test.ExpectedStatus != http.StatusOK {
+				return
+			}
+
+			object := response.JSON().Object()
+			object.Value("redirect_path").String().Equal("c3xd4d")
+			object.Value("total_clicks").Number().Equal(15)
+			object.Value("destinations").Array().Element(1).Object().Value("clicks").Number().Equal(5)
+		})
+	}
+}
+
+func TestCreateShortRecordsAPIKey(t *testing.T) {
+	mock := gomock.NewController(t)
+	dao := mocks.NewMockShortDAO(mock)
+
+	var inserted shortener.Short
+	dao.
+		EXPECT().
+		InsertShort(gomock.Any(), gomock.Any(), gomock.Any(), gomock.AssignableToTypeOf(shortener.Short{})).
+		DoAndReturn(func(_, _, _ interface{}, short shortener.Short) error {
+			inserted = short
+			return nil
+		}).
+		Times(1)
+
+	createShort := shortener.NewCreateShortHandler(dao)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := &shortener.APIKey{ID: 42, Scopes: []string{"create"}}
+		createShort(w, r.WithContext(shortener.ContextWithAPIKey(r.Context(), key)))
+	})
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	e := httpexpect.New(t, server.URL)
+
+	e.POST("/short").WithJSON(&shortener.CreateShortRequest{URL: "lucastephens.com"}).WithHeader("Content-Type", "application/json").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().Value("created_by_key_id").Number().Equal(42)
+
+	if inserted.CreatedByKeyID == nil || *inserted.CreatedByKeyID != 42 {
+		t.Errorf("short should record the key that created it")
+	}
+}
+
+func TestUpdateShortHandler(t *testing.T) {
+	owner := &shortener.Principal{User: &shortener.User{ID: 5}}
+
+	type testCase struct {
+		Name           string
+		URL            string
+		Principal      *shortener.Principal
+		Template       bool
+		Schedule       []shortener.ScheduleRule
+		GetError       error
+		UpdateError    error
+		ExpectUpdate   bool
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{
+			Name:           "Owner Updates",
+			URL:            "https://github.com/soggycactus",
+			Principal:      owner,
+			ExpectUpdate:   true,
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "Admin Key Updates",
+			URL:            "https://github.com/soggycactus",
+			Principal:      &shortener.Principal{APIKey: &shortener.APIKey{ID: 1, Scopes: []string{"admin"}}},
+			ExpectUpdate:   true,
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "Other User",
+			URL:            "https://github.com/soggycactus",
+			Principal:      &shortener.Principal{User: &shortener.User{ID: 6}},
+			ExpectedStatus: http.StatusForbidden,
+		},
+		{
+			Name:           "Manage Key That Did Not Create It",
+			URL:            "https://github.com/soggycactus",
+			Principal:      &shortener.Principal{APIKey: &shortener.APIKey{ID: 2, Scopes: []string{"manage"}}},
+			ExpectedStatus: http.StatusForbidden,
+		},
+		{
+			Name:           "Not Found",
+			URL:            "https://github.com/soggycactus",
+			Principal:      owner,
+			GetError:       sql.ErrNoRows,
+			ExpectedStatus: http.StatusNotFound,
+		},
+		{
+			Name:           "Deleted Concurrently",
+			URL:            "https://github.com/soggycactus",
+			Principal:      owner,
+			UpdateError:    sql.ErrNoRows,
+			ExpectUpdate:   true,
+			ExpectedStatus: http.StatusNotFound,
+		},
+		{
+			Name:           "Invalid URL",
+			URL:            "http://",
+			Principal:      owner,
+			ExpectedStatus: http.StatusBadRequest,
+		},
+		{
+			Name:           "Template Short",
+			URL:            "https://github.com/soggycactus",
+			Principal:      owner,
+			Template:       true,
+			ExpectedStatus: http.StatusConflict,
+		},
+		{
+			Name:           "Scheduled Short",
+			URL:            "https://github.com/soggycactus",
+			Principal:      owner,
+			Schedule:       []shortener.ScheduleRule{{URL: "https://github.com/soon"}},
+			ExpectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			dao := mocks.NewMockShortDAO(mock)
+
+			var existing *shortener.Short
+			if test.GetError == nil {
+				existing = &shortener.Short{RedirectPath: "c3xd4d", OwnerID: pointerInt64(5), Template: test.Template, Schedule: test.Schedule}
+			}
+			dao.EXPECT().GetShort(gomock.Any(), gomock.Any(), gomock.Any(), "c3xd4d").Return(existing, test.GetError).Times(1)
+
+			times := 0
+			if test.ExpectUpdate {
+				times = 1
+			}
+			dao.
+				EXPECT().
+				UpdateShort(gomock.Any(), gomock.Any(), gomock.Any(), gomock.AssignableToTypeOf(shortener.Short{})).
+				DoAndReturn(func(_, _, _ interface{}, short shortener.Short) error {
+					if short.RedirectPath != "c3xd4d" {
+						t.Errorf("expected update of c3xd4d, got %s", short.RedirectPath)
+					}
+					return test.UpdateError
+				}).
+				Times(times)
+
+			router := mux.NewRouter()
+			router.HandleFunc("/short/{short}", withPrincipal(test.Principal, shortener.NewUpdateShortHandler(dao)))
+			server := httptest.NewServer(router)
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			response := e.PUT("/short/c3xd4d").WithJSON(&shortener.UpdateShortRequest{URL: test.URL}).WithHeader("Content-Type", "application/json").
+				Expect().
+				Status(test.ExpectedStatus)
+
+			if test.ExpectedStatus == http.StatusOK {
+				object := response.JSON().Object()
+				object.Value("redirect_path").String().Equal("c3xd4d")
+				object.Value("path").String().Equal("/soggycactus")
+			}
+		})
+	}
+}
+
+func TestDeleteShortHandler(t *testing.T) {
+	type testCase struct {
+		Name           string
+		Principal      *shortener.Principal
+		DeleteError    error
+		ExpectDelete   bool
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{
+			Name:           "Key That Created It",
+			Principal:      &shortener.Principal{APIKey: &shortener.APIKey{ID: 9, Scopes: []string{"manage"}}},
+			ExpectDelete:   true,
+			ExpectedStatus: http.StatusNoContent,
+		},
+		{
+			Name:           "Deleted Concurrently",
+			Principal:      &shortener.Principal{APIKey: &shortener.APIKey{ID: 9, Scopes: []string{"manage"}}},
+			DeleteError:    sql.ErrNoRows,
+			ExpectDelete:   true,
+			ExpectedStatus: http.StatusNotFound,
+		},
+		{
+			Name:           "Internal Error",
+			Principal:      &shortener.Principal{User: &shortener.User{ID: 1, IsAdmin: true}},
+			DeleteError:    errors.New("internal error"),
+			ExpectDelete:   true,
+			ExpectedStatus: http.StatusInternalServerError,
+		},
+		{
+			Name:           "Other User",
+			Principal:      &shortener.Principal{User: &shortener.User{ID: 6}},
+			ExpectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			dao := mocks.NewMockShortDAO(mock)
+			dao.
+				EXPECT().
+				GetShort(gomock.Any(), gomock.Any(), gomock.Any(), "c3xd4d").
+				Return(&shortener.Short{RedirectPath: "c3xd4d", CreatedByKeyID: pointerInt64(9)}, nil).
+				Times(1)
+
+			times := 0
+			if test.ExpectDelete {
+				times = 1
+			}
+			dao.EXPECT().DeleteShort(gomock.Any(), gomock.Any(), gomock.Any(), "c3xd4d").Return(test.DeleteError).Times(times)
+
+			router := mux.NewRouter()
+			router.HandleFunc("/short/{short}", withPrincipal(test.Principal, shortener.NewDeleteShortHandler(dao)))
+			server := httptest.NewServer(router)
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			e.DELETE("/short/c3xd4d").Expect().Status(test.ExpectedStatus)
+		})
+	}
+}
+
+// withPrincipal authenticates every request to handler as principal
+func withPrincipal(principal *shortener.Principal, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if principal != nil {
+			r = r.WithContext(shortener.ContextWithPrincipal(r.Context(), principal))
+		}
+		handler(w, r)
+	}
+}
+
+func pointerInt64(i int64) *int64 {
+	return &i
+}
+
 func pointerString(s string) *string {
 	return &s
 }
@@ -0,0 +1,188 @@
+package shortener
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// MigrationVersionQuery is the latest goose migration applied to the database
+const MigrationVersionQuery = "SELECT COALESCE(MAX(version_id), 0) FROM goose_db_version WHERE is_applied"
+
+// DefaultCheckTimeout bounds how long the readiness endpoint waits for its checks
+const DefaultCheckTimeout = 2 * time.Second
+
+const (
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+
+	StatusReady    = "ready"
+	StatusNotReady = "not_ready"
+	StatusDraining = "draining"
+)
+
+// HealthCheck reports on a dependency of the server. Check returns details describing its state,
+// and an error if it is unhealthy, which makes the server unready unless the check is Optional.
+type HealthCheck struct {
+	Name     string
+	Optional bool
+	Check    func(ctx context.Context) (interface{}, error)
+}
+
+// CheckResult is the outcome of a HealthCheck
+type CheckResult struct {
+	Status   string      `json:"status"`
+	Optional bool        `json:"optional,omitempty"`
+	Details  interface{} `json:"details,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// ReadinessResponse breaks readiness down by dependency
+type ReadinessResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// NewHealthzHandler reports that the process is alive, without looking at its dependencies
+func NewHealthzHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(ReadinessResponse{Status: StatusOK})
+	}
+}
+
+// NewReadyzHandler reports whether the server should receive traffic: it is not draining and none of
+// its required checks fail. Checks run concurrently, and count as failing if they take too long.
+func NewReadyzHandler(draining func() bool, checks ...HealthCheck) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+
+		if draining() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_ = json.NewEncoder(w).Encode(ReadinessResponse{Status: StatusDraining})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), DefaultCheckTimeout)
+		defer cancel()
+
+		results := runChecks(ctx, checks)
+
+		response := ReadinessResponse{Status: StatusReady, Checks: results}
+		for _, result := range results {
+			if result.Status != StatusOK && !result.Optional {
+				response.Status = StatusNotReady
+			}
+		}
+
+		if response.Status != StatusReady {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}
+}
+
+func runChecks(ctx context.Context, checks []HealthCheck) map[string]CheckResult {
+	results := make(map[string]CheckResult, len(checks))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+
+			result := CheckResult{Status: StatusOK, Optional: check.Optional}
+			details, err := check.Check(ctx)
+			result.Details = details
+			if err != nil {
+				result.Status = StatusFailing
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			results[check.Name] = result
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// DatabaseCheck pings the database
+func DatabaseCheck(db *sql.DB) HealthCheck {
+	return HealthCheck{
+		Name: "database",
+		Check: func(ctx context.Context) (interface{}, error) {
+			return nil, db.PingContext(ctx)
+		},
+	}
+}
+
+// MigrationVersion is the schema version the database is at, and the one the server expects
+type MigrationVersion struct {
+	Current int64 `json:"current"`
+	Latest  int64 `json:"latest"`
+}
+
+// MigrationsCheck fails until the database has every migration up to latest applied
+func MigrationsCheck(db *sql.DB, driver string, latest int64) HealthCheck {
+	return HealthCheck{
+		Name: "migrations",
+		Check: func(ctx context.Context) (interface{}, error) {
+			version := MigrationVersion{Latest: latest}
+
+			err := sqlx.NewDb(db, driver).GetContext(ctx, &version.Current, MigrationVersionQuery)
+			if err != nil {
+				return version, err
+			}
+
+			if version.Current < latest {
+				return version, fmt.Errorf("database is at version %d, expected %d", version.Current, latest)
+			}
+			return version, nil
+		},
+	}
+}
+
+// BlocklistCheck reports the lists loaded. A failed reload leaves the previous lists in place, so it
+// does not make the server unready.
+func BlocklistCheck(blocklist *Blocklist) HealthCheck {
+	return HealthCheck{
+		Name:     "blocklist",
+		Optional: true,
+		Check: func(context.Context) (interface{}, error) {
+			status := blocklist.Status()
+			if status.Error != "" {
+				return status, errors.New(status.Error)
+			}
+			return status, nil
+		},
+	}
+}
+
+// DomainCacheCheck reports the domains cached. A failed reload leaves the previous domains in place,
+// so it does not make the server unready.
+func DomainCacheCheck(cache *DomainCache) HealthCheck {
+	return HealthCheck{
+		Name:     "domains",
+		Optional: true,
+		Check: func(context.Context) (interface{}, error) {
+			status := cache.Status()
+			if status.Error != "" {
+				return status, errors.New(status.Error)
+			}
+			return status, nil
+		},
+	}
+}
@@ -0,0 +1,121 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"context"
+	"errors"
+	"l24.dev/shortener"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gavv/httpexpect/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthzHandler(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(shortener.NewHealthzHandler()))
+	defer server.Close()
+	e := httpexpect.New(t, server.URL)
+
+	e.GET("/").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().ValueEqual("status", "ok")
+}
+
+func TestReadyzHandler(t *testing.T) {
+	type testCase struct {
+		Name           string
+		Version        int64
+		PingErr        error
+		Draining       bool
+		ExpectedStatus int
+		Expected       string
+	}
+
+	testCases := []testCase{
+		{Name: "Ready", Version: 20211220101045, ExpectedStatus: http.StatusOK, Expected: shortener.StatusReady},
+		{Name: "Newer Schema", Version: 20220103090000, ExpectedStatus: http.StatusOK, Expected: shortener.StatusReady},
+		{Name: "Pending Migrations", Version: 20211213092210, ExpectedStatus: http.StatusServiceUnavailable, Expected: shortener.StatusNotReady},
+		{Name: "Database Down", Version: 20211220101045, PingErr: errors.New("connection refused"), ExpectedStatus: http.StatusServiceUnavailable, Expected: shortener.StatusNotReady},
+		{Name: "Draining", Draining: true, ExpectedStatus: http.StatusServiceUnavailable, Expected: shortener.StatusDraining},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			if !test.Draining {
+				mock.ExpectPing().WillReturnError(test.PingErr)
+				mock.ExpectQuery(regexp.QuoteMeta(shortener.MigrationVersionQuery)).
+					WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(test.Version))
+			}
+			mock.MatchExpectationsInOrder(false)
+
+			// a failing optional check is reported without making the server unready
+			redis := shortener.HealthCheck{
+				Name:     "redis",
+				Optional: true,
+				Check: func(context.Context) (interface{}, error) {
+					return nil, errors.New("dial tcp: i/o timeout")
+				},
+			}
+
+			handler := shortener.NewReadyzHandler(func() bool { return test.Draining },
+				shortener.DatabaseCheck(db),
+				shortener.MigrationsCheck(db, "postgres", 20211220101045),
+				redis,
+			)
+			server := httptest.NewServer(http.HandlerFunc(handler))
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			response := e.GET("/").
+				Expect().
+				Status(test.ExpectedStatus).
+				JSON().Object()
+			response.ValueEqual("status", test.Expected)
+
+			if !test.Draining {
+				checks := response.Value("checks").Object()
+				checks.Value("migrations").Object().Value("details").Object().
+					ValueEqual("current", test.Version).
+					ValueEqual("latest", 20211220101045)
+				checks.Value("redis").Object().
+					ValueEqual("status", shortener.StatusFailing).
+					ValueEqual("optional", true)
+			}
+			assert.Nil(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestBlocklistCheck(t *testing.T) {
+	blocklist, dir := newTestBlocklist(t)
+	check := shortener.BlocklistCheck(blocklist)
+
+	details, err := check.Check(context.Background())
+	assert.Nil(t, err)
+	status := details.(shortener.BlocklistStatus)
+	assert.Equal(t, blocklist.Size(), status.Entries)
+	assert.WithinDuration(t, time.Now(), status.LoadedAt, time.Minute)
+
+	assert.Nil(t, os.Remove(filepath.Join(dir, "hosts")))
+	assert.NotNil(t, blocklist.Reload())
+
+	details, err = check.Check(context.Background())
+	assert.NotNil(t, err, "a failed reload should be reported")
+	assert.Equal(t, status.Entries, details.(shortener.BlocklistStatus).Entries, "the previous entries should still be counted")
+	assert.True(t, check.Optional)
+}
@@ -0,0 +1,118 @@
+package shortener
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type logFieldsContextKey struct{}
+
+// logFields describe the request a line is logged while serving
+type logFields struct {
+	route string
+	short string
+}
+
+// ParseLogLevel parses a level like debug, info, warn or error
+func ParseLogLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(value))
+	return level, err
+}
+
+// NewLogger logs JSON lines to w from level up. Lines logged with the context of a request carry its
+// request ID, route and short.
+func NewLogger(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(contextHandler{slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})})
+}
+
+// contextHandler adds the fields of the request in the context of a line to it
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestIDFromContext(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+
+	if fields, ok := ctx.Value(logFieldsContextKey{}).(logFields); ok {
+		record.AddAttrs(slog.String("route", fields.route))
+		if fields.short != "" {
+			record.AddAttrs(slog.String("short", fields.short))
+		}
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// NewLoggingMiddleware adds the route and short of each request to the lines logged while serving it.
+// Once served, one request in every sampling is logged with its status and latency, and every server
+// error is. A sampling of 0 logs nothing but server errors.
+//
+// Access logs hold the path of the request and the destination it was redirected to, but never their
+// query strings, which may carry tokens.
+func NewLoggingMiddleware(sampling int) mux.MiddlewareFunc {
+	var served uint64
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), logFieldsContextKey{}, logFields{
+				route: routeTemplate(r),
+				short: mux.Vars(r)["short"],
+			})
+
+			started := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r.WithContext(ctx))
+			latency := time.Since(started)
+
+			status := recorder.Status()
+			if status < http.StatusInternalServerError && (sampling <= 0 || atomic.AddUint64(&served, 1)%uint64(sampling) != 0) {
+				return
+			}
+
+			attrs := []any{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Float64("latency_ms", float64(latency)/float64(time.Millisecond)),
+			}
+			if location := recorder.Header().Get("Location"); location != "" {
+				attrs = append(attrs, slog.String("destination", loggableURL(location)))
+			}
+
+			slog.InfoContext(ctx, "served request", attrs...)
+		})
+	}
+}
+
+// loggableURL strips the credentials, query and fragment off a URL
+func loggableURL(location string) string {
+	URL, err := url.Parse(location)
+	if err != nil {
+		return "unparsable"
+	}
+
+	URL.RawQuery = ""
+	URL.ForceQuery = false
+	URL.Fragment = ""
+	URL.RawFragment = ""
+	URL.User = nil
+	return URL.String()
+}
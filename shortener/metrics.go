@@ -0,0 +1,155 @@
+package shortener
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons short creation can fail for, besides the ones reported to clients as bad requests
+const (
+	ReasonForbidden = "forbidden"
+	ReasonExists    = "exists"
+	ReasonInternal  = "internal"
+)
+
+// Metrics are the Prometheus metrics of the shortener. A nil *Metrics records nothing.
+type Metrics struct {
+	requests       *prometheus.CounterVec
+	latency        *prometheus.HistogramVec
+	redirects      *prometheus.CounterVec
+	notFound       prometheus.Counter
+	creationErrors *prometheus.CounterVec
+	domainHits     prometheus.Counter
+	domainMisses   prometheus.Counter
+}
+
+// NewMetrics creates the metrics of the shortener and registers them with registerer
+func NewMetrics(registerer prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "l24_http_requests_total",
+			Help: "HTTP requests served, by route template, method and status code.",
+		}, []string{"route", "method", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "l24_http_request_duration_seconds",
+			Help:    "Time taken to serve HTTP requests, by route template and method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		redirects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "l24_redirects_total",
+			Help: "Visitors redirected to the destination of a short, by status code.",
+		}, []string{"status"}),
+		notFound: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "l24_shorts_not_found_total",
+			Help: "Visits to shorts that do not exist or cannot be served.",
+		}),
+		creationErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "l24_short_creation_errors_total",
+			Help: "Requests to create a short that were turned down, by reason.",
+		}, []string{"reason"}),
+		domainHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "l24_domain_cache_hits_total",
+			Help: "Domain lookups answered from memory, including hosts remembered as unregistered.",
+		}),
+		domainMisses: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "l24_domain_cache_misses_total",
+			Help: "Domain lookups that had to query the database.",
+		}),
+	}
+
+	registerer.MustRegister(m.requests, m.latency, m.redirects, m.notFound, m.creationErrors, m.domainHits, m.domainMisses)
+
+	return m
+}
+
+// Middleware counts and times requests by the template of the route they matched, like /{short},
+// so the number of series does not grow with the number of shorts
+func (m *Metrics) Middleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := routeTemplate(r)
+
+			started := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+
+			m.requests.WithLabelValues(route, r.Method, strconv.Itoa(recorder.Status())).Inc()
+			m.latency.WithLabelValues(route, r.Method).Observe(time.Since(started).Seconds())
+		})
+	}
+}
+
+func (m *Metrics) redirected(status int) {
+	if m == nil {
+		return
+	}
+	m.redirects.WithLabelValues(strconv.Itoa(status)).Inc()
+}
+
+func (m *Metrics) shortNotFound() {
+	if m == nil {
+		return
+	}
+	m.notFound.Inc()
+}
+
+// creationFailed counts a short that could not be created, for the reason given by err when it is
+// a *URLError, or reason otherwise
+func (m *Metrics) creationFailed(reason string, err error) {
+	if m == nil {
+		return
+	}
+
+	var urlErr *URLError
+	if errors.As(err, &urlErr) {
+		reason = urlErr.Reason
+	}
+	m.creationErrors.WithLabelValues(reason).Inc()
+}
+
+func (m *Metrics) domainCacheHit() {
+	if m == nil {
+		return
+	}
+	m.domainHits.Inc()
+}
+
+func (m *Metrics) domainCacheMiss() {
+	if m == nil {
+		return
+	}
+	m.domainMisses.Inc()
+}
+
+// statusRecorder remembers the status code written through it
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Status is the status code of the response, 200 if the handler wrote nothing
+func (r *statusRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
@@ -0,0 +1,79 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"database/sql"
+	"l24.dev/shortener"
+	"l24.dev/test/mocks"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	mock := gomock.NewController(t)
+	dao := mocks.NewMockShortDAO(mock)
+
+	dao.EXPECT().GetShort(gomock.Any(), shortener.DefaultWorkspaceID, shortener.DefaultDomainID, "c3xd4d").
+		Return(&shortener.Short{RedirectPath: "c3xd4d", Scheme: "https", Host: "lucastephens.com"}, nil).
+		Times(2)
+	dao.EXPECT().GetShort(gomock.Any(), shortener.DefaultWorkspaceID, shortener.DefaultDomainID, "missing").
+		Return(nil, sql.ErrNoRows)
+	dao.EXPECT().InsertShort(gomock.Any(), shortener.DefaultWorkspaceID, shortener.DefaultDomainID, gomock.Any()).
+		Return(shortener.ErrShortExists)
+
+	registry := prometheus.NewRegistry()
+	metrics := shortener.NewMetrics(registry)
+
+	router := mux.NewRouter()
+	router.Use(metrics.Middleware())
+	router.HandleFunc("/short", shortener.NewCreateShortHandler(dao, shortener.WithMetrics(metrics))).Methods(http.MethodPost)
+	router.HandleFunc("/{short}", shortener.NewGetShortHandler(dao, shortener.WithMetrics(metrics))).Methods(http.MethodGet)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+	e := httpexpect.New(t, server.URL).Builder(func(r *httpexpect.Request) {
+		r.WithRedirectPolicy(httpexpect.DontFollowRedirects)
+	})
+
+	e.GET("/c3xd4d").Expect().Status(http.StatusMovedPermanently)
+	e.GET("/c3xd4d").Expect().Status(http.StatusMovedPermanently)
+	e.GET("/missing").Expect().Status(http.StatusNotFound)
+	e.POST("/short").WithJSON(shortener.CreateShortRequest{URL: "http://127.0.0.1/admin"}).WithHeader("Content-Type", "application/json").Expect().Status(http.StatusBadRequest)
+	e.POST("/short").WithJSON(shortener.CreateShortRequest{URL: "lucastephens.com", Alias: "docs"}).WithHeader("Content-Type", "application/json").Expect().Status(http.StatusConflict)
+	e.POST("/short").WithJSON(shortener.CreateShortRequest{URL: "lucastephens.com", Alias: "docs/v2"}).WithHeader("Content-Type", "application/json").Expect().Status(http.StatusBadRequest)
+
+	count, err := testutil.GatherAndCount(registry, "l24_http_request_duration_seconds")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count, "latency should have a series per route, not per short")
+
+	expected := `
+# HELP l24_http_requests_total HTTP requests served, by route template, method and status code.
+# TYPE l24_http_requests_total counter
+l24_http_requests_total{method="GET",route="/{short}",status="301"} 2
+l24_http_requests_total{method="GET",route="/{short}",status="404"} 1
+l24_http_requests_total{method="POST",route="/short",status="400"} 2
+l24_http_requests_total{method="POST",route="/short",status="409"} 1
+# HELP l24_redirects_total Visitors redirected to the destination of a short, by status code.
+# TYPE l24_redirects_total counter
+l24_redirects_total{status="301"} 2
+# HELP l24_shorts_not_found_total Visits to shorts that do not exist or cannot be served.
+# TYPE l24_shorts_not_found_total counter
+l24_shorts_not_found_total 1
+# HELP l24_short_creation_errors_total Requests to create a short that were turned down, by reason.
+# TYPE l24_short_creation_errors_total counter
+l24_short_creation_errors_total{reason="exists"} 1
+l24_short_creation_errors_total{reason="invalid_alias"} 1
+l24_short_creation_errors_total{reason="private_address"} 1
+`
+	assert.Nil(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "l24_http_requests_total", "l24_redirects_total", "l24_shorts_not_found_total", "l24_short_creation_errors_total"))
+}
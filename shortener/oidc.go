@@ -0,0 +1,323 @@
+package shortener
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const (
+	OIDCCookieName     = "l24_oidc"
+	OIDCCookieMaxAge   = 10 * time.Minute
+	DefaultGroupsClaim = "groups"
+
+	IdentityLinkTokenPrefix = "l24l_"
+	IdentityLinkTTL         = 15 * time.Minute
+
+	// RoleAdmin in a group mapping without a workspace makes members of the group instance admins
+	RoleAdmin Role = "admin"
+)
+
+var (
+	// ErrOIDCState is returned when a callback does not belong to a login started by this browser
+	ErrOIDCState = errors.New("oidc state mismatch")
+	// ErrIdentityLinkRequired is returned when an identity logs in for the first time with the email of an
+	// account that has a password, which only the owner of that account can link it to
+	ErrIdentityLinkRequired = errors.New("identity must be linked by the owner of the account")
+	// ErrIdentityLinked is returned when linking an identity that already belongs to a user
+	ErrIdentityLinked = errors.New("identity already linked")
+)
+
+// OIDCConfig configures single sign-on against an OpenID Connect provider
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	GroupsClaim  string
+	GroupRoles   []GroupRole
+}
+
+// GroupRole grants members of an identity provider group a role in a workspace, or
+// makes them instance admins when Workspace is empty and Role is RoleAdmin
+type GroupRole struct {
+	Group     string
+	Workspace string
+	Role      Role
+}
+
+// ParseGroupRoles parses a comma separated list of group mappings, each either
+// "group=admin" or "group=workspace:role", e.g. "sre=admin,growth=marketing:editor"
+func ParseGroupRoles(value string) ([]GroupRole, error) {
+	var mappings []GroupRole
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("group mapping %q must look like group=admin or group=workspace:role", entry)
+		}
+
+		mapping := GroupRole{Group: parts[0]}
+		if parts[1] == string(RoleAdmin) {
+			mapping.Role = RoleAdmin
+			mappings = append(mappings, mapping)
+			continue
+		}
+
+		target := strings.SplitN(parts[1], ":", 2)
+		if len(target) != 2 {
+			return nil, fmt.Errorf("group mapping %q must look like group=admin or group=workspace:role", entry)
+		}
+
+		mapping.Workspace, mapping.Role = target[0], Role(target[1])
+		if mapping.Workspace == DefaultWorkspaceSlug {
+			return nil, fmt.Errorf("group mapping %q: the default workspace has no members", entry)
+		}
+		if err := ValidateRole(mapping.Role); err != nil {
+			return nil, fmt.Errorf("group mapping %q: %w", entry, err)
+		}
+
+		mappings = append(mappings, mapping)
+	}
+
+	return mappings, nil
+}
+
+// Grants is what a set of groups is mapped to: instance admin, and the highest role in each workspace
+type Grants struct {
+	Admin      bool
+	Workspaces map[string]Role
+}
+
+// MapGroups works out what groups are granted by mappings
+func MapGroups(mappings []GroupRole, groups []string) Grants {
+	grants := Grants{Workspaces: map[string]Role{}}
+
+	member := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		member[group] = true
+	}
+
+	for _, mapping := range mappings {
+		if !member[mapping.Group] {
+			continue
+		}
+
+		if mapping.Workspace == "" {
+			grants.Admin = grants.Admin || mapping.Role == RoleAdmin
+			continue
+		}
+
+		if !grants.Workspaces[mapping.Workspace].AtLeast(mapping.Role) {
+			grants.Workspaces[mapping.Workspace] = mapping.Role
+		}
+	}
+
+	return grants
+}
+
+// OIDCIdentity is who the provider says logged in. Users are matched on the issuer and subject, which
+// unlike the email never change hands.
+type OIDCIdentity struct {
+	Issuer  string
+	Subject string
+	Email   string
+	Groups  []string
+}
+
+// IdentityLink is an identity waiting to be linked to an account with a password, identified by the hash
+// of the token handed to whoever logged in with the identity
+type IdentityLink struct {
+	UserID    int64     `db:"user_id"`
+	Issuer    string    `db:"issuer"`
+	Subject   string    `db:"subject"`
+	TokenHash string    `db:"token_hash"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+// GenerateIdentityLink creates a link from identity to user, returning the plaintext token and the IdentityLink to store for it
+func GenerateIdentityLink(user *User, identity *OIDCIdentity, ttl time.Duration, now time.Time) (string, *IdentityLink, error) {
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	token := IdentityLinkTokenPrefix + secret
+
+	return token, &IdentityLink{
+		UserID:    user.ID,
+		Issuer:    identity.Issuer,
+		Subject:   identity.Subject,
+		TokenHash: HashToken(token),
+		ExpiresAt: now.Add(ttl),
+	}, nil
+}
+
+// OIDCProvider runs the authorization code flow with PKCE against an OpenID Connect provider
+type OIDCProvider struct {
+	config   OIDCConfig
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDCProvider discovers the provider at config.IssuerURL
+func NewOIDCProvider(ctx context.Context, config OIDCConfig) (*OIDCProvider, error) {
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = DefaultGroupsClaim
+	}
+
+	provider, err := oidc.NewProvider(ctx, config.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover oidc issuer %s: %w", config.IssuerURL, err)
+	}
+
+	return &OIDCProvider{
+		config: config,
+		oauth2: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+	}, nil
+}
+
+// oidcLogin is what a browser must bring back to the callback: the state and nonce it was sent off
+// with, and the PKCE verifier proving it is the one that started the login
+type oidcLogin struct {
+	state    string
+	nonce    string
+	verifier string
+}
+
+func newOIDCLogin() (*oidcLogin, error) {
+	var values [3]string
+	for i, length := range []int{16, 16, 32} {
+		value, err := randomHex(length)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+
+	return &oidcLogin{state: values[0], nonce: values[1], verifier: values[2]}, nil
+}
+
+// PKCEChallenge derives the S256 code challenge sent to the provider for verifier
+func PKCEChallenge(verifier string) string {
+	digest := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
+
+// authCodeURL returns where to send the browser to log in
+func (p *OIDCProvider) authCodeURL(login *oidcLogin) string {
+	return p.oauth2.AuthCodeURL(login.state,
+		oidc.Nonce(login.nonce),
+		oauth2.SetAuthURLParam("code_challenge", PKCEChallenge(login.verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+}
+
+// exchange trades an authorization code for the identity in its verified ID token
+func (p *OIDCProvider) exchange(ctx context.Context, login *oidcLogin, code string) (*OIDCIdentity, error) {
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", login.verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(login.nonce)) != 1 {
+		return nil, errors.New("id token nonce mismatch")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("cannot read id token claims: %w", err)
+	}
+
+	email, _ := claims["email"].(string)
+	if verified, _ := claims["email_verified"].(bool); !verified {
+		return nil, fmt.Errorf("email %s is not verified", email)
+	}
+
+	email, err = NormalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &OIDCIdentity{Issuer: idToken.Issuer, Subject: idToken.Subject, Email: email}
+
+	groups, _ := claims[p.config.GroupsClaim].([]interface{})
+	for _, group := range groups {
+		if name, ok := group.(string); ok {
+			identity.Groups = append(identity.Groups, name)
+		}
+	}
+
+	return identity, nil
+}
+
+// newOIDCCookie carries login through the provider and back to the callback
+func newOIDCCookie(r *http.Request, login *oidcLogin) *http.Cookie {
+	return &http.Cookie{
+		Name:     OIDCCookieName,
+		Value:    strings.Join([]string{login.state, login.nonce, login.verifier}, "."),
+		Path:     "/auth/oidc",
+		MaxAge:   int(OIDCCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// oidcLoginFromRequest recovers the login a callback belongs to, checking its state matches
+func oidcLoginFromRequest(r *http.Request) (*oidcLogin, error) {
+	cookie, err := r.Cookie(OIDCCookieName)
+	if err != nil {
+		return nil, ErrOIDCState
+	}
+
+	parts := strings.SplitN(cookie.Value, ".", 3)
+	if len(parts) != 3 {
+		return nil, ErrOIDCState
+	}
+
+	login := &oidcLogin{state: parts[0], nonce: parts[1], verifier: parts[2]}
+
+	state := r.URL.Query().Get("state")
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(login.state)) != 1 {
+		return nil, ErrOIDCState
+	}
+
+	return login, nil
+}
+
+// isSecureRequest reports whether the request reached us, or the proxy in front of us, over TLS
+func isSecureRequest(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
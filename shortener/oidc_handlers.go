@@ -0,0 +1,241 @@
+package shortener
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// NewOIDCLoginHandler sends the browser to the identity provider to log in
+func NewOIDCLoginHandler(provider *OIDCProvider) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		login, err := newOIDCLogin()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to start oidc login", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		http.SetCookie(w, newOIDCCookie(r, login))
+		http.Redirect(w, r, provider.authCodeURL(login), http.StatusFound)
+	}
+}
+
+// LinkRequiredResponse is returned by the callback when an identity logs in for the first time with the
+// email of an account that has a password. The token links the two once the account's password confirms it.
+type LinkRequiredResponse struct {
+	Error     string    `json:"error"`
+	Message   string    `json:"message"`
+	LinkToken string    `json:"link_token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type LinkIdentityRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// NewOIDCCallbackHandler completes a login started by NewOIDCLoginHandler. The user is created on their
+// first login and issued a session like a password login. Their admin rights and the workspace roles their
+// groups map to are set again on every login, so leaving a group takes away what it granted.
+func NewOIDCCallbackHandler(provider *OIDCProvider, users UserDAO, workspaces WorkspaceDAO, opts ...HandlerOption) func(w http.ResponseWriter, r *http.Request) {
+	options := newHandlerOptions(opts)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		login, err := oidcLoginFromRequest(r)
+		if err != nil {
+			slog.WarnContext(r.Context(), "rejected oidc callback", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{Name: OIDCCookieName, Path: "/auth/oidc", MaxAge: -1})
+
+		if reason := r.URL.Query().Get("error"); reason != "" {
+			slog.InfoContext(r.Context(), "oidc login failed at the provider", "reason", reason)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		identity, err := provider.exchange(r.Context(), login, r.URL.Query().Get("code"))
+		if err != nil {
+			slog.WarnContext(r.Context(), "failed oidc login", "error", err)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		user, err := userForIdentity(r.Context(), users, identity)
+		if err == ErrIdentityLinkRequired {
+			writeLinkRequired(w, r, users, user, identity, options.clock.Now())
+			return
+		}
+		if err == sql.ErrNoRows || err == ErrIdentityLinked || err == ErrUserExists {
+			slog.WarnContext(r.Context(), "identity cannot be linked to the account with its email", "user", identity.Email, "subject", identity.Subject, "error", err)
+			http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to find user", "user", identity.Email, "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		grants := MapGroups(provider.config.GroupRoles, identity.Groups)
+
+		if user.IsAdmin != grants.Admin {
+			err = users.SetAdmin(r.Context(), user.ID, grants.Admin)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "failed to set admin", "user", user.Email, "admin", grants.Admin, "error", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			user.IsAdmin = grants.Admin
+		}
+
+		roles := make(map[int64]Role, len(grants.Workspaces))
+		for slug, role := range grants.Workspaces {
+			workspace, err := workspaces.GetWorkspaceBySlug(r.Context(), slug)
+			if err == sql.ErrNoRows {
+				slog.WarnContext(r.Context(), "groups map to unknown workspace", "user", user.Email, "workspace", slug)
+				continue
+			}
+			if err != nil {
+				slog.ErrorContext(r.Context(), "failed to get workspace", "user", user.Email, "workspace", slug, "error", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			roles[workspace.ID] = role
+		}
+
+		err = workspaces.SyncGroupMemberships(r.Context(), user.ID, roles)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to grant roles", "user", user.Email, "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		token, session, err := GenerateSession(user, options.sessionTTL, options.clock.Now())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to generate session", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		err = users.InsertSession(r.Context(), *session)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to insert session", "user", user.Email, "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(LoginResponse{Token: token, ExpiresAt: session.ExpiresAt, User: user})
+	}
+}
+
+// NewOIDCLinkHandler links an identity to the account with a password registered with its email. It takes
+// the token the callback handed to whoever logged in with the identity, and the password of the account,
+// so only someone holding both can link them.
+func NewOIDCLinkHandler(users UserDAO) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request LinkIdentityRequest
+
+		err := DecodeJSONBody(w, r, &request)
+		if err != nil {
+			slog.InfoContext(r.Context(), "failed to decode json body", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		tokenHash := HashToken(request.Token)
+
+		user, err := users.GetUserByIdentityLink(r.Context(), tokenHash)
+		if err != nil && err != sql.ErrNoRows {
+			slog.ErrorContext(r.Context(), "failed to look up identity link", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if !CheckPassword(user, request.Password) {
+			slog.WarnContext(r.Context(), "failed to confirm identity link")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		err = users.ConfirmIdentityLink(r.Context(), tokenHash)
+		if err == sql.ErrNoRows {
+			slog.InfoContext(r.Context(), "identity link expired", "user", user.Email)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		if err == ErrIdentityLinked {
+			slog.WarnContext(r.Context(), "identity already linked", "user", user.Email)
+			http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to confirm identity link", "user", user.Email, "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// userForIdentity returns the user identity belongs to. On its first login, an identity gets an account
+// of its own, or takes over the one registered with its email if that has no password and no other
+// identity from the issuer. An account with a password is never linked without its owner, so it is
+// returned along with ErrIdentityLinkRequired.
+func userForIdentity(ctx context.Context, users UserDAO, identity *OIDCIdentity) (*User, error) {
+	user, err := users.GetUserByIdentity(ctx, identity.Issuer, identity.Subject)
+	if err != sql.ErrNoRows {
+		return user, err
+	}
+
+	user, err = users.GetUserByEmail(ctx, identity.Email)
+	if err == sql.ErrNoRows {
+		user = &User{Email: identity.Email}
+		return user, users.InsertExternalUser(ctx, user, identity.Issuer, identity.Subject)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.PasswordHash != nil {
+		return user, ErrIdentityLinkRequired
+	}
+
+	return user, users.LinkIdentity(ctx, user.ID, identity.Issuer, identity.Subject)
+}
+
+// writeLinkRequired hands whoever logged in with identity a token to link it to user with their password
+func writeLinkRequired(w http.ResponseWriter, r *http.Request, users UserDAO, user *User, identity *OIDCIdentity, now time.Time) {
+	token, link, err := GenerateIdentityLink(user, identity, IdentityLinkTTL, now)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to generate identity link", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	err = users.InsertIdentityLink(r.Context(), *link)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to insert identity link", "user", user.Email, "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "identity must be linked to an account with a password", "user", user.Email, "subject", identity.Subject)
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	_ = json.NewEncoder(w).Encode(LinkRequiredResponse{
+		Error:     http.StatusText(http.StatusConflict),
+		Message:   "an account with a password is registered with this email, confirm its password to link it",
+		LinkToken: token,
+		ExpiresAt: link.ExpiresAt,
+	})
+}
@@ -0,0 +1,374 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"l24.dev/shortener"
+	"l24.dev/test/issuer"
+	"l24.dev/test/mocks"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGroupRoles(t *testing.T) {
+	type testCase struct {
+		Name       string
+		Value      string
+		Expected   []shortener.GroupRole
+		ShouldFail bool
+	}
+
+	testCases := []testCase{
+		{Name: "Empty", Value: "", Expected: nil},
+		{
+			Name:  "Admin And Workspace",
+			Value: "sre=admin, growth=marketing:editor",
+			Expected: []shortener.GroupRole{
+				{Group: "sre", Role: shortener.RoleAdmin},
+				{Group: "growth", Workspace: "marketing", Role: shortener.RoleEditor},
+			},
+		},
+		{Name: "Missing Role", Value: "growth=marketing", ShouldFail: true},
+		{Name: "Unknown Role", Value: "growth=marketing:superuser", ShouldFail: true},
+		{Name: "Default Workspace", Value: "everyone=default:viewer", ShouldFail: true},
+		{Name: "Missing Group", Value: "=admin", ShouldFail: true},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mappings, err := shortener.ParseGroupRoles(test.Value)
+			assert.Equal(t, test.ShouldFail, err != nil, "ShouldFail is %v, got %v", test.ShouldFail, err)
+			if err == nil {
+				assert.Equal(t, test.Expected, mappings)
+			}
+		})
+	}
+}
+
+func TestMapGroups(t *testing.T) {
+	mappings := []shortener.GroupRole{
+		{Group: "sre", Role: shortener.RoleAdmin},
+		{Group: "staff", Workspace: "marketing", Role: shortener.RoleViewer},
+		{Group: "growth", Workspace: "marketing", Role: shortener.RoleEditor},
+		{Group: "growth-leads", Workspace: "marketing", Role: shortener.RoleOwner},
+	}
+
+	grants := shortener.MapGroups(mappings, []string{"growth", "staff", "unrelated"})
+	assert.False(t, grants.Admin, "growth should not be admins")
+	assert.Equal(t, map[string]shortener.Role{"marketing": shortener.RoleEditor}, grants.Workspaces, "the highest role should win")
+
+	grants = shortener.MapGroups(mappings, []string{"sre"})
+	assert.True(t, grants.Admin, "sre should be admins")
+	assert.Empty(t, grants.Workspaces, "sre should have no workspace roles")
+}
+
+// oidcServer serves the login and callback handlers for a provider registered with a mock issuer
+func oidcServer(t *testing.T, users shortener.UserDAO, workspaces shortener.WorkspaceDAO, mappings string) (*httptest.Server, *issuer.Issuer) {
+	t.Helper()
+
+	idp, err := issuer.New("l24", "s3cret")
+	if err != nil {
+		t.Fatalf("failed to start issuer: %v", err)
+	}
+	t.Cleanup(idp.Close)
+
+	router := mux.NewRouter()
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	groupRoles, err := shortener.ParseGroupRoles(mappings)
+	if err != nil {
+		t.Fatalf("invalid group mappings: %v", err)
+	}
+
+	provider, err := shortener.NewOIDCProvider(context.Background(), shortener.OIDCConfig{
+		IssuerURL:    idp.URL,
+		ClientID:     "l24",
+		ClientSecret: "s3cret",
+		RedirectURL:  server.URL + "/auth/oidc/callback",
+		GroupRoles:   groupRoles,
+	})
+	if err != nil {
+		t.Fatalf("failed to discover issuer: %v", err)
+	}
+
+	router.HandleFunc("/auth/oidc/login", shortener.NewOIDCLoginHandler(provider))
+	router.HandleFunc("/auth/oidc/callback", shortener.NewOIDCCallbackHandler(provider, users, workspaces))
+
+	return server, idp
+}
+
+func browser(t *testing.T) *http.Client {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("failed to create cookie jar: %v", err)
+	}
+	return &http.Client{Jar: jar}
+}
+
+// oidcLogin logs in through server with a browser, returning the response of the callback
+func oidcLogin(t *testing.T, server *httptest.Server) *http.Response {
+	t.Helper()
+
+	response, err := browser(t).Get(server.URL + "/auth/oidc/login")
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+
+	return response
+}
+
+func TestOIDCLogin(t *testing.T) {
+	mock := gomock.NewController(t)
+	users := mocks.NewMockUserDAO(mock)
+	workspaces := mocks.NewMockWorkspaceDAO(mock)
+
+	server, idp := oidcServer(t, users, workspaces, "sre=admin,growth=marketing:editor")
+	idp.SetClaims(map[string]interface{}{
+		"email":          "Ada@Example.com",
+		"email_verified": true,
+		"groups":         []string{"sre", "growth"},
+	})
+
+	users.EXPECT().GetUserByIdentity(gomock.Any(), idp.URL, "subject").Return(nil, sql.ErrNoRows).Times(1)
+	users.EXPECT().GetUserByEmail(gomock.Any(), "ada@example.com").Return(nil, sql.ErrNoRows).Times(1)
+	users.
+		EXPECT().
+		InsertExternalUser(gomock.Any(), &shortener.User{Email: "ada@example.com"}, idp.URL, "subject").
+		DoAndReturn(func(_ interface{}, user *shortener.User, _, _ string) error {
+			user.ID = 5
+			return nil
+		}).
+		Times(1)
+	users.EXPECT().SetAdmin(gomock.Any(), int64(5), true).Return(nil).Times(1)
+	workspaces.EXPECT().GetWorkspaceBySlug(gomock.Any(), "marketing").Return(marketing, nil).Times(1)
+	workspaces.EXPECT().SyncGroupMemberships(gomock.Any(), int64(5), map[int64]shortener.Role{marketing.ID: shortener.RoleEditor}).Return(nil).Times(1)
+	users.EXPECT().InsertSession(gomock.Any(), gomock.AssignableToTypeOf(shortener.Session{})).Return(nil).Times(1)
+
+	response := oidcLogin(t, server)
+	assert.Equal(t, http.StatusOK, response.StatusCode, "login should succeed")
+
+	var login shortener.LoginResponse
+	err := json.NewDecoder(response.Body).Decode(&login)
+	assert.Nil(t, err, "response should be a login response")
+	assert.True(t, shortener.IsSessionToken(login.Token), "a session should be issued")
+	assert.True(t, login.User.IsAdmin, "sre should be admins")
+}
+
+func TestOIDCLoginRevokesGroupGrants(t *testing.T) {
+	mock := gomock.NewController(t)
+	users := mocks.NewMockUserDAO(mock)
+	workspaces := mocks.NewMockWorkspaceDAO(mock)
+
+	server, idp := oidcServer(t, users, workspaces, "sre=admin,growth=marketing:editor")
+	idp.SetClaims(map[string]interface{}{
+		"email":          "ada@example.com",
+		"email_verified": true,
+		"groups":         []string{"staff"},
+	})
+
+	// no longer in sre nor growth, so neither admin nor a marketing editor
+	users.
+		EXPECT().
+		GetUserByIdentity(gomock.Any(), idp.URL, "subject").
+		Return(&shortener.User{ID: 5, Email: "ada@example.com", IsAdmin: true}, nil).
+		Times(1)
+	users.EXPECT().SetAdmin(gomock.Any(), int64(5), false).Return(nil).Times(1)
+	workspaces.EXPECT().SyncGroupMemberships(gomock.Any(), int64(5), map[int64]shortener.Role{}).Return(nil).Times(1)
+	users.EXPECT().InsertSession(gomock.Any(), gomock.AssignableToTypeOf(shortener.Session{})).Return(nil).Times(1)
+
+	response := oidcLogin(t, server)
+	assert.Equal(t, http.StatusOK, response.StatusCode, "login should succeed")
+
+	var login shortener.LoginResponse
+	err := json.NewDecoder(response.Body).Decode(&login)
+	assert.Nil(t, err, "response should be a login response")
+	assert.False(t, login.User.IsAdmin, "admin should be revoked")
+}
+
+func TestOIDCLoginWithEmailOfPasswordAccount(t *testing.T) {
+	mock := gomock.NewController(t)
+	users := mocks.NewMockUserDAO(mock)
+	workspaces := mocks.NewMockWorkspaceDAO(mock)
+
+	server, idp := oidcServer(t, users, workspaces, "sre=admin")
+	idp.SetClaims(map[string]interface{}{
+		"email":          "ada@example.com",
+		"email_verified": true,
+		"groups":         []string{"sre"},
+	})
+
+	// whoever registered the email with a password must not get the identity, nor its admin rights
+	hash := "$2a$10$hash"
+	users.EXPECT().GetUserByIdentity(gomock.Any(), idp.URL, "subject").Return(nil, sql.ErrNoRows).Times(1)
+	users.
+		EXPECT().
+		GetUserByEmail(gomock.Any(), "ada@example.com").
+		Return(&shortener.User{ID: 5, Email: "ada@example.com", PasswordHash: &hash}, nil).
+		Times(1)
+	users.
+		EXPECT().
+		InsertIdentityLink(gomock.Any(), gomock.AssignableToTypeOf(shortener.IdentityLink{})).
+		DoAndReturn(func(_ interface{}, link shortener.IdentityLink) error {
+			assert.Equal(t, int64(5), link.UserID)
+			assert.Equal(t, idp.URL, link.Issuer)
+			assert.Equal(t, "subject", link.Subject)
+			return nil
+		}).
+		Times(1)
+
+	response := oidcLogin(t, server)
+	assert.Equal(t, http.StatusConflict, response.StatusCode, "the account should not be linked")
+
+	var link shortener.LinkRequiredResponse
+	err := json.NewDecoder(response.Body).Decode(&link)
+	assert.Nil(t, err, "response should say how to link the account")
+	assert.True(t, strings.HasPrefix(link.LinkToken, shortener.IdentityLinkTokenPrefix), "a link token should be issued")
+}
+
+func TestOIDCLinkHandler(t *testing.T) {
+	hash, err := shortener.HashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	owner := &shortener.User{ID: 5, Email: "ada@example.com", PasswordHash: &hash}
+
+	type testCase struct {
+		Name           string
+		Token          string
+		Password       string
+		ConfirmError   error
+		ExpectConfirm  bool
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{Name: "Confirmed", Token: "l24l_valid", Password: "correct horse", ExpectConfirm: true, ExpectedStatus: http.StatusNoContent},
+		{Name: "Wrong Password", Token: "l24l_valid", Password: "wrong horse", ExpectedStatus: http.StatusUnauthorized},
+		{Name: "Unknown Token", Token: "l24l_unknown", Password: "correct horse", ExpectedStatus: http.StatusUnauthorized},
+		{Name: "Already Linked", Token: "l24l_valid", Password: "correct horse", ConfirmError: shortener.ErrIdentityLinked, ExpectConfirm: true, ExpectedStatus: http.StatusConflict},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			users := mocks.NewMockUserDAO(mock)
+			users.EXPECT().GetUserByIdentityLink(gomock.Any(), shortener.HashToken("l24l_valid")).Return(owner, nil).AnyTimes()
+			users.EXPECT().GetUserByIdentityLink(gomock.Any(), shortener.HashToken("l24l_unknown")).Return(nil, sql.ErrNoRows).AnyTimes()
+
+			times := 0
+			if test.ExpectConfirm {
+				times = 1
+			}
+			users.EXPECT().ConfirmIdentityLink(gomock.Any(), shortener.HashToken(test.Token)).Return(test.ConfirmError).Times(times)
+
+			server := httptest.NewServer(http.HandlerFunc(shortener.NewOIDCLinkHandler(users)))
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			e.POST("/auth/oidc/link").
+				WithJSON(&shortener.LinkIdentityRequest{Token: test.Token, Password: test.Password}).WithHeader("Content-Type", "application/json").
+				Expect().
+				Status(test.ExpectedStatus)
+		})
+	}
+}
+
+func TestOIDCLoginRejected(t *testing.T) {
+	type testCase struct {
+		Name           string
+		Claims         map[string]interface{}
+		Tamper         func(callback *url.URL, cookie *http.Cookie)
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{
+			Name:           "State Mismatch",
+			Claims:         map[string]interface{}{"email": "ada@example.com"},
+			Tamper:         func(callback *url.URL, cookie *http.Cookie) { callback.RawQuery += "x" },
+			ExpectedStatus: http.StatusBadRequest,
+		},
+		{
+			Name:   "Wrong PKCE Verifier",
+			Claims: map[string]interface{}{"email": "ada@example.com"},
+			Tamper: func(callback *url.URL, cookie *http.Cookie) {
+				cookie.Value = cookie.Value[:strings.LastIndex(cookie.Value, ".")+1] + strings.Repeat("0", 64)
+			},
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:           "Unverified Email",
+			Claims:         map[string]interface{}{"email": "ada@example.com", "email_verified": false},
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:           "Email Not Known To Be Verified",
+			Claims:         map[string]interface{}{"email": "ada@example.com"},
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:           "No Email",
+			Claims:         map[string]interface{}{},
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			users := mocks.NewMockUserDAO(mock)
+			workspaces := mocks.NewMockWorkspaceDAO(mock)
+
+			server, idp := oidcServer(t, users, workspaces, "")
+			idp.SetClaims(test.Claims)
+
+			// walk through the redirects by hand, so the callback can be tampered with
+			client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+			response, err := client.Get(server.URL + "/auth/oidc/login")
+			if err != nil {
+				t.Fatalf("login failed: %v", err)
+			}
+			response.Body.Close()
+			cookie := response.Cookies()[0]
+
+			response, err = client.Get(response.Header.Get("Location"))
+			if err != nil {
+				t.Fatalf("authorize failed: %v", err)
+			}
+			response.Body.Close()
+
+			callback, err := url.Parse(response.Header.Get("Location"))
+			if err != nil {
+				t.Fatalf("bad callback: %v", err)
+			}
+			if test.Tamper != nil {
+				test.Tamper(callback, cookie)
+			}
+
+			request, _ := http.NewRequest(http.MethodGet, callback.String(), nil)
+			request.AddCookie(cookie)
+			response, err = client.Do(request)
+			if err != nil {
+				t.Fatalf("callback failed: %v", err)
+			}
+			response.Body.Close()
+
+			assert.Equal(t, test.ExpectedStatus, response.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package shortener
+
+import (
+	"net/url"
+	"time"
+)
+
+// HandlerOption customises the behaviour of the handlers built by this package
+type HandlerOption func(*handlerOptions)
+
+type handlerOptions struct {
+	clock      Clock
+	sessionTTL time.Duration
+	urlPolicy  URLPolicy
+	blocklist  *Blocklist
+
+	unlockSecret []byte
+	unlockTTL    time.Duration
+
+	metrics *Metrics
+
+	baseURL *url.URL
+}
+
+func newHandlerOptions(opts []HandlerOption) *handlerOptions {
+	options := &handlerOptions{
+		clock:      SystemClock{},
+		sessionTTL: DefaultSessionTTL,
+		urlPolicy:  DefaultURLPolicy(),
+
+		unlockSecret: defaultUnlockSecret,
+		unlockTTL:    DefaultUnlockTTL,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return options
+}
+
+// WithClock replaces the wall clock used to evaluate schedules
+func WithClock(clock Clock) HandlerOption {
+	return func(o *handlerOptions) {
+		o.clock = clock
+	}
+}
+
+// WithSessionTTL sets how long sessions issued at login stay valid
+func WithSessionTTL(ttl time.Duration) HandlerOption {
+	return func(o *handlerOptions) {
+		o.sessionTTL = ttl
+	}
+}
+
+// WithURLPolicy sets which destinations shorts may be created with
+func WithURLPolicy(policy URLPolicy) HandlerOption {
+	return func(o *handlerOptions) {
+		o.urlPolicy = policy
+	}
+}
+
+// WithBlocklist stops redirects to destinations on blocklist, even before the shorts leading
+// to them have been marked as blocked
+func WithBlocklist(blocklist *Blocklist) HandlerOption {
+	return func(o *handlerOptions) {
+		o.blocklist = blocklist
+	}
+}
+
+// WithUnlockSecret sets the key signing the cookies that let visitors back into password protected
+// shorts. Replicas must share it. An empty secret keeps the random one generated at start.
+func WithUnlockSecret(secret []byte) HandlerOption {
+	return func(o *handlerOptions) {
+		if len(secret) > 0 {
+			o.unlockSecret = secret
+		}
+	}
+}
+
+// WithMetrics records redirects, missing shorts and failed creations in metrics
+func WithMetrics(metrics *Metrics) HandlerOption {
+	return func(o *handlerOptions) {
+		o.metrics = metrics
+	}
+}
+
+// WithBaseURL sets the URL shorts on the default domain are served from, like https://l24.dev, when
+// it cannot be told from the requests creating them, e.g. behind a proxy terminating TLS
+func WithBaseURL(baseURL *url.URL) HandlerOption {
+	return func(o *handlerOptions) {
+		o.baseURL = baseURL
+	}
+}
@@ -0,0 +1,44 @@
+package shortener
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+)
+
+// pageLayout wraps the pages shown to visitors in place of a redirect
+const pageLayout = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>{{template "title" .}}</title></head>
+<body>
+{{template "body" .}}
+</body>
+</html>
+`
+
+func newPage(name, content string) *template.Template {
+	return template.Must(template.Must(template.New(name).Parse(pageLayout)).Parse(content))
+}
+
+var disabledPage = newPage("disabled", `{{define "title"}}Link disabled{{end}}
+{{define "body"}}<h1>This link has been disabled</h1>
+<p>It was reported for breaking our rules and taken down by a moderator.</p>{{end}}`)
+
+var passwordPage = newPage("password", `{{define "title"}}Password required{{end}}
+{{define "body"}}<h1>This link is protected</h1>
+<form method="post">
+<label>Password <input type="password" name="password" autofocus required></label>
+<button type="submit">Continue</button>
+</form>
+{{if .Failed}}<p>That password is not right.</p>{{end}}{{end}}`)
+
+// renderPage writes a page for visitors, which must never be cached as they stand in for redirects
+func renderPage(w http.ResponseWriter, status int, page *template.Template, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	if err := page.Execute(w, data); err != nil {
+		slog.Error("failed to render page", "page", page.Name(), "error", err)
+	}
+}
@@ -0,0 +1,35 @@
+package shortener
+
+import (
+	"net/url"
+	"strings"
+)
+
+// MergeQuery adds incoming parameters to the stored ones. When both define a key the stored
+// values win, so a visitor cannot override parameters chosen by the owner of the short.
+func MergeQuery(stored, incoming url.Values) url.Values {
+	merged := url.Values{}
+
+	for key, values := range incoming {
+		merged[key] = append([]string(nil), values...)
+	}
+
+	for key, values := range stored {
+		merged[key] = append([]string(nil), values...)
+	}
+
+	return merged
+}
+
+// ApplyPassthrough appends the extra path segments a visitor requested to the destination path,
+// and merges the visitor's query parameters into the destination query
+func ApplyPassthrough(destination *url.URL, rest string, query url.Values) {
+	if rest != "" {
+		destination.Path = strings.TrimSuffix(destination.Path, "/") + "/" + strings.TrimPrefix(rest, "/")
+		destination.RawPath = ""
+	}
+
+	if len(query) > 0 {
+		destination.RawQuery = MergeQuery(destination.Query(), query).Encode()
+	}
+}
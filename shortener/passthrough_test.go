@@ -0,0 +1,170 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"l24.dev/shortener"
+	"l24.dev/test/mocks"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeQuery(t *testing.T) {
+	stored := url.Values{"lang": {"en"}, "ref": {"l24"}}
+	incoming := url.Values{"lang": {"de"}, "page": {"2", "3"}}
+
+	merged := shortener.MergeQuery(stored, incoming)
+
+	assert.Equal(t, []string{"en"}, merged["lang"], "stored values should win on conflict")
+	assert.Equal(t, []string{"l24"}, merged["ref"], "stored values should be kept")
+	assert.Equal(t, []string{"2", "3"}, merged["page"], "incoming values should be added")
+}
+
+func TestApplyPassthrough(t *testing.T) {
+	type testCase struct {
+		Name        string
+		Destination string
+		Rest        string
+		Query       url.Values
+		Expected    string
+	}
+
+	testCases := []testCase{
+		{
+			Name:        "Path Appended",
+			Destination: "https://docs.example.com/v2",
+			Rest:        "getting-started",
+			Expected:    "https://docs.example.com/v2/getting-started",
+		},
+		{
+			Name:        "Trailing Slash Not Doubled",
+			Destination: "https://docs.example.com/v2/",
+			Rest:        "guides/install/",
+			Expected:    "https://docs.example.com/v2/guides/install/",
+		},
+		{
+			Name:        "Host Only Destination",
+			Destination: "https://docs.example.com",
+			Rest:        "faq",
+			Expected:    "https://docs.example.com/faq",
+		},
+		{
+			Name:        "Segments Escaped",
+			Destination: "https://docs.example.com",
+			Rest:        "a b/c?d",
+			Expected:    "https://docs.example.com/a%20b/c%3Fd",
+		},
+		{
+			Name:        "Query Merged With Fragment Kept",
+			Destination: "https://docs.example.com/search?lang=en#results",
+			Rest:        "",
+			Query:       url.Values{"lang": {"de"}, "q": {"a&b"}},
+			Expected:    "https://docs.example.com/search?lang=en&q=a%26b#results",
+		},
+		{
+			Name:        "Stored Query Untouched Without Incoming",
+			Destination: "https://docs.example.com/search?z=1&a=2",
+			Rest:        "",
+			Expected:    "https://docs.example.com/search?z=1&a=2",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			destination, err := url.Parse(test.Destination)
+			if err != nil {
+				t.Fatalf("failed to parse destination: %v", err)
+			}
+
+			shortener.ApplyPassthrough(destination, test.Rest, test.Query)
+			assert.Equal(t, test.Expected, destination.String(), "destination should match")
+		})
+	}
+}
+
+func TestGetPassthroughShortHandler(t *testing.T) {
+	type testCase struct {
+		Name             string
+		Passthrough      bool
+		Path             string
+		Query            string
+		ExpectedStatus   int
+		ExpectedLocation string
+	}
+
+	testCases := []testCase{
+		{
+			Name:             "Passthrough Path",
+			Passthrough:      true,
+			Path:             "/docs/getting-started",
+			Query:            "lang=de&tab=cli",
+			ExpectedStatus:   http.StatusMovedPermanently,
+			ExpectedLocation: "https://docs.example.com/v2/getting-started?lang=en&tab=cli",
+		},
+		{
+			Name:             "Passthrough Without Suffix",
+			Passthrough:      true,
+			Path:             "/docs",
+			ExpectedStatus:   http.StatusMovedPermanently,
+			ExpectedLocation: "https://docs.example.com/v2?lang=en",
+		},
+		{
+			Name:           "Suffix On Plain Short",
+			Passthrough:    false,
+			Path:           "/docs/getting-started",
+			ExpectedStatus: http.StatusNotFound,
+		},
+		{
+			Name:             "Query Ignored On Plain Short",
+			Passthrough:      false,
+			Path:             "/docs",
+			Query:            "tab=cli",
+			ExpectedStatus:   http.StatusMovedPermanently,
+			ExpectedLocation: "https://docs.example.com/v2?lang=en",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			dao := mocks.NewMockShortDAO(mock)
+			dao.
+				EXPECT().
+				GetShort(gomock.Any(), gomock.Any(), gomock.Any(), "docs").
+				Return(&shortener.Short{
+					RedirectPath: "docs",
+					Scheme:       "https",
+					Host:         "docs.example.com",
+					Path:         pointerString("/v2"),
+					Query:        pointerString("lang=en"),
+					Passthrough:  test.Passthrough,
+				}, nil).
+				Times(1)
+
+			getShort := shortener.NewGetShortHandler(dao)
+			router := mux.NewRouter()
+			router.HandleFunc("/{short}", getShort)
+			router.HandleFunc("/{short}/{rest:.+}", getShort)
+			server := httptest.NewServer(router)
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			response := e.GET(test.Path).
+				WithQueryString(test.Query).
+				WithRedirectPolicy(httpexpect.DontFollowRedirects).
+				Expect().
+				Status(test.ExpectedStatus)
+
+			if test.ExpectedLocation != "" {
+				response.Header("Location").Equal(test.ExpectedLocation)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package shortener
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	UnlockCookieName = "l24_unlock"
+	DefaultUnlockTTL = time.Hour
+
+	// maxUnlockFormSize is far more than a password form can need
+	maxUnlockFormSize = 4096
+)
+
+// defaultUnlockSecret signs unlock cookies when no secret is configured. It changes on every start,
+// so visitors have to enter passwords again after a restart.
+var defaultUnlockSecret = func() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("cannot generate unlock secret: %v", err))
+	}
+	return secret
+}()
+
+func applyPasswordRequest(short *Short, request CreateShortRequest) error {
+	if request.Password == "" {
+		return nil
+	}
+
+	hash, err := HashPassword(request.Password)
+	if err != nil {
+		return err
+	}
+
+	short.PasswordHash = &hash
+	return nil
+}
+
+// IsProtected reports whether visitors need a password to follow the short
+func (s *Short) IsProtected() bool {
+	return s.PasswordHash != nil
+}
+
+// CheckShortPassword reports whether password unlocks short
+func CheckShortPassword(short *Short, password string) bool {
+	if !short.IsProtected() {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(*short.PasswordHash), []byte(password)) == nil
+}
+
+// unlockSignature ties an unlock cookie to a short, its current password and an expiry time, so
+// it cannot be reused for another short or once the password changes
+func unlockSignature(secret []byte, workspace int64, short *Short, expires int64) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%d|%s|%d|%s", workspace, short.RedirectPath, expires, *short.PasswordHash)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newUnlockCookie lets the visitor follow a protected short without its password until ttl passes.
+// The cookie is scoped to the path of the short, so every protected short has its own.
+func newUnlockCookie(r *http.Request, secret []byte, workspace int64, short *Short, now time.Time, ttl time.Duration) *http.Cookie {
+	expires := now.Add(ttl).Unix()
+
+	return &http.Cookie{
+		Name:     UnlockCookieName,
+		Value:    strconv.FormatInt(expires, 10) + "." + unlockSignature(secret, workspace, short, expires),
+		Path:     shortPath(r),
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// isUnlocked reports whether the request carries an unexpired unlock cookie for short
+func isUnlocked(r *http.Request, secret []byte, workspace int64, short *Short, now time.Time) bool {
+	cookie, err := r.Cookie(UnlockCookieName)
+	if err != nil {
+		return false
+	}
+
+	parts := strings.SplitN(cookie.Value, ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	expires, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || now.Unix() >= expires {
+		return false
+	}
+
+	expected := unlockSignature(secret, workspace, short, expires)
+	return hmac.Equal([]byte(parts[1]), []byte(expected))
+}
+
+type passwordForm struct {
+	Failed bool
+}
+
+// NewUnlockShortHandler checks the password posted from the form shown by protected shorts. A correct
+// password sets a cookie and sends the visitor back to the short, which then redirects.
+func NewUnlockShortHandler(dao ShortDAO, opts ...HandlerOption) func(w http.ResponseWriter, r *http.Request) {
+	options := newHandlerOptions(opts)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		short_url := mux.Vars(r)["short"]
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxUnlockFormSize)
+		if err := r.ParseForm(); err != nil {
+			slog.InfoContext(r.Context(), "failed to parse password form", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		short, err := dao.GetShort(r.Context(), workspaceID(r.Context()), domainID(r.Context()), short_url)
+		if err == sql.ErrNoRows {
+			slog.InfoContext(r.Context(), "short not found")
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to get short", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if !short.IsProtected() {
+			http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
+			return
+		}
+
+		if !CheckShortPassword(short, r.PostForm.Get("password")) {
+			slog.WarnContext(r.Context(), "wrong password", "ip", RequestIP(r))
+			renderPage(w, http.StatusUnauthorized, passwordPage, passwordForm{Failed: true})
+			return
+		}
+
+		http.SetCookie(w, newUnlockCookie(r, options.unlockSecret, workspaceID(r.Context()), short, options.clock.Now(), options.unlockTTL))
+		http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
+	}
+}
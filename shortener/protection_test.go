@@ -0,0 +1,122 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"l24.dev/shortener"
+	"l24.dev/test/mocks"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateProtectedShort(t *testing.T) {
+	type testCase struct {
+		Name           string
+		Password       string
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{Name: "Protected", Password: "correct horse", ExpectedStatus: http.StatusOK},
+		{Name: "Password Too Short", Password: "horse", ExpectedStatus: http.StatusBadRequest},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			dao := mocks.NewMockShortDAO(mock)
+
+			times := 0
+			if test.ExpectedStatus == http.StatusOK {
+				times = 1
+			}
+			dao.EXPECT().
+				InsertShort(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_, _, _ interface{}, short shortener.Short) error {
+					assert.True(t, shortener.CheckShortPassword(&short, test.Password), "the password should be stored hashed")
+					assert.NotEqual(t, test.Password, *short.PasswordHash)
+					return nil
+				}).
+				Times(times)
+
+			server := httptest.NewServer(http.HandlerFunc(shortener.NewCreateShortHandler(dao)))
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			response := e.POST("/short").
+				WithJSON(shortener.CreateShortRequest{URL: "wiki.example.com/oncall", Password: test.Password}).
+				WithHeader("Content-Type", "application/json").
+				Expect().
+				Status(test.ExpectedStatus)
+
+			if test.ExpectedStatus == http.StatusOK {
+				response.Body().NotContains("password")
+			}
+		})
+	}
+}
+
+func TestVisitProtectedShort(t *testing.T) {
+	hash, err := shortener.HashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	short := &shortener.Short{RedirectPath: "oncall", Scheme: "https", Host: "wiki.example.com", PasswordHash: &hash}
+	other := &shortener.Short{RedirectPath: "payroll", Scheme: "https", Host: "hr.example.com", PasswordHash: &hash}
+
+	mock := gomock.NewController(t)
+	dao := mocks.NewMockShortDAO(mock)
+	dao.EXPECT().GetShort(gomock.Any(), gomock.Any(), gomock.Any(), "oncall").Return(short, nil).AnyTimes()
+	dao.EXPECT().GetShort(gomock.Any(), gomock.Any(), gomock.Any(), "payroll").Return(other, nil).AnyTimes()
+
+	clock := &fakeClock{now: time.Date(2021, 12, 13, 9, 0, 0, 0, time.UTC)}
+	opts := []shortener.HandlerOption{shortener.WithClock(clock), shortener.WithUnlockSecret([]byte("test secret"))}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/{short}", shortener.NewGetShortHandler(dao, opts...)).Methods(http.MethodGet)
+	router.HandleFunc("/{short}", shortener.NewUnlockShortHandler(dao, opts...)).Methods(http.MethodPost)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+	e := httpexpect.New(t, server.URL)
+
+	locked := e.GET("/oncall").WithRedirectPolicy(httpexpect.DontFollowRedirects).Expect()
+	locked.Status(http.StatusUnauthorized)
+	locked.Header("Location").Empty()
+	locked.Body().Contains(`type="password"`)
+
+	wrong := e.POST("/oncall").WithFormField("password", "battery staple").WithRedirectPolicy(httpexpect.DontFollowRedirects).Expect()
+	wrong.Status(http.StatusUnauthorized)
+	wrong.Body().Contains("not right")
+	wrong.Cookies().Empty()
+
+	unlocked := e.POST("/oncall").WithFormField("password", "correct horse").WithRedirectPolicy(httpexpect.DontFollowRedirects).Expect()
+	unlocked.Status(http.StatusSeeOther)
+	unlocked.Header("Location").Equal("/oncall")
+	cookie := unlocked.Cookie(shortener.UnlockCookieName)
+	cookie.Path().Equal("/oncall")
+	value := cookie.Value().Raw()
+
+	redirect := e.GET("/oncall").WithCookie(shortener.UnlockCookieName, value).WithRedirectPolicy(httpexpect.DontFollowRedirects).Expect()
+	redirect.Status(http.StatusFound)
+	redirect.Header("Location").Equal("https://wiki.example.com")
+
+	e.GET("/payroll").WithCookie(shortener.UnlockCookieName, value).WithRedirectPolicy(httpexpect.DontFollowRedirects).
+		Expect().Status(http.StatusUnauthorized)
+
+	forged := strings.SplitN(value, ".", 2)[0] + ".deadbeef"
+	e.GET("/oncall").WithCookie(shortener.UnlockCookieName, forged).WithRedirectPolicy(httpexpect.DontFollowRedirects).
+		Expect().Status(http.StatusUnauthorized)
+
+	clock.now = clock.now.Add(shortener.DefaultUnlockTTL)
+	e.GET("/oncall").WithCookie(shortener.UnlockCookieName, value).WithRedirectPolicy(httpexpect.DontFollowRedirects).
+		Expect().Status(http.StatusUnauthorized)
+}
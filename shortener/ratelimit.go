@@ -0,0 +1,309 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// RateLimit is a token bucket: it holds up to Burst tokens, refilled at Rate tokens per second,
+// and every request takes one
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// Enabled reports whether the limit restricts anything
+func (l RateLimit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// ParseRateLimit parses limits like "30/m", meaning 30 requests a minute with bursts of up to 30.
+// The period is one of s, m or h. An empty value disables the limit.
+func ParseRateLimit(value string) (RateLimit, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return RateLimit{}, nil
+	}
+
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return RateLimit{}, fmt.Errorf("rate limit %q must look like 30/m", value)
+	}
+
+	count, err := strconv.Atoi(parts[0])
+	if err != nil || count < 0 {
+		return RateLimit{}, fmt.Errorf("rate limit %q must start with a non-negative count", value)
+	}
+
+	periods := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+	period, ok := periods[parts[1]]
+	if !ok {
+		return RateLimit{}, fmt.Errorf("rate limit %q must be per s, m or h", value)
+	}
+
+	return RateLimit{Rate: float64(count) / period.Seconds(), Burst: count}, nil
+}
+
+// LimitResult is the outcome of taking a token from a bucket
+type LimitResult struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration // until a token is available, when not allowed
+	Reset      time.Duration // until the bucket is full again
+}
+
+// RateLimitStore keeps token buckets, so they can be shared between replicas
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit RateLimit, now time.Time) (LimitResult, error)
+}
+
+// refill works out the state of a bucket at now, given it held tokens at updated,
+// and takes a token from it if it can
+func refill(limit RateLimit, tokens float64, updated time.Time, now time.Time) (float64, LimitResult) {
+	elapsed := now.Sub(updated).Seconds()
+	if elapsed > 0 {
+		tokens = math.Min(float64(limit.Burst), tokens+elapsed*limit.Rate)
+	}
+
+	result := LimitResult{Allowed: tokens >= 1}
+	if result.Allowed {
+		tokens--
+	} else {
+		result.RetryAfter = secondsToDuration((1 - tokens) / limit.Rate)
+	}
+
+	result.Remaining = int(math.Floor(tokens))
+	result.Reset = secondsToDuration((float64(limit.Burst) - tokens) / limit.Rate)
+
+	return tokens, result
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   RateLimit
+}
+
+// MemoryRateLimitStore keeps token buckets in process. Buckets that have filled up again are
+// dropped periodically, so memory is bounded by the clients seen in the last few minutes.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+const memoryStoreSweepInterval = time.Minute
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*bucket{}}
+}
+
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit RateLimit, now time.Time) (LimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now, limit: limit}
+		s.buckets[key] = b
+	}
+
+	tokens, result := refill(limit, b.tokens, b.updated, now)
+	b.tokens, b.updated = tokens, now
+
+	return result, nil
+}
+
+// sweep drops buckets that would be full by now, as they are no different from new ones
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memoryStoreSweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*b.limit.Rate >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// RateLimiterOption customises a RateLimiter
+type RateLimiterOption func(*RateLimiter)
+
+// WithRateLimitClock replaces the wall clock used to refill buckets
+func WithRateLimitClock(clock Clock) RateLimiterOption {
+	return func(l *RateLimiter) {
+		l.clock = clock
+	}
+}
+
+// WithTrustedProxies trusts X-Forwarded-For headers set by proxies in these networks
+func WithTrustedProxies(networks []*net.IPNet) RateLimiterOption {
+	return func(l *RateLimiter) {
+		l.trustedProxies = networks
+	}
+}
+
+// RateLimiter limits how often each client may call the routes it wraps. Clients are told apart
+// by the API key or user that authenticated them, or by their IP address for anonymous requests.
+type RateLimiter struct {
+	name           string
+	store          RateLimitStore
+	limit          RateLimit
+	clock          Clock
+	trustedProxies []*net.IPNet
+}
+
+// NewRateLimiter creates a limiter. Limiters sharing a store must have different names,
+// which keep their budgets apart.
+func NewRateLimiter(name string, store RateLimitStore, limit RateLimit, opts ...RateLimiterOption) *RateLimiter {
+	limiter := &RateLimiter{name: name, store: store, limit: limit, clock: SystemClock{}}
+	for _, opt := range opts {
+		opt(limiter)
+	}
+	return limiter
+}
+
+// Middleware rejects clients that have run out of budget with 429 Too Many Requests. Every response
+// carries RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers. When the store fails
+// requests are let through, as an outage of the limiter should not become an outage of the service.
+func (l *RateLimiter) Middleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if !l.limit.Enabled() {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := l.name + ":" + l.clientKey(r)
+
+			result, err := l.store.Take(r.Context(), key, l.limit, l.clock.Now())
+			if err != nil {
+				slog.ErrorContext(r.Context(), "failed to check rate limit", "key", key, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(l.limit.Burst))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+			if !result.Allowed {
+				slog.WarnContext(r.Context(), "rate limited", "key", key)
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (l *RateLimiter) clientKey(r *http.Request) string {
+	if key := APIKeyFromContext(r.Context()); key != nil && key.ID != 0 {
+		return "key:" + strconv.FormatInt(key.ID, 10)
+	}
+
+	if user := UserFromContext(r.Context()); user != nil {
+		return "user:" + strconv.FormatInt(user.ID, 10)
+	}
+
+	return "ip:" + ClientIP(r, l.trustedProxies)
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ClientIP returns the address of the client making the request. X-Forwarded-For is only believed
+// as far as it was written by trusted proxies: it is read from the right, and the first address
+// not belonging to a trusted proxy is the client.
+func ClientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !isTrustedProxy(host, trustedProxies) {
+		return host
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break // a garbled header cannot be trusted any further
+		}
+		host = hop
+		if !isTrustedProxy(hop, trustedProxies) {
+			break
+		}
+	}
+
+	return host
+}
+
+func isTrustedProxy(address string, trustedProxies []*net.IPNet) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseTrustedProxies parses a comma separated list of CIDR networks or single addresses
+func ParseTrustedProxies(value string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
@@ -0,0 +1,196 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"context"
+	"errors"
+	"l24.dev/shortener"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gavv/httpexpect/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	type testCase struct {
+		Value      string
+		Expected   shortener.RateLimit
+		ShouldFail bool
+	}
+
+	testCases := []testCase{
+		{Value: "", Expected: shortener.RateLimit{}},
+		{Value: "30/m", Expected: shortener.RateLimit{Rate: 0.5, Burst: 30}},
+		{Value: "5/s", Expected: shortener.RateLimit{Rate: 5, Burst: 5}},
+		{Value: "30", ShouldFail: true},
+		{Value: "30/d", ShouldFail: true},
+		{Value: "-1/s", ShouldFail: true},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Value, func(t *testing.T) {
+			limit, err := shortener.ParseRateLimit(test.Value)
+			assert.Equal(t, test.ShouldFail, err != nil, "ShouldFail is %v, got %v", test.ShouldFail, err)
+			if err == nil {
+				assert.Equal(t, test.Expected, limit)
+			}
+		})
+	}
+}
+
+func TestRateLimitStores(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start redis: %v", err)
+	}
+	defer server.Close()
+
+	stores := map[string]shortener.RateLimitStore{
+		"Memory": shortener.NewMemoryRateLimitStore(),
+		"Redis":  shortener.NewRedisRateLimitStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), "test:"),
+	}
+
+	// two requests a second, in bursts of up to three
+	limit := shortener.RateLimit{Rate: 2, Burst: 3}
+	start := time.Date(2021, 11, 29, 9, 0, 0, 0, time.UTC)
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			for i := 2; i >= 0; i-- {
+				result, err := store.Take(ctx, "client", limit, start)
+				assert.Nil(t, err, "take should succeed")
+				assert.True(t, result.Allowed, "the burst should be allowed")
+				assert.Equal(t, i, result.Remaining, "tokens should be used up")
+			}
+
+			result, err := store.Take(ctx, "client", limit, start)
+			assert.Nil(t, err, "take should succeed")
+			assert.False(t, result.Allowed, "an empty bucket should refuse")
+			assert.Equal(t, 500*time.Millisecond, result.RetryAfter, "a token should be back in half a second")
+			assert.Equal(t, 1500*time.Millisecond, result.Reset, "the bucket should be full in a second and a half")
+
+			result, _ = store.Take(ctx, "other client", limit, start)
+			assert.True(t, result.Allowed, "clients should have their own buckets")
+
+			result, _ = store.Take(ctx, "client", limit, start.Add(500*time.Millisecond))
+			assert.True(t, result.Allowed, "the bucket should refill")
+			assert.Equal(t, 0, result.Remaining, "the refilled token should be used")
+
+			result, _ = store.Take(ctx, "client", limit, start.Add(time.Hour))
+			assert.Equal(t, 2, result.Remaining, "the bucket should refill no further than its burst")
+		})
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, shortener.RateLimit, time.Time) (shortener.LimitResult, error) {
+	return shortener.LimitResult{}, errors.New("connection refused")
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2021, 11, 29, 9, 0, 0, 0, time.UTC)}
+	limit := shortener.RateLimit{Rate: 1, Burst: 2}
+	limiter := shortener.NewRateLimiter("create", shortener.NewMemoryRateLimitStore(), limit, shortener.WithRateLimitClock(clock))
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	server := httptest.NewServer(limiter.Middleware()(ok))
+	defer server.Close()
+	e := httpexpect.New(t, server.URL)
+
+	first := e.POST("/short").Expect().Status(http.StatusOK)
+	first.Header("RateLimit-Limit").Equal("2")
+	first.Header("RateLimit-Remaining").Equal("1")
+	first.Header("RateLimit-Reset").Equal("1")
+
+	e.POST("/short").Expect().Status(http.StatusOK).Header("RateLimit-Remaining").Equal("0")
+
+	limited := e.POST("/short").Expect().Status(http.StatusTooManyRequests)
+	limited.Header("Retry-After").Equal("1")
+	limited.Header("RateLimit-Remaining").Equal("0")
+	limited.Header("RateLimit-Reset").Equal("2")
+
+	clock.now = clock.now.Add(time.Second)
+	e.POST("/short").Expect().Status(http.StatusOK)
+}
+
+func TestRateLimiterKeys(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2021, 11, 29, 9, 0, 0, 0, time.UTC)}
+	limiter := shortener.NewRateLimiter("create", shortener.NewMemoryRateLimitStore(), shortener.RateLimit{Rate: 1, Burst: 1}, shortener.WithRateLimitClock(clock))
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	limited := limiter.Middleware()(ok)
+
+	keyA := &shortener.Principal{APIKey: &shortener.APIKey{ID: 1}}
+	keyB := &shortener.Principal{APIKey: &shortener.APIKey{ID: 2}}
+
+	serverA := httptest.NewServer(withPrincipal(keyA, limited.ServeHTTP))
+	defer serverA.Close()
+	serverB := httptest.NewServer(withPrincipal(keyB, limited.ServeHTTP))
+	defer serverB.Close()
+	anonymous := httptest.NewServer(limited)
+	defer anonymous.Close()
+
+	httpexpect.New(t, serverA.URL).POST("/short").Expect().Status(http.StatusOK)
+	httpexpect.New(t, serverA.URL).POST("/short").Expect().Status(http.StatusTooManyRequests)
+	httpexpect.New(t, serverB.URL).POST("/short").Expect().Status(http.StatusOK)
+	httpexpect.New(t, anonymous.URL).POST("/short").Expect().Status(http.StatusOK)
+	httpexpect.New(t, anonymous.URL).POST("/short").Expect().Status(http.StatusTooManyRequests)
+}
+
+func TestRateLimiterFailsOpen(t *testing.T) {
+	limiter := shortener.NewRateLimiter("redirect", failingStore{}, shortener.RateLimit{Rate: 1, Burst: 1})
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	server := httptest.NewServer(limiter.Middleware()(ok))
+	defer server.Close()
+	e := httpexpect.New(t, server.URL)
+
+	e.GET("/c3xd4d").Expect().Status(http.StatusOK).Header("RateLimit-Limit").Empty()
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := shortener.ParseTrustedProxies("10.0.0.0/8, 192.168.1.1")
+	if err != nil {
+		t.Fatalf("failed to parse trusted proxies: %v", err)
+	}
+
+	type testCase struct {
+		Name          string
+		RemoteAddr    string
+		XForwardedFor []string
+		Expected      string
+	}
+
+	testCases := []testCase{
+		{Name: "Direct", RemoteAddr: "203.0.113.7:4312", Expected: "203.0.113.7"},
+		{Name: "Spoofed Header From Untrusted Peer", RemoteAddr: "203.0.113.7:4312", XForwardedFor: []string{"198.51.100.1"}, Expected: "203.0.113.7"},
+		{Name: "Behind Trusted Proxy", RemoteAddr: "10.0.0.5:80", XForwardedFor: []string{"203.0.113.7"}, Expected: "203.0.113.7"},
+		{Name: "Client Spoofing Through Proxy", RemoteAddr: "10.0.0.5:80", XForwardedFor: []string{"198.51.100.1, 203.0.113.7"}, Expected: "203.0.113.7"},
+		{Name: "Chain Of Trusted Proxies", RemoteAddr: "10.0.0.5:80", XForwardedFor: []string{"203.0.113.7, 192.168.1.1", "10.1.1.1"}, Expected: "203.0.113.7"},
+		{Name: "Garbled Header", RemoteAddr: "10.0.0.5:80", XForwardedFor: []string{"nonsense"}, Expected: "10.0.0.5"},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/c3xd4d", nil)
+			r.RemoteAddr = test.RemoteAddr
+			for _, header := range test.XForwardedFor {
+				r.Header.Add("X-Forwarded-For", header)
+			}
+
+			assert.Equal(t, test.Expected, shortener.ClientIP(r, trusted))
+		})
+	}
+
+	_, err = shortener.ParseTrustedProxies("10.0.0.0/33")
+	assert.NotNil(t, err, "invalid networks should be rejected")
+}
@@ -0,0 +1,120 @@
+package shortener
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MaxReportDetailsLength caps the free text a visitor can attach to a report
+const MaxReportDetailsLength = 1000
+
+// ReportReason is why a visitor reported a short
+type ReportReason string
+
+const (
+	ReportPhishing ReportReason = "phishing"
+	ReportMalware  ReportReason = "malware"
+	ReportSpam     ReportReason = "spam"
+	ReportIllegal  ReportReason = "illegal"
+	ReportOther    ReportReason = "other"
+)
+
+// ValidateReportReason checks reason is one of the known reasons
+func ValidateReportReason(reason ReportReason) error {
+	switch reason {
+	case ReportPhishing, ReportMalware, ReportSpam, ReportIllegal, ReportOther:
+		return nil
+	}
+	return fmt.Errorf("unknown report reason %q", reason)
+}
+
+// ModerationAction is what a moderator decides to do about a reported short
+type ModerationAction string
+
+const (
+	// ModerationDisable keeps the short but stops it redirecting
+	ModerationDisable ModerationAction = "disable"
+	// ModerationDelete removes the short, along with its reports
+	ModerationDelete ModerationAction = "delete"
+	// ModerationDismiss closes the reports, leaving the short as it is
+	ModerationDismiss ModerationAction = "dismiss"
+)
+
+// Report is a visitor's complaint about a short
+type Report struct {
+	ID         int64        `json:"id" db:"id"`
+	Reason     ReportReason `json:"reason" db:"reason"`
+	Details    string       `json:"details,omitempty" db:"details"`
+	ReporterIP string       `json:"reporter_ip" db:"reporter_ip"`
+	CreatedAt  time.Time    `json:"created_at" db:"created_at"`
+}
+
+// ReportedShort is an entry of the moderation queue: a short with the reports still open against it
+type ReportedShort struct {
+	ID            int64                `json:"id"`
+	WorkspaceID   int64                `json:"workspace_id"`
+	DomainID      int64                `json:"domain_id"`
+	RedirectPath  string               `json:"redirect_path"`
+	URL           string               `json:"url"`
+	DisabledAt    *time.Time           `json:"disabled_at,omitempty"`
+	BlockedReason *string              `json:"blocked_reason,omitempty"`
+	Reasons       map[ReportReason]int `json:"reasons"`
+	Reports       []Report             `json:"reports"`
+}
+
+// openReport is a report along with the short it was made against, as the moderation queue reads them
+type openReport struct {
+	Report
+	ShortID     int64 `db:"url_id"`
+	WorkspaceID int64 `db:"workspace_id"`
+	DomainID    int64 `db:"domain_id"`
+	Short
+}
+
+// groupReports builds the moderation queue from open reports, putting the most reported shorts
+// first and breaking ties by the oldest report
+func groupReports(reports []openReport) []ReportedShort {
+	queue := []ReportedShort{}
+	index := map[int64]int{}
+
+	for _, report := range reports {
+		i, ok := index[report.ShortID]
+		if !ok {
+			short := report.Short
+			i = len(queue)
+			index[report.ShortID] = i
+			queue = append(queue, ReportedShort{
+				ID:            report.ShortID,
+				WorkspaceID:   report.WorkspaceID,
+				DomainID:      report.DomainID,
+				RedirectPath:  short.RedirectPath,
+				URL:           short.RawURL(),
+				DisabledAt:    short.DisabledAt,
+				BlockedReason: short.BlockedReason,
+				Reasons:       map[ReportReason]int{},
+			})
+		}
+
+		queue[i].Reasons[report.Reason]++
+		queue[i].Reports = append(queue[i].Reports, report.Report)
+	}
+
+	sort.SliceStable(queue, func(a, b int) bool {
+		if len(queue[a].Reports) != len(queue[b].Reports) {
+			return len(queue[a].Reports) > len(queue[b].Reports)
+		}
+		return queue[a].Reports[0].CreatedAt.Before(queue[b].Reports[0].CreatedAt)
+	})
+
+	return queue
+}
+
+// ValidateModerationAction checks action is one a moderator can take
+func ValidateModerationAction(action ModerationAction) error {
+	switch action {
+	case ModerationDisable, ModerationDelete, ModerationDismiss:
+		return nil
+	}
+	return fmt.Errorf("unknown moderation action %q", action)
+}
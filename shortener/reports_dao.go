@@ -0,0 +1,81 @@
+package shortener
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	InsertReportQuery    = "INSERT INTO abuse_reports (url_id, reason, details, reporter_ip) SELECT id, $4, $5, $6 FROM urls WHERE redirect_path=$1 AND workspace_id=$2 AND domain_id=$3 RETURNING id, created_at"
+	ListOpenReportsQuery = "SELECT r.id, r.reason, r.details, r.reporter_ip, r.created_at, u.id AS url_id, u.workspace_id, u.domain_id, u.redirect_path, u.scheme, u.host, u.path, u.query, u.fragment, u.blocked_reason, u.disabled_at FROM abuse_reports r JOIN urls u ON u.id = r.url_id WHERE r.resolved_at IS NULL ORDER BY r.created_at, r.id"
+	DisableShortQuery    = "UPDATE urls SET disabled_at = NOW() WHERE id=$1"
+	DeleteShortByIDQuery = "DELETE FROM urls WHERE id=$1"
+	ResolveReportsQuery  = "UPDATE abuse_reports SET resolved_at = NOW(), resolved_by=$2, resolution=$3 WHERE url_id=$1 AND resolved_at IS NULL"
+)
+
+// ReportDAO stores abuse reports and carries out moderation decisions. Moderation works across
+// workspaces, so shorts are identified by their ID rather than their redirect path.
+type ReportDAO interface {
+	InsertReport(ctx context.Context, workspace int64, domain int64, redirect_path string, report *Report) error
+	ListOpenReports(ctx context.Context) ([]ReportedShort, error)
+	Moderate(ctx context.Context, short int64, action ModerationAction, moderator string) error
+}
+
+func NewReportPostgresDao(db *sql.DB, driver string) *ReportPostgresDAO {
+	return &ReportPostgresDAO{db: db, driver: driver}
+}
+
+type ReportPostgresDAO struct {
+	db     *sql.DB
+	driver string
+}
+
+// InsertReport stores a report against a short, filling in its ID and creation time.
+// It returns sql.ErrNoRows if the short does not exist.
+func (s *ReportPostgresDAO) InsertReport(ctx context.Context, workspace int64, domain int64, redirect_path string, report *Report) error {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	return db.QueryRowxContext(ctx, InsertReportQuery, redirect_path, workspace, domain, report.Reason, report.Details, report.ReporterIP).
+		Scan(&report.ID, &report.CreatedAt)
+}
+
+// ListOpenReports returns the moderation queue: every short with unresolved reports, most reported first
+func (s *ReportPostgresDAO) ListOpenReports(ctx context.Context) ([]ReportedShort, error) {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	var reports []openReport
+	err := db.SelectContext(ctx, &reports, ListOpenReportsQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	return groupReports(reports), nil
+}
+
+// Moderate carries out action on a short and resolves its open reports in the same transaction.
+// It returns sql.ErrNoRows if the short does not exist, or when dismissing, has no open reports.
+func (s *ReportPostgresDAO) Moderate(ctx context.Context, short int64, action ModerationAction, moderator string) error {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	switch action {
+	case ModerationDisable:
+		return executeTransaction(ctx, *db,
+			auditStatement(ctx, AuditDisableShortQuery, AuditDisable, short),
+			statement{query: DisableShortQuery, args: []interface{}{short}, mustAffectRows: true},
+			statement{query: ResolveReportsQuery, args: []interface{}{short, moderator, "disabled"}},
+		)
+	case ModerationDelete:
+		// the reports go along with the short
+		return executeTransaction(ctx, *db,
+			auditStatement(ctx, AuditDeleteShortByIDQuery, AuditDelete, short),
+			statement{query: DeleteShortByIDQuery, args: []interface{}{short}, mustAffectRows: true},
+		)
+	case ModerationDismiss:
+		return executeTransaction(ctx, *db, statement{query: ResolveReportsQuery, args: []interface{}{short, moderator, "dismissed"}, mustAffectRows: true})
+	}
+
+	return fmt.Errorf("unknown moderation action %q", action)
+}
@@ -0,0 +1,126 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"context"
+	"database/sql"
+	"l24.dev/shortener"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInsertReport(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	created := time.Date(2021, 12, 6, 9, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta(shortener.InsertReportQuery)).
+		WithArgs("c3xd4d", shortener.DefaultWorkspaceID, shortener.DefaultDomainID, shortener.ReportPhishing, "", "203.0.113.7").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(4, created))
+	mock.ExpectQuery(regexp.QuoteMeta(shortener.InsertReportQuery)).
+		WithArgs("missing", shortener.DefaultWorkspaceID, shortener.DefaultDomainID, shortener.ReportSpam, "", "203.0.113.7").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}))
+
+	dao := shortener.NewReportPostgresDao(db, "postgres")
+
+	report := &shortener.Report{Reason: shortener.ReportPhishing, ReporterIP: "203.0.113.7"}
+	err = dao.InsertReport(context.Background(), shortener.DefaultWorkspaceID, shortener.DefaultDomainID, "c3xd4d", report)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), report.ID)
+	assert.Equal(t, created, report.CreatedAt)
+
+	err = dao.InsertReport(context.Background(), shortener.DefaultWorkspaceID, shortener.DefaultDomainID, "missing", &shortener.Report{Reason: shortener.ReportSpam, ReporterIP: "203.0.113.7"})
+	assert.Equal(t, sql.ErrNoRows, err, "reports of missing shorts should not be stored")
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestListOpenReports(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	first := time.Date(2021, 12, 6, 9, 0, 0, 0, time.UTC)
+	columns := []string{"id", "reason", "details", "reporter_ip", "created_at", "url_id", "workspace_id", "domain_id", "redirect_path", "scheme", "host", "path", "query", "fragment", "blocked_reason", "disabled_at"}
+	mock.ExpectQuery(regexp.QuoteMeta(shortener.ListOpenReportsQuery)).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, "spam", "", "203.0.113.7", first, 7, 1, 1, "sale", "https", "shop.example", "", "", "", nil, nil).
+			AddRow(2, "phishing", "bank login", "198.51.100.1", first.Add(time.Hour), 12, 1, 1, "c3xd4d", "https", "login-paypal.example", "", "", "", nil, nil).
+			AddRow(3, "malware", "", "198.51.100.2", first.Add(2*time.Hour), 12, 1, 1, "c3xd4d", "https", "login-paypal.example", "", "", "", nil, nil))
+
+	dao := shortener.NewReportPostgresDao(db, "postgres")
+	queue, err := dao.ListOpenReports(context.Background())
+
+	assert.Nil(t, err)
+	if assert.Len(t, queue, 2) {
+		assert.Equal(t, int64(12), queue[0].ID, "the most reported short should come first")
+		assert.Equal(t, "https://login-paypal.example", queue[0].URL)
+		assert.Equal(t, map[shortener.ReportReason]int{shortener.ReportPhishing: 1, shortener.ReportMalware: 1}, queue[0].Reasons)
+		assert.Len(t, queue[0].Reports, 2)
+		assert.Equal(t, int64(7), queue[1].ID)
+	}
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestModerate(t *testing.T) {
+	type testCase struct {
+		Name        string
+		Action      shortener.ModerationAction
+		Affected    int64
+		ExpectedErr error
+	}
+
+	testCases := []testCase{
+		{Name: "Disable", Action: shortener.ModerationDisable, Affected: 1},
+		{Name: "Disable Missing", Action: shortener.ModerationDisable, Affected: 0, ExpectedErr: sql.ErrNoRows},
+		{Name: "Delete", Action: shortener.ModerationDelete, Affected: 1},
+		{Name: "Dismiss", Action: shortener.ModerationDismiss, Affected: 2},
+		{Name: "Dismiss Without Reports", Action: shortener.ModerationDismiss, Affected: 0, ExpectedErr: sql.ErrNoRows},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			switch test.Action {
+			case shortener.ModerationDisable:
+				mock.ExpectExec(regexp.QuoteMeta(shortener.AuditDisableShortQuery)).WithArgs(shortener.AuditDisable, "system", nil, nil, 12).WillReturnResult(sqlmock.NewResult(0, test.Affected))
+				mock.ExpectExec(regexp.QuoteMeta(shortener.DisableShortQuery)).WithArgs(12).WillReturnResult(sqlmock.NewResult(0, test.Affected))
+				if test.Affected > 0 {
+					mock.ExpectExec(regexp.QuoteMeta(shortener.ResolveReportsQuery)).WithArgs(12, "admin", "disabled").WillReturnResult(sqlmock.NewResult(0, 2))
+				}
+			case shortener.ModerationDelete:
+				mock.ExpectExec(regexp.QuoteMeta(shortener.AuditDeleteShortByIDQuery)).WithArgs(shortener.AuditDelete, "system", nil, nil, 12).WillReturnResult(sqlmock.NewResult(0, test.Affected))
+				mock.ExpectExec(regexp.QuoteMeta(shortener.DeleteShortByIDQuery)).WithArgs(12).WillReturnResult(sqlmock.NewResult(0, test.Affected))
+			case shortener.ModerationDismiss:
+				mock.ExpectExec(regexp.QuoteMeta(shortener.ResolveReportsQuery)).WithArgs(12, "admin", "dismissed").WillReturnResult(sqlmock.NewResult(0, test.Affected))
+			}
+			if test.ExpectedErr != nil {
+				mock.ExpectRollback()
+			} else {
+				mock.ExpectCommit()
+			}
+
+			dao := shortener.NewReportPostgresDao(db, "postgres")
+			err = dao.Moderate(context.Background(), 12, test.Action, "admin")
+
+			assert.Equal(t, test.ExpectedErr, err)
+			assert.Nil(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package shortener
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type ReportShortRequest struct {
+	Reason  ReportReason `json:"reason"`
+	Details string       `json:"details,omitempty"`
+}
+
+type ModerateRequest struct {
+	Action ModerationAction `json:"action"`
+}
+
+// NewReportShortHandler lets anyone, signed in or not, report a short for review by an admin
+func NewReportShortHandler(dao ReportDAO) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		short_url := mux.Vars(r)["short"]
+
+		var request ReportShortRequest
+		err := DecodeJSONBody(w, r, &request)
+		if err != nil {
+			slog.InfoContext(r.Context(), "failed to decode json body", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		err = validateReportRequest(request)
+		if err != nil {
+			slog.InfoContext(r.Context(), "invalid report", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		report := &Report{Reason: request.Reason, Details: request.Details, ReporterIP: RequestIP(r)}
+		err = dao.InsertReport(r.Context(), workspaceID(r.Context()), domainID(r.Context()), short_url, report)
+		if err == sql.ErrNoRows {
+			slog.InfoContext(r.Context(), "short not found")
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to store report", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "short reported", "reason", report.Reason, "ip", report.ReporterIP)
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(report)
+	}
+}
+
+func validateReportRequest(request ReportShortRequest) error {
+	if err := ValidateReportReason(request.Reason); err != nil {
+		return err
+	}
+
+	if len(request.Details) > MaxReportDetailsLength {
+		return fmt.Errorf("details are %d bytes long, must be at most %d", len(request.Details), MaxReportDetailsLength)
+	}
+
+	return nil
+}
+
+// NewListReportsHandler returns the moderation queue
+func NewListReportsHandler(dao ReportDAO) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		queue, err := dao.ListOpenReports(r.Context())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to list reports", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(queue)
+	}
+}
+
+// NewModerateHandler disables, deletes or dismisses the reports against a short
+func NewModerateHandler(dao ReportDAO) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		id, err := strconv.ParseInt(vars["id"], 10, 64)
+		if err != nil {
+			slog.InfoContext(r.Context(), "invalid short id", "id", vars["id"], "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		var request ModerateRequest
+		err = DecodeJSONBody(w, r, &request)
+		if err != nil {
+			slog.InfoContext(r.Context(), "failed to decode json body", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		err = ValidateModerationAction(request.Action)
+		if err != nil {
+			slog.InfoContext(r.Context(), "invalid moderation action", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		moderator := PrincipalFromContext(r.Context()).Name()
+		err = dao.Moderate(r.Context(), id, request.Action, moderator)
+		if err == sql.ErrNoRows {
+			slog.InfoContext(r.Context(), "short not found or has no open reports", "id", id)
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to moderate short", "action", request.Action, "id", id, "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "moderated short", "moderator", moderator, "action", request.Action, "id", id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
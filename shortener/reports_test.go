@@ -0,0 +1,196 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"database/sql"
+	"l24.dev/shortener"
+	"l24.dev/test/mocks"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+)
+
+func TestReportShortHandler(t *testing.T) {
+	type testCase struct {
+		Name           string
+		Request        shortener.ReportShortRequest
+		InsertError    error
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{
+			Name:           "Reported",
+			Request:        shortener.ReportShortRequest{Reason: shortener.ReportPhishing, Details: "asks for my bank login"},
+			ExpectedStatus: http.StatusCreated,
+		},
+		{
+			Name:           "Unknown Reason",
+			Request:        shortener.ReportShortRequest{Reason: "boring"},
+			ExpectedStatus: http.StatusBadRequest,
+		},
+		{
+			Name:           "Details Too Long",
+			Request:        shortener.ReportShortRequest{Reason: shortener.ReportSpam, Details: strings.Repeat("a", shortener.MaxReportDetailsLength+1)},
+			ExpectedStatus: http.StatusBadRequest,
+		},
+		{
+			Name:           "Not Found",
+			Request:        shortener.ReportShortRequest{Reason: shortener.ReportMalware},
+			InsertError:    sql.ErrNoRows,
+			ExpectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			dao := mocks.NewMockReportDAO(mock)
+
+			times := 0
+			if test.ExpectedStatus != http.StatusBadRequest {
+				times = 1
+			}
+			dao.EXPECT().
+				InsertReport(gomock.Any(), shortener.DefaultWorkspaceID, shortener.DefaultDomainID, "c3xd4d", gomock.Any()).
+				DoAndReturn(func(_, _, _, _ interface{}, report *shortener.Report) error {
+					if report.ReporterIP != "203.0.113.7" {
+						t.Errorf("expected the report to come from the forwarded client, got %s", report.ReporterIP)
+					}
+					report.ID = 1
+					return test.InsertError
+				}).
+				Times(times)
+
+			router := mux.NewRouter()
+			router.Use(shortener.NewClientIPMiddleware([]*net.IPNet{{IP: net.IPv4(127, 0, 0, 0), Mask: net.CIDRMask(8, 32)}}))
+			router.HandleFunc("/short/{short}/report", shortener.NewReportShortHandler(dao))
+
+			server := httptest.NewServer(router)
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			e.POST("/short/c3xd4d/report").
+				WithJSON(test.Request).
+				WithHeader("Content-Type", "application/json").
+				WithHeader("X-Forwarded-For", "203.0.113.7").
+				Expect().
+				Status(test.ExpectedStatus)
+		})
+	}
+}
+
+func TestListReportsHandler(t *testing.T) {
+	mock := gomock.NewController(t)
+	dao := mocks.NewMockReportDAO(mock)
+
+	reported := time.Date(2021, 12, 6, 9, 0, 0, 0, time.UTC)
+	dao.EXPECT().ListOpenReports(gomock.Any()).Return([]shortener.ReportedShort{{
+		ID:           12,
+		WorkspaceID:  shortener.DefaultWorkspaceID,
+		RedirectPath: "c3xd4d",
+		URL:          "https://login-paypal.example",
+		Reasons:      map[shortener.ReportReason]int{shortener.ReportPhishing: 2},
+		Reports: []shortener.Report{
+			{ID: 1, Reason: shortener.ReportPhishing, ReporterIP: "203.0.113.7", CreatedAt: reported},
+			{ID: 2, Reason: shortener.ReportPhishing, ReporterIP: "198.51.100.1", CreatedAt: reported.Add(time.Hour)},
+		},
+	}}, nil)
+
+	server := httptest.NewServer(http.HandlerFunc(shortener.NewListReportsHandler(dao)))
+	defer server.Close()
+	e := httpexpect.New(t, server.URL)
+
+	queue := e.GET("/admin/reports").Expect().Status(http.StatusOK).JSON().Array()
+	queue.Length().Equal(1)
+	entry := queue.Element(0).Object()
+	entry.Value("id").Number().Equal(12)
+	entry.Value("redirect_path").String().Equal("c3xd4d")
+	entry.Value("reasons").Object().Value("phishing").Number().Equal(2)
+	entry.Value("reports").Array().Length().Equal(2)
+}
+
+func TestModerateHandler(t *testing.T) {
+	type testCase struct {
+		Name           string
+		ID             string
+		Action         shortener.ModerationAction
+		ModerateError  error
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{Name: "Disable", ID: "12", Action: shortener.ModerationDisable, ExpectedStatus: http.StatusNoContent},
+		{Name: "Delete", ID: "12", Action: shortener.ModerationDelete, ExpectedStatus: http.StatusNoContent},
+		{Name: "Dismiss", ID: "12", Action: shortener.ModerationDismiss, ExpectedStatus: http.StatusNoContent},
+		{Name: "Nothing To Dismiss", ID: "12", Action: shortener.ModerationDismiss, ModerateError: sql.ErrNoRows, ExpectedStatus: http.StatusNotFound},
+		{Name: "Unknown Action", ID: "12", Action: "ban", ExpectedStatus: http.StatusBadRequest},
+		{Name: "Invalid ID", ID: "c3xd4d", Action: shortener.ModerationDisable, ExpectedStatus: http.StatusBadRequest},
+	}
+
+	admin := &shortener.Principal{APIKey: &shortener.APIKey{ID: 1, Name: "moderation"}}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			dao := mocks.NewMockReportDAO(mock)
+
+			times := 0
+			if test.ExpectedStatus != http.StatusBadRequest {
+				times = 1
+			}
+			dao.EXPECT().
+				Moderate(gomock.Any(), int64(12), test.Action, admin.Name()).
+				Return(test.ModerateError).
+				Times(times)
+
+			router := mux.NewRouter()
+			router.HandleFunc("/admin/reports/{id}", withPrincipal(admin, shortener.NewModerateHandler(dao)))
+
+			server := httptest.NewServer(router)
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			e.POST("/admin/reports/"+test.ID).
+				WithJSON(shortener.ModerateRequest{Action: test.Action}).
+				WithHeader("Content-Type", "application/json").
+				Expect().
+				Status(test.ExpectedStatus)
+		})
+	}
+}
+
+func TestGetDisabledShort(t *testing.T) {
+	mock := gomock.NewController(t)
+	dao := mocks.NewMockShortDAO(mock)
+
+	disabledAt := time.Date(2021, 12, 6, 9, 0, 0, 0, time.UTC)
+	dao.EXPECT().GetShort(gomock.Any(), gomock.Any(), gomock.Any(), "c3xd4d").Return(&shortener.Short{
+		RedirectPath: "c3xd4d",
+		Scheme:       "https",
+		Host:         "login-paypal.example",
+		DisabledAt:   &disabledAt,
+	}, nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/{short}", shortener.NewGetShortHandler(dao))
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+	e := httpexpect.New(t, server.URL)
+
+	response := e.GET("/c3xd4d").
+		WithRedirectPolicy(httpexpect.DontFollowRedirects).
+		Expect().
+		Status(http.StatusGone)
+	response.Header("Location").Empty()
+	response.Body().Contains("This link has been disabled")
+}
@@ -0,0 +1,104 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	DefaultRetryInitialBackoff = 500 * time.Millisecond
+	DefaultRetryMaxBackoff     = 10 * time.Second
+)
+
+// Sleeper is a Clock that can also wait, so retries can be tested without waiting
+type Sleeper interface {
+	Clock
+	// Sleep waits for d, returning early with the error of ctx if it is done first
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+func (SystemClock) Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// RetryPolicy waits Initial after the first failed attempt, doubling the wait after every other one up to
+// Max, and gives up once MaxWait has passed since the first attempt
+type RetryPolicy struct {
+	Initial time.Duration
+	Max     time.Duration
+	MaxWait time.Duration
+}
+
+// DefaultRetryPolicy backs off from half a second to ten seconds, giving up after maxWait
+func DefaultRetryPolicy(maxWait time.Duration) RetryPolicy {
+	return RetryPolicy{Initial: DefaultRetryInitialBackoff, Max: DefaultRetryMaxBackoff, MaxWait: maxWait}
+}
+
+// Retrier retries an operation on a dependency that may not be up yet, like the database at startup
+type Retrier struct {
+	name   string
+	policy RetryPolicy
+	clock  Sleeper
+}
+
+// RetrierOption customises a Retrier
+type RetrierOption func(*Retrier)
+
+// WithRetryClock replaces the wall clock used to wait between attempts
+func WithRetryClock(clock Sleeper) RetrierOption {
+	return func(r *Retrier) {
+		r.clock = clock
+	}
+}
+
+// NewRetrier retries operations on the dependency called name, which appears in its logs and errors
+func NewRetrier(name string, policy RetryPolicy, opts ...RetrierOption) *Retrier {
+	retrier := &Retrier{name: name, policy: policy, clock: SystemClock{}}
+	for _, opt := range opts {
+		opt(retrier)
+	}
+	return retrier
+}
+
+// Do calls attempt until it succeeds, logging every failure along with the time until the next attempt.
+// The last wait is cut short so one final attempt happens right at MaxWait. It returns the error of the
+// last attempt, saying how long it tried, once MaxWait has passed or ctx is done.
+func (r *Retrier) Do(ctx context.Context, attempt func(ctx context.Context) error) error {
+	started := r.clock.Now()
+	backoff := r.policy.Initial
+
+	for attempts := 1; ; attempts++ {
+		err := attempt(ctx)
+		if err == nil {
+			if attempts > 1 {
+				slog.InfoContext(ctx, r.name+" is available", "attempts", attempts)
+			}
+			return nil
+		}
+
+		elapsed := r.clock.Now().Sub(started)
+		remaining := r.policy.MaxWait - elapsed
+		if remaining <= 0 {
+			return fmt.Errorf("gave up on %s after %d attempts over %s: %w", r.name, attempts, elapsed.Round(time.Millisecond), err)
+		}
+
+		wait := min(backoff, remaining)
+		slog.WarnContext(ctx, r.name+" is unavailable, retrying", "attempt", attempts, "retry_in", wait.Round(time.Millisecond).String(), "error", err)
+
+		if sleepErr := r.clock.Sleep(ctx, wait); sleepErr != nil {
+			return fmt.Errorf("stopped waiting for %s after %d attempts: %w", r.name, attempts, err)
+		}
+
+		backoff = min(backoff*2, r.policy.Max)
+	}
+}
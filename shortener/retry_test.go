@@ -0,0 +1,120 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"context"
+	"errors"
+	"l24.dev/shortener"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sleepingClock moves forward by however long it is asked to sleep, recording every wait
+type sleepingClock struct {
+	now   time.Time
+	slept []time.Duration
+}
+
+func (c *sleepingClock) Now() time.Time {
+	return c.now
+}
+
+func (c *sleepingClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.slept = append(c.slept, d)
+	c.now = c.now.Add(d)
+	return nil
+}
+
+var errRefused = errors.New("connection refused")
+
+func TestRetrierBacksOffUntilSuccess(t *testing.T) {
+	clock := &sleepingClock{now: time.Date(2021, 12, 27, 9, 0, 0, 0, time.UTC)}
+	retrier := shortener.NewRetrier("database", shortener.DefaultRetryPolicy(time.Minute), shortener.WithRetryClock(clock))
+
+	attempts := 0
+	err := retrier.Do(context.Background(), func(ctx context.Context) error {
+		attempts++
+		if attempts < 4 {
+			return errRefused
+		}
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 4, attempts)
+	assert.Equal(t, []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second}, clock.slept, "waits should double")
+}
+
+func TestRetrierCapsBackoff(t *testing.T) {
+	clock := &sleepingClock{now: time.Date(2021, 12, 27, 9, 0, 0, 0, time.UTC)}
+	policy := shortener.RetryPolicy{Initial: time.Second, Max: 3 * time.Second, MaxWait: time.Hour}
+	retrier := shortener.NewRetrier("database", policy, shortener.WithRetryClock(clock))
+
+	attempts := 0
+	err := retrier.Do(context.Background(), func(ctx context.Context) error {
+		attempts++
+		if attempts < 5 {
+			return errRefused
+		}
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}, clock.slept, "waits should stop growing at the max")
+}
+
+func TestRetrierGivesUpAfterMaxWait(t *testing.T) {
+	clock := &sleepingClock{now: time.Date(2021, 12, 27, 9, 0, 0, 0, time.UTC)}
+	policy := shortener.RetryPolicy{Initial: time.Second, Max: 4 * time.Second, MaxWait: 10 * time.Second}
+	retrier := shortener.NewRetrier("database", policy, shortener.WithRetryClock(clock))
+
+	attempts := 0
+	err := retrier.Do(context.Background(), func(ctx context.Context) error {
+		attempts++
+		return errRefused
+	})
+
+	assert.ErrorIs(t, err, errRefused, "the error of the last attempt should be surfaced")
+	assert.EqualError(t, err, "gave up on database after 5 attempts over 10s: connection refused")
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 3 * time.Second}, clock.slept, "the last wait should be cut short at the max wait")
+}
+
+func TestRetrierTriesOnceWithoutMaxWait(t *testing.T) {
+	clock := &sleepingClock{now: time.Date(2021, 12, 27, 9, 0, 0, 0, time.UTC)}
+	retrier := shortener.NewRetrier("database", shortener.DefaultRetryPolicy(0), shortener.WithRetryClock(clock))
+
+	attempts := 0
+	err := retrier.Do(context.Background(), func(ctx context.Context) error {
+		attempts++
+		return errRefused
+	})
+
+	assert.ErrorIs(t, err, errRefused)
+	assert.Equal(t, 1, attempts)
+	assert.Empty(t, clock.slept)
+}
+
+func TestRetrierStopsWhenContextIsDone(t *testing.T) {
+	clock := &sleepingClock{now: time.Date(2021, 12, 27, 9, 0, 0, 0, time.UTC)}
+	retrier := shortener.NewRetrier("database", shortener.DefaultRetryPolicy(time.Minute), shortener.WithRetryClock(clock))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	err := retrier.Do(ctx, func(ctx context.Context) error {
+		attempts++
+		if attempts == 2 {
+			cancel()
+		}
+		return errRefused
+	})
+
+	assert.ErrorIs(t, err, errRefused)
+	assert.EqualError(t, err, "stopped waiting for database after 2 attempts: connection refused")
+	assert.Equal(t, 2, attempts)
+}
@@ -0,0 +1,175 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrShortNotActive is returned when a short is visited before its activation time
+var ErrShortNotActive = errors.New("short is not active yet")
+
+// localTimeLayouts are accepted for schedule times without an offset, which are read in the short's timezone
+var localTimeLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+// Clock tells the time, so schedules can be evaluated against a fake one in tests
+type Clock interface {
+	Now() time.Time
+}
+
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ScheduleRule overrides a short's destination while the current time is within [StartsAt, EndsAt).
+// A missing bound leaves that side of the window open.
+type ScheduleRule struct {
+	ID       int64      `json:"id,omitempty" db:"id"`
+	URL      string     `json:"url" db:"url"`
+	StartsAt *time.Time `json:"starts_at,omitempty" db:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at,omitempty" db:"ends_at"`
+}
+
+// Contains reports whether t falls within the rule's window
+func (r ScheduleRule) Contains(t time.Time) bool {
+	if r.StartsAt != nil && t.Before(*r.StartsAt) {
+		return false
+	}
+
+	if r.EndsAt != nil && !t.Before(*r.EndsAt) {
+		return false
+	}
+
+	return true
+}
+
+func (r ScheduleRule) overlaps(other ScheduleRule) bool {
+	startsBeforeOtherEnds := r.StartsAt == nil || other.EndsAt == nil || r.StartsAt.Before(*other.EndsAt)
+	otherStartsBeforeEnd := other.StartsAt == nil || r.EndsAt == nil || other.StartsAt.Before(*r.EndsAt)
+	return startsBeforeOtherEnds && otherStartsBeforeEnd
+}
+
+// ParseScheduleTime reads an RFC 3339 timestamp, or a local date and time interpreted in loc
+func ParseScheduleTime(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	for _, layout := range localTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("cannot parse time %q, expected RFC 3339 or YYYY-MM-DDTHH:MM[:SS]", value)
+}
+
+// ValidateSchedule checks every rule has a well formed window and that no two windows overlap,
+// so at most one override applies at any instant
+func ValidateSchedule(rules []ScheduleRule) error {
+	for i, rule := range rules {
+		if rule.StartsAt == nil && rule.EndsAt == nil {
+			return fmt.Errorf("schedule rule %d needs a start or an end", i)
+		}
+
+		if rule.StartsAt != nil && rule.EndsAt != nil && !rule.StartsAt.Before(*rule.EndsAt) {
+			return fmt.Errorf("schedule rule %d must start before it ends", i)
+		}
+
+		for j := 0; j < i; j++ {
+			if rule.overlaps(rules[j]) {
+				return fmt.Errorf("schedule rules %d and %d overlap", j, i)
+			}
+		}
+	}
+
+	return nil
+}
+
+func applyScheduleRequest(short *Short, request CreateShortRequest) error {
+	loc := time.UTC
+	if request.Timezone != "" {
+		var err error
+		loc, err = time.LoadLocation(request.Timezone)
+		if err != nil {
+			return fmt.Errorf("unknown timezone %q: %w", request.Timezone, err)
+		}
+		short.Timezone = &request.Timezone
+	}
+
+	if request.ActivateAt != "" {
+		activateAt, err := ParseScheduleTime(request.ActivateAt, loc)
+		if err != nil {
+			return err
+		}
+		short.ActivateAt = &activateAt
+	}
+
+	for _, ruleRequest := range request.Schedule {
+		URL, err := ParseDestinationURL(ruleRequest.URL)
+		if err != nil {
+			return err
+		}
+
+		rule := ScheduleRule{URL: URL.String()}
+
+		if ruleRequest.StartsAt != "" {
+			startsAt, err := ParseScheduleTime(ruleRequest.StartsAt, loc)
+			if err != nil {
+				return err
+			}
+			rule.StartsAt = &startsAt
+		}
+
+		if ruleRequest.EndsAt != "" {
+			endsAt, err := ParseScheduleTime(ruleRequest.EndsAt, loc)
+			if err != nil {
+				return err
+			}
+			rule.EndsAt = &endsAt
+		}
+
+		short.Schedule = append(short.Schedule, rule)
+	}
+
+	return ValidateSchedule(short.Schedule)
+}
+
+// Scheduler decides where a short points at the current time
+type Scheduler struct {
+	clock Clock
+}
+
+func NewScheduler(clock Clock) *Scheduler {
+	return &Scheduler{clock: clock}
+}
+
+// Resolve returns the schedule override active right now, if any. Without an override, a short
+// whose activation time is still in the future resolves to ErrShortNotActive.
+func (s *Scheduler) Resolve(short *Short) (*ScheduleRule, error) {
+	now := s.clock.Now()
+
+	for i := range short.Schedule {
+		if short.Schedule[i].Contains(now) {
+			return &short.Schedule[i], nil
+		}
+	}
+
+	if short.ActivateAt != nil && now.Before(*short.ActivateAt) {
+		return nil, ErrShortNotActive
+	}
+
+	return nil, nil
+}
+
+// IsScheduled reports whether a short's destination can change over time
+func (s *Short) IsScheduled() bool {
+	return s.ActivateAt != nil || len(s.Schedule) > 0
+}
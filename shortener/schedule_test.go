@@ -0,0 +1,229 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"l24.dev/shortener"
+	"l24.dev/test/mocks"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c fakeClock) Now() time.Time {
+	return c.now
+}
+
+func pointerTime(t time.Time) *time.Time {
+	return &t
+}
+
+var (
+	launch     = time.Date(2021, 11, 1, 9, 0, 0, 0, time.UTC)
+	wrapUp     = time.Date(2021, 11, 3, 17, 0, 0, 0, time.UTC)
+	comingSoon = shortener.ScheduleRule{URL: "http://example.com/soon", EndsAt: pointerTime(launch)}
+	archive    = shortener.ScheduleRule{URL: "http://example.com/archive", StartsAt: pointerTime(wrapUp)}
+)
+
+func TestParseScheduleTime(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load location: %v", err)
+	}
+
+	type testCase struct {
+		Name       string
+		Value      string
+		Expected   time.Time
+		ShouldFail bool
+	}
+
+	testCases := []testCase{
+		{
+			Name:     "RFC 3339 Ignores Location",
+			Value:    "2021-11-01T09:00:00Z",
+			Expected: launch,
+		},
+		{
+			Name:     "Local Time Before DST Ends",
+			Value:    "2021-11-06T09:00",
+			Expected: time.Date(2021, 11, 6, 13, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:     "Local Time After DST Ends",
+			Value:    "2021-11-08 09:00:00",
+			Expected: time.Date(2021, 11, 8, 14, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:       "Garbage",
+			Value:      "next tuesday",
+			ShouldFail: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			parsed, err := shortener.ParseScheduleTime(test.Value, newYork)
+			assert.Equal(t, test.ShouldFail, err != nil, "ShouldFail is %v, got %v", test.ShouldFail, err)
+			if err == nil {
+				assert.True(t, test.Expected.Equal(parsed), "expected %v, got %v", test.Expected, parsed)
+			}
+		})
+	}
+}
+
+func TestValidateSchedule(t *testing.T) {
+	type testCase struct {
+		Name       string
+		Rules      []shortener.ScheduleRule
+		ShouldFail bool
+	}
+
+	testCases := []testCase{
+		{
+			Name:       "Disjoint Windows",
+			Rules:      []shortener.ScheduleRule{comingSoon, archive},
+			ShouldFail: false,
+		},
+		{
+			Name:       "Unbounded Rule",
+			Rules:      []shortener.ScheduleRule{{URL: "http://example.com"}},
+			ShouldFail: true,
+		},
+		{
+			Name:       "Ends Before It Starts",
+			Rules:      []shortener.ScheduleRule{{URL: "http://example.com", StartsAt: pointerTime(wrapUp), EndsAt: pointerTime(launch)}},
+			ShouldFail: true,
+		},
+		{
+			Name: "Overlapping Windows",
+			Rules: []shortener.ScheduleRule{
+				comingSoon,
+				{URL: "http://example.com/event", StartsAt: pointerTime(launch.Add(-time.Hour)), EndsAt: pointerTime(wrapUp)},
+			},
+			ShouldFail: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			err := shortener.ValidateSchedule(test.Rules)
+			assert.Equal(t, test.ShouldFail, err != nil, "ShouldFail is %v, got %v", test.ShouldFail, err)
+		})
+	}
+}
+
+func TestSchedulerResolve(t *testing.T) {
+	short := &shortener.Short{
+		RedirectPath: "launch",
+		ActivateAt:   pointerTime(launch),
+		Schedule:     []shortener.ScheduleRule{archive},
+	}
+
+	type testCase struct {
+		Name        string
+		Now         time.Time
+		ExpectedURL string
+		ExpectedErr error
+	}
+
+	testCases := []testCase{
+		{
+			Name:        "Before Activation",
+			Now:         launch.Add(-time.Minute),
+			ExpectedErr: shortener.ErrShortNotActive,
+		},
+		{
+			Name: "At Activation",
+			Now:  launch,
+		},
+		{
+			Name:        "After Event",
+			Now:         wrapUp,
+			ExpectedURL: archive.URL,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			rule, err := shortener.NewScheduler(fakeClock{now: test.Now}).Resolve(short)
+			assert.Equal(t, test.ExpectedErr, err, "error should match")
+			if test.ExpectedURL == "" {
+				assert.Nil(t, rule, "no override should apply")
+			} else {
+				assert.Equal(t, test.ExpectedURL, rule.URL, "override should apply")
+			}
+		})
+	}
+}
+
+func TestGetScheduledShortHandler(t *testing.T) {
+	short := &shortener.Short{
+		RedirectPath: "launch",
+		Scheme:       "http",
+		Host:         "example.com",
+		Path:         pointerString("/event"),
+		ActivateAt:   pointerTime(launch),
+		Schedule:     []shortener.ScheduleRule{archive},
+	}
+
+	type testCase struct {
+		Name             string
+		Now              time.Time
+		ExpectedStatus   int
+		ExpectedLocation string
+	}
+
+	testCases := []testCase{
+		{
+			Name:           "Not Active Yet",
+			Now:            launch.Add(-time.Hour),
+			ExpectedStatus: http.StatusNotFound,
+		},
+		{
+			Name:             "During Event",
+			Now:              launch.Add(time.Hour),
+			ExpectedStatus:   http.StatusFound,
+			ExpectedLocation: "http://example.com/event",
+		},
+		{
+			Name:             "After Event",
+			Now:              wrapUp.Add(time.Hour),
+			ExpectedStatus:   http.StatusFound,
+			ExpectedLocation: archive.URL,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			dao := mocks.NewMockShortDAO(mock)
+			dao.EXPECT().GetShort(gomock.Any(), gomock.Any(), gomock.Any(), "launch").Return(short, nil).Times(1)
+
+			router := mux.NewRouter()
+			router.HandleFunc("/{short}", shortener.NewGetShortHandler(dao, shortener.WithClock(fakeClock{now: test.Now})))
+			server := httptest.NewServer(router)
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			response := e.GET("/launch").
+				WithRedirectPolicy(httpexpect.DontFollowRedirects).
+				Expect().
+				Status(test.ExpectedStatus)
+
+			if test.ExpectedLocation != "" {
+				response.Header("Location").Equal(test.ExpectedLocation)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+const DefaultDrainTimeout = 20 * time.Second
+
+// Worker is a background task running alongside the server. It must return soon after ctx is done,
+// flushing whatever it holds.
+type Worker func(ctx context.Context)
+
+// Server serves HTTP until told to stop, then shuts down gracefully: it stops accepting connections,
+// waits for requests in flight up to a deadline, stops its background workers and closes its resources
+type Server struct {
+	server       *http.Server
+	drainDelay   time.Duration
+	drainTimeout time.Duration
+	workers      []Worker
+	closers      []io.Closer
+	h2c          bool
+
+	draining int32
+}
+
+// ServerOption customises a Server
+type ServerOption func(*Server)
+
+// WithDrainDelay keeps serving for delay after shutdown starts, while reporting that the server is
+// draining, so load balancers polling its readiness stop sending it traffic before it stops listening
+func WithDrainDelay(delay time.Duration) ServerOption {
+	return func(s *Server) {
+		s.drainDelay = delay
+	}
+}
+
+// WithDrainTimeout limits how long requests in flight may take to finish once shutdown starts.
+// Connections still open after it are closed.
+func WithDrainTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.drainTimeout = timeout
+	}
+}
+
+// WithH2C serves HTTP/2 without TLS alongside HTTP/1, for proxies that terminate TLS and speak
+// HTTP/2 to the server
+func WithH2C() ServerOption {
+	return func(s *Server) {
+		s.h2c = true
+	}
+}
+
+// WithWorker runs worker for as long as the server runs
+func WithWorker(worker Worker) ServerOption {
+	return func(s *Server) {
+		s.workers = append(s.workers, worker)
+	}
+}
+
+// WithCloser closes closer once the server has drained and its workers have stopped, e.g. the database pool.
+// Closers are closed in the order they were given.
+func WithCloser(closer io.Closer) ServerOption {
+	return func(s *Server) {
+		s.closers = append(s.closers, closer)
+	}
+}
+
+// HTTPWorker serves server alongside the main one, e.g. metrics on an admin port, shutting it down
+// along with the other workers
+func HTTPWorker(server *http.Server) Worker {
+	return func(ctx context.Context) {
+		go func() {
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("server failed", "address", server.Addr, "error", err)
+			}
+		}()
+
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), DefaultDrainTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("failed to shut down server", "address", server.Addr, "error", err)
+		}
+	}
+}
+
+func NewServer(server *http.Server, opts ...ServerOption) *Server {
+	s := &Server{server: server, drainTimeout: DefaultDrainTimeout}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Draining reports whether the server is shutting down
+func (s *Server) Draining() bool {
+	return atomic.LoadInt32(&s.draining) == 1
+}
+
+// ListenAndServe listens on the address of the http.Server and calls Serve
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(ctx, listener)
+}
+
+// Serve serves requests on listener and runs the workers until ctx is done, typically on a signal,
+// then shuts everything down. It returns once shutdown is complete. When the http.Server has a
+// TLSConfig, requests are served over TLS, with HTTP/2 negotiated through ALPN.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	if s.h2c {
+		s.server.Handler = h2c.NewHandler(s.server.Handler, &http2.Server{})
+	}
+
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	var workers sync.WaitGroup
+	for _, worker := range s.workers {
+		workers.Add(1)
+		go func(worker Worker) {
+			defer workers.Done()
+			worker(workerCtx)
+		}(worker)
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		if s.server.TLSConfig != nil {
+			served <- s.server.ServeTLS(listener, "", "")
+			return
+		}
+		served <- s.server.Serve(listener)
+	}()
+
+	var result *multierror.Error
+
+	select {
+	case err := <-served:
+		result = multierror.Append(result, err)
+	case <-ctx.Done():
+		result = multierror.Append(result, s.drain())
+	}
+
+	stopWorkers()
+	workers.Wait()
+
+	for _, closer := range s.closers {
+		if err := closer.Close(); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+
+	slog.Info("server stopped")
+	return result.ErrorOrNil()
+}
+
+// drain stops accepting connections and waits for requests in flight, closing whatever is left at the deadline
+func (s *Server) drain() error {
+	atomic.StoreInt32(&s.draining, 1)
+
+	if s.drainDelay > 0 {
+		slog.Info("shutting down, still serving while reporting unready", "delay", s.drainDelay.String())
+		time.Sleep(s.drainDelay)
+	}
+
+	slog.Info("shutting down, draining requests", "timeout", s.drainTimeout.String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.drainTimeout)
+	defer cancel()
+
+	err := s.server.Shutdown(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		closeErr := s.server.Close()
+		return multierror.Append(fmt.Errorf("requests still in flight after %s were cut off", s.drainTimeout), closeErr).ErrorOrNil()
+	}
+
+	return err
+}
@@ -0,0 +1,179 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"context"
+	"io"
+	"l24.dev/shortener"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+// slowHandler holds requests until release is closed, telling started about each one
+func slowHandler(started chan<- struct{}, release <-chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		_, _ = io.WriteString(w, "done")
+	})
+}
+
+func get(url string) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		response, err := http.Get(url)
+		if err == nil {
+			var body []byte
+			body, err = io.ReadAll(response.Body)
+			response.Body.Close()
+			if err == nil && string(body) != "done" {
+				err = io.ErrUnexpectedEOF
+			}
+		}
+		result <- err
+	}()
+	return result
+}
+
+func TestServerDrainsOnSignal(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+
+	var workerStopped, closedAfterWorker int32
+	server := shortener.NewServer(&http.Server{Handler: slowHandler(started, release)},
+		shortener.WithDrainTimeout(5*time.Second),
+		shortener.WithWorker(func(ctx context.Context) {
+			<-ctx.Done()
+			atomic.StoreInt32(&workerStopped, 1)
+		}),
+		shortener.WithCloser(closerFunc(func() error {
+			closedAfterWorker = atomic.LoadInt32(&workerStopped)
+			return nil
+		})),
+	)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(ctx, listener) }()
+
+	response := get("http://" + address + "/slow")
+	<-started
+	assert.False(t, server.Draining())
+
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Eventually(t, server.Draining, time.Second, 10*time.Millisecond, "the signal should start draining")
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			conn.Close()
+		}
+		return err != nil
+	}, time.Second, 10*time.Millisecond, "new connections should be refused while draining")
+
+	select {
+	case <-served:
+		t.Fatal("the server should wait for the request in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	assert.Nil(t, <-response, "the request in flight should complete")
+	assert.Nil(t, <-served)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&workerStopped), "workers should be stopped")
+	assert.Equal(t, int32(1), closedAfterWorker, "resources should be closed after the workers stop")
+}
+
+func TestServerCutsOffRequestsAfterDrainTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+
+	closed := false
+	server := shortener.NewServer(&http.Server{Handler: slowHandler(started, release)},
+		shortener.WithDrainTimeout(50*time.Millisecond),
+		shortener.WithCloser(closerFunc(func() error {
+			closed = true
+			return nil
+		})),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(ctx, listener) }()
+
+	response := get("http://" + listener.Addr().String() + "/slow")
+	<-started
+	cancel()
+
+	assert.NotNil(t, <-served, "cutting off requests should be reported")
+	assert.NotNil(t, <-response, "the request should be cut off")
+	assert.True(t, closed, "resources should be closed even after a timeout")
+}
+
+func TestServerReportsDrainingBeforeClosing(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + listener.Addr().String() + "/readyz"
+
+	srv := &http.Server{}
+	server := shortener.NewServer(srv, shortener.WithDrainDelay(200*time.Millisecond))
+	srv.Handler = http.HandlerFunc(shortener.NewReadyzHandler(server.Draining))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(ctx, listener) }()
+
+	response, err := http.Get(url)
+	if assert.Nil(t, err) {
+		response.Body.Close()
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+	}
+
+	cancel()
+	assert.Eventually(t, server.Draining, time.Second, 10*time.Millisecond)
+
+	response, err = http.Get(url)
+	if assert.Nil(t, err, "the server should keep serving during the delay") {
+		response.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode, "readiness should fail while draining")
+	}
+
+	assert.Nil(t, <-served)
+}
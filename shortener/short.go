@@ -14,6 +14,28 @@ type Short struct {
 	Path         *string `json:"path" db:"path"`
 	Query        *string `json:"query" db:"query"`
 	Fragment     *string `json:"fragment" db:"fragment"`
+
+	Passthrough bool `json:"passthrough,omitempty" db:"passthrough"`
+	Template    bool `json:"template,omitempty" db:"template"`
+
+	ForwardQuery bool    `json:"forward_query,omitempty" db:"forward_query"`
+	UTMSource    *string `json:"utm_source,omitempty" db:"utm_source"`
+	UTMMedium    *string `json:"utm_medium,omitempty" db:"utm_medium"`
+	UTMCampaign  *string `json:"utm_campaign,omitempty" db:"utm_campaign"`
+
+	ActivateAt *time.Time `json:"activate_at,omitempty" db:"activate_at"`
+	Timezone   *string    `json:"timezone,omitempty" db:"timezone"`
+
+	CreatedByKeyID *int64 `json:"created_by_key_id,omitempty" db:"created_by_key_id"`
+	OwnerID        *int64 `json:"owner_id,omitempty" db:"owner_id"`
+
+	BlockedReason *string    `json:"blocked_reason,omitempty" db:"blocked_reason"`
+	DisabledAt    *time.Time `json:"disabled_at,omitempty" db:"disabled_at"`
+
+	PasswordHash *string `json:"-" db:"password_hash"`
+
+	Destinations []Destination  `json:"destinations,omitempty" db:"-"`
+	Schedule     []ScheduleRule `json:"schedule,omitempty" db:"-"`
 }
 
 func (s *Short) RawURL() string {
@@ -34,6 +56,14 @@ func (s *Short) RawURL() string {
 	return url
 }
 
+// RedirectsOnlyToURL reports whether visiting the short always leads to its URL as stored. Shorts that
+// pass through paths, fill in templates, forward queries, split traffic or follow a schedule don't.
+func (s *Short) RedirectsOnlyToURL() bool {
+	return !s.Passthrough && !s.Template && !s.ForwardQuery &&
+		isNilOrEmptyString(s.UTMSource) && isNilOrEmptyString(s.UTMMedium) && isNilOrEmptyString(s.UTMCampaign) &&
+		len(s.Destinations) == 0 && len(s.Schedule) == 0
+}
+
 func NewShort(scheme, host, path, query, fragment string) (*Short, error) {
 	if !strings.HasPrefix(path, "/") && path != "" {
 		path = "/" + path
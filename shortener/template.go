@@ -0,0 +1,224 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrMissingTemplateParameter is returned when a visit does not supply a value a template needs
+var ErrMissingTemplateParameter = errors.New("missing template parameter")
+
+// placeholderPattern matches {1}, {2}, ... for path segments, {rest} for the whole suffix and {query.name} for query parameters
+var placeholderPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+var queryPlaceholderPattern = regexp.MustCompile(`^query\.[A-Za-z0-9_.\-]+$`)
+
+// TemplateParams are the values a visit supplies to a template short
+type TemplateParams struct {
+	Segments []string
+	Query    url.Values
+}
+
+// NewTemplateParams splits the path suffix after the short into segments
+func NewTemplateParams(rest string, query url.Values) TemplateParams {
+	var segments []string
+	if rest != "" {
+		segments = strings.Split(strings.Trim(rest, "/"), "/")
+	}
+	return TemplateParams{Segments: segments, Query: query}
+}
+
+// ValidateTemplate checks that every placeholder in a destination is known, and that none appear
+// in the scheme or host, so substitution can never change where a template points
+func ValidateTemplate(template string) error {
+	prefix, rest := splitOrigin(template)
+	if placeholderPattern.MatchString(prefix) {
+		return fmt.Errorf("template %q has a placeholder in its scheme or host", template)
+	}
+
+	for _, match := range placeholderPattern.FindAllStringSubmatch(rest, -1) {
+		if !isKnownPlaceholder(match[1]) {
+			return fmt.Errorf("template %q has unknown placeholder {%s}", template, match[1])
+		}
+	}
+
+	return nil
+}
+
+// RenderTemplate fills the placeholders of a destination. Values are escaped for the part of the URL
+// they land in, so they cannot introduce new path segments, query parameters or fragments.
+func RenderTemplate(template string, params TemplateParams) (string, error) {
+	origin, rest := splitOrigin(template)
+
+	path, query, fragment, hasQuery, hasFragment := splitReference(rest)
+
+	renderedPath, err := renderPart(path, params, escapePathValue)
+	if err != nil {
+		return "", err
+	}
+
+	rendered := origin + renderedPath
+
+	if hasQuery {
+		renderedQuery, err := renderPart(query, params, escapeQueryValue)
+		if err != nil {
+			return "", err
+		}
+		rendered += "?" + renderedQuery
+	}
+
+	if hasFragment {
+		renderedFragment, err := renderPart(fragment, params, escapePathValue)
+		if err != nil {
+			return "", err
+		}
+		rendered += "#" + renderedFragment
+	}
+
+	// defence in depth: whatever was substituted, the result must still point at the template's origin
+	templateURL, err := url.Parse(origin)
+	if err != nil {
+		return "", err
+	}
+	renderedURL, err := url.Parse(rendered)
+	if err != nil {
+		return "", err
+	}
+	if renderedURL.Scheme != templateURL.Scheme || renderedURL.Host != templateURL.Host {
+		return "", fmt.Errorf("rendered template %q escaped its origin %q", rendered, origin)
+	}
+
+	return rendered, nil
+}
+
+func applyTemplateRequest(short *Short, request CreateShortRequest) error {
+	if !request.Template {
+		return nil
+	}
+
+	if request.Passthrough || len(request.Destinations) > 0 || len(request.Schedule) > 0 {
+		return errors.New("template shorts cannot pass through paths, split traffic or be scheduled")
+	}
+
+	err := ValidateTemplate(short.RawURL())
+	if err != nil {
+		return err
+	}
+
+	short.Template = true
+	return nil
+}
+
+func isKnownPlaceholder(name string) bool {
+	if name == "rest" || queryPlaceholderPattern.MatchString(name) {
+		return true
+	}
+
+	index, err := strconv.Atoi(name)
+	return err == nil && index > 0
+}
+
+// splitOrigin separates scheme://host from the rest of a URL
+func splitOrigin(raw string) (string, string) {
+	schemeEnd := strings.Index(raw, "://")
+	if schemeEnd < 0 {
+		return "", raw
+	}
+
+	hostStart := schemeEnd + len("://")
+	hostEnd := strings.IndexAny(raw[hostStart:], "/?#")
+	if hostEnd < 0 {
+		return raw, ""
+	}
+
+	return raw[:hostStart+hostEnd], raw[hostStart+hostEnd:]
+}
+
+// splitReference separates the path, query and fragment of everything after the origin
+func splitReference(rest string) (path, query, fragment string, hasQuery, hasFragment bool) {
+	if i := strings.Index(rest, "#"); i >= 0 {
+		rest, fragment, hasFragment = rest[:i], rest[i+1:], true
+	}
+
+	if i := strings.Index(rest, "?"); i >= 0 {
+		rest, query, hasQuery = rest[:i], rest[i+1:], true
+	}
+
+	return rest, query, fragment, hasQuery, hasFragment
+}
+
+func renderPart(part string, params TemplateParams, escape func(string) (string, error)) (string, error) {
+	var renderErr error
+
+	rendered := placeholderPattern.ReplaceAllStringFunc(part, func(placeholder string) string {
+		if renderErr != nil {
+			return ""
+		}
+
+		name := placeholder[1 : len(placeholder)-1]
+
+		if name == "rest" {
+			if len(params.Segments) == 0 {
+				renderErr = fmt.Errorf("%w: {rest}", ErrMissingTemplateParameter)
+				return ""
+			}
+
+			escaped := make([]string, 0, len(params.Segments))
+			for _, segment := range params.Segments {
+				value, err := escape(segment)
+				if err != nil {
+					renderErr = err
+					return ""
+				}
+				escaped = append(escaped, value)
+			}
+			return strings.Join(escaped, "/")
+		}
+
+		if strings.HasPrefix(name, "query.") {
+			key := strings.TrimPrefix(name, "query.")
+			if _, ok := params.Query[key]; !ok {
+				renderErr = fmt.Errorf("%w: {%s}", ErrMissingTemplateParameter, name)
+				return ""
+			}
+			value, err := escape(params.Query.Get(key))
+			if err != nil {
+				renderErr = err
+			}
+			return value
+		}
+
+		index, err := strconv.Atoi(name)
+		if err != nil || index < 1 || index > len(params.Segments) {
+			renderErr = fmt.Errorf("%w: {%s}", ErrMissingTemplateParameter, name)
+			return ""
+		}
+
+		value, err := escape(params.Segments[index-1])
+		if err != nil {
+			renderErr = err
+		}
+		return value
+	})
+
+	if renderErr != nil {
+		return "", renderErr
+	}
+
+	return rendered, nil
+}
+
+func escapePathValue(value string) (string, error) {
+	if value == "." || value == ".." {
+		return "", fmt.Errorf("template value %q is not allowed in a path", value)
+	}
+	return url.PathEscape(value), nil
+}
+
+func escapeQueryValue(value string) (string, error) {
+	return url.QueryEscape(value), nil
+}
@@ -0,0 +1,265 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"errors"
+	"l24.dev/shortener"
+	"l24.dev/test/mocks"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTemplate(t *testing.T) {
+	type testCase struct {
+		Name       string
+		Template   string
+		ShouldFail bool
+	}
+
+	testCases := []testCase{
+		{
+			Name:     "Positional",
+			Template: "https://jira.example.com/browse/{1}",
+		},
+		{
+			Name:     "Every Placeholder",
+			Template: "https://example.com/{1}/{rest}?q={query.q}#{2}",
+		},
+		{
+			Name:     "No Placeholders",
+			Template: "https://example.com/static",
+		},
+		{
+			Name:       "Placeholder In Host",
+			Template:   "https://{1}.example.com/",
+			ShouldFail: true,
+		},
+		{
+			Name:       "Placeholder As Host",
+			Template:   "https://{1}",
+			ShouldFail: true,
+		},
+		{
+			Name:       "Unknown Placeholder",
+			Template:   "https://example.com/{user}",
+			ShouldFail: true,
+		},
+		{
+			Name:       "Zero Index",
+			Template:   "https://example.com/{0}",
+			ShouldFail: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			err := shortener.ValidateTemplate(test.Template)
+			assert.Equal(t, test.ShouldFail, err != nil, "ShouldFail is %v, got %v", test.ShouldFail, err)
+		})
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	type testCase struct {
+		Name        string
+		Template    string
+		Rest        string
+		Query       url.Values
+		Expected    string
+		ExpectedErr error
+		ShouldFail  bool
+	}
+
+	testCases := []testCase{
+		{
+			Name:     "Positional",
+			Template: "https://jira.example.com/browse/{1}",
+			Rest:     "PROJ-123",
+			Expected: "https://jira.example.com/browse/PROJ-123",
+		},
+		{
+			Name:     "Rest Keeps Separators",
+			Template: "https://github.com/{rest}",
+			Rest:     "soggycactus/l24.dev/pulls",
+			Expected: "https://github.com/soggycactus/l24.dev/pulls",
+		},
+		{
+			Name:     "Query Placeholder",
+			Template: "https://www.google.com/search?q={query.q}&hl=en",
+			Query:    url.Values{"q": {"a&b=c d"}},
+			Expected: "https://www.google.com/search?q=a%26b%3Dc+d&hl=en",
+		},
+		{
+			Name:     "Positional In Query And Fragment",
+			Template: "https://example.com/search?q={1}#{2}",
+			Rest:     "cats/results",
+			Expected: "https://example.com/search?q=cats#results",
+		},
+		{
+			Name:     "Path Value Cannot Add Segments",
+			Template: "https://example.com/users/{1}/profile",
+			Rest:     "a?admin=true#x",
+			Expected: "https://example.com/users/a%3Fadmin=true%23x/profile",
+		},
+		{
+			Name:       "Placeholder In Host Is Never Rendered",
+			Template:   "https://example.com{query.host}",
+			Query:      url.Values{"host": {"@evil.com"}},
+			ShouldFail: true,
+		},
+		{
+			Name:       "Dot Segment",
+			Template:   "https://example.com/docs/{1}/index",
+			Rest:       "..",
+			ShouldFail: true,
+		},
+		{
+			Name:        "Missing Positional",
+			Template:    "https://jira.example.com/browse/{1}",
+			ExpectedErr: shortener.ErrMissingTemplateParameter,
+			ShouldFail:  true,
+		},
+		{
+			Name:        "Missing Query",
+			Template:    "https://www.google.com/search?q={query.q}",
+			ExpectedErr: shortener.ErrMissingTemplateParameter,
+			ShouldFail:  true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			rendered, err := shortener.RenderTemplate(test.Template, shortener.NewTemplateParams(test.Rest, test.Query))
+			assert.Equal(t, test.ShouldFail, err != nil, "ShouldFail is %v, got %v", test.ShouldFail, err)
+			if test.ExpectedErr != nil {
+				assert.True(t, errors.Is(err, test.ExpectedErr), "expected %v, got %v", test.ExpectedErr, err)
+			}
+			if !test.ShouldFail {
+				assert.Equal(t, test.Expected, rendered, "rendered template should match")
+			}
+		})
+	}
+}
+
+func TestGetTemplateShortHandler(t *testing.T) {
+	type testCase struct {
+		Name             string
+		Path             string
+		ExpectedStatus   int
+		ExpectedLocation string
+	}
+
+	testCases := []testCase{
+		{
+			Name:             "Issue",
+			Path:             "/jira/PROJ-123",
+			ExpectedStatus:   http.StatusMovedPermanently,
+			ExpectedLocation: "https://jira.example.com/browse/PROJ-123",
+		},
+		{
+			Name:           "Missing Issue",
+			Path:           "/jira",
+			ExpectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			dao := mocks.NewMockShortDAO(mock)
+			dao.
+				EXPECT().
+				GetShort(gomock.Any(), gomock.Any(), gomock.Any(), "jira").
+				Return(&shortener.Short{
+					RedirectPath: "jira",
+					Scheme:       "https",
+					Host:         "jira.example.com",
+					Path:         pointerString("/browse/{1}"),
+					Template:     true,
+				}, nil).
+				Times(1)
+
+			getShort := shortener.NewGetShortHandler(dao)
+			router := mux.NewRouter()
+			router.HandleFunc("/{short}", getShort)
+			router.HandleFunc("/{short}/{rest:.+}", getShort)
+			server := httptest.NewServer(router)
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			response := e.GET(test.Path).
+				WithRedirectPolicy(httpexpect.DontFollowRedirects).
+				Expect().
+				Status(test.ExpectedStatus)
+
+			if test.ExpectedLocation != "" {
+				response.Header("Location").Equal(test.ExpectedLocation)
+			}
+		})
+	}
+}
+
+func TestCreateTemplateShortHandler(t *testing.T) {
+	type testCase struct {
+		Name           string
+		Request        shortener.CreateShortRequest
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{
+			Name:           "Template",
+			Request:        shortener.CreateShortRequest{URL: "https://jira.example.com/browse/{1}", Alias: "jira", Template: true},
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "Unknown Placeholder",
+			Request:        shortener.CreateShortRequest{URL: "https://jira.example.com/browse/{issue}", Template: true},
+			ExpectedStatus: http.StatusBadRequest,
+		},
+		{
+			Name:           "Template With Passthrough",
+			Request:        shortener.CreateShortRequest{URL: "https://jira.example.com/browse/{1}", Template: true, Passthrough: true},
+			ExpectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			dao := mocks.NewMockShortDAO(mock)
+
+			times := 0
+			if test.ExpectedStatus == http.StatusOK {
+				times = 1
+			}
+			dao.
+				EXPECT().
+				InsertShort(gomock.Any(), gomock.Any(), gomock.Any(), gomock.AssignableToTypeOf(shortener.Short{})).
+				Return(nil).
+				Times(times)
+
+			server := httptest.NewServer(http.HandlerFunc(shortener.NewCreateShortHandler(dao)))
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			response := e.POST("/short").WithJSON(&test.Request).WithHeader("Content-Type", "application/json").
+				Expect().
+				Status(test.ExpectedStatus)
+
+			if test.ExpectedStatus == http.StatusOK {
+				object := response.JSON().Object()
+				object.Value("template").Boolean().True()
+				object.Value("path").String().Equal("/browse/{1}")
+			}
+		})
+	}
+}
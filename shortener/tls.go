@@ -0,0 +1,176 @@
+package shortener
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// CertReloader serves the certificate in a pair of PEM files, picking up a new one without a restart
+// whenever it is told to or the files change
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	version string
+}
+
+// NewCertReloader loads the certificate and key in certFile and keyFile
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	reloader := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.Reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// Reload loads the certificate and key again. If they cannot be loaded, the previous certificate is kept.
+func (c *CertReloader) Reload() error {
+	version, err := c.fileVersion()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate %s: %w", c.certFile, err)
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.version = version
+	c.mu.Unlock()
+
+	return nil
+}
+
+// GetCertificate returns the current certificate, to be used as tls.Config.GetCertificate
+func (c *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// TLSConfig serves the current certificate over TLS 1.2 or later
+func (c *CertReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: c.GetCertificate,
+	}
+}
+
+// Run reloads the certificate whenever reload receives, typically on SIGHUP, and whenever the files
+// change, checking them every interval, until ctx is done
+func (c *CertReloader) Run(ctx context.Context, interval time.Duration, reload <-chan os.Signal) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-reload:
+		case <-ticker.C:
+			if !c.changed() {
+				continue
+			}
+		}
+
+		if err := c.Reload(); err != nil {
+			slog.ErrorContext(ctx, "keeping previous certificate", "error", err)
+			continue
+		}
+		slog.InfoContext(ctx, "reloaded certificate", "file", c.certFile)
+	}
+}
+
+// changed reports whether either file was modified since the certificate was loaded
+func (c *CertReloader) changed() bool {
+	version, err := c.fileVersion()
+	if err != nil {
+		return false // a file being replaced may briefly be missing, so try again on the next tick
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return version != c.version
+}
+
+// fileVersion identifies the current content of both files by their size and modification time
+func (c *CertReloader) fileVersion() (string, error) {
+	version := ""
+	for _, path := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		version += fmt.Sprintf("%d:%d;", info.Size(), info.ModTime().UnixNano())
+	}
+	return version, nil
+}
+
+// HSTS is the Strict-Transport-Security policy sent to browsers
+type HSTS struct {
+	MaxAge            time.Duration
+	IncludeSubdomains bool
+	Preload           bool
+}
+
+// Header is the value of the Strict-Transport-Security header
+func (h HSTS) Header() string {
+	value := "max-age=" + strconv.FormatInt(int64(h.MaxAge/time.Second), 10)
+	if h.IncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	if h.Preload {
+		value += "; preload"
+	}
+	return value
+}
+
+// NewHSTSMiddleware tells browsers to only reach us over HTTPS for the max age of hsts. Browsers ignore
+// the header over plain HTTP, so it is also safe to send behind a proxy terminating TLS.
+func NewHSTSMiddleware(hsts HSTS) mux.MiddlewareFunc {
+	header := hsts.Header()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Strict-Transport-Security", header)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// NewHTTPSRedirectHandler redirects every request to the same URL over HTTPS on httpsPort, preserving
+// its method. The port is left out of the URL when it is 443.
+func NewHTTPSRedirectHandler(httpsPort string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := (&url.URL{Host: r.Host}).Hostname()
+		if host == "" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	}
+}
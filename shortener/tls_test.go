@@ -0,0 +1,277 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"l24.dev/shortener"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+)
+
+// selfSigned generates a certificate for 127.0.0.1 and localhost, identified by serial
+type selfSigned struct {
+	cert *x509.Certificate
+	pem  []byte
+	key  []byte
+}
+
+func newSelfSigned(t *testing.T, serial int64) selfSigned {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	return selfSigned{
+		cert: cert,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		key:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// write replaces the certificate and key files, moving their modification time forward so the change
+// is seen even on file systems with coarse timestamps
+func (s selfSigned) write(t *testing.T, certFile, keyFile string, modified time.Time) {
+	for path, content := range map[string][]byte{certFile: s.pem, keyFile: s.key} {
+		if err := os.WriteFile(path, content, 0o600); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatalf("failed to touch %s: %v", path, err)
+		}
+	}
+}
+
+func certFiles(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	return filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+}
+
+func servedSerial(t *testing.T, reloader *shortener.CertReloader) int64 {
+	cert, err := reloader.GetCertificate(nil)
+	if err != nil || cert == nil {
+		t.Fatalf("no certificate served: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("failed to parse served certificate: %v", err)
+	}
+	return leaf.SerialNumber.Int64()
+}
+
+func TestCertReloaderReloadsOnSignal(t *testing.T) {
+	certFile, keyFile := certFiles(t)
+	modified := time.Now().Add(-time.Hour)
+	newSelfSigned(t, 1).write(t, certFile, keyFile, modified)
+
+	reloader, err := shortener.NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("failed to load certificate: %v", err)
+	}
+	assert.Equal(t, int64(1), servedSerial(t, reloader))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hup := make(chan os.Signal)
+	go reloader.Run(ctx, time.Hour, hup)
+
+	// the same modification time, so only the signal can reveal the change
+	newSelfSigned(t, 2).write(t, certFile, keyFile, modified)
+	hup <- os.Interrupt
+	hup <- os.Interrupt // handed over once the first reload is done
+
+	assert.Equal(t, int64(2), servedSerial(t, reloader), "the signal should reload the certificate")
+}
+
+func TestCertReloaderReloadsOnFileChange(t *testing.T) {
+	certFile, keyFile := certFiles(t)
+	modified := time.Now().Add(-time.Hour)
+	newSelfSigned(t, 1).write(t, certFile, keyFile, modified)
+
+	reloader, err := shortener.NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("failed to load certificate: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Run(ctx, 10*time.Millisecond, nil)
+
+	newSelfSigned(t, 2).write(t, certFile, keyFile, modified.Add(time.Minute))
+
+	assert.Eventually(t, func() bool {
+		return servedSerial(t, reloader) == 2
+	}, 5*time.Second, 10*time.Millisecond, "a changed file should be picked up")
+}
+
+func TestCertReloaderKeepsCertificateWhenReloadFails(t *testing.T) {
+	certFile, keyFile := certFiles(t)
+	newSelfSigned(t, 1).write(t, certFile, keyFile, time.Now())
+
+	reloader, err := shortener.NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("failed to load certificate: %v", err)
+	}
+
+	// a certificate that does not match the key
+	other := newSelfSigned(t, 2)
+	if err := os.WriteFile(certFile, other.pem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NotNil(t, reloader.Reload())
+	assert.Equal(t, int64(1), servedSerial(t, reloader), "the previous certificate should still be served")
+
+	_, err = shortener.NewCertReloader(certFile, keyFile)
+	assert.NotNil(t, err, "a broken pair should not load at startup")
+}
+
+func TestServerServesHTTP2OverTLS(t *testing.T) {
+	certFile, keyFile := certFiles(t)
+	cert := newSelfSigned(t, 1)
+	cert.write(t, certFile, keyFile, time.Now())
+
+	reloader, err := shortener.NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("failed to load certificate: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hsts := shortener.HSTS{MaxAge: 365 * 24 * time.Hour, IncludeSubdomains: true}
+	handler := shortener.NewHSTSMiddleware(hsts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server := shortener.NewServer(&http.Server{Handler: handler, TLSConfig: reloader.TLSConfig()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(ctx, listener) }()
+	defer func() {
+		cancel()
+		assert.Nil(t, <-served)
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert.cert)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: roots},
+		ForceAttemptHTTP2: true,
+	}}
+
+	response, err := client.Get("https://" + listener.Addr().String() + "/")
+	if assert.Nil(t, err) {
+		response.Body.Close()
+		assert.Equal(t, 2, response.ProtoMajor, "HTTP/2 should be negotiated")
+		assert.Equal(t, "max-age=31536000; includeSubDomains", response.Header.Get("Strict-Transport-Security"))
+	}
+}
+
+func TestServerServesH2C(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := shortener.NewServer(&http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}, shortener.WithH2C())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(ctx, listener) }()
+	defer func() {
+		cancel()
+		<-served
+	}()
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, address string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, address)
+		},
+	}}
+
+	response, err := client.Get("http://" + listener.Addr().String() + "/")
+	if assert.Nil(t, err) {
+		response.Body.Close()
+		assert.Equal(t, 2, response.ProtoMajor, "HTTP/2 should be spoken without TLS")
+	}
+
+	response, err = http.Get("http://" + listener.Addr().String() + "/")
+	if assert.Nil(t, err) {
+		response.Body.Close()
+		assert.Equal(t, 1, response.ProtoMajor, "HTTP/1 should still be served")
+	}
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	type testCase struct {
+		Name     string
+		Port     string
+		Method   string
+		URL      string
+		Expected string
+	}
+
+	testCases := []testCase{
+		{Name: "Default Port", Port: "443", Method: http.MethodGet, URL: "http://l24.dev/c3xd4d?utm_source=mail", Expected: "https://l24.dev/c3xd4d?utm_source=mail"},
+		{Name: "Custom Port", Port: "8443", Method: http.MethodGet, URL: "http://l24.dev:8080/c3xd4d", Expected: "https://l24.dev:8443/c3xd4d"},
+		{Name: "IPv6 Host", Port: "443", Method: http.MethodGet, URL: "http://[::1]:80/c3xd4d", Expected: "https://[::1]/c3xd4d"},
+		{Name: "Method Preserved", Port: "443", Method: http.MethodPost, URL: "http://l24.dev/short", Expected: "https://l24.dev/short"},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			response := httptest.NewRecorder()
+			shortener.NewHTTPSRedirectHandler(test.Port)(response, httptest.NewRequest(test.Method, test.URL, nil))
+
+			assert.Equal(t, http.StatusPermanentRedirect, response.Code)
+			assert.Equal(t, test.Expected, response.Header().Get("Location"))
+		})
+	}
+}
+
+func TestHSTSHeader(t *testing.T) {
+	assert.Equal(t, "max-age=300", shortener.HSTS{MaxAge: 5 * time.Minute}.Header())
+	assert.Equal(t, "max-age=63072000; includeSubDomains; preload", shortener.HSTS{MaxAge: 2 * 365 * 24 * time.Hour, IncludeSubdomains: true, Preload: true}.Header())
+}
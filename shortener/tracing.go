@@ -0,0 +1,89 @@
+package shortener
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName names the tracer the shortener's spans come from
+const TracerName = "l24.dev/shortener"
+
+// Attributes of the spans of the shortener, besides the OpenTelemetry semantic conventions
+const (
+	WorkspaceAttribute   = attribute.Key("l24.workspace")
+	DomainAttribute      = attribute.Key("l24.domain")
+	ShortAttribute       = attribute.Key("l24.short")
+	DestinationAttribute = attribute.Key("l24.destination")
+	StatementsAttribute  = attribute.Key("l24.statements")
+)
+
+// tracer is looked up on every span so tests, and main, can swap the global provider
+func tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// NewTracingMiddleware starts a span for every request, named after the template of the route it matched,
+// like GET /{short}. When the caller sent a W3C traceparent header the span continues its trace.
+// Spans and propagation go through the global OpenTelemetry provider and propagator.
+func NewTracingMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := routeTemplate(r)
+
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			// only the route goes on the span: paths and queries can carry whatever visitors put in them
+			ctx, span := tracer().Start(ctx, r.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(semconv.HTTPMethodKey.String(r.Method), semconv.HTTPRouteKey.String(route)),
+			)
+			defer span.End()
+
+			recorder := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r.WithContext(ctx))
+
+			span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(recorder.Status())...)
+			span.SetStatus(semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(recorder.Status(), trace.SpanKindServer))
+		})
+	}
+}
+
+// startSpan starts an internal span under the one in ctx
+func startSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer().Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// endSpan ends span, marking it failed with err. A missing or already taken short is an answer the
+// handlers expect rather than a failure, so it is not marked.
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) && !errors.Is(err, ErrShortExists) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// shortAttributes identify the short a span works on
+func shortAttributes(workspace int64, domain int64, redirectPath string) []attribute.KeyValue {
+	return []attribute.KeyValue{WorkspaceAttribute.Int64(workspace), DomainAttribute.Int64(domain), ShortAttribute.String(redirectPath)}
+}
+
+// routeTemplate is the template of the route r matched, like /{short}, so spans and metrics do not
+// multiply with the number of shorts
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,181 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"context"
+	"errors"
+	"l24.dev/shortener"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans sends the spans of the test to an in-memory exporter
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	})
+	return exporter
+}
+
+func findSpan(spans tracetest.SpanStubs, name string) *tracetest.SpanStub {
+	for i := range spans {
+		if spans[i].Name == name {
+			return &spans[i]
+		}
+	}
+	return nil
+}
+
+func hasAttribute(span *tracetest.SpanStub, expected attribute.KeyValue) bool {
+	for _, attr := range span.Attributes {
+		if attr == expected {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTracingContinuesTraceOfCaller(t *testing.T) {
+	exporter := recordSpans(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(shortener.GetShortQuery)).
+		WithArgs("c3xd4d", shortener.DefaultWorkspaceID, shortener.DefaultDomainID).
+		WillReturnRows(sqlmock.NewRows([]string{"redirect_path", "scheme", "host", "path", "query", "fragment"}).
+			AddRow("c3xd4d", "https", "lucastephens.com", nil, nil, nil))
+	mock.ExpectQuery(regexp.QuoteMeta(shortener.GetDestinationsQuery)).
+		WithArgs("c3xd4d", shortener.DefaultWorkspaceID, shortener.DefaultDomainID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "url", "weight", "clicks"}))
+	mock.ExpectQuery(regexp.QuoteMeta(shortener.GetScheduleQuery)).
+		WithArgs("c3xd4d", shortener.DefaultWorkspaceID, shortener.DefaultDomainID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "url", "starts_at", "ends_at"}))
+
+	router := mux.NewRouter()
+	router.Use(shortener.NewTracingMiddleware())
+	router.HandleFunc("/{short}", shortener.NewGetShortHandler(shortener.NewShortPostgresDao(db, "postgres"))).Methods(http.MethodGet)
+
+	request := httptest.NewRequest(http.MethodGet, "/c3xd4d?utm_source=mail", nil)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusMovedPermanently, response.Code)
+	assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 2, "there should be a span for the request and one for the DAO")
+
+	server := findSpan(spans, "GET /{short}")
+	if assert.NotNil(t, server, "the request span should be named after its route") {
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID().String(), "the trace of the caller should continue")
+		assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String(), "the span of the caller should be the parent")
+		assert.True(t, server.Parent.IsRemote())
+		assert.Equal(t, trace.SpanKindServer, server.SpanKind)
+		assert.True(t, hasAttribute(server, semconv.HTTPRouteKey.String("/{short}")))
+		assert.True(t, hasAttribute(server, semconv.HTTPStatusCodeKey.Int(http.StatusMovedPermanently)))
+		assert.Equal(t, codes.Unset, server.Status.Code)
+	}
+
+	get := findSpan(spans, "ShortDAO.GetShort")
+	if assert.NotNil(t, get) && server != nil {
+		assert.Equal(t, server.SpanContext.SpanID(), get.Parent.SpanID(), "the DAO span should be a child of the request span")
+		assert.Equal(t, server.SpanContext.TraceID(), get.SpanContext.TraceID())
+		assert.True(t, hasAttribute(get, shortener.ShortAttribute.String("c3xd4d")))
+		assert.True(t, hasAttribute(get, shortener.WorkspaceAttribute.Int64(shortener.DefaultWorkspaceID)))
+	}
+}
+
+func TestTracingMarksMissingShortsAsAnswers(t *testing.T) {
+	exporter := recordSpans(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(shortener.GetShortQuery)).
+		WithArgs("missing", shortener.DefaultWorkspaceID, shortener.DefaultDomainID).
+		WillReturnRows(sqlmock.NewRows([]string{"redirect_path"}))
+
+	router := mux.NewRouter()
+	router.Use(shortener.NewTracingMiddleware())
+	router.HandleFunc("/{short}", shortener.NewGetShortHandler(shortener.NewShortPostgresDao(db, "postgres"))).Methods(http.MethodGet)
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	assert.Equal(t, http.StatusNotFound, response.Code)
+
+	spans := exporter.GetSpans()
+	if get := findSpan(spans, "ShortDAO.GetShort"); assert.NotNil(t, get) {
+		assert.Equal(t, codes.Unset, get.Status.Code, "a missing short should not be a failed span")
+	}
+	if server := findSpan(spans, "GET /{short}"); assert.NotNil(t, server) {
+		assert.Equal(t, codes.Unset, server.Status.Code, "a 404 is not a server error")
+		assert.False(t, server.Parent.IsValid(), "without a traceparent the request should start a trace")
+	}
+}
+
+func TestTracingTransactions(t *testing.T) {
+	exporter := recordSpans(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(shortener.AuditDeleteShortQuery)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(shortener.DeleteShortQuery)).
+		WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "test")
+	err = shortener.NewShortPostgresDao(db, "postgres").DeleteShort(ctx, shortener.DefaultWorkspaceID, shortener.DefaultDomainID, "test")
+	parent.End()
+
+	assert.NotNil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 3)
+
+	transaction := findSpan(spans, "executeTransaction")
+	remove := findSpan(spans, "ShortDAO.DeleteShort")
+	if assert.NotNil(t, transaction) && assert.NotNil(t, remove) {
+		assert.Equal(t, remove.SpanContext.SpanID(), transaction.Parent.SpanID(), "the transaction should be a child of the DAO call")
+		assert.Equal(t, parent.SpanContext().SpanID(), remove.Parent.SpanID(), "the DAO call should be a child of the span in its context")
+		assert.True(t, hasAttribute(transaction, semconv.DBSystemPostgreSQL))
+		assert.True(t, hasAttribute(transaction, shortener.StatementsAttribute.Int(2)))
+		assert.Equal(t, codes.Error, transaction.Status.Code, "the failed transaction should be marked")
+		assert.Equal(t, codes.Error, remove.Status.Code, "the failed DAO call should be marked")
+		assert.Len(t, transaction.Events, 1, "the error should be recorded")
+	}
+}
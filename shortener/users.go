@@ -0,0 +1,97 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	SessionTokenPrefix = "l24s_"
+	DefaultSessionTTL  = 24 * time.Hour
+
+	MinPasswordLength = 8
+	MaxPasswordLength = 72 // bcrypt ignores anything longer
+)
+
+// ErrUserExists is returned when registering an email that already has an account
+var ErrUserExists = errors.New("user already exists")
+
+// dummyPasswordHash is compared against when a login names an unknown user, so that
+// unknown and known emails take the same time to reject
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("l24.dev dummy password"), bcrypt.DefaultCost)
+
+type User struct {
+	ID           int64     `json:"id" db:"id"`
+	Email        string    `json:"email" db:"email"`
+	PasswordHash *string   `json:"-" db:"password_hash"`
+	IsAdmin      bool      `json:"is_admin" db:"is_admin"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// Session is a login, identified by the hash of its bearer token
+type Session struct {
+	UserID    int64     `db:"user_id"`
+	TokenHash string    `db:"token_hash"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+// NormalizeEmail validates an email address and lower-cases it, so it can be compared
+func NormalizeEmail(email string) (string, error) {
+	address, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || address.Name != "" {
+		return "", fmt.Errorf("invalid email %q", email)
+	}
+	return strings.ToLower(address.Address), nil
+}
+
+// HashPassword validates a password and returns its bcrypt hash
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength || len(password) > MaxPasswordLength {
+		return "", fmt.Errorf("password must be between %d and %d bytes", MinPasswordLength, MaxPasswordLength)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches the user's password. A nil user, or one
+// without a password, never matches but costs as much to check as one that does.
+func CheckPassword(user *User, password string) bool {
+	hash := dummyPasswordHash
+	if user != nil && user.PasswordHash != nil {
+		hash = []byte(*user.PasswordHash)
+	}
+
+	err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+	return err == nil && user != nil && user.PasswordHash != nil
+}
+
+// GenerateSession creates a session for user, returning the plaintext bearer token and the Session to store for it
+func GenerateSession(user *User, ttl time.Duration, now time.Time) (string, *Session, error) {
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	token := SessionTokenPrefix + secret
+
+	return token, &Session{
+		UserID:    user.ID,
+		TokenHash: HashToken(token),
+		ExpiresAt: now.Add(ttl),
+	}, nil
+}
+
+// IsSessionToken reports whether a bearer token looks like a session token
+func IsSessionToken(token string) bool {
+	return strings.HasPrefix(token, SessionTokenPrefix)
+}
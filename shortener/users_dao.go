@@ -0,0 +1,194 @@
+package shortener
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	InsertUserQuery                 = "INSERT INTO users (email, password_hash) VALUES ($1, $2) RETURNING id, is_admin, created_at"
+	GetUserByEmailQuery             = "SELECT id, email, password_hash, is_admin, created_at FROM users WHERE email=$1"
+	InsertSessionQuery              = "INSERT INTO sessions (user_id, token_hash, expires_at) VALUES ($1, $2, $3)"
+	GetUserBySessionQuery           = "SELECT u.id, u.email, u.password_hash, u.is_admin, u.created_at FROM users u JOIN sessions s ON s.user_id = u.id WHERE s.token_hash=$1 AND s.expires_at > NOW()"
+	DeleteSessionQuery              = "DELETE FROM sessions WHERE token_hash=$1"
+	DeleteExpiredSessionsQuery      = "DELETE FROM sessions WHERE expires_at <= NOW()"
+	GetUserByIdentityQuery          = "SELECT u.id, u.email, u.password_hash, u.is_admin, u.created_at FROM users u JOIN user_identities i ON i.user_id = u.id WHERE i.issuer=$1 AND i.subject=$2"
+	InsertExternalUserQuery         = "WITH u AS (INSERT INTO users (email) VALUES ($1) RETURNING id, is_admin, created_at), i AS (INSERT INTO user_identities (user_id, issuer, subject) SELECT id, $2, $3 FROM u) SELECT id, is_admin, created_at FROM u"
+	LinkIdentityQuery               = "INSERT INTO user_identities (user_id, issuer, subject) SELECT id, $2, $3 FROM users WHERE id=$1 AND password_hash IS NULL AND NOT EXISTS (SELECT 1 FROM user_identities WHERE user_id=$1 AND issuer=$2)"
+	SetAdminQuery                   = "UPDATE users SET is_admin=$2 WHERE id=$1"
+	InsertIdentityLinkQuery         = "INSERT INTO identity_links (user_id, issuer, subject, token_hash, expires_at) VALUES ($1, $2, $3, $4, $5)"
+	DeleteExpiredIdentityLinksQuery = "DELETE FROM identity_links WHERE expires_at <= NOW()"
+	GetUserByIdentityLinkQuery      = "SELECT u.id, u.email, u.password_hash, u.is_admin, u.created_at FROM users u JOIN identity_links l ON l.user_id = u.id WHERE l.token_hash=$1 AND l.expires_at > NOW()"
+	ConfirmIdentityLinkQuery        = "INSERT INTO user_identities (user_id, issuer, subject) SELECT user_id, issuer, subject FROM identity_links WHERE token_hash=$1 AND expires_at > NOW()"
+	DeleteIdentityLinkQuery         = "DELETE FROM identity_links WHERE token_hash=$1"
+)
+
+type UserDAO interface {
+	InsertUser(ctx context.Context, user *User) error
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	InsertSession(ctx context.Context, session Session) error
+	GetUserBySession(ctx context.Context, token_hash string) (*User, error)
+	DeleteSession(ctx context.Context, token_hash string) error
+	GetUserByIdentity(ctx context.Context, issuer string, subject string) (*User, error)
+	InsertExternalUser(ctx context.Context, user *User, issuer string, subject string) error
+	LinkIdentity(ctx context.Context, user int64, issuer string, subject string) error
+	SetAdmin(ctx context.Context, user int64, admin bool) error
+	InsertIdentityLink(ctx context.Context, link IdentityLink) error
+	GetUserByIdentityLink(ctx context.Context, token_hash string) (*User, error)
+	ConfirmIdentityLink(ctx context.Context, token_hash string) error
+}
+
+func NewUserPostgresDao(db *sql.DB, driver string) *UserPostgresDAO {
+	return &UserPostgresDAO{db: db, driver: driver}
+}
+
+type UserPostgresDAO struct {
+	db     *sql.DB
+	driver string
+}
+
+// InsertUser stores user, filling in its ID, admin flag and creation time. It returns
+// ErrUserExists if the email is already registered.
+func (s *UserPostgresDAO) InsertUser(ctx context.Context, user *User) error {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	err := db.QueryRowxContext(ctx, InsertUserQuery, user.Email, user.PasswordHash).
+		Scan(&user.ID, &user.IsAdmin, &user.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrUserExists
+	}
+
+	return err
+}
+
+func (s *UserPostgresDAO) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	var user User
+	err := db.GetContext(ctx, &user, GetUserByEmailQuery, email)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// InsertSession stores a new session, clearing out expired ones in the same transaction
+func (s *UserPostgresDAO) InsertSession(ctx context.Context, session Session) error {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	return executeTransaction(ctx, *db,
+		statement{query: DeleteExpiredSessionsQuery},
+		statement{query: InsertSessionQuery, args: []interface{}{session.UserID, session.TokenHash, session.ExpiresAt}},
+	)
+}
+
+// GetUserBySession returns the user owning an unexpired session
+func (s *UserPostgresDAO) GetUserBySession(ctx context.Context, token_hash string) (*User, error) {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	var user User
+	err := db.GetContext(ctx, &user, GetUserBySessionQuery, token_hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (s *UserPostgresDAO) DeleteSession(ctx context.Context, token_hash string) error {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	return executeTransaction(ctx, *db, statement{query: DeleteSessionQuery, args: []interface{}{token_hash}})
+}
+
+// GetUserByIdentity returns the user an identity provider knows as subject
+func (s *UserPostgresDAO) GetUserByIdentity(ctx context.Context, issuer string, subject string) (*User, error) {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	var user User
+	err := db.GetContext(ctx, &user, GetUserByIdentityQuery, issuer, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// InsertExternalUser stores a user without a password along with their identity at issuer, filling in
+// their ID, admin flag and creation time. It returns ErrUserExists if the email is already registered
+// or the identity already belongs to someone.
+func (s *UserPostgresDAO) InsertExternalUser(ctx context.Context, user *User, issuer string, subject string) error {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	err := db.QueryRowxContext(ctx, InsertExternalUserQuery, user.Email, issuer, subject).
+		Scan(&user.ID, &user.IsAdmin, &user.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrUserExists
+	}
+
+	return err
+}
+
+// LinkIdentity attaches an identity at issuer to a user who has no password and no other identity there,
+// such as one who signed in before identities were recorded. It returns sql.ErrNoRows for any other user,
+// and ErrIdentityLinked if the identity already belongs to someone.
+func (s *UserPostgresDAO) LinkIdentity(ctx context.Context, user int64, issuer string, subject string) error {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	err := executeTransaction(ctx, *db, statement{query: LinkIdentityQuery, args: []interface{}{user, issuer, subject}, mustAffectRows: true})
+	if isUniqueViolation(err) {
+		return ErrIdentityLinked
+	}
+
+	return err
+}
+
+// SetAdmin grants or revokes admin rights
+func (s *UserPostgresDAO) SetAdmin(ctx context.Context, user int64, admin bool) error {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	return executeTransaction(ctx, *db, statement{query: SetAdminQuery, args: []interface{}{user, admin}})
+}
+
+// InsertIdentityLink stores a link waiting to be confirmed, clearing out expired ones in the same transaction
+func (s *UserPostgresDAO) InsertIdentityLink(ctx context.Context, link IdentityLink) error {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	return executeTransaction(ctx, *db,
+		statement{query: DeleteExpiredIdentityLinksQuery},
+		statement{query: InsertIdentityLinkQuery, args: []interface{}{link.UserID, link.Issuer, link.Subject, link.TokenHash, link.ExpiresAt}},
+	)
+}
+
+// GetUserByIdentityLink returns the user an unexpired link would attach an identity to
+func (s *UserPostgresDAO) GetUserByIdentityLink(ctx context.Context, token_hash string) (*User, error) {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	var user User
+	err := db.GetContext(ctx, &user, GetUserByIdentityLinkQuery, token_hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// ConfirmIdentityLink attaches the identity of a link to its user and uses the link up. It returns
+// sql.ErrNoRows if the link does not exist or has expired, and ErrIdentityLinked if the identity
+// already belongs to someone.
+func (s *UserPostgresDAO) ConfirmIdentityLink(ctx context.Context, token_hash string) error {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	err := executeTransaction(ctx, *db,
+		statement{query: ConfirmIdentityLinkQuery, args: []interface{}{token_hash}, mustAffectRows: true},
+		statement{query: DeleteIdentityLinkQuery, args: []interface{}{token_hash}},
+	)
+	if isUniqueViolation(err) {
+		return ErrIdentityLinked
+	}
+
+	return err
+}
@@ -0,0 +1,167 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"context"
+	"database/sql"
+	"l24.dev/shortener"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInsertUser(t *testing.T) {
+	type testCase struct {
+		Name        string
+		InsertError error
+		ExpectedErr error
+	}
+
+	testCases := []testCase{
+		{Name: "Inserted", InsertError: nil, ExpectedErr: nil},
+		{Name: "Email Taken", InsertError: &pq.Error{Code: "23505"}, ExpectedErr: shortener.ErrUserExists},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			hash := "$2a$10$hash"
+			expectation := mock.ExpectQuery(regexp.QuoteMeta(shortener.InsertUserQuery)).WithArgs("luca@example.com", &hash)
+			if test.InsertError != nil {
+				expectation.WillReturnError(test.InsertError)
+			} else {
+				expectation.WillReturnRows(sqlmock.NewRows([]string{"id", "is_admin", "created_at"}).AddRow(5, false, time.Now()))
+			}
+
+			user := &shortener.User{Email: "luca@example.com", PasswordHash: &hash}
+			dao := shortener.NewUserPostgresDao(db, "postgres")
+			err = dao.InsertUser(context.Background(), user)
+
+			assert.Equal(t, test.ExpectedErr, err, "error should match")
+			if err == nil {
+				assert.Equal(t, int64(5), user.ID, "id should be filled in")
+			}
+			assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+		})
+	}
+}
+
+func TestInsertSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	expiresAt := time.Date(2021, 11, 16, 14, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(shortener.DeleteExpiredSessionsQuery)).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(regexp.QuoteMeta(shortener.InsertSessionQuery)).
+		WithArgs(5, "digest", expiresAt).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	dao := shortener.NewUserPostgresDao(db, "postgres")
+	err = dao.InsertSession(context.Background(), shortener.Session{UserID: 5, TokenHash: "digest", ExpiresAt: expiresAt})
+
+	assert.Nil(t, err, "insert should succeed")
+	assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+}
+
+func TestGetUserBySession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(shortener.GetUserBySessionQuery)).
+		WithArgs("digest").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password_hash", "is_admin", "created_at"}).
+			AddRow(5, "luca@example.com", "$2a$10$hash", false, time.Now()))
+
+	dao := shortener.NewUserPostgresDao(db, "postgres")
+	user, err := dao.GetUserBySession(context.Background(), "digest")
+
+	assert.Nil(t, err, "get should succeed")
+	assert.Equal(t, "luca@example.com", user.Email, "user should be loaded")
+	assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+}
+
+func TestLinkIdentity(t *testing.T) {
+	type testCase struct {
+		Name         string
+		RowsAffected int64
+		ExecError    error
+		ExpectedErr  error
+	}
+
+	testCases := []testCase{
+		{Name: "Linked", RowsAffected: 1},
+		{Name: "Has A Password Or Another Identity", RowsAffected: 0, ExpectedErr: sql.ErrNoRows},
+		{Name: "Identity Taken", ExecError: &pq.Error{Code: "23505"}, ExpectedErr: shortener.ErrIdentityLinked},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			exec := mock.ExpectExec(regexp.QuoteMeta(shortener.LinkIdentityQuery)).WithArgs(5, "https://idp.example.com", "subject")
+			if test.ExecError != nil {
+				exec.WillReturnError(test.ExecError)
+			} else {
+				exec.WillReturnResult(sqlmock.NewResult(1, test.RowsAffected))
+			}
+			if test.ExpectedErr != nil {
+				mock.ExpectRollback()
+			} else {
+				mock.ExpectCommit()
+			}
+
+			dao := shortener.NewUserPostgresDao(db, "postgres")
+			err = dao.LinkIdentity(context.Background(), 5, "https://idp.example.com", "subject")
+
+			assert.Equal(t, test.ExpectedErr, err)
+			assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+		})
+	}
+}
+
+func TestConfirmIdentityLink(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(shortener.ConfirmIdentityLinkQuery)).
+		WithArgs("digest").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(shortener.DeleteIdentityLinkQuery)).
+		WithArgs("digest").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	dao := shortener.NewUserPostgresDao(db, "postgres")
+	err = dao.ConfirmIdentityLink(context.Background(), "digest")
+
+	assert.Nil(t, err, "confirm should succeed")
+	assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+}
@@ -0,0 +1,131 @@
+package shortener
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type CredentialsRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type LoginResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	User      *User     `json:"user"`
+}
+
+func NewRegisterHandler(dao UserDAO) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request CredentialsRequest
+
+		err := DecodeJSONBody(w, r, &request)
+		if err != nil {
+			slog.InfoContext(r.Context(), "failed to decode json body", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		email, err := NormalizeEmail(request.Email)
+		if err != nil {
+			slog.InfoContext(r.Context(), "invalid email", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		hash, err := HashPassword(request.Password)
+		if err != nil {
+			slog.InfoContext(r.Context(), "invalid password", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		user := &User{Email: email, PasswordHash: &hash}
+
+		err = dao.InsertUser(r.Context(), user)
+		if err == ErrUserExists {
+			slog.InfoContext(r.Context(), "user already exists", "user", email)
+			http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to insert user", "user", email, "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(user)
+	}
+}
+
+func NewLoginHandler(dao UserDAO, opts ...HandlerOption) func(w http.ResponseWriter, r *http.Request) {
+	options := newHandlerOptions(opts)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request CredentialsRequest
+
+		err := DecodeJSONBody(w, r, &request)
+		if err != nil {
+			slog.InfoContext(r.Context(), "failed to decode json body", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		var user *User
+		if email, err := NormalizeEmail(request.Email); err == nil {
+			user, err = dao.GetUserByEmail(r.Context(), email)
+			if err != nil && err != sql.ErrNoRows {
+				slog.ErrorContext(r.Context(), "failed to look up user", "user", email, "error", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if !CheckPassword(user, request.Password) {
+			slog.WarnContext(r.Context(), "failed login", "user", request.Email)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		token, session, err := GenerateSession(user, options.sessionTTL, options.clock.Now())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to generate session", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		err = dao.InsertSession(r.Context(), *session)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to insert session", "user", user.Email, "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(LoginResponse{Token: token, ExpiresAt: session.ExpiresAt, User: user})
+	}
+}
+
+func NewLogoutHandler(dao UserDAO) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := BearerToken(r)
+		if !IsSessionToken(token) {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		err := dao.DeleteSession(r.Context(), HashToken(token))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to delete session", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,191 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"database/sql"
+	"l24.dev/shortener"
+	"l24.dev/test/mocks"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/golang/mock/gomock"
+)
+
+func TestRegisterHandler(t *testing.T) {
+	type testCase struct {
+		Name           string
+		Request        shortener.CredentialsRequest
+		InsertError    error
+		ExpectInsert   bool
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{
+			Name:           "Register",
+			Request:        shortener.CredentialsRequest{Email: "Luca@Example.com", Password: "correct horse battery staple"},
+			ExpectInsert:   true,
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "Already Registered",
+			Request:        shortener.CredentialsRequest{Email: "luca@example.com", Password: "correct horse battery staple"},
+			InsertError:    shortener.ErrUserExists,
+			ExpectInsert:   true,
+			ExpectedStatus: http.StatusConflict,
+		},
+		{
+			Name:           "Bad Email",
+			Request:        shortener.CredentialsRequest{Email: "luca", Password: "correct horse battery staple"},
+			ExpectedStatus: http.StatusBadRequest,
+		},
+		{
+			Name:           "Short Password",
+			Request:        shortener.CredentialsRequest{Email: "luca@example.com", Password: "hunter2"},
+			ExpectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			dao := mocks.NewMockUserDAO(mock)
+
+			times := 0
+			if test.ExpectInsert {
+				times = 1
+			}
+			dao.
+				EXPECT().
+				InsertUser(gomock.Any(), gomock.AssignableToTypeOf(&shortener.User{})).
+				DoAndReturn(func(_ interface{}, user *shortener.User) error {
+					user.ID = 5
+					return test.InsertError
+				}).
+				Times(times)
+
+			server := httptest.NewServer(http.HandlerFunc(shortener.NewRegisterHandler(dao)))
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			response := e.POST("/auth/register").WithJSON(&test.Request).WithHeader("Content-Type", "application/json").
+				Expect().
+				Status(test.ExpectedStatus)
+
+			if test.ExpectedStatus == http.StatusOK {
+				object := response.JSON().Object()
+				object.Keys().ContainsOnly("id", "email", "is_admin", "created_at")
+				object.Value("email").String().Equal("luca@example.com")
+			}
+		})
+	}
+}
+
+func TestLoginHandler(t *testing.T) {
+	hash, err := shortener.HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	user := &shortener.User{ID: 5, Email: "luca@example.com", PasswordHash: &hash}
+	now := time.Date(2021, 11, 15, 14, 0, 0, 0, time.UTC)
+
+	type testCase struct {
+		Name           string
+		Request        shortener.CredentialsRequest
+		StoredUser     *shortener.User
+		LookupError    error
+		ExpectSession  bool
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{
+			Name:           "Login",
+			Request:        shortener.CredentialsRequest{Email: "LUCA@example.com", Password: "correct horse battery staple"},
+			StoredUser:     user,
+			ExpectSession:  true,
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "Wrong Password",
+			Request:        shortener.CredentialsRequest{Email: "luca@example.com", Password: "Tr0ub4dor&3"},
+			StoredUser:     user,
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:           "Unknown User",
+			Request:        shortener.CredentialsRequest{Email: "nobody@example.com", Password: "correct horse battery staple"},
+			LookupError:    sql.ErrNoRows,
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			dao := mocks.NewMockUserDAO(mock)
+			dao.EXPECT().GetUserByEmail(gomock.Any(), gomock.Any()).Return(test.StoredUser, test.LookupError).Times(1)
+
+			times := 0
+			if test.ExpectSession {
+				times = 1
+			}
+			dao.EXPECT().InsertSession(gomock.Any(), gomock.AssignableToTypeOf(shortener.Session{})).Return(nil).Times(times)
+
+			login := shortener.NewLoginHandler(dao, shortener.WithClock(fakeClock{now: now}), shortener.WithSessionTTL(time.Hour))
+			server := httptest.NewServer(http.HandlerFunc(login))
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			response := e.POST("/auth/login").WithJSON(&test.Request).WithHeader("Content-Type", "application/json").
+				Expect().
+				Status(test.ExpectedStatus)
+
+			if test.ExpectedStatus == http.StatusOK {
+				object := response.JSON().Object()
+				object.Value("token").String().Match(`^l24s_[0-9a-f]{64}$`)
+				object.Value("expires_at").String().Equal("2021-11-15T15:00:00Z")
+				object.Value("user").Object().NotContainsKey("password_hash")
+			}
+		})
+	}
+}
+
+func TestLogoutHandler(t *testing.T) {
+	const token = "l24s_0000000000000000000000000000000000000000000000000000000000000000"
+
+	mock := gomock.NewController(t)
+	dao := mocks.NewMockUserDAO(mock)
+	dao.EXPECT().DeleteSession(gomock.Any(), shortener.HashToken(token)).Return(nil).Times(1)
+
+	server := httptest.NewServer(http.HandlerFunc(shortener.NewLogoutHandler(dao)))
+	defer server.Close()
+	e := httpexpect.New(t, server.URL)
+
+	e.POST("/auth/logout").WithHeader("Authorization", "Bearer "+token).Expect().Status(http.StatusNoContent)
+	e.POST("/auth/logout").Expect().Status(http.StatusBadRequest)
+}
+
+func TestCreateShortRecordsOwner(t *testing.T) {
+	mock := gomock.NewController(t)
+	dao := mocks.NewMockShortDAO(mock)
+	dao.
+		EXPECT().
+		InsertShort(gomock.Any(), gomock.Any(), gomock.Any(), gomock.AssignableToTypeOf(shortener.Short{})).
+		Return(nil).
+		Times(1)
+
+	principal := &shortener.Principal{User: &shortener.User{ID: 5}}
+	server := httptest.NewServer(withPrincipal(principal, shortener.NewCreateShortHandler(dao)))
+	defer server.Close()
+	e := httpexpect.New(t, server.URL)
+
+	e.POST("/short").WithJSON(&shortener.CreateShortRequest{URL: "lucastephens.com"}).WithHeader("Content-Type", "application/json").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().Value("owner_id").Number().Equal(5)
+}
@@ -0,0 +1,74 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"l24.dev/shortener"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	type testCase struct {
+		Name       string
+		Email      string
+		Expected   string
+		ShouldFail bool
+	}
+
+	testCases := []testCase{
+		{Name: "Plain", Email: "luca@example.com", Expected: "luca@example.com"},
+		{Name: "Mixed Case And Spaces", Email: "  Luca@Example.COM ", Expected: "luca@example.com"},
+		{Name: "Display Name", Email: "Luca <luca@example.com>", ShouldFail: true},
+		{Name: "Missing Domain", Email: "luca@", ShouldFail: true},
+		{Name: "Not An Email", Email: "luca", ShouldFail: true},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			email, err := shortener.NormalizeEmail(test.Email)
+			assert.Equal(t, test.ShouldFail, err != nil, "ShouldFail is %v, got %v", test.ShouldFail, err)
+			if err == nil {
+				assert.Equal(t, test.Expected, email, "email should be normalized")
+			}
+		})
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	_, err := shortener.HashPassword("short")
+	assert.NotNil(t, err, "short passwords should be rejected")
+
+	_, err = shortener.HashPassword(strings.Repeat("a", shortener.MaxPasswordLength+1))
+	assert.NotNil(t, err, "passwords bcrypt would truncate should be rejected")
+
+	hash, err := shortener.HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	assert.NotContains(t, hash, "correct horse", "hash should not contain the password")
+
+	user := &shortener.User{ID: 1, PasswordHash: &hash}
+	assert.True(t, shortener.CheckPassword(user, "correct horse battery staple"), "right password should match")
+	assert.False(t, shortener.CheckPassword(user, "Tr0ub4dor&3"), "wrong password should not match")
+	assert.False(t, shortener.CheckPassword(nil, "correct horse battery staple"), "unknown user should not match")
+	assert.False(t, shortener.CheckPassword(&shortener.User{ID: 2}, ""), "user without password should not match")
+}
+
+func TestGenerateSession(t *testing.T) {
+	now := time.Date(2021, 11, 15, 14, 0, 0, 0, time.UTC)
+
+	token, session, err := shortener.GenerateSession(&shortener.User{ID: 5}, time.Hour, now)
+	if err != nil {
+		t.Fatalf("failed to generate session: %v", err)
+	}
+
+	assert.True(t, shortener.IsSessionToken(token), "token should look like a session token")
+	assert.False(t, shortener.IsAPIKey(token), "token should not look like an api key")
+	assert.Equal(t, int64(5), session.UserID, "session should belong to the user")
+	assert.Equal(t, shortener.HashToken(token), session.TokenHash, "session should store the token hash")
+	assert.Equal(t, now.Add(time.Hour), session.ExpiresAt, "session should expire after its ttl")
+}
@@ -0,0 +1,378 @@
+package shortener
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+)
+
+// Reasons a destination URL can be rejected for, reported to clients so they can tell what to fix
+const (
+	ReasonInvalidURL     = "invalid_url"
+	ReasonTooLong        = "too_long"
+	ReasonScheme         = "scheme_not_allowed"
+	ReasonCredentials    = "embedded_credentials"
+	ReasonHostDenied     = "host_denied"
+	ReasonHostNotAllowed = "host_not_allowed"
+	ReasonHomograph      = "homograph"
+	ReasonInternalHost   = "internal_host"
+	ReasonPrivateAddress = "private_address"
+	ReasonBlocklisted    = "blocklisted"
+)
+
+// Reasons the rest of a request can be rejected for
+const (
+	ReasonInvalidBody         = "invalid_body"
+	ReasonInvalidAlias        = "invalid_alias"
+	ReasonInvalidDestinations = "invalid_destinations"
+	ReasonInvalidSchedule     = "invalid_schedule"
+	ReasonInvalidTemplate     = "invalid_template"
+	ReasonInvalidForwarding   = "invalid_forwarding"
+	ReasonInvalidPassword     = "invalid_password"
+)
+
+const DefaultMaxURLLength = 2048
+
+// URLError explains why a destination URL was rejected
+type URLError struct {
+	URL     string `json:"url"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+func (e *URLError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Reason, e.Message)
+}
+
+func newURLError(raw string, reason string, format string, args ...interface{}) *URLError {
+	return &URLError{URL: raw, Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
+// HostResolver looks up the addresses of a host, as net.Resolver does
+type HostResolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// URLPolicy decides which destinations shorts may redirect to
+type URLPolicy struct {
+	AllowedSchemes []string
+	MaxLength      int
+
+	// AllowPrivate permits loopback, private and link-local addresses, and internal hostnames
+	AllowPrivate bool
+
+	// DeniedHosts are never allowed. When AllowedHosts is set, only those hosts are allowed.
+	// Either matches the host itself and all of its subdomains.
+	DeniedHosts  []string
+	AllowedHosts []string
+
+	// Resolver, when set, is used to reject hostnames pointing at private addresses. Hosts that
+	// do not resolve are let through, as their owner may not have published them yet.
+	Resolver HostResolver
+
+	// Blocklist, when set, rejects known malicious destinations
+	Blocklist *Blocklist
+}
+
+// DefaultURLPolicy allows public http and https destinations of up to DefaultMaxURLLength bytes
+func DefaultURLPolicy() URLPolicy {
+	return URLPolicy{
+		AllowedSchemes: []string{"http", "https"},
+		MaxLength:      DefaultMaxURLLength,
+	}
+}
+
+// Check validates a destination URL, returning a *URLError if the policy rejects it
+func (p URLPolicy) Check(ctx context.Context, raw string) error {
+	if p.MaxLength > 0 && len(raw) > p.MaxLength {
+		return newURLError(raw, ReasonTooLong, "url is %d bytes long, must be at most %d", len(raw), p.MaxLength)
+	}
+
+	URL, err := url.Parse(raw)
+	if err != nil || URL.Host == "" {
+		return newURLError(raw, ReasonInvalidURL, "url cannot be parsed")
+	}
+
+	checks := []func(context.Context, *url.URL) error{
+		p.checkScheme,
+		p.checkCredentials,
+		p.checkHostLists,
+		p.checkHomograph,
+		p.checkAddress,
+		p.checkBlocklist,
+	}
+
+	for _, check := range checks {
+		if err := check(ctx, URL); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckShort validates every URL a short can redirect to
+func (p URLPolicy) CheckShort(ctx context.Context, short *Short) error {
+	urls := []string{short.RawURL()}
+	for _, destination := range short.Destinations {
+		urls = append(urls, destination.URL)
+	}
+	for _, rule := range short.Schedule {
+		urls = append(urls, rule.URL)
+	}
+
+	for _, raw := range urls {
+		if err := p.Check(ctx, raw); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p URLPolicy) checkScheme(_ context.Context, URL *url.URL) error {
+	for _, scheme := range p.AllowedSchemes {
+		if strings.EqualFold(URL.Scheme, scheme) {
+			return nil
+		}
+	}
+
+	return newURLError(URL.String(), ReasonScheme, "scheme %q is not allowed", URL.Scheme)
+}
+
+func (p URLPolicy) checkCredentials(_ context.Context, URL *url.URL) error {
+	if URL.User != nil {
+		return newURLError(URL.Redacted(), ReasonCredentials, "urls must not contain credentials")
+	}
+
+	return nil
+}
+
+func (p URLPolicy) checkHostLists(_ context.Context, URL *url.URL) error {
+	host := canonicalHost(URL)
+
+	if matchesHost(host, p.DeniedHosts) {
+		return newURLError(URL.String(), ReasonHostDenied, "host %s is not allowed", host)
+	}
+
+	if len(p.AllowedHosts) > 0 && !matchesHost(host, p.AllowedHosts) {
+		return newURLError(URL.String(), ReasonHostNotAllowed, "host %s is not on the allowlist", host)
+	}
+
+	return nil
+}
+
+// hostProfile converts hosts between their ASCII and Unicode forms. Unlike idna.Lookup it tolerates
+// underscores, which turn up in real hostnames.
+var hostProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.StrictDomainName(false))
+
+func (p URLPolicy) checkHomograph(_ context.Context, URL *url.URL) error {
+	host := canonicalHost(URL)
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+
+	unicodeHost, err := hostProfile.ToUnicode(host)
+	if err != nil {
+		return newURLError(URL.String(), ReasonInvalidURL, "host %s is not a valid domain name", host)
+	}
+
+	for _, label := range strings.Split(unicodeHost, ".") {
+		if isConfusable(label) {
+			return newURLError(URL.String(), ReasonHomograph, "host %s mimics another domain with lookalike characters", unicodeHost)
+		}
+	}
+
+	return nil
+}
+
+func (p URLPolicy) checkAddress(ctx context.Context, URL *url.URL) error {
+	if p.AllowPrivate {
+		return nil
+	}
+
+	host := canonicalHost(URL)
+
+	if ip := net.ParseIP(host); ip != nil {
+		if isPrivateIP(ip) {
+			return newURLError(URL.String(), ReasonPrivateAddress, "address %s is not public", ip)
+		}
+		return nil
+	}
+
+	if isInternalHostname(host) {
+		return newURLError(URL.String(), ReasonInternalHost, "host %s is not publicly reachable", host)
+	}
+
+	if p.Resolver == nil {
+		return nil
+	}
+
+	addresses, err := p.Resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+
+	for _, address := range addresses {
+		if isPrivateIP(address.IP) {
+			return newURLError(URL.String(), ReasonPrivateAddress, "host %s resolves to %s, which is not public", host, address.IP)
+		}
+	}
+
+	return nil
+}
+
+func (p URLPolicy) checkBlocklist(_ context.Context, URL *url.URL) error {
+	if p.Blocklist == nil {
+		return nil
+	}
+
+	if match, ok := p.Blocklist.Match(URL.String()); ok {
+		return newURLError(URL.String(), ReasonBlocklisted, "url is on a blocklist of malicious links (%s)", match)
+	}
+
+	return nil
+}
+
+// canonicalHost is the lowercase host of URL, without its port or a trailing dot
+func canonicalHost(URL *url.URL) string {
+	return strings.TrimSuffix(strings.ToLower(URL.Hostname()), ".")
+}
+
+// matchesHost reports whether host is one of patterns or a subdomain of one
+func matchesHost(host string, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(pattern)), "*"), ".")
+		if pattern == "" {
+			continue
+		}
+		if host == pattern || strings.HasSuffix(host, "."+pattern) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// carrierGradeNAT is shared address space (RFC 6598), private in all but name
+var carrierGradeNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || carrierGradeNAT.Contains(ip)
+}
+
+var internalSuffixes = []string{"localhost", "local", "internal", "intranet", "lan", "home.arpa"}
+
+// isInternalHostname reports whether host can only be reached from inside a network: single label
+// names, reserved suffixes, and numeric hosts that browsers read as addresses, like 2130706433
+func isInternalHostname(host string) bool {
+	if !strings.Contains(host, ".") || matchesHost(host, internalSuffixes) {
+		return true
+	}
+
+	labels := strings.Split(host, ".")
+	last := labels[len(labels)-1]
+	if strings.HasPrefix(last, "0x") {
+		return strings.Trim(last[2:], "0123456789abcdef") == ""
+	}
+	return last != "" && strings.Trim(last, "0123456789") == ""
+}
+
+// mixableScripts are the combinations of scripts routinely written together, following the
+// highly restrictive profile of Unicode TR39
+var mixableScripts = [][]*unicode.RangeTable{
+	{unicode.Latin, unicode.Han, unicode.Hiragana, unicode.Katakana},
+	{unicode.Latin, unicode.Han, unicode.Bopomofo},
+	{unicode.Latin, unicode.Han, unicode.Hangul},
+}
+
+// latinLookalikes are the Cyrillic and Greek letters indistinguishable from Latin ones
+const latinLookalikes = "асԁеһіјӏорԛѕԝхуαικνορυχ"
+
+// isConfusable reports whether a domain label mixes scripts in a way that suggests spoofing, like
+// Latin with Cyrillic, or is spelled entirely with letters that look like Latin ones, like "аррӏе"
+func isConfusable(label string) bool {
+	var scripts []*unicode.RangeTable
+	lookalikes := true
+	letters := 0
+
+	for _, r := range label {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+
+		if !strings.ContainsRune(latinLookalikes, r) {
+			lookalikes = false
+		}
+
+		script := scriptOf(r)
+		if !containsTable(scripts, script) {
+			scripts = append(scripts, script)
+		}
+	}
+
+	if len(scripts) == 1 {
+		return scripts[0] != unicode.Latin && lookalikes && letters > 0
+	}
+
+	for _, allowed := range mixableScripts {
+		mixable := true
+		for _, script := range scripts {
+			mixable = mixable && containsTable(allowed, script)
+		}
+		if mixable {
+			return false
+		}
+	}
+
+	return len(scripts) > 1
+}
+
+func scriptOf(r rune) *unicode.RangeTable {
+	for _, script := range unicode.Scripts {
+		if script != unicode.Common && script != unicode.Inherited && unicode.Is(script, r) {
+			return script
+		}
+	}
+	return unicode.Common
+}
+
+func containsTable(tables []*unicode.RangeTable, table *unicode.RangeTable) bool {
+	for _, t := range tables {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+// writeBadRequest rejects a request with 400 Bad Request, explaining why in a JSON body. The reason
+// given is reported unless err is a *URLError, which tells more precisely what is wrong with a URL.
+func writeBadRequest(w http.ResponseWriter, reason string, err error) {
+	body := struct {
+		Error   string `json:"error"`
+		URL     string `json:"url,omitempty"`
+		Reason  string `json:"reason"`
+		Message string `json:"message"`
+	}{Error: http.StatusText(http.StatusBadRequest), Reason: reason, Message: err.Error()}
+
+	var urlErr *URLError
+	if errors.As(err, &urlErr) {
+		body.URL, body.Reason, body.Message = urlErr.URL, urlErr.Reason, urlErr.Message
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(body)
+}
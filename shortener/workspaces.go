@@ -0,0 +1,227 @@
+package shortener
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// DefaultWorkspaceID is the workspace serving the unprefixed /{short} routes. It has no
+	// members: its shorts are managed by whoever owns or created them, see Principal.CanManage.
+	DefaultWorkspaceID   int64 = 1
+	DefaultWorkspaceSlug       = "default"
+
+	InvitationTokenPrefix = "l24i_"
+	DefaultInvitationTTL  = 7 * 24 * time.Hour
+)
+
+const workspaceContextKey contextKey = "workspace"
+
+// ErrWorkspaceExists is returned when creating a workspace whose slug is already taken
+var ErrWorkspaceExists = errors.New("workspace already exists")
+
+var workspaceSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,39}$`)
+
+// Role is what a member may do within a workspace
+type Role string
+
+const (
+	RoleOwner  Role = "owner"  // manages members and invitations, and everything an editor can
+	RoleEditor Role = "editor" // creates, updates and deletes shorts
+	RoleViewer Role = "viewer" // reads stats
+)
+
+var roleRanks = map[Role]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+// AtLeast reports whether the role grants everything min does. The empty role, held by
+// non-members, grants nothing.
+func (r Role) AtLeast(min Role) bool {
+	return roleRanks[r] > 0 && roleRanks[r] >= roleRanks[min]
+}
+
+// ValidateRole checks that role is one of the known roles
+func ValidateRole(role Role) error {
+	if _, ok := roleRanks[role]; !ok {
+		return fmt.Errorf("unknown role %q", role)
+	}
+	return nil
+}
+
+type Workspace struct {
+	ID        int64     `json:"id" db:"id"`
+	Slug      string    `json:"slug" db:"slug"`
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Membership is a user's role in a workspace
+type Membership struct {
+	WorkspaceID int64     `json:"workspace_id" db:"workspace_id"`
+	UserID      int64     `json:"user_id" db:"user_id"`
+	Email       string    `json:"email" db:"email"`
+	Role        Role      `json:"role" db:"role"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// Invitation offers a role in a workspace to whoever can log in with its email.
+// Only the hash of its token is stored.
+type Invitation struct {
+	ID          int64      `json:"id" db:"id"`
+	WorkspaceID int64      `json:"workspace_id" db:"workspace_id"`
+	Email       string     `json:"email" db:"email"`
+	Role        Role       `json:"role" db:"role"`
+	TokenHash   string     `json:"-" db:"token_hash"`
+	InvitedBy   *int64     `json:"invited_by,omitempty" db:"invited_by"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt   time.Time  `json:"expires_at" db:"expires_at"`
+	AcceptedAt  *time.Time `json:"accepted_at,omitempty" db:"accepted_at"`
+}
+
+// ValidateWorkspaceSlug checks that a slug can be served as the {workspace} path segment
+func ValidateWorkspaceSlug(slug string) error {
+	if !workspaceSlugPattern.MatchString(slug) {
+		return fmt.Errorf("workspace slug %q must be 2-40 lowercase letters, digits or '-', starting with a letter or digit", slug)
+	}
+
+	if slug == DefaultWorkspaceSlug {
+		return fmt.Errorf("workspace slug %q is reserved", slug)
+	}
+
+	return nil
+}
+
+// GenerateInvitation creates an invitation to workspace, returning the plaintext token to hand to the invitee
+func GenerateInvitation(workspace int64, email string, role Role, invitedBy *int64, ttl time.Duration, now time.Time) (string, *Invitation, error) {
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	token := InvitationTokenPrefix + secret
+
+	return token, &Invitation{
+		WorkspaceID: workspace,
+		Email:       email,
+		Role:        role,
+		TokenHash:   HashToken(token),
+		InvitedBy:   invitedBy,
+		ExpiresAt:   now.Add(ttl),
+	}, nil
+}
+
+// IsInvitationToken reports whether a token looks like an invitation token
+func IsInvitationToken(token string) bool {
+	return strings.HasPrefix(token, InvitationTokenPrefix)
+}
+
+type workspaceAccess struct {
+	workspace *Workspace
+	role      Role
+}
+
+// ContextWithWorkspace returns a copy of ctx addressing workspace, where the request's principal holds role
+func ContextWithWorkspace(ctx context.Context, workspace *Workspace, role Role) context.Context {
+	return context.WithValue(ctx, workspaceContextKey, &workspaceAccess{workspace: workspace, role: role})
+}
+
+// WorkspaceFromContext returns the workspace a request addresses, or nil for the default workspace
+func WorkspaceFromContext(ctx context.Context) *Workspace {
+	if access, ok := ctx.Value(workspaceContextKey).(*workspaceAccess); ok {
+		return access.workspace
+	}
+	return nil
+}
+
+// RoleFromContext returns the role the request's principal holds in the workspace it addresses
+func RoleFromContext(ctx context.Context) Role {
+	if access, ok := ctx.Value(workspaceContextKey).(*workspaceAccess); ok {
+		return access.role
+	}
+	return ""
+}
+
+// workspaceID returns the ID of the workspace a request addresses
+func workspaceID(ctx context.Context) int64 {
+	if workspace := WorkspaceFromContext(ctx); workspace != nil {
+		return workspace.ID
+	}
+	return DefaultWorkspaceID
+}
+
+// authorizeWorkspace reports whether the request may act in the workspace it addresses with at least role min.
+// Admins act everywhere. In the default workspace the scope checks of the Authenticator are all there is.
+func authorizeWorkspace(ctx context.Context, min Role) bool {
+	if workspaceID(ctx) == DefaultWorkspaceID {
+		return true
+	}
+
+	if principal := PrincipalFromContext(ctx); principal != nil && principal.HasScope(ScopeAdmin) {
+		return true
+	}
+
+	return RoleFromContext(ctx).AtLeast(min)
+}
+
+// authorizeShort reports whether the request may act on short with at least role min. Shorts in the
+// default workspace belong to whoever owns or created them, elsewhere the membership role decides.
+func authorizeShort(ctx context.Context, short *Short, min Role) bool {
+	if workspaceID(ctx) == DefaultWorkspaceID {
+		return PrincipalFromContext(ctx).CanManage(short)
+	}
+
+	return authorizeWorkspace(ctx, min)
+}
+
+// NewWorkspaceResolver returns middleware loading the workspace named by the {workspace} route
+// variable, along with the role the request's user holds in it. Unknown workspaces get 404 Not Found.
+// It must run after the Authenticator, so the user is known.
+func NewWorkspaceResolver(dao WorkspaceDAO) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			slug := mux.Vars(r)["workspace"]
+			if slug == "" {
+				slug = DefaultWorkspaceSlug
+			}
+
+			workspace, err := dao.GetWorkspaceBySlug(r.Context(), slug)
+			if err == sql.ErrNoRows {
+				slog.InfoContext(r.Context(), "workspace not found", "workspace", slug)
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				slog.ErrorContext(r.Context(), "failed to get workspace", "workspace", slug, "error", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			var role Role
+			if user := UserFromContext(r.Context()); user != nil && workspace.ID != DefaultWorkspaceID {
+				membership, err := dao.GetMembership(r.Context(), workspace.ID, user.ID)
+				if err != nil && err != sql.ErrNoRows {
+					slog.ErrorContext(r.Context(), "failed to look up membership", "user", user.Email, "workspace", slug, "error", err)
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					return
+				}
+				if membership != nil {
+					role = membership.Role
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(ContextWithWorkspace(r.Context(), workspace, role)))
+		})
+	}
+}
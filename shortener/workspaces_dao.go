@@ -0,0 +1,176 @@
+package shortener
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	InsertWorkspaceQuery        = "INSERT INTO workspaces (slug, name) VALUES ($1, $2)"
+	InsertWorkspaceOwnerQuery   = "INSERT INTO workspace_members (workspace_id, user_id, role) VALUES ((SELECT id FROM workspaces WHERE slug=$1), $2, 'owner')"
+	GetWorkspaceBySlugQuery     = "SELECT id, slug, name, created_at FROM workspaces WHERE slug=$1"
+	ListWorkspacesQuery         = "SELECT w.id, w.slug, w.name, w.created_at FROM workspaces w JOIN workspace_members m ON m.workspace_id = w.id WHERE m.user_id=$1 ORDER BY w.slug"
+	GetMembershipQuery          = "SELECT m.workspace_id, m.user_id, u.email, m.role, m.created_at FROM workspace_members m JOIN users u ON u.id = m.user_id WHERE m.workspace_id=$1 AND m.user_id=$2"
+	ListMembersQuery            = "SELECT m.workspace_id, m.user_id, u.email, m.role, m.created_at FROM workspace_members m JOIN users u ON u.id = m.user_id WHERE m.workspace_id=$1 ORDER BY u.email"
+	UpdateMemberRoleQuery       = "UPDATE workspace_members SET role=$3 WHERE workspace_id=$1 AND user_id=$2"
+	DeleteMemberQuery           = "DELETE FROM workspace_members WHERE workspace_id=$1 AND user_id=$2"
+	RevokeGroupMembersQuery     = "DELETE FROM workspace_members WHERE user_id=$1 AND granted_by_groups AND NOT (workspace_id = ANY($2))"
+	UpsertGroupMemberQuery      = "INSERT INTO workspace_members (workspace_id, user_id, role, granted_by_groups) VALUES ($1, $2, $3, TRUE) ON CONFLICT (workspace_id, user_id) DO UPDATE SET role = EXCLUDED.role WHERE workspace_members.granted_by_groups"
+	InsertInvitationQuery       = "INSERT INTO workspace_invitations (workspace_id, email, role, token_hash, invited_by, expires_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at"
+	AcceptInvitationMemberQuery = "INSERT INTO workspace_members (workspace_id, user_id, role) SELECT workspace_id, $2, role FROM workspace_invitations WHERE token_hash=$1 AND email=$3 AND accepted_at IS NULL AND expires_at > NOW() ON CONFLICT (workspace_id, user_id) DO UPDATE SET role = EXCLUDED.role"
+	MarkInvitationAcceptedQuery = "UPDATE workspace_invitations SET accepted_at = NOW() WHERE token_hash=$1"
+)
+
+// WorkspaceDAO stores workspaces, their members and invitations. Apart from creating workspaces and
+// listing a user's own, every method is scoped to a single workspace.
+type WorkspaceDAO interface {
+	InsertWorkspace(ctx context.Context, workspace *Workspace, owner int64) error
+	GetWorkspaceBySlug(ctx context.Context, slug string) (*Workspace, error)
+	ListWorkspaces(ctx context.Context, user int64) ([]Workspace, error)
+	GetMembership(ctx context.Context, workspace int64, user int64) (*Membership, error)
+	ListMembers(ctx context.Context, workspace int64) ([]Membership, error)
+	UpdateMemberRole(ctx context.Context, workspace int64, user int64, role Role) error
+	DeleteMember(ctx context.Context, workspace int64, user int64) error
+	SyncGroupMemberships(ctx context.Context, user int64, roles map[int64]Role) error
+	InsertInvitation(ctx context.Context, workspace int64, invitation *Invitation) error
+	AcceptInvitation(ctx context.Context, token_hash string, user *User) error
+}
+
+func NewWorkspacePostgresDao(db *sql.DB, driver string) *WorkspacePostgresDAO {
+	return &WorkspacePostgresDAO{db: db, driver: driver}
+}
+
+type WorkspacePostgresDAO struct {
+	db     *sql.DB
+	driver string
+}
+
+// InsertWorkspace stores workspace with owner as its first member, filling in its ID and creation time.
+// It returns ErrWorkspaceExists if the slug is already taken.
+func (s *WorkspacePostgresDAO) InsertWorkspace(ctx context.Context, workspace *Workspace, owner int64) error {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	err := executeTransaction(ctx, *db,
+		statement{query: InsertWorkspaceQuery, args: []interface{}{workspace.Slug, workspace.Name}},
+		statement{query: InsertWorkspaceOwnerQuery, args: []interface{}{workspace.Slug, owner}},
+	)
+	if isUniqueViolation(err) {
+		return ErrWorkspaceExists
+	}
+	if err != nil {
+		return err
+	}
+
+	return db.GetContext(ctx, workspace, GetWorkspaceBySlugQuery, workspace.Slug)
+}
+
+func (s *WorkspacePostgresDAO) GetWorkspaceBySlug(ctx context.Context, slug string) (*Workspace, error) {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	var workspace Workspace
+	err := db.GetContext(ctx, &workspace, GetWorkspaceBySlugQuery, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	return &workspace, nil
+}
+
+// ListWorkspaces returns the workspaces user is a member of
+func (s *WorkspacePostgresDAO) ListWorkspaces(ctx context.Context, user int64) ([]Workspace, error) {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	workspaces := []Workspace{}
+	err := db.SelectContext(ctx, &workspaces, ListWorkspacesQuery, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return workspaces, nil
+}
+
+func (s *WorkspacePostgresDAO) GetMembership(ctx context.Context, workspace int64, user int64) (*Membership, error) {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	var membership Membership
+	err := db.GetContext(ctx, &membership, GetMembershipQuery, workspace, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &membership, nil
+}
+
+func (s *WorkspacePostgresDAO) ListMembers(ctx context.Context, workspace int64) ([]Membership, error) {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	members := []Membership{}
+	err := db.SelectContext(ctx, &members, ListMembersQuery, workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// UpdateMemberRole changes the role of a member, returning sql.ErrNoRows if user is not a member
+func (s *WorkspacePostgresDAO) UpdateMemberRole(ctx context.Context, workspace int64, user int64, role Role) error {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	return executeTransaction(ctx, *db, statement{
+		query:          UpdateMemberRoleQuery,
+		args:           []interface{}{workspace, user, role},
+		mustAffectRows: true,
+	})
+}
+
+// DeleteMember removes user from workspace, returning sql.ErrNoRows if they are not a member
+func (s *WorkspacePostgresDAO) DeleteMember(ctx context.Context, workspace int64, user int64) error {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	return executeTransaction(ctx, *db, statement{query: DeleteMemberQuery, args: []interface{}{workspace, user}, mustAffectRows: true})
+}
+
+// SyncGroupMemberships makes the memberships user was granted by identity provider groups match roles,
+// a role per workspace ID. Memberships granted any other way, like by invitation, are left alone.
+func (s *WorkspacePostgresDAO) SyncGroupMemberships(ctx context.Context, user int64, roles map[int64]Role) error {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	workspaces := make([]int64, 0, len(roles))
+	for workspace := range roles {
+		workspaces = append(workspaces, workspace)
+	}
+	sort.Slice(workspaces, func(i, j int) bool { return workspaces[i] < workspaces[j] })
+
+	statements := []statement{{query: RevokeGroupMembersQuery, args: []interface{}{user, pq.Int64Array(workspaces)}}}
+	for _, workspace := range workspaces {
+		statements = append(statements, statement{query: UpsertGroupMemberQuery, args: []interface{}{workspace, user, roles[workspace]}})
+	}
+
+	return executeTransaction(ctx, *db, statements...)
+}
+
+// InsertInvitation stores an invitation to workspace, filling in its ID and creation time
+func (s *WorkspacePostgresDAO) InsertInvitation(ctx context.Context, workspace int64, invitation *Invitation) error {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	invitation.WorkspaceID = workspace
+	return db.QueryRowxContext(ctx, InsertInvitationQuery,
+		workspace, invitation.Email, invitation.Role, invitation.TokenHash, invitation.InvitedBy, invitation.ExpiresAt,
+	).Scan(&invitation.ID, &invitation.CreatedAt)
+}
+
+// AcceptInvitation makes user a member of the workspace they were invited to. It returns sql.ErrNoRows
+// unless the invitation exists, was addressed to the user's email and is neither used nor expired.
+func (s *WorkspacePostgresDAO) AcceptInvitation(ctx context.Context, token_hash string, user *User) error {
+	db := sqlx.NewDb(s.db, s.driver)
+
+	return executeTransaction(ctx, *db,
+		statement{query: AcceptInvitationMemberQuery, args: []interface{}{token_hash, user.ID, user.Email}, mustAffectRows: true},
+		statement{query: MarkInvitationAcceptedQuery, args: []interface{}{token_hash}},
+	)
+}
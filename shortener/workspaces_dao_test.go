@@ -0,0 +1,155 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"context"
+	"database/sql"
+	"l24.dev/shortener"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInsertWorkspace(t *testing.T) {
+	type testCase struct {
+		Name        string
+		InsertError error
+		ExpectedErr error
+	}
+
+	testCases := []testCase{
+		{Name: "Inserted", InsertError: nil, ExpectedErr: nil},
+		{Name: "Slug Taken", InsertError: &pq.Error{Code: "23505"}, ExpectedErr: shortener.ErrWorkspaceExists},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			if test.InsertError != nil {
+				mock.ExpectExec(regexp.QuoteMeta(shortener.InsertWorkspaceQuery)).
+					WithArgs("marketing", "Marketing").
+					WillReturnError(test.InsertError)
+				mock.ExpectRollback()
+			} else {
+				mock.ExpectExec(regexp.QuoteMeta(shortener.InsertWorkspaceQuery)).
+					WithArgs("marketing", "Marketing").
+					WillReturnResult(sqlmock.NewResult(7, 1))
+				mock.ExpectExec(regexp.QuoteMeta(shortener.InsertWorkspaceOwnerQuery)).
+					WithArgs("marketing", 5).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+				mock.ExpectQuery(regexp.QuoteMeta(shortener.GetWorkspaceBySlugQuery)).
+					WithArgs("marketing").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "slug", "name", "created_at"}).
+						AddRow(7, "marketing", "Marketing", time.Now()))
+			}
+
+			workspace := &shortener.Workspace{Slug: "marketing", Name: "Marketing"}
+			dao := shortener.NewWorkspacePostgresDao(db, "postgres")
+			err = dao.InsertWorkspace(context.Background(), workspace, 5)
+
+			assert.Equal(t, test.ExpectedErr, err, "error should match")
+			if err == nil {
+				assert.Equal(t, int64(7), workspace.ID, "id should be filled in")
+			}
+			assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+		})
+	}
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	type testCase struct {
+		Name         string
+		RowsAffected int64
+		ExpectedErr  error
+	}
+
+	testCases := []testCase{
+		{Name: "Accepted", RowsAffected: 1, ExpectedErr: nil},
+		{Name: "Used, Expired Or Someone Else's", RowsAffected: 0, ExpectedErr: sql.ErrNoRows},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta(shortener.AcceptInvitationMemberQuery)).
+				WithArgs("digest", 6, "bob@example.com").
+				WillReturnResult(sqlmock.NewResult(0, test.RowsAffected))
+			if test.ExpectedErr == nil {
+				mock.ExpectExec(regexp.QuoteMeta(shortener.MarkInvitationAcceptedQuery)).
+					WithArgs("digest").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			dao := shortener.NewWorkspacePostgresDao(db, "postgres")
+			err = dao.AcceptInvitation(context.Background(), "digest", &shortener.User{ID: 6, Email: "bob@example.com"})
+
+			assert.Equal(t, test.ExpectedErr, err, "error should match")
+			assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+		})
+	}
+}
+
+func TestSyncGroupMemberships(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(shortener.RevokeGroupMembersQuery)).
+		WithArgs(5, pq.Int64Array{3, 7}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(shortener.UpsertGroupMemberQuery)).
+		WithArgs(3, 5, shortener.RoleViewer).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(shortener.UpsertGroupMemberQuery)).
+		WithArgs(7, 5, shortener.RoleEditor).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	dao := shortener.NewWorkspacePostgresDao(db, "postgres")
+	err = dao.SyncGroupMemberships(context.Background(), 5, map[int64]shortener.Role{7: shortener.RoleEditor, 3: shortener.RoleViewer})
+
+	assert.Nil(t, err, "sync should succeed")
+	assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+}
+
+func TestShortQueriesAreScopedByWorkspace(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(shortener.GetShortQuery)).
+		WithArgs("launch", 7, shortener.DefaultDomainID).
+		WillReturnError(sql.ErrNoRows)
+
+	dao := shortener.NewShortPostgresDao(db, "postgres")
+	_, err = dao.GetShort(context.Background(), 7, shortener.DefaultDomainID, "launch")
+
+	assert.Equal(t, sql.ErrNoRows, err, "a short from another workspace should not be found")
+	assert.Nil(t, mock.ExpectationsWereMet(), "mock expectations should be met")
+}
@@ -0,0 +1,357 @@
+package shortener
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type CreateWorkspaceRequest struct {
+	Slug string `json:"slug"`
+	Name string `json:"name,omitempty"`
+}
+
+type UpdateMemberRequest struct {
+	Role Role `json:"role"`
+}
+
+type CreateInvitationRequest struct {
+	Email string `json:"email"`
+	Role  Role   `json:"role"`
+}
+
+// CreateInvitationResponse is the only place the plaintext invitation token is ever returned
+type CreateInvitationResponse struct {
+	Invitation
+	Token string `json:"token"`
+}
+
+type AcceptInvitationRequest struct {
+	Token string `json:"token"`
+}
+
+func NewCreateWorkspaceHandler(dao WorkspaceDAO) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := UserFromContext(r.Context())
+		if user == nil {
+			slog.WarnContext(r.Context(), "cannot own a workspace", "principal", PrincipalFromContext(r.Context()).Name())
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		var request CreateWorkspaceRequest
+
+		err := DecodeJSONBody(w, r, &request)
+		if err != nil {
+			slog.InfoContext(r.Context(), "failed to decode json body", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		err = ValidateWorkspaceSlug(request.Slug)
+		if err != nil {
+			slog.InfoContext(r.Context(), "invalid workspace", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		workspace := &Workspace{Slug: request.Slug, Name: strings.TrimSpace(request.Name)}
+		if workspace.Name == "" {
+			workspace.Name = workspace.Slug
+		}
+
+		err = dao.InsertWorkspace(r.Context(), workspace, user.ID)
+		if err == ErrWorkspaceExists {
+			slog.InfoContext(r.Context(), "workspace already exists", "workspace", workspace.Slug)
+			http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to insert workspace", "workspace", workspace.Slug, "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(workspace)
+	}
+}
+
+func NewListWorkspacesHandler(dao WorkspaceDAO) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := UserFromContext(r.Context())
+		if user == nil {
+			slog.WarnContext(r.Context(), "not a member of any workspace", "principal", PrincipalFromContext(r.Context()).Name())
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		workspaces, err := dao.ListWorkspaces(r.Context(), user.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to list workspaces", "user", user.Email, "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(workspaces)
+	}
+}
+
+func NewListMembersHandler(dao WorkspaceDAO) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		workspace, ok := authorizeMembers(w, r, RoleViewer)
+		if !ok {
+			return
+		}
+
+		members, err := dao.ListMembers(r.Context(), workspace.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to list members", "workspace", workspace.Slug, "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(members)
+	}
+}
+
+func NewUpdateMemberHandler(dao WorkspaceDAO) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		workspace, ok := authorizeMembers(w, r, RoleOwner)
+		if !ok {
+			return
+		}
+
+		user, ok := memberIDFromRequest(w, r)
+		if !ok {
+			return
+		}
+
+		var request UpdateMemberRequest
+
+		err := DecodeJSONBody(w, r, &request)
+		if err != nil {
+			slog.InfoContext(r.Context(), "failed to decode json body", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		err = ValidateRole(request.Role)
+		if err != nil {
+			slog.InfoContext(r.Context(), "invalid role", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		if request.Role != RoleOwner && !keepsAnOwner(w, r, dao, workspace, user) {
+			return
+		}
+
+		err = dao.UpdateMemberRole(r.Context(), workspace.ID, user, request.Role)
+		if err == sql.ErrNoRows {
+			slog.InfoContext(r.Context(), "user is not a member", "user", user, "workspace", workspace.Slug)
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to update member", "user", user, "workspace", workspace.Slug, "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func NewRemoveMemberHandler(dao WorkspaceDAO) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		workspace, ok := authorizeMembers(w, r, RoleOwner)
+		if !ok {
+			return
+		}
+
+		user, ok := memberIDFromRequest(w, r)
+		if !ok {
+			return
+		}
+
+		if !keepsAnOwner(w, r, dao, workspace, user) {
+			return
+		}
+
+		err := dao.DeleteMember(r.Context(), workspace.ID, user)
+		if err == sql.ErrNoRows {
+			slog.InfoContext(r.Context(), "user is not a member", "user", user, "workspace", workspace.Slug)
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to remove member", "user", user, "workspace", workspace.Slug, "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func NewCreateInvitationHandler(dao WorkspaceDAO, opts ...HandlerOption) func(w http.ResponseWriter, r *http.Request) {
+	options := newHandlerOptions(opts)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		workspace, ok := authorizeMembers(w, r, RoleOwner)
+		if !ok {
+			return
+		}
+
+		var request CreateInvitationRequest
+
+		err := DecodeJSONBody(w, r, &request)
+		if err != nil {
+			slog.InfoContext(r.Context(), "failed to decode json body", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		email, err := NormalizeEmail(request.Email)
+		if err != nil {
+			slog.InfoContext(r.Context(), "invalid email", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		err = ValidateRole(request.Role)
+		if err != nil {
+			slog.InfoContext(r.Context(), "invalid role", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		var invitedBy *int64
+		if user := UserFromContext(r.Context()); user != nil {
+			invitedBy = &user.ID
+		}
+
+		token, invitation, err := GenerateInvitation(workspace.ID, email, request.Role, invitedBy, DefaultInvitationTTL, options.clock.Now())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to generate invitation", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		err = dao.InsertInvitation(r.Context(), workspace.ID, invitation)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to insert invitation", "user", email, "workspace", workspace.Slug, "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(CreateInvitationResponse{Invitation: *invitation, Token: token})
+	}
+}
+
+func NewAcceptInvitationHandler(dao WorkspaceDAO) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := UserFromContext(r.Context())
+		if user == nil {
+			slog.WarnContext(r.Context(), "cannot join a workspace", "principal", PrincipalFromContext(r.Context()).Name())
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		var request AcceptInvitationRequest
+
+		err := DecodeJSONBody(w, r, &request)
+		if err != nil {
+			slog.InfoContext(r.Context(), "failed to decode json body", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		if !IsInvitationToken(request.Token) {
+			slog.InfoContext(r.Context(), "malformed invitation token")
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		err = dao.AcceptInvitation(r.Context(), HashToken(request.Token), user)
+		if err == sql.ErrNoRows {
+			slog.InfoContext(r.Context(), "no open invitation", "user", user.Email)
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to accept invitation", "user", user.Email, "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// authorizeMembers checks the request addresses a workspace with members, in which its principal holds
+// at least role min, writing an error response and returning false if not
+func authorizeMembers(w http.ResponseWriter, r *http.Request, min Role) (*Workspace, bool) {
+	workspace := WorkspaceFromContext(r.Context())
+	if workspace == nil || workspace.ID == DefaultWorkspaceID {
+		slog.InfoContext(r.Context(), "the default workspace has no members")
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return nil, false
+	}
+
+	if !authorizeWorkspace(r.Context(), min) {
+		slog.WarnContext(r.Context(), "principal lacks role", "principal", PrincipalFromContext(r.Context()).Name(), "role", min, "workspace", workspace.Slug)
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return nil, false
+	}
+
+	return workspace, true
+}
+
+func memberIDFromRequest(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	vars := mux.Vars(r)
+
+	id, err := strconv.ParseInt(vars["user"], 10, 64)
+	if err != nil {
+		slog.InfoContext(r.Context(), "invalid user id", "id", vars["user"], "error", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return 0, false
+	}
+
+	return id, true
+}
+
+// keepsAnOwner checks that demoting or removing user leaves the workspace with an owner,
+// writing a 409 Conflict and returning false if not
+func keepsAnOwner(w http.ResponseWriter, r *http.Request, dao WorkspaceDAO, workspace *Workspace, user int64) bool {
+	members, err := dao.ListMembers(r.Context(), workspace.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list members", "workspace", workspace.Slug, "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return false
+	}
+
+	owners := 0
+	for _, member := range members {
+		if member.Role == RoleOwner && member.UserID != user {
+			owners++
+		}
+	}
+
+	if owners == 0 {
+		slog.InfoContext(r.Context(), "workspace would be left without an owner", "workspace", workspace.Slug)
+		http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+		return false
+	}
+
+	return true
+}
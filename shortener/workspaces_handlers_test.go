@@ -0,0 +1,430 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"database/sql"
+	"l24.dev/shortener"
+	"l24.dev/test/mocks"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+)
+
+var marketing = &shortener.Workspace{ID: 7, Slug: "marketing", Name: "Marketing"}
+
+// inWorkspace serves handler under the /w/{workspace} prefix, authenticated as principal
+func inWorkspace(principal *shortener.Principal, workspaces shortener.WorkspaceDAO, pattern string, handler http.HandlerFunc) *httptest.Server {
+	router := mux.NewRouter()
+	router.Handle(pattern, withPrincipal(principal, shortener.NewWorkspaceResolver(workspaces)(handler).ServeHTTP))
+	return httptest.NewServer(router)
+}
+
+func expectMembership(workspaces *mocks.MockWorkspaceDAO, user int64, role shortener.Role) {
+	workspaces.EXPECT().GetWorkspaceBySlug(gomock.Any(), "marketing").Return(marketing, nil).Times(1)
+
+	if role == "" {
+		workspaces.EXPECT().GetMembership(gomock.Any(), marketing.ID, user).Return(nil, sql.ErrNoRows).Times(1)
+		return
+	}
+
+	workspaces.
+		EXPECT().
+		GetMembership(gomock.Any(), marketing.ID, user).
+		Return(&shortener.Membership{WorkspaceID: marketing.ID, UserID: user, Role: role}, nil).
+		Times(1)
+}
+
+func TestWorkspaceResolverUnknownWorkspace(t *testing.T) {
+	mock := gomock.NewController(t)
+	workspaces := mocks.NewMockWorkspaceDAO(mock)
+	workspaces.EXPECT().GetWorkspaceBySlug(gomock.Any(), "nope").Return(nil, sql.ErrNoRows).Times(1)
+
+	shorts := mocks.NewMockShortDAO(mock)
+	server := inWorkspace(nil, workspaces, "/w/{workspace}/{short}", shortener.NewGetShortHandler(shorts))
+	defer server.Close()
+	e := httpexpect.New(t, server.URL)
+
+	e.GET("/w/nope/c3xd4d").Expect().Status(http.StatusNotFound)
+}
+
+func TestGetShortInWorkspace(t *testing.T) {
+	mock := gomock.NewController(t)
+	workspaces := mocks.NewMockWorkspaceDAO(mock)
+	workspaces.EXPECT().GetWorkspaceBySlug(gomock.Any(), "marketing").Return(marketing, nil).Times(1)
+
+	shorts := mocks.NewMockShortDAO(mock)
+	shorts.
+		EXPECT().
+		GetShort(gomock.Any(), marketing.ID, shortener.DefaultDomainID, "launch").
+		Return(&shortener.Short{RedirectPath: "launch", Scheme: "https", Host: "example.com"}, nil).
+		Times(1)
+
+	server := inWorkspace(nil, workspaces, "/w/{workspace}/{short}", shortener.NewGetShortHandler(shorts))
+	defer server.Close()
+	e := httpexpect.New(t, server.URL)
+
+	e.GET("/w/marketing/launch").
+		WithRedirectPolicy(httpexpect.DontFollowRedirects).
+		Expect().
+		Status(http.StatusMovedPermanently).
+		Header("Location").Equal("https://example.com")
+}
+
+func TestGetSplitShortInWorkspace(t *testing.T) {
+	short := &shortener.Short{
+		RedirectPath: "launch",
+		Scheme:       "https",
+		Host:         "example.com",
+		Destinations: []shortener.Destination{
+			{ID: 7, URL: "https://a.example.com", Weight: 1},
+			{ID: 8, URL: "https://b.example.com", Weight: 1},
+		},
+	}
+	cookieName := shortener.VariantCookieName(marketing.ID, shortener.DefaultDomainID, "launch")
+
+	mock := gomock.NewController(t)
+	workspaces := mocks.NewMockWorkspaceDAO(mock)
+	workspaces.EXPECT().GetWorkspaceBySlug(gomock.Any(), "marketing").Return(marketing, nil).Times(2)
+
+	shorts := mocks.NewMockShortDAO(mock)
+	shorts.EXPECT().GetShort(gomock.Any(), marketing.ID, shortener.DefaultDomainID, "launch").Return(short, nil).Times(2)
+	shorts.EXPECT().IncrementDestinationClicks(gomock.Any(), marketing.ID, gomock.Any()).Return(nil).Times(1)
+	shorts.EXPECT().IncrementDestinationClicks(gomock.Any(), marketing.ID, int64(8)).Return(nil).Times(1)
+
+	server := inWorkspace(nil, workspaces, "/w/{workspace}/{short}", shortener.NewGetShortHandler(shorts))
+	defer server.Close()
+	e := httpexpect.New(t, server.URL)
+
+	// the cookie must be scoped to the workspace path, or the browser never sends it back
+	cookie := e.GET("/w/marketing/launch").
+		WithRedirectPolicy(httpexpect.DontFollowRedirects).
+		Expect().
+		Status(http.StatusFound).
+		Cookie(cookieName)
+	cookie.Value().NotEmpty()
+	cookie.Path().Equal("/w/marketing/launch")
+
+	e.GET("/w/marketing/launch").
+		WithCookie(cookieName, "8").
+		WithRedirectPolicy(httpexpect.DontFollowRedirects).
+		Expect().
+		Status(http.StatusFound).
+		Header("Location").Equal("https://b.example.com")
+}
+
+func TestCreateShortInWorkspace(t *testing.T) {
+	type testCase struct {
+		Name           string
+		Role           shortener.Role
+		Admin          bool
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{Name: "Owner", Role: shortener.RoleOwner, ExpectedStatus: http.StatusOK},
+		{Name: "Editor", Role: shortener.RoleEditor, ExpectedStatus: http.StatusOK},
+		{Name: "Viewer", Role: shortener.RoleViewer, ExpectedStatus: http.StatusForbidden},
+		{Name: "Not A Member", Role: "", ExpectedStatus: http.StatusForbidden},
+		{Name: "Admin", Role: "", Admin: true, ExpectedStatus: http.StatusOK},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			workspaces := mocks.NewMockWorkspaceDAO(mock)
+			expectMembership(workspaces, 5, test.Role)
+
+			times := 0
+			if test.ExpectedStatus == http.StatusOK {
+				times = 1
+			}
+			shorts := mocks.NewMockShortDAO(mock)
+			shorts.
+				EXPECT().
+				InsertShort(gomock.Any(), marketing.ID, shortener.DefaultDomainID, gomock.AssignableToTypeOf(shortener.Short{})).
+				Return(nil).
+				Times(times)
+
+			principal := &shortener.Principal{User: &shortener.User{ID: 5, IsAdmin: test.Admin}}
+			server := inWorkspace(principal, workspaces, "/w/{workspace}/short", shortener.NewCreateShortHandler(shorts))
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			e.POST("/w/marketing/short").WithJSON(&shortener.CreateShortRequest{URL: "lucastephens.com"}).WithHeader("Content-Type", "application/json").
+				Expect().
+				Status(test.ExpectedStatus)
+		})
+	}
+}
+
+func TestShortStatsInWorkspace(t *testing.T) {
+	type testCase struct {
+		Name           string
+		Role           shortener.Role
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{Name: "Viewer", Role: shortener.RoleViewer, ExpectedStatus: http.StatusOK},
+		{Name: "Not A Member", Role: "", ExpectedStatus: http.StatusForbidden},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			workspaces := mocks.NewMockWorkspaceDAO(mock)
+			expectMembership(workspaces, 5, test.Role)
+
+			// the short was created by someone else, membership alone grants access
+			owner := int64(9)
+			shorts := mocks.NewMockShortDAO(mock)
+			shorts.
+				EXPECT().
+				GetShort(gomock.Any(), marketing.ID, shortener.DefaultDomainID, "launch").
+				Return(&shortener.Short{RedirectPath: "launch", OwnerID: &owner}, nil).
+				Times(1)
+
+			principal := &shortener.Principal{User: &shortener.User{ID: 5}}
+			server := inWorkspace(principal, workspaces, "/w/{workspace}/short/{short}/stats", shortener.NewGetShortStatsHandler(shorts))
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			e.GET("/w/marketing/short/launch/stats").Expect().Status(test.ExpectedStatus)
+		})
+	}
+}
+
+func TestCreateWorkspaceHandler(t *testing.T) {
+	type testCase struct {
+		Name           string
+		Principal      *shortener.Principal
+		Request        shortener.CreateWorkspaceRequest
+		InsertError    error
+		ExpectInsert   bool
+		ExpectedStatus int
+	}
+
+	user := &shortener.Principal{User: &shortener.User{ID: 5}}
+
+	testCases := []testCase{
+		{
+			Name:           "Create",
+			Principal:      user,
+			Request:        shortener.CreateWorkspaceRequest{Slug: "marketing", Name: "Marketing"},
+			ExpectInsert:   true,
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "Slug Taken",
+			Principal:      user,
+			Request:        shortener.CreateWorkspaceRequest{Slug: "marketing"},
+			InsertError:    shortener.ErrWorkspaceExists,
+			ExpectInsert:   true,
+			ExpectedStatus: http.StatusConflict,
+		},
+		{
+			Name:           "Bad Slug",
+			Principal:      user,
+			Request:        shortener.CreateWorkspaceRequest{Slug: "Marketing Team"},
+			ExpectedStatus: http.StatusBadRequest,
+		},
+		{
+			Name:           "API Key",
+			Principal:      &shortener.Principal{APIKey: &shortener.APIKey{ID: 3}},
+			Request:        shortener.CreateWorkspaceRequest{Slug: "marketing"},
+			ExpectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			dao := mocks.NewMockWorkspaceDAO(mock)
+
+			times := 0
+			if test.ExpectInsert {
+				times = 1
+			}
+			dao.
+				EXPECT().
+				InsertWorkspace(gomock.Any(), gomock.AssignableToTypeOf(&shortener.Workspace{}), int64(5)).
+				Return(test.InsertError).
+				Times(times)
+
+			server := httptest.NewServer(withPrincipal(test.Principal, shortener.NewCreateWorkspaceHandler(dao)))
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			e.POST("/workspaces").WithJSON(&test.Request).WithHeader("Content-Type", "application/json").
+				Expect().
+				Status(test.ExpectedStatus)
+		})
+	}
+}
+
+func TestUpdateMemberHandler(t *testing.T) {
+	type testCase struct {
+		Name           string
+		Role           shortener.Role
+		Target         string
+		Request        shortener.UpdateMemberRequest
+		Members        []shortener.Membership
+		ExpectUpdate   bool
+		ExpectedStatus int
+	}
+
+	members := []shortener.Membership{
+		{WorkspaceID: 7, UserID: 5, Role: shortener.RoleOwner},
+		{WorkspaceID: 7, UserID: 6, Role: shortener.RoleViewer},
+	}
+
+	testCases := []testCase{
+		{
+			Name:           "Promote",
+			Role:           shortener.RoleOwner,
+			Target:         "6",
+			Request:        shortener.UpdateMemberRequest{Role: shortener.RoleEditor},
+			Members:        members,
+			ExpectUpdate:   true,
+			ExpectedStatus: http.StatusNoContent,
+		},
+		{
+			Name:           "Demote Last Owner",
+			Role:           shortener.RoleOwner,
+			Target:         "5",
+			Request:        shortener.UpdateMemberRequest{Role: shortener.RoleViewer},
+			Members:        members,
+			ExpectedStatus: http.StatusConflict,
+		},
+		{
+			Name:           "Unknown Role",
+			Role:           shortener.RoleOwner,
+			Target:         "6",
+			Request:        shortener.UpdateMemberRequest{Role: "superuser"},
+			ExpectedStatus: http.StatusBadRequest,
+		},
+		{
+			Name:           "Editor Cannot Manage Members",
+			Role:           shortener.RoleEditor,
+			Target:         "6",
+			Request:        shortener.UpdateMemberRequest{Role: shortener.RoleEditor},
+			ExpectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			dao := mocks.NewMockWorkspaceDAO(mock)
+			expectMembership(dao, 5, test.Role)
+
+			if test.Members != nil {
+				dao.EXPECT().ListMembers(gomock.Any(), marketing.ID).Return(test.Members, nil).Times(1)
+			}
+
+			times := 0
+			if test.ExpectUpdate {
+				times = 1
+			}
+			dao.EXPECT().UpdateMemberRole(gomock.Any(), marketing.ID, int64(6), test.Request.Role).Return(nil).Times(times)
+
+			principal := &shortener.Principal{User: &shortener.User{ID: 5}}
+			server := inWorkspace(principal, dao, "/w/{workspace}/members/{user}", shortener.NewUpdateMemberHandler(dao))
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			e.PUT("/w/marketing/members/"+test.Target).WithJSON(&test.Request).WithHeader("Content-Type", "application/json").
+				Expect().
+				Status(test.ExpectedStatus)
+		})
+	}
+}
+
+func TestMembersOfDefaultWorkspace(t *testing.T) {
+	mock := gomock.NewController(t)
+	dao := mocks.NewMockWorkspaceDAO(mock)
+	dao.
+		EXPECT().
+		GetWorkspaceBySlug(gomock.Any(), "default").
+		Return(&shortener.Workspace{ID: shortener.DefaultWorkspaceID, Slug: "default"}, nil).
+		Times(1)
+
+	principal := &shortener.Principal{User: &shortener.User{ID: 5}}
+	server := inWorkspace(principal, dao, "/w/{workspace}/members", shortener.NewListMembersHandler(dao))
+	defer server.Close()
+	e := httpexpect.New(t, server.URL)
+
+	e.GET("/w/default/members").Expect().Status(http.StatusNotFound)
+}
+
+func TestCreateInvitationHandler(t *testing.T) {
+	mock := gomock.NewController(t)
+	dao := mocks.NewMockWorkspaceDAO(mock)
+	expectMembership(dao, 5, shortener.RoleOwner)
+	dao.
+		EXPECT().
+		InsertInvitation(gomock.Any(), marketing.ID, gomock.AssignableToTypeOf(&shortener.Invitation{})).
+		Return(nil).
+		Times(1)
+
+	principal := &shortener.Principal{User: &shortener.User{ID: 5}}
+	server := inWorkspace(principal, dao, "/w/{workspace}/invitations", shortener.NewCreateInvitationHandler(dao))
+	defer server.Close()
+	e := httpexpect.New(t, server.URL)
+
+	object := e.POST("/w/marketing/invitations").
+		WithJSON(&shortener.CreateInvitationRequest{Email: "Bob@Example.com", Role: shortener.RoleEditor}).
+		WithHeader("Content-Type", "application/json").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object()
+
+	object.Value("token").String().Match(`^l24i_[0-9a-f]{64}$`)
+	object.Value("email").String().Equal("bob@example.com")
+	object.NotContainsKey("token_hash")
+}
+
+func TestAcceptInvitationHandler(t *testing.T) {
+	const token = "l24i_0000000000000000000000000000000000000000000000000000000000000000"
+
+	type testCase struct {
+		Name           string
+		Token          string
+		AcceptError    error
+		ExpectAccept   bool
+		ExpectedStatus int
+	}
+
+	testCases := []testCase{
+		{Name: "Accept", Token: token, ExpectAccept: true, ExpectedStatus: http.StatusNoContent},
+		{Name: "Used Or Expired", Token: token, AcceptError: sql.ErrNoRows, ExpectAccept: true, ExpectedStatus: http.StatusNotFound},
+		{Name: "Not An Invitation", Token: "l24s_abc", ExpectedStatus: http.StatusBadRequest},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			mock := gomock.NewController(t)
+			dao := mocks.NewMockWorkspaceDAO(mock)
+
+			times := 0
+			if test.ExpectAccept {
+				times = 1
+			}
+			user := &shortener.User{ID: 6, Email: "bob@example.com"}
+			dao.EXPECT().AcceptInvitation(gomock.Any(), shortener.HashToken(token), user).Return(test.AcceptError).Times(times)
+
+			server := httptest.NewServer(withPrincipal(&shortener.Principal{User: user}, shortener.NewAcceptInvitationHandler(dao)))
+			defer server.Close()
+			e := httpexpect.New(t, server.URL)
+
+			e.POST("/invitations/accept").WithJSON(&shortener.AcceptInvitationRequest{Token: test.Token}).WithHeader("Content-Type", "application/json").
+				Expect().
+				Status(test.ExpectedStatus)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+//go:build unit || all
+
+package shortener_test
+
+import (
+	"l24.dev/shortener"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleAtLeast(t *testing.T) {
+	type testCase struct {
+		Role     shortener.Role
+		Min      shortener.Role
+		Expected bool
+	}
+
+	testCases := []testCase{
+		{Role: shortener.RoleOwner, Min: shortener.RoleEditor, Expected: true},
+		{Role: shortener.RoleEditor, Min: shortener.RoleEditor, Expected: true},
+		{Role: shortener.RoleViewer, Min: shortener.RoleEditor, Expected: false},
+		{Role: shortener.RoleViewer, Min: shortener.RoleViewer, Expected: true},
+		{Role: shortener.RoleEditor, Min: shortener.RoleOwner, Expected: false},
+		{Role: "", Min: shortener.RoleViewer, Expected: false},
+		{Role: "superuser", Min: shortener.RoleViewer, Expected: false},
+	}
+
+	for _, test := range testCases {
+		t.Run(string(test.Role)+" at least "+string(test.Min), func(t *testing.T) {
+			assert.Equal(t, test.Expected, test.Role.AtLeast(test.Min))
+		})
+	}
+
+	assert.Nil(t, shortener.ValidateRole(shortener.RoleViewer), "viewer should be a valid role")
+	assert.NotNil(t, shortener.ValidateRole("superuser"), "unknown roles should be rejected")
+}
+
+func TestValidateWorkspaceSlug(t *testing.T) {
+	type testCase struct {
+		Slug       string
+		ShouldFail bool
+	}
+
+	testCases := []testCase{
+		{Slug: "marketing", ShouldFail: false},
+		{Slug: "team-42", ShouldFail: false},
+		{Slug: "m", ShouldFail: true},
+		{Slug: "Marketing", ShouldFail: true},
+		{Slug: "-marketing", ShouldFail: true},
+		{Slug: "growth/ops", ShouldFail: true},
+		{Slug: "default", ShouldFail: true},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Slug, func(t *testing.T) {
+			err := shortener.ValidateWorkspaceSlug(test.Slug)
+			assert.Equal(t, test.ShouldFail, err != nil, "ShouldFail is %v, got %v", test.ShouldFail, err)
+		})
+	}
+}
+
+func TestGenerateInvitation(t *testing.T) {
+	now := time.Date(2021, 11, 22, 10, 0, 0, 0, time.UTC)
+	inviter := int64(5)
+
+	token, invitation, err := shortener.GenerateInvitation(7, "bob@example.com", shortener.RoleEditor, &inviter, shortener.DefaultInvitationTTL, now)
+	if err != nil {
+		t.Fatalf("failed to generate invitation: %v", err)
+	}
+
+	assert.True(t, shortener.IsInvitationToken(token), "token should look like an invitation token")
+	assert.False(t, shortener.IsSessionToken(token), "token should not look like a session token")
+	assert.Equal(t, shortener.HashToken(token), invitation.TokenHash, "invitation should store the token hash")
+	assert.Equal(t, int64(7), invitation.WorkspaceID, "invitation should be to the workspace")
+	assert.Equal(t, now.Add(7*24*time.Hour), invitation.ExpiresAt, "invitation should expire after a week")
+}
+
+func TestValidateAliasReservesWorkspaceRoutes(t *testing.T) {
+	for _, alias := range []string{"w", "workspaces", "invitations"} {
+		assert.NotNil(t, shortener.ValidateAlias(alias), "%s should be reserved", alias)
+	}
+}
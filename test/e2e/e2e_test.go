@@ -10,6 +10,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"l24.dev/migrations"
 	"l24.dev/shortener"
 
 	"github.com/gorilla/mux"
@@ -28,7 +29,8 @@ func TestCreateAndGet(t *testing.T) {
 		log.Fatalf("failed to open database: %v", err)
 	}
 
-	err = goose.Up(db, "../../migrations")
+	goose.SetBaseFS(migrations.FS)
+	err = goose.Up(db, migrations.Dir)
 	if err != nil {
 		log.Fatalf("failed to run migrations: %v", err)
 	}
@@ -39,6 +41,7 @@ func TestCreateAndGet(t *testing.T) {
 
 	router := mux.NewRouter()
 	router.HandleFunc("/{short}", getShortHandler).Methods(http.MethodGet)
+	router.HandleFunc("/{short}/{rest:.+}", getShortHandler).Methods(http.MethodGet)
 	router.HandleFunc("/short", createShortHandler).Methods(http.MethodPost)
 
 	server := httptest.NewServer(router)
@@ -85,7 +88,7 @@ func TestCreateAndGet(t *testing.T) {
 				Expect().
 				Status(http.StatusOK).JSON().Object()
 
-			postResponse.Keys().ContainsOnly("redirect_path", "scheme", "host", "path", "query", "fragment")
+			postResponse.Keys().ContainsOnly("redirect_path", "scheme", "host", "path", "query", "fragment", "short_url")
 			redirect_path := postResponse.Value("redirect_path").NotNull().String()
 			postResponse.Value("scheme").NotNull().String().Equal(test.ExpectedScheme)
 			postResponse.Value("host").NotNull().String().Equal(test.ExpectedHost)
@@ -0,0 +1,94 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: shortener/apikeys_dao.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	shortener "l24.dev/shortener"
+)
+
+// MockAPIKeyDAO is a mock of APIKeyDAO interface.
+type MockAPIKeyDAO struct {
+	ctrl     *gomock.Controller
+	recorder *MockAPIKeyDAOMockRecorder
+}
+
+// MockAPIKeyDAOMockRecorder is the mock recorder for MockAPIKeyDAO.
+type MockAPIKeyDAOMockRecorder struct {
+	mock *MockAPIKeyDAO
+}
+
+// NewMockAPIKeyDAO creates a new mock instance.
+func NewMockAPIKeyDAO(ctrl *gomock.Controller) *MockAPIKeyDAO {
+	mock := &MockAPIKeyDAO{ctrl: ctrl}
+	mock.recorder = &MockAPIKeyDAOMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAPIKeyDAO) EXPECT() *MockAPIKeyDAOMockRecorder {
+	return m.recorder
+}
+
+// GetAPIKeyByHash mocks base method.
+func (m *MockAPIKeyDAO) GetAPIKeyByHash(ctx context.Context, hash string) (*shortener.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPIKeyByHash", ctx, hash)
+	ret0, _ := ret[0].(*shortener.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAPIKeyByHash indicates an expected call of GetAPIKeyByHash.
+func (mr *MockAPIKeyDAOMockRecorder) GetAPIKeyByHash(ctx, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPIKeyByHash", reflect.TypeOf((*MockAPIKeyDAO)(nil).GetAPIKeyByHash), ctx, hash)
+}
+
+// InsertAPIKey mocks base method.
+func (m *MockAPIKeyDAO) InsertAPIKey(ctx context.Context, key *shortener.APIKey) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertAPIKey", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertAPIKey indicates an expected call of InsertAPIKey.
+func (mr *MockAPIKeyDAOMockRecorder) InsertAPIKey(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertAPIKey", reflect.TypeOf((*MockAPIKeyDAO)(nil).InsertAPIKey), ctx, key)
+}
+
+// ListAPIKeys mocks base method.
+func (m *MockAPIKeyDAO) ListAPIKeys(ctx context.Context) ([]shortener.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAPIKeys", ctx)
+	ret0, _ := ret[0].([]shortener.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAPIKeys indicates an expected call of ListAPIKeys.
+func (mr *MockAPIKeyDAOMockRecorder) ListAPIKeys(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAPIKeys", reflect.TypeOf((*MockAPIKeyDAO)(nil).ListAPIKeys), ctx)
+}
+
+// RevokeAPIKey mocks base method.
+func (m *MockAPIKeyDAO) RevokeAPIKey(ctx context.Context, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAPIKey", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAPIKey indicates an expected call of RevokeAPIKey.
+func (mr *MockAPIKeyDAOMockRecorder) RevokeAPIKey(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAPIKey", reflect.TypeOf((*MockAPIKeyDAO)(nil).RevokeAPIKey), ctx, id)
+}
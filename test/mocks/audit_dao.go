@@ -0,0 +1,51 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: shortener/audit_dao.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	shortener "l24.dev/shortener"
+)
+
+// MockAuditDAO is a mock of AuditDAO interface.
+type MockAuditDAO struct {
+	ctrl     *gomock.Controller
+	recorder *MockAuditDAOMockRecorder
+}
+
+// MockAuditDAOMockRecorder is the mock recorder for MockAuditDAO.
+type MockAuditDAOMockRecorder struct {
+	mock *MockAuditDAO
+}
+
+// NewMockAuditDAO creates a new mock instance.
+func NewMockAuditDAO(ctrl *gomock.Controller) *MockAuditDAO {
+	mock := &MockAuditDAO{ctrl: ctrl}
+	mock.recorder = &MockAuditDAOMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAuditDAO) EXPECT() *MockAuditDAOMockRecorder {
+	return m.recorder
+}
+
+// ListAuditEvents mocks base method.
+func (m *MockAuditDAO) ListAuditEvents(ctx context.Context, filter shortener.AuditFilter) ([]shortener.AuditEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAuditEvents", ctx, filter)
+	ret0, _ := ret[0].([]shortener.AuditEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAuditEvents indicates an expected call of ListAuditEvents.
+func (mr *MockAuditDAOMockRecorder) ListAuditEvents(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAuditEvents", reflect.TypeOf((*MockAuditDAO)(nil).ListAuditEvents), ctx, filter)
+}
@@ -0,0 +1,65 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: shortener/blocklist_dao.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	shortener "l24.dev/shortener"
+)
+
+// MockBlocklistDAO is a mock of BlocklistDAO interface.
+type MockBlocklistDAO struct {
+	ctrl     *gomock.Controller
+	recorder *MockBlocklistDAOMockRecorder
+}
+
+// MockBlocklistDAOMockRecorder is the mock recorder for MockBlocklistDAO.
+type MockBlocklistDAOMockRecorder struct {
+	mock *MockBlocklistDAO
+}
+
+// NewMockBlocklistDAO creates a new mock instance.
+func NewMockBlocklistDAO(ctrl *gomock.Controller) *MockBlocklistDAO {
+	mock := &MockBlocklistDAO{ctrl: ctrl}
+	mock.recorder = &MockBlocklistDAOMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBlocklistDAO) EXPECT() *MockBlocklistDAOMockRecorder {
+	return m.recorder
+}
+
+// ListShortTargets mocks base method.
+func (m *MockBlocklistDAO) ListShortTargets(ctx context.Context) ([]shortener.ShortTarget, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListShortTargets", ctx)
+	ret0, _ := ret[0].([]shortener.ShortTarget)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListShortTargets indicates an expected call of ListShortTargets.
+func (mr *MockBlocklistDAOMockRecorder) ListShortTargets(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListShortTargets", reflect.TypeOf((*MockBlocklistDAO)(nil).ListShortTargets), ctx)
+}
+
+// SetBlocked mocks base method.
+func (m *MockBlocklistDAO) SetBlocked(ctx context.Context, changes []shortener.BlockedShort) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetBlocked", ctx, changes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetBlocked indicates an expected call of SetBlocked.
+func (mr *MockBlocklistDAOMockRecorder) SetBlocked(ctx, changes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetBlocked", reflect.TypeOf((*MockBlocklistDAO)(nil).SetBlocked), ctx, changes)
+}
@@ -6,10 +6,10 @@ package mocks
 
 import (
 	context "context"
-	shortener "l24.dev/shortener"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
+	shortener "l24.dev/shortener"
 )
 
 // MockShortDAO is a mock of ShortDAO interface.
@@ -35,31 +35,73 @@ func (m *MockShortDAO) EXPECT() *MockShortDAOMockRecorder {
 	return m.recorder
 }
 
+// DeleteShort mocks base method.
+func (m *MockShortDAO) DeleteShort(ctx context.Context, workspace, domain int64, redirect_path string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteShort", ctx, workspace, domain, redirect_path)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteShort indicates an expected call of DeleteShort.
+func (mr *MockShortDAOMockRecorder) DeleteShort(ctx, workspace, domain, redirect_path interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteShort", reflect.TypeOf((*MockShortDAO)(nil).DeleteShort), ctx, workspace, domain, redirect_path)
+}
+
 // GetShort mocks base method.
-func (m *MockShortDAO) GetShort(ctx context.Context, redirect_path string) (*shortener.Short, error) {
+func (m *MockShortDAO) GetShort(ctx context.Context, workspace, domain int64, redirect_path string) (*shortener.Short, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetShort", ctx, redirect_path)
+	ret := m.ctrl.Call(m, "GetShort", ctx, workspace, domain, redirect_path)
 	ret0, _ := ret[0].(*shortener.Short)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetShort indicates an expected call of GetShort.
-func (mr *MockShortDAOMockRecorder) GetShort(ctx, redirect_path interface{}) *gomock.Call {
+func (mr *MockShortDAOMockRecorder) GetShort(ctx, workspace, domain, redirect_path interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetShort", reflect.TypeOf((*MockShortDAO)(nil).GetShort), ctx, workspace, domain, redirect_path)
+}
+
+// IncrementDestinationClicks mocks base method.
+func (m *MockShortDAO) IncrementDestinationClicks(ctx context.Context, workspace, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementDestinationClicks", ctx, workspace, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// IncrementDestinationClicks indicates an expected call of IncrementDestinationClicks.
+func (mr *MockShortDAOMockRecorder) IncrementDestinationClicks(ctx, workspace, id interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetShort", reflect.TypeOf((*MockShortDAO)(nil).GetShort), ctx, redirect_path)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementDestinationClicks", reflect.TypeOf((*MockShortDAO)(nil).IncrementDestinationClicks), ctx, workspace, id)
 }
 
 // InsertShort mocks base method.
-func (m *MockShortDAO) InsertShort(ctx context.Context, short shortener.Short) error {
+func (m *MockShortDAO) InsertShort(ctx context.Context, workspace, domain int64, short shortener.Short) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "InsertShort", ctx, short)
+	ret := m.ctrl.Call(m, "InsertShort", ctx, workspace, domain, short)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // InsertShort indicates an expected call of InsertShort.
-func (mr *MockShortDAOMockRecorder) InsertShort(ctx, short interface{}) *gomock.Call {
+func (mr *MockShortDAOMockRecorder) InsertShort(ctx, workspace, domain, short interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertShort", reflect.TypeOf((*MockShortDAO)(nil).InsertShort), ctx, workspace, domain, short)
+}
+
+// UpdateShort mocks base method.
+func (m *MockShortDAO) UpdateShort(ctx context.Context, workspace, domain int64, short shortener.Short) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateShort", ctx, workspace, domain, short)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateShort indicates an expected call of UpdateShort.
+func (mr *MockShortDAOMockRecorder) UpdateShort(ctx, workspace, domain, short interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertShort", reflect.TypeOf((*MockShortDAO)(nil).InsertShort), ctx, short)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateShort", reflect.TypeOf((*MockShortDAO)(nil).UpdateShort), ctx, workspace, domain, short)
 }
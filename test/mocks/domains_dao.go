@@ -0,0 +1,94 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: shortener/domains_dao.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	shortener "l24.dev/shortener"
+)
+
+// MockDomainDAO is a mock of DomainDAO interface.
+type MockDomainDAO struct {
+	ctrl     *gomock.Controller
+	recorder *MockDomainDAOMockRecorder
+}
+
+// MockDomainDAOMockRecorder is the mock recorder for MockDomainDAO.
+type MockDomainDAOMockRecorder struct {
+	mock *MockDomainDAO
+}
+
+// NewMockDomainDAO creates a new mock instance.
+func NewMockDomainDAO(ctrl *gomock.Controller) *MockDomainDAO {
+	mock := &MockDomainDAO{ctrl: ctrl}
+	mock.recorder = &MockDomainDAOMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDomainDAO) EXPECT() *MockDomainDAOMockRecorder {
+	return m.recorder
+}
+
+// DeleteDomain mocks base method.
+func (m *MockDomainDAO) DeleteDomain(ctx context.Context, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteDomain", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteDomain indicates an expected call of DeleteDomain.
+func (mr *MockDomainDAOMockRecorder) DeleteDomain(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteDomain", reflect.TypeOf((*MockDomainDAO)(nil).DeleteDomain), ctx, id)
+}
+
+// GetDomainByHost mocks base method.
+func (m *MockDomainDAO) GetDomainByHost(ctx context.Context, host string) (*shortener.Domain, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDomainByHost", ctx, host)
+	ret0, _ := ret[0].(*shortener.Domain)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDomainByHost indicates an expected call of GetDomainByHost.
+func (mr *MockDomainDAOMockRecorder) GetDomainByHost(ctx, host interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDomainByHost", reflect.TypeOf((*MockDomainDAO)(nil).GetDomainByHost), ctx, host)
+}
+
+// InsertDomain mocks base method.
+func (m *MockDomainDAO) InsertDomain(ctx context.Context, domain *shortener.Domain) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertDomain", ctx, domain)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertDomain indicates an expected call of InsertDomain.
+func (mr *MockDomainDAOMockRecorder) InsertDomain(ctx, domain interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertDomain", reflect.TypeOf((*MockDomainDAO)(nil).InsertDomain), ctx, domain)
+}
+
+// ListDomains mocks base method.
+func (m *MockDomainDAO) ListDomains(ctx context.Context) ([]shortener.Domain, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListDomains", ctx)
+	ret0, _ := ret[0].([]shortener.Domain)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListDomains indicates an expected call of ListDomains.
+func (mr *MockDomainDAOMockRecorder) ListDomains(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListDomains", reflect.TypeOf((*MockDomainDAO)(nil).ListDomains), ctx)
+}
@@ -0,0 +1,79 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: shortener/reports_dao.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	shortener "l24.dev/shortener"
+)
+
+// MockReportDAO is a mock of ReportDAO interface.
+type MockReportDAO struct {
+	ctrl     *gomock.Controller
+	recorder *MockReportDAOMockRecorder
+}
+
+// MockReportDAOMockRecorder is the mock recorder for MockReportDAO.
+type MockReportDAOMockRecorder struct {
+	mock *MockReportDAO
+}
+
+// NewMockReportDAO creates a new mock instance.
+func NewMockReportDAO(ctrl *gomock.Controller) *MockReportDAO {
+	mock := &MockReportDAO{ctrl: ctrl}
+	mock.recorder = &MockReportDAOMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockReportDAO) EXPECT() *MockReportDAOMockRecorder {
+	return m.recorder
+}
+
+// InsertReport mocks base method.
+func (m *MockReportDAO) InsertReport(ctx context.Context, workspace, domain int64, redirect_path string, report *shortener.Report) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertReport", ctx, workspace, domain, redirect_path, report)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertReport indicates an expected call of InsertReport.
+func (mr *MockReportDAOMockRecorder) InsertReport(ctx, workspace, domain, redirect_path, report interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertReport", reflect.TypeOf((*MockReportDAO)(nil).InsertReport), ctx, workspace, domain, redirect_path, report)
+}
+
+// ListOpenReports mocks base method.
+func (m *MockReportDAO) ListOpenReports(ctx context.Context) ([]shortener.ReportedShort, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListOpenReports", ctx)
+	ret0, _ := ret[0].([]shortener.ReportedShort)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListOpenReports indicates an expected call of ListOpenReports.
+func (mr *MockReportDAOMockRecorder) ListOpenReports(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListOpenReports", reflect.TypeOf((*MockReportDAO)(nil).ListOpenReports), ctx)
+}
+
+// Moderate mocks base method.
+func (m *MockReportDAO) Moderate(ctx context.Context, short int64, action shortener.ModerationAction, moderator string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Moderate", ctx, short, action, moderator)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Moderate indicates an expected call of Moderate.
+func (mr *MockReportDAOMockRecorder) Moderate(ctx, short, action, moderator interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Moderate", reflect.TypeOf((*MockReportDAO)(nil).Moderate), ctx, short, action, moderator)
+}
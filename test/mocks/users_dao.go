@@ -0,0 +1,208 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: shortener/users_dao.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	shortener "l24.dev/shortener"
+)
+
+// MockUserDAO is a mock of UserDAO interface.
+type MockUserDAO struct {
+	ctrl     *gomock.Controller
+	recorder *MockUserDAOMockRecorder
+}
+
+// MockUserDAOMockRecorder is the mock recorder for MockUserDAO.
+type MockUserDAOMockRecorder struct {
+	mock *MockUserDAO
+}
+
+// NewMockUserDAO creates a new mock instance.
+func NewMockUserDAO(ctrl *gomock.Controller) *MockUserDAO {
+	mock := &MockUserDAO{ctrl: ctrl}
+	mock.recorder = &MockUserDAOMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUserDAO) EXPECT() *MockUserDAOMockRecorder {
+	return m.recorder
+}
+
+// ConfirmIdentityLink mocks base method.
+func (m *MockUserDAO) ConfirmIdentityLink(ctx context.Context, token_hash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfirmIdentityLink", ctx, token_hash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ConfirmIdentityLink indicates an expected call of ConfirmIdentityLink.
+func (mr *MockUserDAOMockRecorder) ConfirmIdentityLink(ctx, token_hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmIdentityLink", reflect.TypeOf((*MockUserDAO)(nil).ConfirmIdentityLink), ctx, token_hash)
+}
+
+// DeleteSession mocks base method.
+func (m *MockUserDAO) DeleteSession(ctx context.Context, token_hash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteSession", ctx, token_hash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteSession indicates an expected call of DeleteSession.
+func (mr *MockUserDAOMockRecorder) DeleteSession(ctx, token_hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSession", reflect.TypeOf((*MockUserDAO)(nil).DeleteSession), ctx, token_hash)
+}
+
+// GetUserByEmail mocks base method.
+func (m *MockUserDAO) GetUserByEmail(ctx context.Context, email string) (*shortener.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByEmail", ctx, email)
+	ret0, _ := ret[0].(*shortener.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByEmail indicates an expected call of GetUserByEmail.
+func (mr *MockUserDAOMockRecorder) GetUserByEmail(ctx, email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByEmail", reflect.TypeOf((*MockUserDAO)(nil).GetUserByEmail), ctx, email)
+}
+
+// GetUserByIdentity mocks base method.
+func (m *MockUserDAO) GetUserByIdentity(ctx context.Context, issuer, subject string) (*shortener.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByIdentity", ctx, issuer, subject)
+	ret0, _ := ret[0].(*shortener.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByIdentity indicates an expected call of GetUserByIdentity.
+func (mr *MockUserDAOMockRecorder) GetUserByIdentity(ctx, issuer, subject interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByIdentity", reflect.TypeOf((*MockUserDAO)(nil).GetUserByIdentity), ctx, issuer, subject)
+}
+
+// GetUserByIdentityLink mocks base method.
+func (m *MockUserDAO) GetUserByIdentityLink(ctx context.Context, token_hash string) (*shortener.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByIdentityLink", ctx, token_hash)
+	ret0, _ := ret[0].(*shortener.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByIdentityLink indicates an expected call of GetUserByIdentityLink.
+func (mr *MockUserDAOMockRecorder) GetUserByIdentityLink(ctx, token_hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByIdentityLink", reflect.TypeOf((*MockUserDAO)(nil).GetUserByIdentityLink), ctx, token_hash)
+}
+
+// GetUserBySession mocks base method.
+func (m *MockUserDAO) GetUserBySession(ctx context.Context, token_hash string) (*shortener.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserBySession", ctx, token_hash)
+	ret0, _ := ret[0].(*shortener.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserBySession indicates an expected call of GetUserBySession.
+func (mr *MockUserDAOMockRecorder) GetUserBySession(ctx, token_hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserBySession", reflect.TypeOf((*MockUserDAO)(nil).GetUserBySession), ctx, token_hash)
+}
+
+// InsertExternalUser mocks base method.
+func (m *MockUserDAO) InsertExternalUser(ctx context.Context, user *shortener.User, issuer, subject string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertExternalUser", ctx, user, issuer, subject)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertExternalUser indicates an expected call of InsertExternalUser.
+func (mr *MockUserDAOMockRecorder) InsertExternalUser(ctx, user, issuer, subject interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertExternalUser", reflect.TypeOf((*MockUserDAO)(nil).InsertExternalUser), ctx, user, issuer, subject)
+}
+
+// InsertIdentityLink mocks base method.
+func (m *MockUserDAO) InsertIdentityLink(ctx context.Context, link shortener.IdentityLink) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertIdentityLink", ctx, link)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertIdentityLink indicates an expected call of InsertIdentityLink.
+func (mr *MockUserDAOMockRecorder) InsertIdentityLink(ctx, link interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertIdentityLink", reflect.TypeOf((*MockUserDAO)(nil).InsertIdentityLink), ctx, link)
+}
+
+// InsertSession mocks base method.
+func (m *MockUserDAO) InsertSession(ctx context.Context, session shortener.Session) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertSession", ctx, session)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertSession indicates an expected call of InsertSession.
+func (mr *MockUserDAOMockRecorder) InsertSession(ctx, session interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertSession", reflect.TypeOf((*MockUserDAO)(nil).InsertSession), ctx, session)
+}
+
+// InsertUser mocks base method.
+func (m *MockUserDAO) InsertUser(ctx context.Context, user *shortener.User) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertUser", ctx, user)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertUser indicates an expected call of InsertUser.
+func (mr *MockUserDAOMockRecorder) InsertUser(ctx, user interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertUser", reflect.TypeOf((*MockUserDAO)(nil).InsertUser), ctx, user)
+}
+
+// LinkIdentity mocks base method.
+func (m *MockUserDAO) LinkIdentity(ctx context.Context, user int64, issuer, subject string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LinkIdentity", ctx, user, issuer, subject)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LinkIdentity indicates an expected call of LinkIdentity.
+func (mr *MockUserDAOMockRecorder) LinkIdentity(ctx, user, issuer, subject interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LinkIdentity", reflect.TypeOf((*MockUserDAO)(nil).LinkIdentity), ctx, user, issuer, subject)
+}
+
+// SetAdmin mocks base method.
+func (m *MockUserDAO) SetAdmin(ctx context.Context, user int64, admin bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetAdmin", ctx, user, admin)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetAdmin indicates an expected call of SetAdmin.
+func (mr *MockUserDAOMockRecorder) SetAdmin(ctx, user, admin interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAdmin", reflect.TypeOf((*MockUserDAO)(nil).SetAdmin), ctx, user, admin)
+}
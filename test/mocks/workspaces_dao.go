@@ -0,0 +1,180 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: shortener/workspaces_dao.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	shortener "l24.dev/shortener"
+)
+
+// MockWorkspaceDAO is a mock of WorkspaceDAO interface.
+type MockWorkspaceDAO struct {
+	ctrl     *gomock.Controller
+	recorder *MockWorkspaceDAOMockRecorder
+}
+
+// MockWorkspaceDAOMockRecorder is the mock recorder for MockWorkspaceDAO.
+type MockWorkspaceDAOMockRecorder struct {
+	mock *MockWorkspaceDAO
+}
+
+// NewMockWorkspaceDAO creates a new mock instance.
+func NewMockWorkspaceDAO(ctrl *gomock.Controller) *MockWorkspaceDAO {
+	mock := &MockWorkspaceDAO{ctrl: ctrl}
+	mock.recorder = &MockWorkspaceDAOMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWorkspaceDAO) EXPECT() *MockWorkspaceDAOMockRecorder {
+	return m.recorder
+}
+
+// AcceptInvitation mocks base method.
+func (m *MockWorkspaceDAO) AcceptInvitation(ctx context.Context, token_hash string, user *shortener.User) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AcceptInvitation", ctx, token_hash, user)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AcceptInvitation indicates an expected call of AcceptInvitation.
+func (mr *MockWorkspaceDAOMockRecorder) AcceptInvitation(ctx, token_hash, user interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcceptInvitation", reflect.TypeOf((*MockWorkspaceDAO)(nil).AcceptInvitation), ctx, token_hash, user)
+}
+
+// DeleteMember mocks base method.
+func (m *MockWorkspaceDAO) DeleteMember(ctx context.Context, workspace, user int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMember", ctx, workspace, user)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteMember indicates an expected call of DeleteMember.
+func (mr *MockWorkspaceDAOMockRecorder) DeleteMember(ctx, workspace, user interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMember", reflect.TypeOf((*MockWorkspaceDAO)(nil).DeleteMember), ctx, workspace, user)
+}
+
+// GetMembership mocks base method.
+func (m *MockWorkspaceDAO) GetMembership(ctx context.Context, workspace, user int64) (*shortener.Membership, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMembership", ctx, workspace, user)
+	ret0, _ := ret[0].(*shortener.Membership)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMembership indicates an expected call of GetMembership.
+func (mr *MockWorkspaceDAOMockRecorder) GetMembership(ctx, workspace, user interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMembership", reflect.TypeOf((*MockWorkspaceDAO)(nil).GetMembership), ctx, workspace, user)
+}
+
+// GetWorkspaceBySlug mocks base method.
+func (m *MockWorkspaceDAO) GetWorkspaceBySlug(ctx context.Context, slug string) (*shortener.Workspace, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWorkspaceBySlug", ctx, slug)
+	ret0, _ := ret[0].(*shortener.Workspace)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWorkspaceBySlug indicates an expected call of GetWorkspaceBySlug.
+func (mr *MockWorkspaceDAOMockRecorder) GetWorkspaceBySlug(ctx, slug interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWorkspaceBySlug", reflect.TypeOf((*MockWorkspaceDAO)(nil).GetWorkspaceBySlug), ctx, slug)
+}
+
+// InsertInvitation mocks base method.
+func (m *MockWorkspaceDAO) InsertInvitation(ctx context.Context, workspace int64, invitation *shortener.Invitation) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertInvitation", ctx, workspace, invitation)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertInvitation indicates an expected call of InsertInvitation.
+func (mr *MockWorkspaceDAOMockRecorder) InsertInvitation(ctx, workspace, invitation interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertInvitation", reflect.TypeOf((*MockWorkspaceDAO)(nil).InsertInvitation), ctx, workspace, invitation)
+}
+
+// InsertWorkspace mocks base method.
+func (m *MockWorkspaceDAO) InsertWorkspace(ctx context.Context, workspace *shortener.Workspace, owner int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertWorkspace", ctx, workspace, owner)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertWorkspace indicates an expected call of InsertWorkspace.
+func (mr *MockWorkspaceDAOMockRecorder) InsertWorkspace(ctx, workspace, owner interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertWorkspace", reflect.TypeOf((*MockWorkspaceDAO)(nil).InsertWorkspace), ctx, workspace, owner)
+}
+
+// ListMembers mocks base method.
+func (m *MockWorkspaceDAO) ListMembers(ctx context.Context, workspace int64) ([]shortener.Membership, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListMembers", ctx, workspace)
+	ret0, _ := ret[0].([]shortener.Membership)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListMembers indicates an expected call of ListMembers.
+func (mr *MockWorkspaceDAOMockRecorder) ListMembers(ctx, workspace interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMembers", reflect.TypeOf((*MockWorkspaceDAO)(nil).ListMembers), ctx, workspace)
+}
+
+// ListWorkspaces mocks base method.
+func (m *MockWorkspaceDAO) ListWorkspaces(ctx context.Context, user int64) ([]shortener.Workspace, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListWorkspaces", ctx, user)
+	ret0, _ := ret[0].([]shortener.Workspace)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListWorkspaces indicates an expected call of ListWorkspaces.
+func (mr *MockWorkspaceDAOMockRecorder) ListWorkspaces(ctx, user interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListWorkspaces", reflect.TypeOf((*MockWorkspaceDAO)(nil).ListWorkspaces), ctx, user)
+}
+
+// SyncGroupMemberships mocks base method.
+func (m *MockWorkspaceDAO) SyncGroupMemberships(ctx context.Context, user int64, roles map[int64]shortener.Role) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SyncGroupMemberships", ctx, user, roles)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SyncGroupMemberships indicates an expected call of SyncGroupMemberships.
+func (mr *MockWorkspaceDAOMockRecorder) SyncGroupMemberships(ctx, user, roles interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SyncGroupMemberships", reflect.TypeOf((*MockWorkspaceDAO)(nil).SyncGroupMemberships), ctx, user, roles)
+}
+
+// UpdateMemberRole mocks base method.
+func (m *MockWorkspaceDAO) UpdateMemberRole(ctx context.Context, workspace, user int64, role shortener.Role) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateMemberRole", ctx, workspace, user, role)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateMemberRole indicates an expected call of UpdateMemberRole.
+func (mr *MockWorkspaceDAOMockRecorder) UpdateMemberRole(ctx, workspace, user, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateMemberRole", reflect.TypeOf((*MockWorkspaceDAO)(nil).UpdateMemberRole), ctx, workspace, user, role)
+}